@@ -8,6 +8,7 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -17,7 +18,12 @@ import (
 	"gitlab.com/elixxir/client/cmix/rounds"
 	crypto "gitlab.com/elixxir/crypto/broadcast"
 	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/id/ephemeral"
+	"gitlab.com/xx_network/primitives/netTime"
 	"gitlab.com/xx_network/primitives/utils"
+	"io"
+	"os"
 	"regexp"
 	"time"
 )
@@ -29,17 +35,31 @@ const (
 	errWriteChannelFile   = "could not write file: %+v"
 	errWriteChannelStdout = "could not write to stdout: %+v"
 
-	// LoadChannel
-	errReadChannelFile  = "failed to read channel data from file: %+v"
-	errUnmarshalChannel = "failed to unmarshal channel: %+v"
+	// LoadChannelFile
+	errReadChannelFile = "failed to read channel data from file: %+v"
+
+	// UnmarshalChannelFile
+	errUnmarshalChannel  = "failed to unmarshal channel: %+v"
+	errUnmarshalHandover = "failed to unmarshal handover %d: %+v"
 
 	// WriteRsaPrivateKey
+	errEncryptRsaPrivKey   = "could not encrypt RSA private key: %+v"
 	errWriteRsaPrivKeyFile = "could not write file: %+v"
 
 	// ReadRsaPrivateKey
 	errReadRsaPrivKeyFile    = "failed to read RSA private key data from file: %+v"
+	errNoPassphrase          = "RSA private key is encrypted and no passphrase was supplied"
+	errGetPassphrase         = "failed to get passphrase: %+v"
+	errDecryptRsaPrivKey     = "could not decrypt RSA private key %q: %+v"
 	errLoadPrivateKeyFromPem = "could not load RSA private key from PEM: %+v"
 
+	// ReceptionCallback
+	errDecodeSized          = "failed to decode sized broadcast: %+v"
+	errUnmarshalMessage     = "failed to unmarshal message: %+v"
+	errAddFragment          = "failed to add fragment from %q: %+v"
+	errUnmarshalReassembled = "failed to unmarshal reassembled message from %q: %+v"
+	errNestedFragment       = "reassembled message from %q is a fragment"
+
 	// SymmetricBroadcastFn
 	errNewSymmetricMessage = "failed to create new symmetric message with payload and metadata: %+v"
 	errNewSymmetricSized   = "failed to make new symmetric sized broadcast message: %+v"
@@ -51,12 +71,24 @@ const (
 	errAsymmetricBroadcast  = "failed to broadcast asymmetric payload: %+v"
 )
 
+// channelFile is the contents of a channel file. It is the marshalled channel
+// followed by the chain of handovers of its RSA key, if there are any.
+type channelFile struct {
+	*crypto.Channel
+
+	// Handovers are the marshalled handovers in the order they were made.
+	Handovers [][]byte `json:",omitempty"`
+}
+
 // WriteChannel serialises and write the channel to the given file path. If no
-// path is supplied, it is printed to stdout.
-func WriteChannel(path string, s *crypto.Channel) error {
-	data, err := s.Marshal()
+// path is supplied, it is printed to stdout. If handovers are supplied, then
+// the chain of handovers of the channel's RSA key is included so that members
+// who load the file learn the current key.
+func WriteChannel(
+	path string, s *crypto.Channel, handovers ...KeyHandover) error {
+	data, err := MarshalChannelFile(s, handovers)
 	if err != nil {
-		return errors.Errorf(errMarshalChannel, err)
+		return err
 	}
 
 	if path != "" {
@@ -76,136 +108,349 @@ func WriteChannel(path string, s *crypto.Channel) error {
 	return nil
 }
 
-// LoadChannel loads the data from the given file path and deserializes it into
-// a channel.
+// LoadChannel loads the data from the given file path, or invite link, and
+// deserializes it into a channel. Any handovers in the file are verified but
+// not returned.
 func LoadChannel(path string) (*crypto.Channel, error) {
+	c, _, err := LoadChannelFile(path)
+	return c, err
+}
+
+// LoadChannelFile loads the data from the given file path and deserializes it
+// into a channel and the chain of handovers of its RSA key. If the path is an
+// invite link, then the channel is parsed from the invite instead.
+func LoadChannelFile(path string) (*crypto.Channel, []KeyHandover, error) {
+	if IsInvite(path) {
+		return ParseInvite(path)
+	}
+
 	data, err := utils.ReadFile(path)
 	if err != nil {
-		return nil, errors.Errorf(errReadChannelFile, err)
+		return nil, nil, errors.Errorf(errReadChannelFile, err)
 	}
 
-	c, err := crypto.UnmarshalChannel(data)
+	c, handovers, err := UnmarshalChannelFile(data)
 	if err != nil {
-		return nil, errors.Errorf(errUnmarshalChannel, err)
+		return nil, nil, err
 	}
 
 	jww.DEBUG.Printf(
 		"Loaded channel %q from file: %+v", c.Name, c)
 
-	return c, nil
+	return c, handovers, nil
 }
 
-// WriteRsaPrivateKey writes the RSA private key PEM to the given file path. If
-// not file path is supplied, the channel name is used instead.
-func WriteRsaPrivateKey(path, channelName string, pk *rsa.PrivateKey) error {
-	if path == "" {
-		match := regexp.MustCompile("\\s")
-		path = match.ReplaceAllString(channelName, "") + "-privateKey.pem"
+// MarshalChannelFile serialises the channel and the chain of handovers of its
+// RSA key into the contents of a channel file.
+func MarshalChannelFile(
+	c *crypto.Channel, handovers []KeyHandover) ([]byte, error) {
+	file := channelFile{Channel: c}
+	for _, h := range handovers {
+		file.Handovers = append(file.Handovers, h.Marshal())
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil, errors.Errorf(errMarshalChannel, err)
+	}
+
+	return data, nil
+}
+
+// UnmarshalChannelFile deserializes the contents of a channel file, or an
+// invite link, into a channel and the chain of handovers of its RSA key.
+// Returns an error if the chain does not start at the channel's key or is not
+// validly signed.
+func UnmarshalChannelFile(data []byte) (*crypto.Channel, []KeyHandover, error) {
+	if IsInvite(string(data)) {
+		return ParseInvite(string(data))
+	}
+
+	file := channelFile{Channel: &crypto.Channel{}}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, errors.Errorf(errUnmarshalChannel, err)
+	}
+
+	var handovers []KeyHandover
+	for i, payload := range file.Handovers {
+		h, err := UnmarshalKeyHandover(payload)
+		if err != nil {
+			return nil, nil, errors.Errorf(errUnmarshalHandover, i, err)
+		}
+		handovers = append(handovers, h)
 	}
 
-	pem := rsa.CreatePrivateKeyPem(pk)
+	if _, err := VerifyHandovers(file.Channel, handovers); err != nil {
+		return nil, nil, errors.Errorf(errUnmarshalChannel, err)
+	}
+
+	return file.Channel, handovers, nil
+}
+
+// WriteRsaPrivateKey writes the RSA private key PEM to the given file path. If
+// not file path is supplied, the channel name is used instead. If a passphrase
+// is supplied, then the key is encrypted with it using EncryptRsaPrivateKey.
+// The file is only readable by its owner.
+func WriteRsaPrivateKey(path, channelName string, pk *rsa.PrivateKey,
+	passphrase []byte, rng io.Reader) error {
+	path = RsaPrivateKeyPath(path, channelName)
+
+	data := rsa.CreatePrivateKeyPem(pk)
+	if len(passphrase) > 0 {
+		var err error
+		data, err = EncryptRsaPrivateKey(pk, passphrase, DefaultKeyParams, rng)
+		if err != nil {
+			return errors.Errorf(errEncryptRsaPrivKey, err)
+		}
+	}
 
-	err := utils.WriteFileDef(path, pem)
+	err := writeKeyFile(path, data)
 	if err != nil {
 		return errors.Errorf(errWriteRsaPrivKeyFile, err)
 	}
 
-	jww.INFO.Printf("Saved new channel RSA private key to file %q.", path)
+	jww.INFO.Printf("Saved channel RSA private key to file %q (encrypted: "+
+		"%t).", path, len(passphrase) > 0)
 
 	return nil
 }
 
 // ReadRsaPrivateKey reads the RSA private key PEM from the given file path. If
-// not file path is supplied, the channel name is used instead.
-func ReadRsaPrivateKey(path, channelName string) (*rsa.PrivateKey, error) {
+// not file path is supplied, the channel name is used instead. If the key is
+// encrypted, then it is decrypted with the passphrase returned by passphrase,
+// which is only called for encrypted keys.
+func ReadRsaPrivateKey(path, channelName string,
+	passphrase func() ([]byte, error)) (*rsa.PrivateKey, error) {
+	path = RsaPrivateKeyPath(path, channelName)
+
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf(errReadRsaPrivKeyFile, err)
+	}
+
+	var pk *rsa.PrivateKey
+	if IsEncryptedRsaPrivateKey(data) {
+		if passphrase == nil {
+			return nil, errors.New(errNoPassphrase)
+		}
+		p, err := passphrase()
+		if err != nil {
+			return nil, errors.Errorf(errGetPassphrase, err)
+		}
+		pk, err = DecryptRsaPrivateKey(data, p)
+		if err != nil {
+			return nil, errors.Errorf(errDecryptRsaPrivKey, path, err)
+		}
+	} else {
+		jww.WARN.Printf("Channel RSA private key file %q is not encrypted. "+
+			"Encrypt it with a passphrase using the key encrypt command.",
+			path)
+		pk, err = rsa.LoadPrivateKeyFromPem(data)
+		if err != nil {
+			return nil, errors.Errorf(errLoadPrivateKeyFromPem, err)
+		}
+	}
+
+	jww.INFO.Printf("Loaded channel RSA private key from file %q.", path)
+
+	return pk, nil
+}
+
+// RsaPrivateKeyPath returns the path to the RSA private key file. If no path is
+// supplied, then the default path derived from the channel name is returned.
+func RsaPrivateKeyPath(path, channelName string) string {
 	if path == "" {
 		match := regexp.MustCompile("\\s")
 		path = match.ReplaceAllString(channelName, "") + "-privateKey.pem"
 	}
 
-	data, err := utils.ReadFile(path)
+	return path
+}
+
+// writeKeyFile replaces the file at the path with the data by writing it to a
+// temporary file first, so that the existing key is not lost if writing fails.
+// The file is only readable by its owner.
+func writeKeyFile(path string, data []byte) error {
+	path, err := utils.ExpandPath(path)
 	if err != nil {
-		return nil, errors.Errorf(errReadRsaPrivKeyFile, err)
+		return err
 	}
 
-	pk, err := rsa.LoadPrivateKeyFromPem(data)
+	tmp := path + ".tmp"
+	err = utils.WriteFile(tmp, data, keyFilePerms, utils.DirPerms)
 	if err != nil {
-		return nil, errors.Errorf(errLoadPrivateKeyFromPem, err)
+		return err
 	}
 
-	jww.INFO.Printf("Loaded channel RSA private key to file %q.", path)
-
-	return pk, nil
+	return os.Rename(tmp, path)
 }
 
 // ReceivedBroadcast contains the broadcast message and its metadata.
 type ReceivedBroadcast struct {
-	Tag       Tag
-	Timestamp time.Time
-	Username  string
-	Message   []byte
-}
-
-// ReceptionCallback generates the listener callback function that the broadcast
-// channel delivers new payloads on. Also returns a channel that receives all
-// received broadcast messages for the UI to use to print messages.
-func ReceptionCallback() (broadcast.ListenerFunc, chan ReceivedBroadcast) {
-	cbChan := make(chan ReceivedBroadcast, 100)
-	cb := func(payload []byte, ephID receptionID.EphemeralIdentity,
+	Tag          Tag
+	Timestamp    time.Time
+	Username     string
+	Message      []byte
+	Extensions   Extensions `json:",omitempty"`
+	ReceivedTime time.Time
+	RoundID      id.Round
+	EphID        ephemeral.Id
+
+	// Asymmetric is true if the message was sent asymmetrically, which can
+	// only be done by the holder of the channel's RSA private key.
+	Asymmetric bool `json:",omitempty"`
+
+	// Verification is set when the message is checked against the identity
+	// keys in the Keyring.
+	Verification Verification `json:",omitempty"`
+
+	// Role is set to the role the channel admin granted the identity key the
+	// message is signed with when it is checked against the Roles.
+	Role Role `json:",omitempty"`
+
+	// Grant is set to the grant of the Role when it is set by the Roles. It
+	// is not stored with the message.
+	Grant *RoleGrant `json:"-"`
+}
+
+// MalformedMessage describes a received broadcast that could not be decoded.
+type MalformedMessage struct {
+	Err          error
+	ReceivedTime time.Time
+	RoundID      id.Round
+}
+
+// ReceptionCallback generates the listener callback functions that the
+// symmetric and asymmetric broadcast channels deliver new payloads on. Also
+// returns a channel that receives all received broadcast messages for the UI to
+// use to print messages. Messages split into fragments are only delivered once
+// every fragment is received. Payloads that cannot be decoded are dropped and
+// reported to the malformed callback, if one is provided. Once done is closed,
+// received messages are dropped instead of waiting for room in the channel.
+func ReceptionCallback(malformed func(MalformedMessage),
+	done <-chan struct{}) (
+	sym, asym broadcast.ListenerFunc, cbChan chan ReceivedBroadcast) {
+	cbChan = make(chan ReceivedBroadcast, 100)
+	sym = receptionListener(false, malformed, cbChan, done)
+	asym = receptionListener(true, malformed, cbChan, done)
+	return sym, asym, cbChan
+}
+
+// receptionListener generates the listener callback function for either the
+// symmetric or asymmetric broadcast channel. Each has its own reassembler so
+// that fragments sent symmetrically cannot be mixed into asymmetric messages.
+func receptionListener(asymmetric bool, malformed func(MalformedMessage),
+	cbChan chan ReceivedBroadcast,
+	done <-chan struct{}) broadcast.ListenerFunc {
+	ra := newReassembler(fragmentTimeout)
+	return func(payload []byte, ephID receptionID.EphemeralIdentity,
 		round rounds.Round) {
 		jww.INFO.Printf("Received broadcast message from %s (%d) on round %d: %q",
 			ephID.Source, ephID.EphId.Int64(), round.ID, payload)
 
+		drop := func(err error) {
+			jww.WARN.Printf("Dropped malformed message received on round "+
+				"%d: %+v", round.ID, err)
+			if malformed != nil {
+				malformed(MalformedMessage{
+					Err:          err,
+					ReceivedTime: netTime.Now(),
+					RoundID:      round.ID,
+				})
+			}
+		}
+
 		decodedPayload, err := broadcast.DecodeSizedBroadcast(payload)
 		if err != nil {
-			jww.ERROR.Printf("Failed to decode sized broadcast: %+v", err)
+			drop(errors.Errorf(errDecodeSized, err))
+			return
 		}
 
-		tag, timestamp, username, payload := UnmarshalMessage(decodedPayload)
+		m, err := UnmarshalMessage(decodedPayload)
+		if err != nil {
+			drop(errors.Errorf(errUnmarshalMessage, err))
+			return
+		}
+
+		// Wait for the rest of the message if this is one of its fragments
+		if m.Tag == Fragment {
+			data, complete, err :=
+				ra.add(m.Username, m.Timestamp, m.Payload, netTime.Now())
+			if err != nil {
+				drop(errors.Errorf(errAddFragment, m.Username, err))
+				return
+			} else if !complete {
+				return
+			}
+
+			username := m.Username
+			m, err = UnmarshalMessage(data)
+			if err != nil {
+				drop(errors.Errorf(errUnmarshalReassembled, username, err))
+				return
+			} else if m.Tag == Fragment {
+				drop(errors.Errorf(errNestedFragment, username))
+				return
+			}
+		}
 
-		cbChan <- ReceivedBroadcast{
-			Tag:       tag,
-			Timestamp: timestamp,
-			Username:  username,
-			Message:   payload,
+		r := ReceivedBroadcast{
+			Tag:          m.Tag,
+			Timestamp:    m.Timestamp,
+			Username:     m.Username,
+			Message:      m.Payload,
+			Extensions:   m.Extensions,
+			ReceivedTime: netTime.Now(),
+			RoundID:      round.ID,
+			EphID:        ephID.EphId,
+			Asymmetric:   asymmetric,
+		}
+		select {
+		case cbChan <- r:
+		case <-done:
 		}
 	}
-	return cb, cbChan
 }
 
 // BroadcastFn allows the UI to pass the message and its metadata to the
-// broadcast client.
-type BroadcastFn func(tag Tag, timestamp time.Time, message []byte) error
+// broadcast client. Any extensions are included in the message.
+type BroadcastFn func(tag Tag, timestamp time.Time, message []byte,
+	extensions ...Extension) error
 
 // SymmetricBroadcastFn returns the BroadcastFn used to broadcast symmetric
-// broadcast messages.
+// broadcast messages. Messages too large for a single broadcast are split into
+// fragments.
 func SymmetricBroadcastFn(c broadcast.Channel, username string) (BroadcastFn, int) {
 	// Get the maximum payload size; dependent on symmetric or asymmetric
 	maxSymmetric := c.MaxPayloadSize()
 	maxSized := broadcast.MaxSizedBroadcastPayloadSize(maxSymmetric)
-	maxPayloadSize := MaxMessagePayloadSize(maxSized, username)
+	maxPayloadSize := MaxFragmentedPayloadSize(maxSized, username)
 
-	broadcastFn := func(tag Tag, timestamp time.Time, message []byte) error {
-		message, err := NewMessage(maxSized, tag, timestamp, username, message)
+	broadcastFn := func(tag Tag, timestamp time.Time, message []byte,
+		extensions ...Extension) error {
+		messages, err := encodeMessage(
+			maxSized, tag, timestamp, username, message, extensions...)
 		if err != nil {
 			return errors.Errorf(errNewSymmetricMessage, err)
 		}
 
-		payload, err := broadcast.NewSizedBroadcast(maxSymmetric, message)
-		if err != nil {
-			return errors.Errorf(errNewSymmetricSized, err)
-		}
+		for i, message := range messages {
+			payload, err := broadcast.NewSizedBroadcast(maxSymmetric, message)
+			if err != nil {
+				return errors.Errorf(errNewSymmetricSized, err)
+			}
 
-		cMixParams := cmix.GetDefaultCMIXParams()
+			cMixParams := cmix.GetDefaultCMIXParams()
 
-		round, ephID, err := c.Broadcast(payload, cMixParams)
-		if err != nil {
-			return errors.Errorf(errSymmetricBroadcast, err)
-		}
+			round, ephID, err := c.Broadcast(payload, cMixParams)
+			if err != nil {
+				return errors.Errorf(errSymmetricBroadcast, err)
+			}
 
-		jww.INFO.Printf(
-			"Broadcasted symmetric payload on round %s to ephemeral ID %d",
-			round.String(), ephID.Int64())
+			jww.INFO.Printf("Broadcasted symmetric payload %d/%d on round %s "+
+				"to ephemeral ID %d",
+				i+1, len(messages), round.String(), ephID.Int64())
+		}
 
 		return nil
 	}
@@ -214,38 +459,69 @@ func SymmetricBroadcastFn(c broadcast.Channel, username string) (BroadcastFn, in
 }
 
 // AsymmetricBroadcastFn returns the BroadcastFn used to broadcast asymmetric
-// broadcast messages.
+// broadcast messages. Messages too large for a single broadcast are split into
+// fragments.
 func AsymmetricBroadcastFn(
 	c broadcast.Channel, username string, pk *rsa.PrivateKey) (BroadcastFn, int) {
 	// Get the maximum payload size; dependent on symmetric or asymmetric
 	maxAsymmetric := c.MaxPayloadSize()
 	maxSized := broadcast.MaxSizedBroadcastPayloadSize(maxAsymmetric)
-	maxPayloadSize := MaxMessagePayloadSize(maxSized, username)
+	maxPayloadSize := MaxFragmentedPayloadSize(maxSized, username)
 
-	broadcastFn := func(tag Tag, timestamp time.Time, message []byte) error {
-		message, err := NewMessage(maxSized, tag, timestamp, username, message)
+	broadcastFn := func(tag Tag, timestamp time.Time, message []byte,
+		extensions ...Extension) error {
+		messages, err := encodeMessage(
+			maxSized, tag, timestamp, username, message, extensions...)
 		if err != nil {
 			return errors.Errorf(errNewAsymmetricMessage, err)
 		}
 
-		payload, err := broadcast.NewSizedBroadcast(maxAsymmetric, message)
-		if err != nil {
-			return errors.Errorf(errNewAsymmetricSized, err)
-		}
+		for i, message := range messages {
+			payload, err := broadcast.NewSizedBroadcast(maxAsymmetric, message)
+			if err != nil {
+				return errors.Errorf(errNewAsymmetricSized, err)
+			}
 
-		cMixParams := cmix.GetDefaultCMIXParams()
+			cMixParams := cmix.GetDefaultCMIXParams()
 
-		round, ephID, err := c.BroadcastAsymmetric(pk, payload, cMixParams)
-		if err != nil {
-			return errors.Errorf(errAsymmetricBroadcast, err)
-		}
+			round, ephID, err := c.BroadcastAsymmetric(pk, payload, cMixParams)
+			if err != nil {
+				return errors.Errorf(errAsymmetricBroadcast, err)
+			}
 
-		jww.INFO.Printf(
-			"Broadcasted asymmetric payload on round %s to ephemeral ID %d",
-			round.String(), ephID.Int64())
+			jww.INFO.Printf("Broadcasted asymmetric payload %d/%d on round %s "+
+				"to ephemeral ID %d",
+				i+1, len(messages), round.String(), ephID.Int64())
+		}
 
 		return nil
 	}
 
 	return broadcastFn, maxPayloadSize
 }
+
+// AssignMessageID wraps the BroadcastFn so that every message sent is assigned
+// a new random MessageID that other messages can refer to. Messages that
+// already have a MessageIDExt extension keep their ID and ephemeral messages,
+// which cannot be referred to, are not assigned one. Returns nil if the
+// BroadcastFn is nil.
+func AssignMessageID(fn BroadcastFn) BroadcastFn {
+	if fn == nil {
+		return nil
+	}
+
+	return func(tag Tag, timestamp time.Time, message []byte,
+		extensions ...Extension) error {
+		_, exists := Extensions(extensions).Get(MessageIDExt)
+		if !exists && !tag.IsEphemeral() {
+			mid, err := NewMessageID()
+			if err != nil {
+				return err
+			}
+			extensions = append(
+				[]Extension{NewMessageIDExtension(mid)}, extensions...)
+		}
+
+		return fn(tag, timestamp, message, extensions...)
+	}
+}
@@ -0,0 +1,81 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/xx_network/primitives/netTime"
+	"testing"
+	"time"
+)
+
+// Tests that AssignMessageID adds a unique MessageIDExt extension to every
+// message and keeps the other extensions.
+func TestAssignMessageID(t *testing.T) {
+	var sent []Extensions
+	fn := AssignMessageID(func(_ Tag, _ time.Time, _ []byte,
+		extensions ...Extension) error {
+		sent = append(sent, extensions)
+		return nil
+	})
+
+	parent, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("Failed to generate message ID: %+v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = fn(Default, netTime.Now(), []byte("Hello"),
+			NewReplyToExtension(parent))
+		if err != nil {
+			t.Fatalf("Failed to send message %d: %+v", i, err)
+		}
+	}
+
+	ids := make(map[MessageID]bool)
+	for i, extensions := range sent {
+		mid, exists := extensions.MessageID()
+		if !exists {
+			t.Errorf("Message %d was not assigned an ID: %+v", i, extensions)
+		} else if ids[mid] {
+			t.Errorf("Message %d was assigned duplicate ID %s.", i, mid)
+		}
+		ids[mid] = true
+
+		if replyTo, _ := extensions.ReplyTo(); replyTo != parent {
+			t.Errorf("Message %d has incorrect reply ID."+
+				"\nexpected: %s\nreceived: %s", i, parent, replyTo)
+		}
+	}
+}
+
+// Tests that AssignMessageID does not replace an existing message ID.
+func TestAssignMessageID_Existing(t *testing.T) {
+	mid, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("Failed to generate message ID: %+v", err)
+	}
+
+	var received MessageID
+	fn := AssignMessageID(func(_ Tag, _ time.Time, _ []byte,
+		extensions ...Extension) error {
+		if len(extensions) != 1 {
+			t.Errorf("Expected 1 extension. Got %d.", len(extensions))
+		}
+		received, _ = Extensions(extensions).MessageID()
+		return nil
+	})
+
+	if err = fn(Default, netTime.Now(), nil, NewMessageIDExtension(mid)); err != nil {
+		t.Fatalf("Failed to send message: %+v", err)
+	}
+
+	if received != mid {
+		t.Errorf("Message ID replaced.\nexpected: %s\nreceived: %s",
+			mid, received)
+	}
+}
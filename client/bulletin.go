@@ -0,0 +1,427 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxTopicLen is the maximum length, in bytes, of a channel topic.
+	MaxTopicLen = 256
+
+	// MaxPins is the maximum number of messages pinned in a channel. Pinning
+	// another message unpins the oldest pin.
+	MaxPins = 5
+
+	// BulletinInterval is how often the channel admin re-broadcasts the topic
+	// and pinned messages so that new members receive them.
+	BulletinInterval = 5 * time.Minute
+
+	// BulletinJoinInterval is the minimum time between re-broadcasts of the
+	// topic and pinned messages made when members join the channel.
+	BulletinJoinInterval = time.Minute
+
+	// maxUnpins is the maximum number of unpinned messages remembered so that
+	// older pins of them are ignored.
+	maxUnpins = 4 * MaxPins
+)
+
+// Size constants.
+const (
+	pinUsernameLenSize = 1
+	pinTimestampSize   = 8
+	pinMinSize         = pinUsernameLenSize + pinTimestampSize
+)
+
+// Storage keys.
+const bulletinKeyPrefix = "bulletin/"
+
+// Error messages.
+const (
+	// ValidateTopic
+	errTopicLen = "topic of %d bytes exceeds maximum of %d bytes"
+
+	// NewPinnedMessage
+	errPinNoID        = "message has no message ID"
+	errPinTag         = "cannot pin %s message"
+	errPinDeleted     = "cannot pin deleted message"
+	errPinUsernameLen = "length of username %q cannot exceed %d"
+
+	// UnmarshalPinnedMessage
+	errPinLen = "pinned message of size %d shorter than minimum size %d"
+
+	// Bulletins.Apply
+	errBulletinTarget = "%s message has no target message ID"
+	errSaveBulletin   = "failed to save bulletin for channel %s: %+v"
+
+	// Bulletins.getBulletin
+	errLoadBulletin = "failed to load bulletin for channel %s: %+v"
+)
+
+/*
++---------------------------------------------------+
+|               Pinned Message Payload              |
++-------------+-------------+-----------+-----------+
+| usernameLen |  username   | timestamp |   text    |
+|   1 byte    | usernameLen |  8 bytes  | remaining |
++-------------+-------------+-----------+-----------+
+
+The payload is a copy of the pinned message so that members who joined after it
+was sent can read it. The timestamp is when the pinned message was sent, in Unix
+nanoseconds. Pins are sent asymmetrically with the Pin tag and the ID of the
+pinned message in the ReplyToExt extension.
+
+Unpins are sent asymmetrically with the Unpin tag, no payload, and the ID of the
+unpinned message in the ReplyToExt extension. Each unpin is remembered so that a
+pin of the message from before it is ignored.
+*/
+
+// PinnedMessage is a copy of a message pinned by the channel admin.
+type PinnedMessage struct {
+	// MessageID is the ID of the pinned message.
+	MessageID MessageID
+
+	// Username is the sender of the pinned message.
+	Username string
+
+	// Timestamp is when the pinned message was sent.
+	Timestamp time.Time
+
+	// Text is the text of the pinned message.
+	Text string
+
+	// PinnedAt is when the message was pinned.
+	PinnedAt time.Time
+}
+
+// UnpinnedMessage records when a message was unpinned by the channel admin.
+type UnpinnedMessage struct {
+	// MessageID is the ID of the unpinned message.
+	MessageID MessageID
+
+	// UnpinnedAt is when the message was last unpinned.
+	UnpinnedAt time.Time
+}
+
+// Bulletin is the topic and pinned messages of a channel, set by the channel
+// admin.
+type Bulletin struct {
+	// Topic is the current topic. It is empty if no topic is set.
+	Topic string
+
+	// TopicSetAt is when the topic was last set or cleared.
+	TopicSetAt time.Time
+
+	// Pins are the pinned messages, in the order they were pinned.
+	Pins []PinnedMessage
+
+	// Unpins are the last maxUnpins unpinned messages, in the order they were
+	// unpinned.
+	Unpins []UnpinnedMessage
+}
+
+// IsEmpty determines if the Bulletin has no topic and no pinned messages.
+func (b Bulletin) IsEmpty() bool {
+	return b.Topic == "" && len(b.Pins) == 0
+}
+
+// ValidateTopic returns an error if the topic is too long to be sent in a
+// Topic message. An empty topic clears the current topic.
+func ValidateTopic(topic string) error {
+	if len(topic) > MaxTopicLen {
+		return errors.Errorf(errTopicLen, len(topic), MaxTopicLen)
+	}
+	return nil
+}
+
+// NewPinnedMessage returns a copy of the received chat or admin message that
+// can be pinned.
+func NewPinnedMessage(r ReceivedBroadcast) (PinnedMessage, error) {
+	mid, exists := r.Extensions.MessageID()
+	if !exists {
+		return PinnedMessage{}, errors.New(errPinNoID)
+	} else if r.Tag != Default && r.Tag != Admin {
+		return PinnedMessage{}, errors.Errorf(errPinTag, r.Tag)
+	} else if len(r.Message) == 0 {
+		return PinnedMessage{}, errors.New(errPinDeleted)
+	} else if len(r.Username) > math.MaxUint8 {
+		return PinnedMessage{}, errors.Errorf(
+			errPinUsernameLen, r.Username, math.MaxUint8)
+	}
+
+	return PinnedMessage{
+		MessageID: mid,
+		Username:  r.Username,
+		Timestamp: r.Timestamp,
+		Text:      string(r.Message),
+	}, nil
+}
+
+// Marshal encodes the copy of the pinned message into a payload that can be
+// sent with the Pin tag. The message ID and pin time are sent in the message
+// extensions and timestamp.
+func (p PinnedMessage) Marshal() []byte {
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(pinMinSize + len(p.Username) + len(p.Text))
+
+	buff.WriteByte(uint8(len(p.Username)))
+	buff.WriteString(p.Username)
+	timestamp := make([]byte, pinTimestampSize)
+	binary.BigEndian.PutUint64(timestamp, uint64(p.Timestamp.UnixNano()))
+	buff.Write(timestamp)
+	buff.WriteString(p.Text)
+
+	return buff.Bytes()
+}
+
+// UnmarshalPinnedMessage decodes the received message with the Pin tag into a
+// PinnedMessage.
+func UnmarshalPinnedMessage(r ReceivedBroadcast) (PinnedMessage, error) {
+	mid, exists := r.Extensions.ReplyTo()
+	if !exists {
+		return PinnedMessage{}, errors.Errorf(errBulletinTarget, r.Tag)
+	} else if len(r.Message) < pinMinSize {
+		return PinnedMessage{}, errors.Errorf(
+			errPinLen, len(r.Message), pinMinSize)
+	}
+
+	buff := bytes.NewBuffer(r.Message)
+	usernameLen := int(buff.Next(pinUsernameLenSize)[0])
+	if buff.Len() < usernameLen+pinTimestampSize {
+		return PinnedMessage{}, errors.Errorf(
+			errPinLen, len(r.Message), pinMinSize+usernameLen)
+	}
+
+	return PinnedMessage{
+		MessageID: mid,
+		Username:  string(buff.Next(usernameLen)),
+		Timestamp: time.Unix(0,
+			int64(binary.BigEndian.Uint64(buff.Next(pinTimestampSize)))),
+		Text:     buff.String(),
+		PinnedAt: r.Timestamp,
+	}, nil
+}
+
+// Bulletins contains the last known Bulletin of each channel. Bulletins are
+// changed by Topic, Pin, and Unpin messages sent asymmetrically by the channel
+// admin and are persisted in a key-value store.
+type Bulletins struct {
+	kv ekv.KeyValue
+
+	// bulletins are the bulletins of each channel that has been accessed.
+	bulletins map[id.ID]*Bulletin
+
+	mux sync.Mutex
+}
+
+// NewBulletins returns Bulletins stored in the key-value store. To encrypt
+// them, the store should be an ekv.Filestore opened with the session password.
+func NewBulletins(kv ekv.KeyValue) *Bulletins {
+	return &Bulletins{
+		kv:        kv,
+		bulletins: make(map[id.ID]*Bulletin),
+	}
+}
+
+// Get returns a copy of the Bulletin of the channel.
+func (b *Bulletins) Get(channelID *id.ID) (Bulletin, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	bulletin, err := b.getBulletin(channelID)
+	if err != nil {
+		return Bulletin{}, err
+	}
+
+	c := *bulletin
+	c.Pins = append([]PinnedMessage{}, bulletin.Pins...)
+	c.Unpins = append([]UnpinnedMessage{}, bulletin.Unpins...)
+	return c, nil
+}
+
+// Apply changes the Bulletin of the channel as described by the Topic, Pin, or
+// Unpin message and saves it. The message must have been sent asymmetrically.
+// Messages older than the state they change are ignored so that re-broadcasts
+// are only applied by members that have not yet received them. Returns false
+// if the Bulletin was not changed.
+func (b *Bulletins) Apply(channelID *id.ID, r ReceivedBroadcast) (bool, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	bulletin, err := b.getBulletin(channelID)
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+	switch r.Tag {
+	case Topic:
+		if err = ValidateTopic(string(r.Message)); err != nil {
+			return false, err
+		}
+		changed = r.Timestamp.After(bulletin.TopicSetAt)
+		if changed {
+			bulletin.Topic = string(r.Message)
+			bulletin.TopicSetAt = r.Timestamp
+		}
+	case Pin:
+		p, err := UnmarshalPinnedMessage(r)
+		if err != nil {
+			return false, err
+		}
+		changed = bulletin.pin(p)
+	case Unpin:
+		mid, exists := r.Extensions.ReplyTo()
+		if !exists {
+			return false, errors.Errorf(errBulletinTarget, r.Tag)
+		}
+		changed = bulletin.unpin(mid, r.Timestamp)
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if err = b.kv.SetInterface(bulletinKey(channelID), bulletin); err != nil {
+		return false, errors.Errorf(errSaveBulletin, channelID, err)
+	}
+
+	return true, nil
+}
+
+// Filter returns a channel that receives every message sent on the given
+// channel after applying Topic, Pin, and Unpin messages to the Bulletin of the
+// channel. These messages are dropped if they are not sent asymmetrically or
+// they do not change the Bulletin, so that re-broadcasts are only received
+// once. The returned channel is closed when the given channel or done is
+// closed.
+func (b *Bulletins) Filter(channelID *id.ID, in chan ReceivedBroadcast,
+	done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		if !r.Tag.IsBulletin() {
+			return r, true
+		} else if !r.Asymmetric {
+			jww.WARN.Printf("Dropped %s message from %q on channel %s that "+
+				"was not sent by the admin.", r.Tag, r.Username, channelID)
+			return r, false
+		}
+
+		changed, err := b.Apply(channelID, r)
+		if err != nil {
+			jww.WARN.Printf("Dropped %s message on channel %s: %+v",
+				r.Tag, channelID, err)
+			return r, false
+		} else if !changed {
+			jww.DEBUG.Printf("Dropped %s message on channel %s that was "+
+				"already applied.", r.Tag, channelID)
+			return r, false
+		}
+		return r, true
+	})
+}
+
+// pin adds the message to the pins. If it is already pinned, then it is only
+// updated if it was pinned again more recently. Returns false if the pins were
+// not changed, including when the message was unpinned after this pin.
+func (b *Bulletin) pin(p PinnedMessage) bool {
+	for _, u := range b.Unpins {
+		if u.MessageID == p.MessageID && !p.PinnedAt.After(u.UnpinnedAt) {
+			return false
+		}
+	}
+
+	for i := range b.Pins {
+		if b.Pins[i].MessageID == p.MessageID {
+			if !p.PinnedAt.After(b.Pins[i].PinnedAt) {
+				return false
+			}
+			b.Pins = append(b.Pins[:i:i], b.Pins[i+1:]...)
+			break
+		}
+	}
+
+	b.Pins = append(b.Pins, p)
+	sort.SliceStable(b.Pins, func(i, j int) bool {
+		return b.Pins[i].PinnedAt.Before(b.Pins[j].PinnedAt)
+	})
+	if len(b.Pins) > MaxPins {
+		evicted := b.Pins[0]
+		b.Pins = b.Pins[len(b.Pins)-MaxPins:]
+
+		// A pin older than all the others is evicted straight away
+		if evicted.MessageID == p.MessageID {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unpin records that the message with the ID was unpinned at the given time
+// and removes it from the pins if it was pinned before then. Returns false if
+// the message was already unpinned at or after that time.
+func (b *Bulletin) unpin(mid MessageID, at time.Time) bool {
+	for i := range b.Unpins {
+		if b.Unpins[i].MessageID == mid {
+			if !at.After(b.Unpins[i].UnpinnedAt) {
+				return false
+			}
+			b.Unpins = append(b.Unpins[:i:i], b.Unpins[i+1:]...)
+			break
+		}
+	}
+
+	b.Unpins = append(b.Unpins, UnpinnedMessage{mid, at})
+	sort.SliceStable(b.Unpins, func(i, j int) bool {
+		return b.Unpins[i].UnpinnedAt.Before(b.Unpins[j].UnpinnedAt)
+	})
+	if len(b.Unpins) > maxUnpins {
+		b.Unpins = b.Unpins[len(b.Unpins)-maxUnpins:]
+	}
+
+	for i := range b.Pins {
+		if b.Pins[i].MessageID == mid && b.Pins[i].PinnedAt.Before(at) {
+			b.Pins = append(b.Pins[:i:i], b.Pins[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+// getBulletin returns the Bulletin for the channel, loading it from storage if
+// it has not yet been accessed. Must be called while the lock is held.
+func (b *Bulletins) getBulletin(channelID *id.ID) (*Bulletin, error) {
+	if bulletin, exists := b.bulletins[*channelID]; exists {
+		return bulletin, nil
+	}
+
+	bulletin := &Bulletin{}
+	err := b.kv.GetInterface(bulletinKey(channelID), bulletin)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadBulletin, channelID, err)
+	}
+
+	b.bulletins[*channelID] = bulletin
+	return bulletin, nil
+}
+
+// bulletinKey returns the storage key for the Bulletin of a channel.
+func bulletinKey(channelID *id.ID) string {
+	return bulletinKeyPrefix + channelID.String()
+}
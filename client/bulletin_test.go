@@ -0,0 +1,267 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newPinnedMessage returns a new message with a random message ID that is
+// pinned at the given time.
+func newPinnedMessage(t *testing.T, text string, pinnedAt time.Time) (
+	PinnedMessage, ReceivedBroadcast) {
+	mid, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("Failed to generate message ID: %+v", err)
+	}
+
+	p, err := NewPinnedMessage(ReceivedBroadcast{
+		Tag:        Default,
+		Username:   "alice",
+		Timestamp:  time.Unix(0, 42),
+		Message:    []byte(text),
+		Extensions: Extensions{NewMessageIDExtension(mid)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create pinned message: %+v", err)
+	}
+	p.PinnedAt = pinnedAt
+
+	return p, ReceivedBroadcast{
+		Tag:        Pin,
+		Timestamp:  pinnedAt,
+		Message:    p.Marshal(),
+		Extensions: Extensions{NewReplyToExtension(p.MessageID)},
+		Asymmetric: true,
+	}
+}
+
+// Tests that a PinnedMessage marshalled and unmarshalled matches the original.
+func TestPinnedMessage_Marshal_Unmarshal(t *testing.T) {
+	p, r := newPinnedMessage(t, "Maintenance at 5pm", time.Unix(100, 0))
+
+	received, err := UnmarshalPinnedMessage(r)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal pinned message: %+v", err)
+	}
+	if !reflect.DeepEqual(p, received) {
+		t.Errorf("Unmarshalled message does not match original."+
+			"\nexpected: %+v\nreceived: %+v", p, received)
+	}
+}
+
+// Error path: Tests that NewPinnedMessage rejects messages without an ID,
+// messages that are not chat or admin messages, and deleted messages.
+func TestNewPinnedMessage_Invalid(t *testing.T) {
+	mid, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("Failed to generate message ID: %+v", err)
+	}
+	ext := Extensions{NewMessageIDExtension(mid)}
+
+	for i, r := range []ReceivedBroadcast{
+		{Tag: Default, Message: []byte("hello")},
+		{Tag: Join, Message: []byte("hello"), Extensions: ext},
+		{Tag: Default, Extensions: ext},
+	} {
+		if _, err = NewPinnedMessage(r); err == nil {
+			t.Errorf("Pinned invalid message (%d): %+v", i, r)
+		}
+	}
+}
+
+// Tests that Bulletins.Apply only sets topics newer than the current one,
+// keeps at most MaxPins pins, and unpins messages.
+func TestBulletins_Apply(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	b := NewBulletins(ekv.MakeMemstore())
+	topic := func(text string, ts int64) ReceivedBroadcast {
+		return ReceivedBroadcast{Tag: Topic, Timestamp: time.Unix(ts, 0),
+			Message: []byte(text), Asymmetric: true}
+	}
+
+	for i, tt := range []struct {
+		r       ReceivedBroadcast
+		changed bool
+	}{
+		{topic("new", 10), true},
+		{topic("old", 5), false},
+		{topic("new", 10), false},
+		{topic("", 20), true},
+	} {
+		changed, err := b.Apply(channelID, tt.r)
+		if err != nil {
+			t.Errorf("Failed to apply topic (%d): %+v", i, err)
+		} else if changed != tt.changed {
+			t.Errorf("Unexpected change (%d).\nexpected: %t\nreceived: %t",
+				i, tt.changed, changed)
+		}
+	}
+
+	var pins []PinnedMessage
+	for i := 0; i < MaxPins+1; i++ {
+		p, r := newPinnedMessage(t, "pin", time.Unix(int64(100+i), 0))
+		pins = append(pins, p)
+		if changed, err := b.Apply(channelID, r); err != nil || !changed {
+			t.Errorf("Failed to apply pin %d: %t %+v", i, changed, err)
+		}
+	}
+
+	// A pin older than all the others is not kept
+	_, old := newPinnedMessage(t, "old", time.Unix(50, 0))
+	if changed, err := b.Apply(channelID, old); err != nil || changed {
+		t.Errorf("Applied pin older than all others: %t %+v", changed, err)
+	}
+
+	unpin := ReceivedBroadcast{Tag: Unpin, Timestamp: time.Unix(200, 0),
+		Extensions: Extensions{NewReplyToExtension(pins[1].MessageID)},
+		Asymmetric: true}
+	if changed, err := b.Apply(channelID, unpin); err != nil || !changed {
+		t.Errorf("Failed to apply unpin: %t %+v", changed, err)
+	}
+	if changed, err := b.Apply(channelID, unpin); err != nil || changed {
+		t.Errorf("Applied the same unpin twice: %t %+v", changed, err)
+	}
+
+	bulletin, err := b.Get(channelID)
+	if err != nil {
+		t.Fatalf("Failed to get bulletin: %+v", err)
+	}
+	if bulletin.Topic != "" || !bulletin.TopicSetAt.Equal(time.Unix(20, 0)) {
+		t.Errorf("Unexpected topic %q set at %s.",
+			bulletin.Topic, bulletin.TopicSetAt)
+	}
+	expected := pins[2:]
+	if !reflect.DeepEqual(expected, bulletin.Pins) {
+		t.Errorf("Unexpected pins.\nexpected: %+v\nreceived: %+v",
+			expected, bulletin.Pins)
+	}
+}
+
+// Tests that Bulletins.Filter applies admin bulletin messages, drops those
+// that are not sent asymmetrically or that are already applied, and that the
+// bulletin is loaded from storage by new Bulletins.
+func TestBulletins_Filter(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	kv := ekv.MakeMemstore()
+	b := NewBulletins(kv)
+
+	p, pin := newPinnedMessage(t, "Maintenance at 5pm", time.Unix(100, 0))
+	topic := ReceivedBroadcast{Tag: Topic, Timestamp: time.Unix(10, 0),
+		Message: []byte("maintenance"), Asymmetric: true}
+	forged := topic
+	forged.Asymmetric = false
+	forged.Timestamp = time.Unix(20, 0)
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := b.Filter(channelID, in, nil)
+	in <- topic
+	in <- pin
+	in <- forged
+	in <- topic
+	in <- pin
+	in <- ReceivedBroadcast{Tag: Default, Username: "alice"}
+	close(in)
+
+	var received []ReceivedBroadcast
+	for r := range out {
+		received = append(received, r)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("Unexpected number of messages received."+
+			"\nexpected: %d\nreceived: %d", 3, len(received))
+	}
+	if received[0].Tag != Topic || received[1].Tag != Pin ||
+		received[2].Tag != Default {
+		t.Errorf("Unexpected messages received: %+v", received)
+	}
+
+	bulletin, err := NewBulletins(kv).Get(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load bulletin: %+v", err)
+	}
+	if bulletin.Topic != "maintenance" {
+		t.Errorf("Unexpected topic.\nexpected: %q\nreceived: %q",
+			"maintenance", bulletin.Topic)
+	}
+	if len(bulletin.Pins) != 1 || bulletin.Pins[0].MessageID != p.MessageID ||
+		bulletin.Pins[0].Text != p.Text {
+		t.Errorf("Unexpected pins.\nexpected: %+v\nreceived: %+v",
+			[]PinnedMessage{p}, bulletin.Pins)
+	}
+}
+
+// Tests that Bulletins.Apply ignores a replayed pin from before the message was
+// unpinned, accepts a later pin of it, does not remove a pin made after an
+// unpin, and keeps the unpins in storage.
+func TestBulletins_Apply_Unpin(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	kv := ekv.MakeMemstore()
+	b := NewBulletins(kv)
+
+	_, pin := newPinnedMessage(t, "pin", time.Unix(100, 0))
+	mid, _ := pin.Extensions.ReplyTo()
+	unpin := func(at int64) ReceivedBroadcast {
+		return ReceivedBroadcast{Tag: Unpin, Timestamp: time.Unix(at, 0),
+			Extensions: Extensions{NewReplyToExtension(mid)}, Asymmetric: true}
+	}
+	repin := pin
+	repin.Timestamp = time.Unix(300, 0)
+
+	for i, tt := range []struct {
+		r       ReceivedBroadcast
+		changed bool
+		pinned  bool
+	}{
+		{pin, true, true},
+		{unpin(200), true, false},
+		{pin, false, false},
+		{unpin(150), false, false},
+		{repin, true, true},
+		{unpin(250), true, true},
+	} {
+		changed, err := b.Apply(channelID, tt.r)
+		if err != nil {
+			t.Fatalf("Failed to apply %s (%d): %+v", tt.r.Tag, i, err)
+		} else if changed != tt.changed {
+			t.Errorf("Unexpected change (%d).\nexpected: %t\nreceived: %t",
+				i, tt.changed, changed)
+		}
+
+		bulletin, _ := b.Get(channelID)
+		if pinned := len(bulletin.Pins) == 1; pinned != tt.pinned {
+			t.Errorf("Unexpected pins (%d): %+v", i, bulletin.Pins)
+		}
+	}
+
+	bulletin, err := NewBulletins(kv).Get(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load bulletin: %+v", err)
+	}
+	if len(bulletin.Unpins) != 1 || bulletin.Unpins[0].MessageID != mid ||
+		!bulletin.Unpins[0].UnpinnedAt.Equal(time.Unix(250, 0)) {
+		t.Errorf("Unexpected unpins: %+v", bulletin.Unpins)
+	}
+
+	// A member who missed the unpin receives the re-broadcast unpin and then
+	// a replayed pin
+	offline := NewBulletins(ekv.MakeMemstore())
+	for _, r := range []ReceivedBroadcast{unpin(200), pin} {
+		if _, err = offline.Apply(channelID, r); err != nil {
+			t.Fatalf("Failed to apply %s: %+v", r.Tag, err)
+		}
+	}
+	if bulletin, _ = offline.Get(channelID); len(bulletin.Pins) != 0 {
+		t.Errorf("Replayed pin applied after unpin: %+v", bulletin.Pins)
+	}
+}
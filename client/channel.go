@@ -0,0 +1,657 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/client/broadcast"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/netTime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Error messages.
+const (
+	// JoinChannel
+	errNewSymmetricChannel  = "failed to start new symmetric broadcast client: %+v"
+	errNewAsymmetricChannel = "failed to start new asymmetric broadcast client: %+v"
+
+	// JoinedChannel.Moderate
+	errNotAdmin     = "channel was joined without its RSA private key"
+	errNotModerator = "channel was joined without its RSA private key " +
+		"or a moderator grant"
+	errSendModeration  = "failed to send moderation command: %+v"
+	errApplyModeration = "failed to apply moderation command: %+v"
+
+	// JoinedChannel.Grant and JoinedChannel.Revoke
+	errNoRoles   = "channel was joined without roles"
+	errSendRole  = "failed to send %s: %+v"
+	errApplyRole = "failed to apply %s: %+v"
+
+	// JoinedChannel.HandOver
+	errNoHandovers   = "channel was joined without handovers"
+	errSendHandover  = "failed to send handover: %+v"
+	errApplyHandover = "failed to apply handover: %+v"
+
+	// JoinedChannel.RebroadcastBulletin
+	errRebroadcastBulletin = "failed to re-broadcast %s: %+v"
+
+	// JoinedChannel.RebroadcastRevocations
+	errRebroadcastRevocation = "failed to re-broadcast revocation of %s: %+v"
+)
+
+// JoinedChannel contains the broadcast clients for a channel that has been
+// joined and the functions used to send and receive messages on it.
+type JoinedChannel struct {
+	// Channel is the channel that was joined.
+	Channel *crypto.Channel
+
+	// Username is the name messages are sent under.
+	Username string
+
+	// Received receives every message broadcast on the channel.
+	Received chan ReceivedBroadcast
+
+	// Malformed receives a report of every received message that could not be
+	// decoded. Reports are dropped if it is full.
+	Malformed chan MalformedMessage
+
+	// SymBroadcastFn sends symmetric messages to the channel.
+	SymBroadcastFn BroadcastFn
+
+	// AsymBroadcastFn sends asymmetric admin messages to the channel. It is
+	// nil if the channel's RSA private key was not provided.
+	AsymBroadcastFn BroadcastFn
+
+	// SymMaxPayloadSize and AsymMaxPayloadSize are the maximum sizes of a
+	// message that can be sent with SymBroadcastFn and AsymBroadcastFn.
+	SymMaxPayloadSize  int
+	AsymMaxPayloadSize int
+
+	sym, asym broadcast.Channel
+
+	// moderation contains the mute and ban lists of the channel. It is nil if
+	// the channel is not moderated.
+	moderation *Moderation
+
+	// bulletins contains the topic and pinned messages of the channel. It is
+	// nil if they are not tracked.
+	bulletins *Bulletins
+
+	// roles contains the roles granted in the channel. It is nil if they are
+	// not tracked.
+	roles *Roles
+
+	// handovers contains the handovers of the channel's RSA key. It is nil if
+	// they are not tracked.
+	handovers *Handovers
+
+	// identity is the identity key sent messages are signed with. It is nil if
+	// sent messages are not signed.
+	identity ed25519.PublicKey
+
+	// privateKey is the channel's RSA private key used to sign moderation
+	// commands. It is nil if the channel was joined without it.
+	privateKey *rsa.PrivateKey
+	rng        *fastRNG.StreamGenerator
+
+	// malformedCount is the number of malformed messages received. It must be
+	// accessed atomically.
+	malformedCount uint64
+
+	// done is closed when the channel is left to stop every stage of the
+	// reception pipeline.
+	done  chan struct{}
+	leave sync.Once
+}
+
+// ChannelStores are the stores a channel is joined with. Each store is
+// optional and its feature is disabled when it is nil.
+type ChannelStores struct {
+	// History saves all sent and received messages.
+	History *History
+
+	// Keyring signs sent messages with its identity key and verifies the
+	// sender of every received message.
+	Keyring *Keyring
+
+	// Moderation saves moderation messages from the channel admin and drops
+	// messages from banned users.
+	Moderation *Moderation
+
+	// Bulletins saves the topic and pinned messages set by the channel admin.
+	Bulletins *Bulletins
+
+	// Roles saves the roles granted by the channel admin and marks received
+	// messages with the role of their sender, so that moderators can
+	// moderate.
+	Roles *Roles
+
+	// Handovers saves handovers of the channel's RSA key so that asymmetric
+	// messages are only accepted from the current key.
+	Handovers *Handovers
+}
+
+// JoinChannel starts the symmetric and asymmetric broadcast clients for the
+// channel. If the private key is nil, then the channel is joined without the
+// ability to send admin messages. The features of each of the stores are
+// enabled if the store is not nil. If the channel's RSA key has been handed
+// over, then the private key is ignored if it is not the current key. Returns
+// an error if the username is not valid. Every sent message is assigned a
+// MessageID.
+func JoinChannel(channel *crypto.Channel, username string, pk *rsa.PrivateKey,
+	net broadcast.Client, rng *fastRNG.StreamGenerator,
+	stores ChannelStores) (*JoinedChannel, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+
+	h, kr, mod := stores.History, stores.Keyring, stores.Moderation
+	b, ro, ho := stores.Bulletins, stores.Roles, stores.Handovers
+
+	key := func() *rsa.PublicKey { return channel.RsaPubKey }
+	if ho != nil {
+		key = func() *rsa.PublicKey { return ho.Key(channel) }
+	}
+	if pk != nil && !EqualRsaPublicKeys(pk.GetPublic(), key()) {
+		jww.WARN.Printf("RSA private key of channel %q (%s) has been handed "+
+			"over to key %s; joining without admin privileges.",
+			channel.Name, channel.ReceptionID, RsaFingerprint(key()))
+		pk = nil
+	}
+
+	jc := &JoinedChannel{
+		Channel:    channel,
+		Username:   username,
+		Malformed:  make(chan MalformedMessage, 100),
+		moderation: mod,
+		bulletins:  b,
+		roles:      ro,
+		handovers:  ho,
+		privateKey: pk,
+		rng:        rng,
+		done:       make(chan struct{}),
+	}
+	if kr != nil {
+		jc.identity = kr.PublicKey()
+	}
+
+	symCb, asymCb, cbChan := ReceptionCallback(jc.reportMalformed, jc.done)
+	jc.Received = cbChan
+
+	symParams := broadcast.Param{Method: broadcast.Symmetric}
+	symClient, err := broadcast.NewBroadcastChannel(
+		*channel, symCb, net, rng, symParams)
+	if err != nil {
+		return nil, errors.Errorf(errNewSymmetricChannel, err)
+	}
+
+	// Asymmetric messages are decrypted with the channel's current key instead
+	// of the key in the channel file
+	asymNet := &asymmetricClient{
+		Client: net,
+		p:      &asymmetricProcessor{channel: *channel, key: key, cb: asymCb},
+	}
+	asymParams := broadcast.Param{Method: broadcast.Asymmetric}
+	asymClient, err := broadcast.NewBroadcastChannel(
+		*channel, asymCb, asymNet, rng, asymParams)
+	if err != nil {
+		symClient.Stop()
+		return nil, errors.Errorf(errNewAsymmetricChannel, err)
+	}
+
+	jc.sym, jc.asym = symClient, asymClient
+
+	jc.SymBroadcastFn, jc.SymMaxPayloadSize =
+		SymmetricBroadcastFn(symClient, username)
+
+	if pk != nil {
+		jc.AsymBroadcastFn, jc.AsymMaxPayloadSize =
+			AsymmetricBroadcastFn(asymClient, username, pk)
+	}
+
+	// Messages are verified before they are recorded and signed before the
+	// record of them is made so that the history contains both. Banned users
+	// are matched by their verified identity key, so they are filtered after
+	// verification and before they are recorded. Roles are set before
+	// moderation so that commands from moderators are accepted. Every stage
+	// stops when the channel is left.
+	if kr != nil {
+		jc.Received = kr.VerifyAll(channel.ReceptionID, jc.Received, jc.done)
+	}
+
+	if ho != nil {
+		jc.Received = ho.Filter(channel, jc.Received, jc.done)
+	}
+
+	if ro != nil {
+		jc.Received = ro.Filter(channel.ReceptionID, key, jc.Received, jc.done)
+	}
+
+	if mod != nil {
+		jc.Received =
+			mod.Filter(channel.ReceptionID, key, jc.Received, jc.done)
+	}
+
+	if b != nil {
+		jc.Received = b.Filter(channel.ReceptionID, jc.Received, jc.done)
+	}
+
+	if h != nil {
+		jc.Received = h.Record(channel.ReceptionID, jc.Received, jc.done)
+		jc.SymBroadcastFn = h.RecordSent(
+			channel.ReceptionID, username, false, jc.SymBroadcastFn)
+		jc.AsymBroadcastFn = h.RecordSent(
+			channel.ReceptionID, username, true, jc.AsymBroadcastFn)
+	}
+
+	if kr != nil {
+		jc.SymBroadcastFn =
+			kr.SignBroadcastFn(channel.ReceptionID, username, jc.SymBroadcastFn)
+		jc.AsymBroadcastFn =
+			kr.SignBroadcastFn(channel.ReceptionID, username, jc.AsymBroadcastFn)
+	}
+
+	// The message ID is assigned first so that it is signed and recorded
+	jc.SymBroadcastFn = AssignMessageID(jc.SymBroadcastFn)
+	jc.AsymBroadcastFn = AssignMessageID(jc.AsymBroadcastFn)
+
+	jww.INFO.Printf("Joined channel %q (%s) as %q.",
+		channel.Name, channel.ReceptionID, username)
+
+	return jc, nil
+}
+
+// MalformedCount returns the number of received messages that could not be
+// decoded.
+func (jc *JoinedChannel) MalformedCount() uint64 {
+	return atomic.LoadUint64(&jc.malformedCount)
+}
+
+// reportMalformed counts the malformed message and sends it to the Malformed
+// channel if it is not full.
+func (jc *JoinedChannel) reportMalformed(mm MalformedMessage) {
+	atomic.AddUint64(&jc.malformedCount, 1)
+	select {
+	case jc.Malformed <- mm:
+	default:
+	}
+}
+
+// IsMuted determines if the sender of the message received on the channel is
+// muted by the channel admin.
+func (jc *JoinedChannel) IsMuted(r ReceivedBroadcast) bool {
+	return jc.moderation != nil &&
+		jc.moderation.IsMuted(jc.Channel.ReceptionID, r)
+}
+
+// Moderate sends a ModerationCommand for the user with the username or
+// identity key to the channel. If the channel was joined with its RSA private
+// key, then the command is signed with it and sent asymmetrically. Otherwise,
+// it is sent with the user's moderator grant. The command is also applied to
+// the local moderation lists so that it takes effect before it is received.
+func (jc *JoinedChannel) Moderate(
+	action ModerationAction, username string, key ed25519.PublicKey) error {
+	mc, err := NewModerationCommand(action, username, key, netTime.Now())
+	if err != nil {
+		return err
+	}
+
+	if jc.privateKey != nil && jc.AsymBroadcastFn != nil {
+		stream := jc.rng.GetStream()
+		mc, err = mc.Sign(jc.Channel.ReceptionID, jc.privateKey, stream)
+		stream.Close()
+		if err != nil {
+			return err
+		}
+
+		err = jc.AsymBroadcastFn(Moderate, netTime.Now(), mc.Marshal())
+	} else if g, isModerator := jc.ModeratorGrant(); isModerator {
+		err = jc.SymBroadcastFn(Moderate, netTime.Now(), mc.Marshal(),
+			Extension{GrantExt, g.Marshal()})
+	} else {
+		return errors.New(errNotModerator)
+	}
+	if err != nil {
+		return errors.Errorf(errSendModeration, err)
+	}
+
+	if jc.moderation != nil {
+		_, err = jc.moderation.Apply(jc.Channel.ReceptionID, mc)
+		if err != nil {
+			return errors.Errorf(errApplyModeration, err)
+		}
+	}
+
+	return nil
+}
+
+// ModerationLists returns the mute and ban lists of the channel. Returns empty
+// lists if the channel is not moderated.
+func (jc *JoinedChannel) ModerationLists() (ModerationLists, error) {
+	if jc.moderation == nil {
+		return ModerationLists{}, nil
+	}
+	return jc.moderation.Lists(jc.Channel.ReceptionID)
+}
+
+// ModeratorGrant returns the user's grant of the Moderator role in the
+// channel. Returns false if the user is not a moderator or sent messages are
+// not signed.
+func (jc *JoinedChannel) ModeratorGrant() (RoleGrant, bool) {
+	if jc.roles == nil || jc.identity == nil {
+		return RoleGrant{}, false
+	}
+
+	g, exists :=
+		jc.roles.Get(jc.Channel.ReceptionID, jc.identity, netTime.Now())
+	if !exists || g.Role != Moderator {
+		return RoleGrant{}, false
+	}
+	return g, true
+}
+
+// IsModerator determines if the user can moderate the channel, either as the
+// channel admin or with a moderator grant.
+func (jc *JoinedChannel) IsModerator() bool {
+	if jc.privateKey != nil && jc.AsymBroadcastFn != nil {
+		return true
+	}
+	_, isModerator := jc.ModeratorGrant()
+	return isModerator
+}
+
+// Grants returns the grants in the channel that have not expired or been
+// revoked. Returns nil if roles are not tracked.
+func (jc *JoinedChannel) Grants() ([]RoleGrant, error) {
+	if jc.roles == nil {
+		return nil, nil
+	}
+	return jc.roles.Grants(jc.Channel.ReceptionID, netTime.Now())
+}
+
+// Grant signs a RoleGrant of the role to the identity key with the channel's
+// RSA private key and sends it to the channel. Pass a zero expiry for a grant
+// that never expires. The grant is also saved locally.
+func (jc *JoinedChannel) Grant(
+	role Role, key ed25519.PublicKey, expires time.Time) error {
+	if jc.privateKey == nil || jc.AsymBroadcastFn == nil {
+		return errors.New(errNotAdmin)
+	} else if jc.roles == nil {
+		return errors.New(errNoRoles)
+	}
+
+	now := netTime.Now()
+	g, err := NewRoleGrant(role, key, now, expires)
+	if err != nil {
+		return err
+	}
+
+	stream := jc.rng.GetStream()
+	g, err = g.Sign(jc.Channel.ReceptionID, jc.privateKey, stream)
+	stream.Close()
+	if err != nil {
+		return err
+	}
+
+	if err = jc.AsymBroadcastFn(Grant, now, g.Marshal()); err != nil {
+		return errors.Errorf(errSendRole, Grant, err)
+	}
+
+	if _, err = jc.roles.Apply(jc.Channel.ReceptionID, g); err != nil {
+		return errors.Errorf(errApplyRole, Grant, err)
+	}
+
+	return nil
+}
+
+// Revoke revokes every role granted to the identity key and sends the
+// revocation to the channel. The revocation is also saved locally.
+func (jc *JoinedChannel) Revoke(key ed25519.PublicKey) error {
+	if jc.privateKey == nil || jc.AsymBroadcastFn == nil {
+		return errors.New(errNotAdmin)
+	} else if jc.roles == nil {
+		return errors.New(errNoRoles)
+	}
+
+	key, err := UnmarshalRevocation(key)
+	if err != nil {
+		return err
+	}
+
+	now := netTime.Now()
+	if err = jc.AsymBroadcastFn(Revoke, now, key); err != nil {
+		return errors.Errorf(errSendRole, Revoke, err)
+	}
+
+	if _, err = jc.roles.Revoke(jc.Channel.ReceptionID, key, now); err != nil {
+		return errors.Errorf(errApplyRole, Revoke, err)
+	}
+
+	return nil
+}
+
+// PublicKey returns the channel's current RSA public key. It is the key in the
+// channel file unless the channel has been handed over to another key.
+func (jc *JoinedChannel) PublicKey() *rsa.PublicKey {
+	if jc.handovers == nil {
+		return jc.Channel.RsaPubKey
+	}
+	return jc.handovers.Key(jc.Channel)
+}
+
+// Handovers returns the handovers of the channel's RSA key in the order they
+// were made. Returns nil if they are not tracked.
+func (jc *JoinedChannel) Handovers() ([]KeyHandover, error) {
+	if jc.handovers == nil {
+		return nil, nil
+	}
+	return jc.handovers.Chain(jc.Channel)
+}
+
+// HandOver signs a KeyHandover of the channel to the successor key with the
+// channel's current RSA private key and sends it to the channel. The handover
+// is also saved locally. Once it is received, admin messages are only accepted
+// from the owner of the successor key.
+func (jc *JoinedChannel) HandOver(
+	successor *rsa.PublicKey) (KeyHandover, error) {
+	if jc.privateKey == nil || jc.AsymBroadcastFn == nil {
+		return KeyHandover{}, errors.New(errNotAdmin)
+	} else if jc.handovers == nil {
+		return KeyHandover{}, errors.New(errNoHandovers)
+	}
+
+	now := netTime.Now()
+	stream := jc.rng.GetStream()
+	h, err := NewKeyHandover(
+		jc.Channel.ReceptionID, jc.privateKey, successor, now, stream)
+	stream.Close()
+	if err != nil {
+		return KeyHandover{}, err
+	}
+
+	if err = jc.AsymBroadcastFn(Handover, now, h.Marshal()); err != nil {
+		return KeyHandover{}, errors.Errorf(errSendHandover, err)
+	}
+
+	if _, err = jc.handovers.Apply(jc.Channel, h); err != nil {
+		return KeyHandover{}, errors.Errorf(errApplyHandover, err)
+	}
+
+	return h, nil
+}
+
+// Bulletin returns the topic and pinned messages of the channel. Returns an
+// empty Bulletin if they are not tracked.
+func (jc *JoinedChannel) Bulletin() (Bulletin, error) {
+	if jc.bulletins == nil {
+		return Bulletin{}, nil
+	}
+	return jc.bulletins.Get(jc.Channel.ReceptionID)
+}
+
+// SetTopic sends the topic to the channel as the channel admin. An empty topic
+// clears the current topic.
+func (jc *JoinedChannel) SetTopic(topic string) error {
+	if jc.AsymBroadcastFn == nil {
+		return errors.New(errNotAdmin)
+	} else if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+
+	return jc.AsymBroadcastFn(Topic, netTime.Now(), []byte(topic))
+}
+
+// PinMessage pins the received message to the channel as the channel admin.
+func (jc *JoinedChannel) PinMessage(r ReceivedBroadcast) error {
+	if jc.AsymBroadcastFn == nil {
+		return errors.New(errNotAdmin)
+	}
+
+	p, err := NewPinnedMessage(r)
+	if err != nil {
+		return err
+	}
+
+	return jc.AsymBroadcastFn(Pin, netTime.Now(), p.Marshal(),
+		NewReplyToExtension(p.MessageID))
+}
+
+// UnpinMessage unpins the message with the ID from the channel as the channel
+// admin.
+func (jc *JoinedChannel) UnpinMessage(mid MessageID) error {
+	if jc.AsymBroadcastFn == nil {
+		return errors.New(errNotAdmin)
+	}
+
+	return jc.AsymBroadcastFn(
+		Unpin, netTime.Now(), nil, NewReplyToExtension(mid))
+}
+
+// RebroadcastBulletin sends the topic, pinned messages, and unpins of the
+// channel again with the time they were originally set so that members who
+// joined or were offline since receive them. A cleared topic is sent as an
+// empty topic. Members who already have them ignore them. Does nothing if the
+// channel was joined without its RSA private key.
+func (jc *JoinedChannel) RebroadcastBulletin() error {
+	if jc.AsymBroadcastFn == nil {
+		return nil
+	}
+
+	bulletin, err := jc.Bulletin()
+	if err != nil {
+		return err
+	}
+
+	if !bulletin.TopicSetAt.IsZero() {
+		err = jc.AsymBroadcastFn(
+			Topic, bulletin.TopicSetAt, []byte(bulletin.Topic))
+		if err != nil {
+			return errors.Errorf(errRebroadcastBulletin, Topic, err)
+		}
+	}
+
+	for _, u := range bulletin.Unpins {
+		err = jc.AsymBroadcastFn(
+			Unpin, u.UnpinnedAt, nil, NewReplyToExtension(u.MessageID))
+		if err != nil {
+			return errors.Errorf(errRebroadcastBulletin, Unpin, err)
+		}
+	}
+
+	for _, p := range bulletin.Pins {
+		err = jc.AsymBroadcastFn(Pin, p.PinnedAt, p.Marshal(),
+			NewReplyToExtension(p.MessageID))
+		if err != nil {
+			return errors.Errorf(errRebroadcastBulletin, Pin, err)
+		}
+	}
+
+	return nil
+}
+
+// RebroadcastRevocations sends every revocation of the channel's roles again
+// with the time it was originally made so that members who missed it stop
+// accepting the revoked grants. Members who already have them ignore them.
+// Does nothing if the channel was joined without its RSA private key or roles.
+func (jc *JoinedChannel) RebroadcastRevocations() error {
+	if jc.AsymBroadcastFn == nil || jc.roles == nil {
+		return nil
+	}
+
+	revocations, err := jc.roles.Revocations(jc.Channel.ReceptionID)
+	if err != nil {
+		return err
+	}
+
+	for _, rv := range revocations {
+		err = jc.AsymBroadcastFn(Revoke, rv.RevokedAt, rv.Key)
+		if err != nil {
+			return errors.Errorf(errRebroadcastRevocation,
+				base64.StdEncoding.EncodeToString(rv.Key), err)
+		}
+	}
+
+	return nil
+}
+
+// Leave stops the broadcast clients so that no more messages are received on
+// the channel and stops the reception pipeline, closing Received if it has any
+// stages. It is safe to call more than once.
+func (jc *JoinedChannel) Leave() {
+	jc.leave.Do(func() {
+		jc.sym.Stop()
+		jc.asym.Stop()
+		close(jc.done)
+
+		jww.INFO.Printf("Left channel %q (%s).",
+			jc.Channel.Name, jc.Channel.ReceptionID)
+	})
+}
+
+// stageFn processes a message in a stage of the reception pipeline. It returns
+// false if the message is dropped.
+type stageFn func(r ReceivedBroadcast) (ReceivedBroadcast, bool)
+
+// pipe starts a stage of the reception pipeline that passes every message
+// received on in through fn to the returned channel. The stage stops and closes
+// the returned channel when in or done is closed; a nil done is never closed.
+func pipe(in chan ReceivedBroadcast, done <-chan struct{},
+	fn stageFn) chan ReceivedBroadcast {
+	out := make(chan ReceivedBroadcast, cap(in))
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case r, ok := <-in:
+				if !ok {
+					return
+				} else if r, ok = fn(r); !ok {
+					continue
+				}
+
+				select {
+				case out <- r:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,73 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+	"time"
+)
+
+// Tests that every stage of a reception pipeline stops and closes its output
+// when done is closed, even though its input is never closed.
+func Test_pipe_Done(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	in := make(chan ReceivedBroadcast, 10)
+	done := make(chan struct{})
+
+	kr, err := LoadKeyring(ekv.MakeMemstore(), false)
+	if err != nil {
+		t.Fatalf("Failed to make keyring: %+v", err)
+	}
+	out := kr.VerifyAll(channelID, in, done)
+	out = NewModeration(ekv.MakeMemstore()).Filter(channelID, nil, out, done)
+	out = NewBulletins(ekv.MakeMemstore()).Filter(channelID, out, done)
+
+	in <- ReceivedBroadcast{Tag: Default, Username: "alice"}
+	select {
+	case r := <-out:
+		if r.Username != "alice" {
+			t.Errorf("Unexpected message received: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for message.")
+	}
+
+	close(done)
+	select {
+	case r, ok := <-out:
+		if ok {
+			t.Errorf("Received message after done was closed: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Pipeline output not closed after done was closed.")
+	}
+}
+
+// Tests that pipe drops messages that fn rejects and closes its output when
+// its input is closed.
+func Test_pipe_Drop(t *testing.T) {
+	in := make(chan ReceivedBroadcast, 10)
+	out := pipe(in, nil, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		return r, r.Username != "mallory"
+	})
+
+	for _, username := range []string{"alice", "mallory", "bob"} {
+		in <- ReceivedBroadcast{Username: username}
+	}
+	close(in)
+
+	var received []string
+	for r := range out {
+		received = append(received, r.Username)
+	}
+	if len(received) != 2 || received[0] != "alice" || received[1] != "bob" {
+		t.Errorf("Unexpected messages received: %v", received)
+	}
+}
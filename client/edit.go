@@ -0,0 +1,101 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+)
+
+// CanModify determines if the change, an Edit or Delete message, may be applied
+// to the original message. A change is accepted when it is sent by the same
+// signing identity as a verified original or, if the original is not verified,
+// under the same username. Asymmetric deletes, which only the channel admin can
+// send, may retract any message. Admin messages may only be modified
+// asymmetrically, and only chat messages may be edited.
+func CanModify(original, change ReceivedBroadcast) bool {
+	switch change.Tag {
+	case Edit:
+		if original.Tag != Default && original.Tag != Admin {
+			return false
+		}
+	case Delete:
+		if original.Tag != Default && original.Tag != Admin &&
+			original.Tag != File {
+			return false
+		} else if change.Asymmetric {
+			return true
+		}
+	default:
+		return false
+	}
+
+	if original.Asymmetric && !change.Asymmetric {
+		return false
+	} else if change.Verification == Impersonation {
+		return false
+	}
+
+	if original.Verification == Verified {
+		originalKey, _ := original.Extensions.Get(SigningKeyExt)
+		changeKey, _ := change.Extensions.Get(SigningKeyExt)
+		return change.Verification == Verified &&
+			bytes.Equal(originalKey, changeKey)
+	}
+
+	return original.Username == change.Username
+}
+
+// ApplyChanges returns the messages as they are shown in the channel feed,
+// with every Edit and Delete message accepted by CanModify applied to the
+// message it modifies. Edited messages contain the text of their last accepted
+// edit and deleted messages are removed. The Edit and Delete messages
+// themselves are not returned.
+func ApplyChanges(messages []ReceivedBroadcast) []ReceivedBroadcast {
+	applied := make([]ReceivedBroadcast, 0, len(messages))
+	ids := make(map[MessageID]int)
+	deleted := make(map[int]struct{})
+	for _, r := range messages {
+		if r.Tag != Edit && r.Tag != Delete {
+			if mid, exists := r.Extensions.MessageID(); exists {
+				if _, exists = ids[mid]; !exists {
+					ids[mid] = len(applied)
+				}
+			}
+			applied = append(applied, r)
+			continue
+		}
+
+		mid, exists := r.Extensions.EditOf()
+		if !exists {
+			continue
+		}
+		i, exists := ids[mid]
+		if !exists {
+			continue
+		} else if _, exists = deleted[i]; exists {
+			continue
+		} else if !CanModify(applied[i], r) {
+			continue
+		}
+
+		if r.Tag == Edit {
+			applied[i].Message = r.Message
+		} else {
+			deleted[i] = struct{}{}
+		}
+	}
+
+	shown := applied[:0]
+	for i, r := range applied {
+		if _, exists := deleted[i]; !exists {
+			shown = append(shown, r)
+		}
+	}
+
+	return shown
+}
@@ -0,0 +1,119 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"testing"
+)
+
+// Tests that CanModify only accepts edits and deletes from the sender of the
+// original message and asymmetric deletes from the admin.
+func TestCanModify(t *testing.T) {
+	aliceKey := Extensions{{SigningKeyExt, []byte("aliceKey")}}
+	malloryKey := Extensions{{SigningKeyExt, []byte("malloryKey")}}
+
+	text := ReceivedBroadcast{Tag: Default, Username: "alice"}
+	signed := ReceivedBroadcast{Tag: Default, Username: "alice",
+		Extensions: aliceKey, Verification: Verified}
+	admin := ReceivedBroadcast{Tag: Admin, Username: "admin", Asymmetric: true}
+	join := ReceivedBroadcast{Tag: Join, Username: "alice"}
+	file := ReceivedBroadcast{Tag: File, Username: "alice"}
+
+	tests := []struct {
+		name     string
+		original ReceivedBroadcast
+		change   ReceivedBroadcast
+		allowed  bool
+	}{
+		{"edit by same username", text,
+			ReceivedBroadcast{Tag: Edit, Username: "alice"}, true},
+		{"delete by same username", text,
+			ReceivedBroadcast{Tag: Delete, Username: "alice"}, true},
+		{"edit by other username", text,
+			ReceivedBroadcast{Tag: Edit, Username: "bob"}, false},
+		{"delete by other username", text,
+			ReceivedBroadcast{Tag: Delete, Username: "bob"}, false},
+		{"edit by impersonator", text, ReceivedBroadcast{Tag: Edit,
+			Username: "alice", Verification: Impersonation}, false},
+		{"edit by same identity", signed, ReceivedBroadcast{Tag: Edit,
+			Username: "alice2", Extensions: aliceKey,
+			Verification: Verified}, true},
+		{"edit by other identity", signed, ReceivedBroadcast{Tag: Edit,
+			Username: "alice", Extensions: malloryKey,
+			Verification: Verified}, false},
+		{"unsigned edit of verified message", signed,
+			ReceivedBroadcast{Tag: Edit, Username: "alice"}, false},
+		{"admin delete", text, ReceivedBroadcast{Tag: Delete,
+			Username: "admin", Asymmetric: true}, true},
+		{"admin edit of other message", text, ReceivedBroadcast{Tag: Edit,
+			Username: "admin", Asymmetric: true}, false},
+		{"symmetric edit of admin message", admin,
+			ReceivedBroadcast{Tag: Edit, Username: "admin"}, false},
+		{"admin edit of admin message", admin, ReceivedBroadcast{Tag: Edit,
+			Username: "admin", Asymmetric: true}, true},
+		{"edit of join", join,
+			ReceivedBroadcast{Tag: Edit, Username: "alice"}, false},
+		{"edit of file", file,
+			ReceivedBroadcast{Tag: Edit, Username: "alice"}, false},
+		{"delete of file", file,
+			ReceivedBroadcast{Tag: Delete, Username: "alice"}, true},
+		{"non-modifying tag", text,
+			ReceivedBroadcast{Tag: Default, Username: "alice"}, false},
+	}
+
+	for _, tt := range tests {
+		if allowed := CanModify(tt.original, tt.change); allowed != tt.allowed {
+			t.Errorf("Unexpected result for %s.\nexpected: %t\nreceived: %t",
+				tt.name, tt.allowed, allowed)
+		}
+	}
+}
+
+// Tests that ApplyChanges applies accepted edits and deletes to the messages
+// they modify and drops the Edit and Delete messages.
+func TestApplyChanges(t *testing.T) {
+	first, second, third := MessageID{1}, MessageID{2}, MessageID{3}
+	messages := []ReceivedBroadcast{
+		{Tag: Default, Username: "alice", Message: []byte("first"),
+			Extensions: Extensions{NewMessageIDExtension(first)}},
+		{Tag: Default, Username: "bob", Message: []byte("second"),
+			Extensions: Extensions{NewMessageIDExtension(second)}},
+		{Tag: Default, Username: "carol", Message: []byte("third"),
+			Extensions: Extensions{NewMessageIDExtension(third)}},
+		{Tag: Default, Username: "mallory", Message: []byte("duplicate"),
+			Extensions: Extensions{NewMessageIDExtension(first)}},
+		{Tag: Edit, Username: "alice", Message: []byte("first edited"),
+			Extensions: Extensions{NewEditOfExtension(first)}},
+		{Tag: Edit, Username: "mallory", Message: []byte("hacked"),
+			Extensions: Extensions{NewEditOfExtension(first)}},
+		{Tag: Delete, Username: "bob",
+			Extensions: Extensions{NewEditOfExtension(second)}},
+		{Tag: Edit, Username: "bob", Message: []byte("second edited"),
+			Extensions: Extensions{NewEditOfExtension(second)}},
+		{Tag: Delete, Username: "mallory",
+			Extensions: Extensions{NewEditOfExtension(third)}},
+	}
+
+	applied := ApplyChanges(messages)
+
+	expected := []string{"first edited", "third", "duplicate"}
+	if len(applied) != len(expected) {
+		t.Fatalf("Expected %d messages, received %d: %+v",
+			len(expected), len(applied), applied)
+	}
+	for i, r := range applied {
+		if string(r.Message) != expected[i] {
+			t.Errorf("Unexpected message %d.\nexpected: %q\nreceived: %q",
+				i, expected[i], r.Message)
+		}
+	}
+
+	if string(messages[0].Message) != "first" {
+		t.Errorf("ApplyChanges modified the original messages.")
+	}
+}
@@ -0,0 +1,227 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+)
+
+// Error messages.
+const (
+	// unmarshalExtensions
+	errExtensionHeader = "extensions of size %d too short to contain header"
+	errExtensionValue  = "%s extension of size %d exceeds remaining %d bytes"
+
+	// NewMessageID
+	errNewMessageID = "failed to generate message ID: %+v"
+)
+
+// ExtensionType identifies the field contained in an Extension.
+type ExtensionType uint8
+
+const (
+	// MessageIDExt is a MessageID that uniquely identifies the message.
+	MessageIDExt ExtensionType = 1
+
+	// ReplyToExt is the MessageID of the message being replied to.
+	ReplyToExt ExtensionType = 2
+
+	// EditOfExt is the MessageID of the message being edited.
+	EditOfExt ExtensionType = 3
+
+	// ContentTypeExt is the MIME type of the payload.
+	ContentTypeExt ExtensionType = 4
+
+	// SigningKeyExt is the ed25519 identity key of the sender.
+	SigningKeyExt ExtensionType = 5
+
+	// SignatureExt is the ed25519 signature of the message made with the key in
+	// SigningKeyExt. It must be the last extension.
+	SignatureExt ExtensionType = 6
+
+	// GrantExt is the RoleGrant that gives the sender the role they act
+	// under. It must precede SignatureExt.
+	GrantExt ExtensionType = 7
+)
+
+// extensionTypeStringMap correlates each ExtensionType to a human-readable
+// name.
+var extensionTypeStringMap = map[ExtensionType]string{
+	MessageIDExt:   "messageID",
+	ReplyToExt:     "replyTo",
+	EditOfExt:      "editOf",
+	ContentTypeExt: "contentType",
+	SigningKeyExt:  "signingKey",
+	SignatureExt:   "signature",
+	GrantExt:       "grant",
+}
+
+// String returns a human-readable name for the ExtensionType for debugging
+// purposes. Adheres to the fmt.Stringer interface.
+func (t ExtensionType) String() string {
+	str, exists := extensionTypeStringMap[t]
+	if exists {
+		return str
+	}
+
+	return "UNKNOWN EXTENSION: " + strconv.FormatUint(uint64(t), 10)
+}
+
+// Extension is an optional field included in a Version1 message.
+type Extension struct {
+	Type  ExtensionType `json:"type"`
+	Value []byte        `json:"value"`
+}
+
+// Extensions is the list of extensions of a message.
+type Extensions []Extension
+
+// Get returns the value of the first extension of the given type.
+func (e Extensions) Get(t ExtensionType) ([]byte, bool) {
+	for _, ext := range e {
+		if ext.Type == t {
+			return ext.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MessageID returns the value of the MessageIDExt extension.
+func (e Extensions) MessageID() (MessageID, bool) {
+	return e.getMessageID(MessageIDExt)
+}
+
+// ReplyTo returns the value of the ReplyToExt extension.
+func (e Extensions) ReplyTo() (MessageID, bool) {
+	return e.getMessageID(ReplyToExt)
+}
+
+// EditOf returns the value of the EditOfExt extension.
+func (e Extensions) EditOf() (MessageID, bool) {
+	return e.getMessageID(EditOfExt)
+}
+
+// ContentType returns the value of the ContentTypeExt extension.
+func (e Extensions) ContentType() (string, bool) {
+	value, exists := e.Get(ContentTypeExt)
+	return string(value), exists
+}
+
+// getMessageID returns the value of the extension as a MessageID. Returns false
+// if the extension does not exist or is not the size of a MessageID.
+func (e Extensions) getMessageID(t ExtensionType) (MessageID, bool) {
+	value, exists := e.Get(t)
+	if !exists || len(value) != MessageIDLen {
+		return MessageID{}, false
+	}
+
+	var mid MessageID
+	copy(mid[:], value)
+	return mid, true
+}
+
+// marshal encodes the extensions as a list of type-length-value fields.
+func (e Extensions) marshal() ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	for _, ext := range e {
+		if len(ext.Value) > math.MaxUint16 {
+			return nil, errors.Errorf(
+				errExtensionLen, ext.Type, len(ext.Value), math.MaxUint16)
+		}
+
+		buff.WriteByte(byte(ext.Type))
+
+		b := make([]byte, extLenSize)
+		binary.LittleEndian.PutUint16(b, uint16(len(ext.Value)))
+		buff.Write(b)
+
+		buff.Write(ext.Value)
+	}
+
+	if buff.Len() > math.MaxUint16 {
+		return nil, errors.Errorf(errExtensionsLen, buff.Len(), math.MaxUint16)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// unmarshalExtensions decodes the list of type-length-value fields.
+func unmarshalExtensions(data []byte) (Extensions, error) {
+	var e Extensions
+	buff := bytes.NewBuffer(data)
+	for buff.Len() > 0 {
+		if buff.Len() < extHeaderSize {
+			return nil, errors.Errorf(errExtensionHeader, buff.Len())
+		}
+
+		t := ExtensionType(buff.Next(extTypeSize)[0])
+		n := int(binary.LittleEndian.Uint16(buff.Next(extLenSize)))
+		if buff.Len() < n {
+			return nil, errors.Errorf(errExtensionValue, t, n, buff.Len())
+		}
+
+		e = append(e, Extension{
+			Type:  t,
+			Value: append([]byte{}, buff.Next(n)...),
+		})
+	}
+
+	return e, nil
+}
+
+// NewMessageIDExtension returns a MessageIDExt extension.
+func NewMessageIDExtension(mid MessageID) Extension {
+	return Extension{MessageIDExt, mid.Bytes()}
+}
+
+// NewReplyToExtension returns a ReplyToExt extension.
+func NewReplyToExtension(mid MessageID) Extension {
+	return Extension{ReplyToExt, mid.Bytes()}
+}
+
+// NewEditOfExtension returns an EditOfExt extension.
+func NewEditOfExtension(mid MessageID) Extension {
+	return Extension{EditOfExt, mid.Bytes()}
+}
+
+// NewContentTypeExtension returns a ContentTypeExt extension.
+func NewContentTypeExtension(contentType string) Extension {
+	return Extension{ContentTypeExt, []byte(contentType)}
+}
+
+// MessageIDLen is the length of a MessageID.
+const MessageIDLen = 16
+
+// MessageID uniquely identifies a message sent to a channel.
+type MessageID [MessageIDLen]byte
+
+// NewMessageID generates a new random MessageID.
+func NewMessageID() (MessageID, error) {
+	var mid MessageID
+	if _, err := rand.Read(mid[:]); err != nil {
+		return MessageID{}, errors.Errorf(errNewMessageID, err)
+	}
+	return mid, nil
+}
+
+// Bytes returns the MessageID as a byte slice.
+func (mid MessageID) Bytes() []byte {
+	return append([]byte{}, mid[:]...)
+}
+
+// String returns the MessageID as a base 64 encoded string. Adheres to the
+// fmt.Stringer interface.
+func (mid MessageID) String() string {
+	return base64.RawURLEncoding.EncodeToString(mid[:])
+}
@@ -0,0 +1,185 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/utils"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size constants.
+const (
+	fileNameLenSize = 1
+	fileHashSize    = sha256.Size
+	fileMinSize     = fileNameLenSize + fileHashSize
+)
+
+// Error messages.
+const (
+	// ReadAttachment
+	errReadAttachment = "failed to read file %q: %+v"
+	errAttachmentSize = "file of size %d cannot exceed %d"
+
+	// NewAttachment
+	errFileNameLen = "length of file name %q cannot exceed %d"
+	errFileName    = "invalid file name %q"
+
+	// UnmarshalAttachment
+	errAttachmentLen  = "attachment of size %d shorter than minimum size %d"
+	errAttachmentHash = "hash of file %q does not match its contents"
+
+	// Attachment.Save
+	errSaveAttachment = "failed to save file to %q: %+v"
+)
+
+/*
++----------------------------------------------------------+
+|                    Attachment Payload                    |
++-------------+-------------------+----------+-------------+
+| fileNameLen |     fileName      |   hash   |    data     |
+|   1 byte    | fileNameLen bytes | 32 bytes |  remaining  |
++-------------+-------------------+----------+-------------+
+
+The hash is the SHA-256 hash of the data. Attachments are sent with the File tag
+and are split into fragments when larger than a single message.
+*/
+
+// Attachment is a file shared in a channel.
+type Attachment struct {
+	// Name is the base name of the file.
+	Name string
+
+	// Data is the contents of the file.
+	Data []byte
+
+	// Hash is the SHA-256 hash of the data.
+	Hash [fileHashSize]byte
+}
+
+// MaxAttachmentSize returns the maximum size of a file with the given name that
+// can be sent with a BroadcastFn that accepts messages up to maxPayloadSize.
+func MaxAttachmentSize(maxPayloadSize int, name string) int {
+	return maxPayloadSize - (fileMinSize + len(filepath.Base(name)))
+}
+
+// ReadAttachment reads the file at the path into an Attachment. Returns an
+// error if the encoded attachment would be larger than maxPayloadSize.
+func ReadAttachment(path string, maxPayloadSize int) (Attachment, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return Attachment{}, errors.Errorf(errReadAttachment, path, err)
+	}
+
+	if maxSize := MaxAttachmentSize(maxPayloadSize, path); len(data) > maxSize {
+		return Attachment{}, errors.Errorf(errAttachmentSize, len(data), maxSize)
+	}
+
+	return NewAttachment(filepath.Base(path), data)
+}
+
+// NewAttachment returns an Attachment containing the file data.
+func NewAttachment(name string, data []byte) (Attachment, error) {
+	if len(name) > math.MaxUint8 {
+		return Attachment{}, errors.Errorf(errFileNameLen, name, math.MaxUint8)
+	} else if !validFileName(name) {
+		return Attachment{}, errors.Errorf(errFileName, name)
+	}
+
+	return Attachment{
+		Name: name,
+		Data: data,
+		Hash: sha256.Sum256(data),
+	}, nil
+}
+
+// Marshal encodes the Attachment into a payload that can be sent with the File
+// tag.
+func (a Attachment) Marshal() []byte {
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(fileMinSize + len(a.Name) + len(a.Data))
+
+	buff.WriteByte(uint8(len(a.Name)))
+	buff.WriteString(a.Name)
+	buff.Write(a.Hash[:])
+	buff.Write(a.Data)
+
+	return buff.Bytes()
+}
+
+// UnmarshalAttachment decodes the payload of a message with the File tag into
+// an Attachment. Returns an error if the name is not a plain file name or the
+// hash does not match the data.
+func UnmarshalAttachment(payload []byte) (Attachment, error) {
+	if len(payload) < fileMinSize {
+		return Attachment{}, errors.Errorf(
+			errAttachmentLen, len(payload), fileMinSize)
+	}
+
+	buff := bytes.NewBuffer(payload)
+	nameLen := int(buff.Next(fileNameLenSize)[0])
+	if buff.Len() < nameLen+fileHashSize {
+		return Attachment{}, errors.Errorf(
+			errAttachmentLen, len(payload), fileMinSize+nameLen)
+	}
+
+	var a Attachment
+	a.Name = string(buff.Next(nameLen))
+	copy(a.Hash[:], buff.Next(fileHashSize))
+	a.Data = buff.Bytes()
+
+	if !validFileName(a.Name) {
+		return Attachment{}, errors.Errorf(errFileName, a.Name)
+	}
+
+	if sha256.Sum256(a.Data) != a.Hash {
+		return Attachment{}, errors.Errorf(errAttachmentHash, a.Name)
+	}
+
+	return a, nil
+}
+
+// Save writes the file to the path. If no path is supplied, the file is saved
+// under its name in the current directory. Existing files are never
+// overwritten. Returns the path the file was saved to.
+func (a Attachment) Save(path string) (string, error) {
+	if path == "" {
+		path = a.Name
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", errors.Errorf(errSaveAttachment, path, err)
+	}
+
+	if _, err = f.Write(a.Data); err != nil {
+		_ = f.Close()
+		return "", errors.Errorf(errSaveAttachment, path, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return "", errors.Errorf(errSaveAttachment, path, err)
+	}
+
+	jww.INFO.Printf("Saved attachment %q to file %q.", a.Name, path)
+
+	return path, nil
+}
+
+// validFileName determines if the name is a plain file name that cannot refer
+// to a different directory when saved.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,97 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that an Attachment marshalled with Attachment.Marshal can be decoded
+// with UnmarshalAttachment.
+func TestAttachment_Marshal_UnmarshalAttachment(t *testing.T) {
+	a, err := NewAttachment("log.txt", []byte("This is my log file."))
+	if err != nil {
+		t.Fatalf("Failed to create new attachment: %+v", err)
+	}
+
+	received, err := UnmarshalAttachment(a.Marshal())
+	if err != nil {
+		t.Fatalf("Failed to unmarshal attachment: %+v", err)
+	}
+
+	if !reflect.DeepEqual(a, received) {
+		t.Errorf("Unmarshalled attachment does not match expected."+
+			"\nexpected: %+v\nreceived: %+v", a, received)
+	}
+}
+
+// Error path: Tests that UnmarshalAttachment returns an error when the data
+// does not match the hash.
+func TestUnmarshalAttachment_HashMismatch(t *testing.T) {
+	a, err := NewAttachment("log.txt", []byte("This is my log file."))
+	if err != nil {
+		t.Fatalf("Failed to create new attachment: %+v", err)
+	}
+
+	payload := a.Marshal()
+	payload[len(payload)-1]++
+
+	_, err = UnmarshalAttachment(payload)
+	if err == nil {
+		t.Errorf("Did not receive error for modified data.")
+	}
+}
+
+// Error path: Tests that UnmarshalAttachment returns an error for names that
+// are not plain file names and for truncated payloads.
+func TestUnmarshalAttachment_Invalid(t *testing.T) {
+	for _, name := range []string{"../log.txt", "dir/log.txt", "..", ""} {
+		a := Attachment{Name: name}
+		if _, err := UnmarshalAttachment(a.Marshal()); err == nil {
+			t.Errorf("Did not receive error for name %q.", name)
+		}
+	}
+
+	a, _ := NewAttachment("log.txt", nil)
+	payload := a.Marshal()
+	if _, err := UnmarshalAttachment(payload[:len(payload)-1]); err == nil {
+		t.Errorf("Did not receive error for truncated payload.")
+	}
+}
+
+// Tests that Attachment.Save writes the file and does not overwrite existing
+// files.
+func TestAttachment_Save(t *testing.T) {
+	data := []byte("This is my log file.")
+	a, err := NewAttachment("log.txt", data)
+	if err != nil {
+		t.Fatalf("Failed to create new attachment: %+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), a.Name)
+	if _, err = a.Save(path); err != nil {
+		t.Fatalf("Failed to save attachment: %+v", err)
+	}
+
+	received, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved file: %+v", err)
+	}
+	if !bytes.Equal(data, received) {
+		t.Errorf("Saved file does not match expected."+
+			"\nexpected: %q\nreceived: %q", data, received)
+	}
+
+	if _, err = a.Save(path); err == nil {
+		t.Errorf("Did not receive error when overwriting existing file.")
+	}
+}
@@ -0,0 +1,291 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"math"
+	"sync"
+	"time"
+)
+
+// Size constants.
+const (
+	fragmentIDSize     = 8
+	fragmentIndexSize  = 2
+	fragmentTotalSize  = 2
+	fragmentHeaderSize = fragmentIDSize + fragmentIndexSize + fragmentTotalSize
+
+	// MaxFragments is the maximum number of fragments a single message can be
+	// split into.
+	MaxFragments = 64
+)
+
+const (
+	// fragmentTimeout is how long the fragments of a message are kept waiting
+	// for the rest to arrive before the message is dropped.
+	fragmentTimeout = 2 * time.Minute
+
+	// maxPartialMessages is the maximum number of incomplete messages that are
+	// kept at once. Fragments of new messages are dropped past this limit.
+	maxPartialMessages = 256
+
+	// maxExtensionsSize is the room reserved for the extensions of a message
+	// when calculating the maximum size of a fragmented payload.
+	maxExtensionsSize = 512
+)
+
+// Error messages.
+const (
+	// encodeMessage
+	errFragmentSize  = "max size of payload (%d) too small to fit a fragment"
+	errFragmentCount = "message requires %d fragments; cannot exceed %d"
+	errMessageID     = "failed to generate message ID: %+v"
+	errNewFragment   = "failed to create fragment %d of %d: %+v"
+
+	// unmarshalFragment
+	errFragmentLen   = "fragment of size %d shorter than header size %d"
+	errFragmentIndex = "fragment index %d out of range of total %d"
+	errFragmentMax   = "fragment total %d not in range [1, %d]"
+
+	// reassembler.add
+	errFragmentTotal = "fragment total %d does not match %d of earlier fragments"
+)
+
+/*
++-----------------------------------------------------------+
+|                     Fragment Payload                      |
++-----------+---------+---------+---------------------------+
+| messageID |  index  |  total  |           chunk           |
+|  8 bytes  | 2 bytes | 2 bytes |      remaining bytes      |
++-----------+---------+---------+---------------------------+
+
+The chunks of every fragment of a message, in order of their index, make up the
+encoded message. Each fragment is sent as the payload of a broadcast message
+with the Fragment tag and the timestamp and username of the original message.
+*/
+
+// MaxFragmentedPayloadSize returns the maximum size of a payload that can be
+// split into fragments for the given max payload size of a single message and
+// username. Room is reserved for up to maxExtensionsSize bytes of extensions.
+func MaxFragmentedPayloadSize(maxPayloadSize int, username string) int {
+	maxMessageSize := MaxMessagePayloadSize(maxPayloadSize, username)
+	chunkSize := maxMessageSize - fragmentHeaderSize
+	if chunkSize <= 0 {
+		return maxMessageSize
+	}
+	return chunkSize*MaxFragments -
+		(minSizeV1 + len(username) + maxExtensionsSize)
+}
+
+// encodeMessage generates the messages to broadcast for the payload. If the
+// message fits in a single broadcast, then only one is returned. Otherwise, the
+// encoded message is split into fragments that share a random message ID.
+func encodeMessage(maxPayloadSize int, tag Tag, timestamp time.Time,
+	username string, payload []byte, extensions ...Extension) ([][]byte, error) {
+	data, err := NewMessage(
+		math.MaxInt, tag, timestamp, username, payload, extensions...)
+	if err != nil {
+		return nil, err
+	} else if len(data) <= maxPayloadSize {
+		return [][]byte{data}, nil
+	}
+
+	chunkSize := MaxMessagePayloadSize(maxPayloadSize, username) -
+		fragmentHeaderSize
+	if chunkSize <= 0 {
+		return nil, errors.Errorf(errFragmentSize, maxPayloadSize)
+	}
+
+	total := (len(data) + chunkSize - 1) / chunkSize
+	if total > MaxFragments {
+		return nil, errors.Errorf(errFragmentCount, total, MaxFragments)
+	}
+
+	messageID := make([]byte, fragmentIDSize)
+	if _, err = rand.Read(messageID); err != nil {
+		return nil, errors.Errorf(errMessageID, err)
+	}
+
+	messages := make([][]byte, total)
+	for i := range messages {
+		chunk := data[i*chunkSize:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+
+		fragment := newFragment(messageID, uint16(i), uint16(total), chunk)
+		message, err := NewMessage(
+			maxPayloadSize, Fragment, timestamp, username, fragment)
+		if err != nil {
+			return nil, errors.Errorf(errNewFragment, i+1, total, err)
+		}
+		messages[i] = message
+	}
+
+	return messages, nil
+}
+
+// newFragment generates a fragment payload containing the chunk.
+func newFragment(messageID []byte, index, total uint16, chunk []byte) []byte {
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(fragmentHeaderSize + len(chunk))
+
+	buff.Write(messageID)
+
+	b := make([]byte, fragmentIndexSize)
+	binary.LittleEndian.PutUint16(b, index)
+	buff.Write(b)
+
+	b = make([]byte, fragmentTotalSize)
+	binary.LittleEndian.PutUint16(b, total)
+	buff.Write(b)
+
+	buff.Write(chunk)
+
+	return buff.Bytes()
+}
+
+// unmarshalFragment decodes the fragment payload into its header and chunk.
+func unmarshalFragment(data []byte) (
+	messageID uint64, index, total uint16, chunk []byte, err error) {
+	if len(data) < fragmentHeaderSize {
+		return 0, 0, 0, nil,
+			errors.Errorf(errFragmentLen, len(data), fragmentHeaderSize)
+	}
+
+	buff := bytes.NewBuffer(data)
+	messageID = binary.LittleEndian.Uint64(buff.Next(fragmentIDSize))
+	index = binary.LittleEndian.Uint16(buff.Next(fragmentIndexSize))
+	total = binary.LittleEndian.Uint16(buff.Next(fragmentTotalSize))
+	chunk = buff.Bytes()
+
+	// The total is checked before the reassembler allocates room for that many
+	// chunks
+	if total == 0 || total > MaxFragments {
+		return 0, 0, 0, nil, errors.Errorf(errFragmentMax, total, MaxFragments)
+	} else if index >= total {
+		return 0, 0, 0, nil, errors.Errorf(errFragmentIndex, index, total)
+	}
+
+	return messageID, index, total, chunk, nil
+}
+
+// fragmentKey uniquely identifies the fragments of a single message.
+type fragmentKey struct {
+	username  string
+	timestamp int64
+	messageID uint64
+}
+
+// partialMessage contains the fragments of a message received so far.
+type partialMessage struct {
+	chunks    [][]byte
+	received  int
+	firstSeen time.Time
+}
+
+// reassembler collects received fragments and rebuilds the messages they were
+// split from. Incomplete messages are dropped after the timeout.
+type reassembler struct {
+	partials map[fragmentKey]*partialMessage
+
+	// completed contains the time each message was reassembled so that
+	// duplicate fragments received afterwards are ignored until the timeout.
+	completed map[fragmentKey]time.Time
+
+	timeout time.Duration
+	mux     sync.Mutex
+}
+
+// newReassembler returns a new reassembler that drops incomplete messages after
+// the timeout.
+func newReassembler(timeout time.Duration) *reassembler {
+	return &reassembler{
+		partials:  make(map[fragmentKey]*partialMessage),
+		completed: make(map[fragmentKey]time.Time),
+		timeout:   timeout,
+	}
+}
+
+// add stores the fragment received at the given time. If it completes its
+// message, then the encoded message is returned and complete is true.
+// Duplicate fragments are ignored.
+func (ra *reassembler) add(username string, timestamp time.Time,
+	fragment []byte, now time.Time) (data []byte, complete bool, err error) {
+	messageID, index, total, chunk, err := unmarshalFragment(fragment)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ra.mux.Lock()
+	defer ra.mux.Unlock()
+
+	ra.expire(now)
+
+	key := fragmentKey{username, timestamp.UnixNano(), messageID}
+	if _, exists := ra.completed[key]; exists {
+		return nil, false, nil
+	}
+
+	pm, exists := ra.partials[key]
+	if !exists {
+		if len(ra.partials) >= maxPartialMessages {
+			jww.WARN.Printf("Dropped fragment %d/%d of message %d from %q: "+
+				"too many incomplete messages.",
+				index+1, total, messageID, username)
+			return nil, false, nil
+		}
+		pm = &partialMessage{
+			chunks:    make([][]byte, total),
+			firstSeen: now,
+		}
+		ra.partials[key] = pm
+	} else if len(pm.chunks) != int(total) {
+		return nil, false, errors.Errorf(errFragmentTotal, total, len(pm.chunks))
+	}
+
+	if pm.chunks[index] != nil {
+		return nil, false, nil
+	}
+	pm.chunks[index] = append([]byte{}, chunk...)
+	pm.received++
+
+	if pm.received < len(pm.chunks) {
+		return nil, false, nil
+	}
+
+	delete(ra.partials, key)
+	ra.completed[key] = now
+
+	return bytes.Join(pm.chunks, nil), true, nil
+}
+
+// expire drops every incomplete message that has been waiting longer than the
+// timeout and forgets completed messages older than the timeout. Must be called
+// while the lock is held.
+func (ra *reassembler) expire(now time.Time) {
+	for key, completedAt := range ra.completed {
+		if now.Sub(completedAt) > ra.timeout {
+			delete(ra.completed, key)
+		}
+	}
+
+	for key, pm := range ra.partials {
+		if now.Sub(pm.firstSeen) > ra.timeout {
+			jww.WARN.Printf("Dropped message %d from %q: received %d of %d "+
+				"fragments before timing out after %s.", key.messageID,
+				key.username, pm.received, len(pm.chunks), ra.timeout)
+			delete(ra.partials, key)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"gitlab.com/xx_network/primitives/netTime"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that a payload too large for a single message is split into fragments
+// by encodeMessage that are reassembled by reassembler.add, regardless of the
+// order they are received in.
+func Test_encodeMessage_reassembler_add(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	maxPayloadSize := 128
+	tag := Admin
+	timestamp := netTime.Now()
+	username := "myUsername"
+	payload := make([]byte, 1000)
+	prng.Read(payload)
+
+	extensions := Extensions{NewContentTypeExtension("text/plain")}
+
+	messages, err := encodeMessage(
+		maxPayloadSize, tag, timestamp, username, payload, extensions...)
+	if err != nil {
+		t.Fatalf("Failed to encode message: %+v", err)
+	}
+
+	if len(messages) < 2 {
+		t.Fatalf("Expected message to be split into fragments. Got %d.",
+			len(messages))
+	}
+
+	prng.Shuffle(len(messages), func(i, j int) {
+		messages[i], messages[j] = messages[j], messages[i]
+	})
+
+	ra := newReassembler(fragmentTimeout)
+	for i, message := range messages {
+		if len(message) > maxPayloadSize {
+			t.Errorf("Fragment %d of size %d larger than max %d.",
+				i, len(message), maxPayloadSize)
+		}
+
+		m, err := UnmarshalMessage(message)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal fragment %d: %+v", i, err)
+		}
+		if m.Tag != Fragment {
+			t.Errorf("Fragment %d has incorrect tag."+
+				"\nexpected: %s\nreceived: %s", i, Fragment, m.Tag)
+		}
+
+		// Duplicates must be ignored
+		for j := 0; j < 2; j++ {
+			data, complete, err :=
+				ra.add(m.Username, m.Timestamp, m.Payload, netTime.Now())
+			if err != nil {
+				t.Fatalf("Failed to add fragment %d: %+v", i, err)
+			}
+
+			if i < len(messages)-1 || j > 0 {
+				if complete {
+					t.Errorf("Message complete after fragment %d (%d).", i, j)
+				}
+				continue
+			}
+
+			if !complete {
+				t.Fatalf("Message not complete after last fragment.")
+			}
+
+			reassembled, err := UnmarshalMessage(data)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal reassembled message: %+v", err)
+			}
+			if reassembled.Tag != tag {
+				t.Errorf("Reassembled tag does not match expected."+
+					"\nexpected: %s\nreceived: %s", tag, reassembled.Tag)
+			}
+			if !bytes.Equal(payload, reassembled.Payload) {
+				t.Errorf("Reassembled payload does not match expected."+
+					"\nexpected: %v\nreceived: %v", payload, reassembled.Payload)
+			}
+			if !reflect.DeepEqual(extensions, reassembled.Extensions) {
+				t.Errorf("Reassembled extensions do not match expected."+
+					"\nexpected: %v\nreceived: %v",
+					extensions, reassembled.Extensions)
+			}
+		}
+	}
+
+	if len(ra.partials) != 0 {
+		t.Errorf("Reassembled message not removed: %+v", ra.partials)
+	}
+}
+
+// Tests that encodeMessage returns a single unfragmented message when the
+// payload fits.
+func Test_encodeMessage_Single(t *testing.T) {
+	tag := Default
+	timestamp := netTime.Now()
+	username := "myUsername"
+	payload := []byte("This is my payload.")
+
+	messages, err := encodeMessage(1024, tag, timestamp, username, payload)
+	if err != nil {
+		t.Fatalf("Failed to encode message: %+v", err)
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message. Got %d.", len(messages))
+	}
+
+	m, err := UnmarshalMessage(messages[0])
+	if err != nil {
+		t.Fatalf("Failed to unmarshal message: %+v", err)
+	}
+	if m.Tag != tag || !bytes.Equal(payload, m.Payload) {
+		t.Errorf("Unexpected message.\nexpected: %s %q\nreceived: %s %q",
+			tag, payload, m.Tag, m.Payload)
+	}
+}
+
+// Error path: Tests that encodeMessage returns an error when the payload needs
+// more than MaxFragments fragments.
+func Test_encodeMessage_TooLarge(t *testing.T) {
+	maxPayloadSize := 128
+	username := "myUsername"
+	max := MaxFragmentedPayloadSize(maxPayloadSize, username)
+
+	// A payload of the max size must fit with the reserved extensions
+	ext := Extension{ContentTypeExt, make([]byte, maxExtensionsSize-extHeaderSize)}
+	_, err := encodeMessage(maxPayloadSize, Default, netTime.Now(), username,
+		make([]byte, max), ext)
+	if err != nil {
+		t.Errorf("Failed to encode message of max size %d: %+v", max, err)
+	}
+
+	chunkSize := MaxMessagePayloadSize(maxPayloadSize, username) -
+		fragmentHeaderSize
+	_, err = encodeMessage(maxPayloadSize, Default, netTime.Now(), username,
+		make([]byte, chunkSize*MaxFragments))
+	if err == nil {
+		t.Errorf("Did not receive error for message larger than %d fragments.",
+			MaxFragments)
+	}
+}
+
+// Tests that reassembler.add drops incomplete messages once the timeout has
+// elapsed.
+func Test_reassembler_add_Timeout(t *testing.T) {
+	timestamp := netTime.Now()
+	username := "myUsername"
+	messages, err := encodeMessage(
+		128, Default, timestamp, username, make([]byte, 500))
+	if err != nil {
+		t.Fatalf("Failed to encode message: %+v", err)
+	}
+
+	ra := newReassembler(time.Minute)
+	now := netTime.Now()
+	for _, message := range messages[:len(messages)-1] {
+		m, _ := UnmarshalMessage(message)
+		if _, _, err = ra.add(username, timestamp, m.Payload, now); err != nil {
+			t.Fatalf("Failed to add fragment: %+v", err)
+		}
+	}
+
+	// Add the last fragment after the timeout
+	m, _ := UnmarshalMessage(messages[len(messages)-1])
+	_, complete, err :=
+		ra.add(username, timestamp, m.Payload, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to add fragment: %+v", err)
+	}
+
+	if complete {
+		t.Errorf("Message completed after earlier fragments timed out.")
+	}
+}
+
+// Error path: Tests that unmarshalFragment returns an error for fragments that
+// are too short, have an index out of range, or have a total of zero or more
+// than MaxFragments.
+func Test_unmarshalFragment_Error(t *testing.T) {
+	if _, _, _, _, err := unmarshalFragment([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Did not receive error for short fragment.")
+	}
+
+	fragment := newFragment(make([]byte, fragmentIDSize), 5, 5, []byte{1})
+	if _, _, _, _, err := unmarshalFragment(fragment); err == nil {
+		t.Errorf("Did not receive error for index out of range.")
+	}
+
+	for _, total := range []uint16{0, MaxFragments + 1, 65535} {
+		fragment = newFragment(make([]byte, fragmentIDSize), 0, total, []byte{1})
+		if _, _, _, _, err := unmarshalFragment(fragment); err == nil {
+			t.Errorf("Did not receive error for total %d.", total)
+		}
+	}
+}
+
+// Error path: Tests that reassembler.add rejects a fragment with an oversized
+// total without keeping a partial message for it.
+func Test_reassembler_add_OversizedTotal(t *testing.T) {
+	ra := newReassembler(fragmentTimeout)
+	fragment := newFragment(make([]byte, fragmentIDSize), 0, 65535, []byte{1})
+
+	_, complete, err := ra.add("alice", time.Unix(0, 1), fragment, time.Now())
+	if err == nil || complete {
+		t.Errorf("Did not receive error for oversized total (complete: %t).",
+			complete)
+	}
+	if len(ra.partials) != 0 {
+		t.Errorf("Kept %d partial messages for oversized total.",
+			len(ra.partials))
+	}
+}
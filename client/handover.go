@@ -0,0 +1,540 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	goCrypto "crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/client/broadcast"
+	"gitlab.com/elixxir/client/cmix/identity/receptionID"
+	"gitlab.com/elixxir/client/cmix/message"
+	"gitlab.com/elixxir/client/cmix/rounds"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"sync"
+	"time"
+)
+
+// Size constants.
+const (
+	handoverTimestampSize = 8
+	handoverKeyLenSize    = 2
+	handoverMinSize       = handoverTimestampSize + handoverKeyLenSize
+)
+
+// Storage keys.
+const handoversKeyPrefix = "handovers/"
+
+// Error messages.
+const (
+	// NewKeyHandover
+	errHandoverSameKey = "successor key is the key it replaces"
+	errHandoverSign    = "failed to sign handover: %+v"
+
+	// KeyHandover.Verify
+	errHandoverNotSigned = "handover is not signed"
+	errHandoverNoKey     = "no RSA public key to verify the handover with"
+	errHandoverKeySize   = "successor key of %d bytes does not match the " +
+		"%d bytes of the key it replaces"
+	errHandoverSignature = "handover signature is invalid: %+v"
+
+	// UnmarshalKeyHandover
+	errHandoverLen    = "handover of size %d shorter than minimum size %d"
+	errHandoverKeyLen = "handover successor key of size %d longer than " +
+		"remaining %d bytes"
+	errHandoverKey = "failed to load handover successor key: %+v"
+
+	// VerifyHandovers
+	errHandoverChain = "handover %d is invalid: %+v"
+
+	// Handovers.Merge
+	errHandoverFork = "handover %d conflicts with the handover to key %s " +
+		"already received"
+
+	// Handovers.receive
+	errHandoverNotAsymmetric = "handover is not sent by the channel admin"
+
+	// Handovers.save
+	errSaveHandovers = "failed to save handovers for channel %s: %+v"
+
+	// Handovers.getChain
+	errLoadHandovers = "failed to load handovers for channel %s: %+v"
+)
+
+/*
++-----------------------------------------------------------------+
+|                      Key Handover Payload                       |
++-----------+----------+-------------------------+----------------+
+| issuedAt  |  keyLen  |      successor key      |   signature    |
+|  8 bytes  | 2 bytes  |     keyLen bytes        |   remaining    |
++-----------+----------+-------------------------+----------------+
+
+The timestamp is in Unix nanoseconds. The successor key is the PEM of the RSA
+public key that replaces the channel's current key. The signature is an RSA-PSS
+signature, made with the private key of the key being replaced, of the SHA-256
+hash of the channel ID followed by the PEM of the key being replaced and the
+payload preceding the signature.
+
+Handovers are sent asymmetrically with the Handover tag using the key being
+replaced. The chain of handovers starts at the RSA public key in the channel
+file, which the channel's reception ID is derived from, so that every key in it
+can be verified by members who only have the channel file. Updated channel files
+carry the chain so that members who join later, or missed the announcement,
+learn the current key.
+*/
+
+// KeyHandover is a statement signed with a channel's current RSA private key
+// that hands the channel over to a successor key. Once it is received,
+// asymmetric messages are only accepted from the successor key.
+type KeyHandover struct {
+	// Successor is the RSA public key that replaces the channel's current key.
+	Successor *rsa.PublicKey
+
+	// IssuedAt is when the handover was made.
+	IssuedAt time.Time
+
+	// Signature is the signature of the handover by the key it replaces.
+	Signature []byte
+}
+
+// NewKeyHandover returns a KeyHandover of the channel to the successor key
+// signed with the channel's current RSA private key. The successor key must be
+// the same size as the current key, since asymmetric messages are split into
+// parts sized by the key in the channel file.
+func NewKeyHandover(channelID *id.ID, current *rsa.PrivateKey,
+	successor *rsa.PublicKey, issuedAt time.Time,
+	rng io.Reader) (KeyHandover, error) {
+	if EqualRsaPublicKeys(current.GetPublic(), successor) {
+		return KeyHandover{}, errors.New(errHandoverSameKey)
+	} else if successor.Size() != current.GetPublic().Size() {
+		return KeyHandover{}, errors.Errorf(errHandoverKeySize,
+			successor.Size(), current.GetPublic().Size())
+	}
+
+	// The timestamp is truncated to its encoded precision so that an
+	// unmarshalled handover is equal to the original
+	h := KeyHandover{
+		Successor: successor,
+		IssuedAt:  time.Unix(0, issuedAt.UnixNano()),
+	}
+
+	hashed := sha256.Sum256(h.signedData(channelID, current.GetPublic()))
+	signature, err := rsa.Sign(rng, current, goCrypto.SHA256, hashed[:], nil)
+	if err != nil {
+		return KeyHandover{}, errors.Errorf(errHandoverSign, err)
+	}
+	h.Signature = signature
+
+	return h, nil
+}
+
+// Verify checks that the handover is signed with the private key of the
+// channel's current RSA public key and that the successor key is the same size.
+func (h KeyHandover) Verify(channelID *id.ID, current *rsa.PublicKey) error {
+	if len(h.Signature) == 0 {
+		return errors.New(errHandoverNotSigned)
+	} else if current == nil {
+		return errors.New(errHandoverNoKey)
+	} else if h.Successor.Size() != current.Size() {
+		return errors.Errorf(
+			errHandoverKeySize, h.Successor.Size(), current.Size())
+	}
+
+	hashed := sha256.Sum256(h.signedData(channelID, current))
+	err := rsa.Verify(current, goCrypto.SHA256, hashed[:], h.Signature, nil)
+	if err != nil {
+		return errors.Errorf(errHandoverSignature, err)
+	}
+
+	return nil
+}
+
+// Marshal encodes the KeyHandover into a payload that can be sent with the
+// Handover tag or saved in a channel file.
+func (h KeyHandover) Marshal() []byte {
+	return append(h.marshalUnsigned(), h.Signature...)
+}
+
+// UnmarshalKeyHandover decodes the payload of a message with the Handover tag
+// into a KeyHandover. The signature is not verified.
+func UnmarshalKeyHandover(payload []byte) (KeyHandover, error) {
+	if len(payload) < handoverMinSize {
+		return KeyHandover{}, errors.Errorf(
+			errHandoverLen, len(payload), handoverMinSize)
+	}
+
+	buff := bytes.NewBuffer(payload)
+	issuedAt := time.Unix(0,
+		int64(binary.BigEndian.Uint64(buff.Next(handoverTimestampSize))))
+	keyLen := int(binary.BigEndian.Uint16(buff.Next(handoverKeyLenSize)))
+	if keyLen > buff.Len() {
+		return KeyHandover{}, errors.Errorf(
+			errHandoverKeyLen, keyLen, buff.Len())
+	}
+
+	successor, err := rsa.LoadPublicKeyFromPem(buff.Next(keyLen))
+	if err != nil {
+		return KeyHandover{}, errors.Errorf(errHandoverKey, err)
+	}
+
+	h := KeyHandover{Successor: successor, IssuedAt: issuedAt}
+	if buff.Len() > 0 {
+		h.Signature = append([]byte{}, buff.Bytes()...)
+	}
+
+	return h, nil
+}
+
+// marshalUnsigned encodes every field of the handover except the signature.
+func (h KeyHandover) marshalUnsigned() []byte {
+	key := rsa.CreatePublicKeyPem(h.Successor)
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(handoverMinSize + len(key) + len(h.Signature))
+
+	b := make([]byte, handoverTimestampSize)
+	binary.BigEndian.PutUint64(b, uint64(h.IssuedAt.UnixNano()))
+	buff.Write(b)
+	b = make([]byte, handoverKeyLenSize)
+	binary.BigEndian.PutUint16(b, uint16(len(key)))
+	buff.Write(b)
+	buff.Write(key)
+
+	return buff.Bytes()
+}
+
+// signedData returns the data signed for the handover. It is made up of the
+// channel ID and the PEM of the key being replaced followed by the encoded
+// handover without the signature.
+func (h KeyHandover) signedData(
+	channelID *id.ID, current *rsa.PublicKey) []byte {
+	data := append(channelID.Marshal(), rsa.CreatePublicKeyPem(current)...)
+	return append(data, h.marshalUnsigned()...)
+}
+
+// VerifyHandovers verifies that each handover in the chain is signed with the
+// key handed over by the one before it, starting with the RSA public key in the
+// channel file. Returns the channel's current key, which is the successor key
+// of the last handover.
+func VerifyHandovers(
+	channel *crypto.Channel, chain []KeyHandover) (*rsa.PublicKey, error) {
+	key := channel.RsaPubKey
+	for i, h := range chain {
+		if err := h.Verify(channel.ReceptionID, key); err != nil {
+			return nil, errors.Errorf(errHandoverChain, i, err)
+		}
+		key = h.Successor
+	}
+
+	return key, nil
+}
+
+// RsaFingerprint returns a short fingerprint of the RSA public key that can be
+// compared out of band. It is the base64 encoding of the first 8 bytes of the
+// SHA-256 hash of the key's PEM.
+func RsaFingerprint(pub *rsa.PublicKey) string {
+	h := sha256.Sum256(rsa.CreatePublicKeyPem(pub))
+	return base64.RawStdEncoding.EncodeToString(h[:8])
+}
+
+// EqualRsaPublicKeys determines if the two RSA public keys are the same.
+func EqualRsaPublicKeys(a, b *rsa.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.GetE() == b.GetE() && a.GetN().Cmp(b.GetN()) == 0
+}
+
+// channelHandovers are the handovers received in a channel.
+type channelHandovers struct {
+	// Handovers are the marshalled handovers in the order they were made.
+	Handovers [][]byte `json:"handovers,omitempty"`
+
+	// chain is the decoded handovers and key is the channel's current key.
+	chain []KeyHandover
+	key   *rsa.PublicKey
+}
+
+// Handovers contains the chain of handovers of the RSA key of each channel.
+// The chain is extended by Handover messages sent asymmetrically by the channel
+// admin and by the chains in updated channel files. It is persisted in a
+// key-value store.
+type Handovers struct {
+	kv ekv.KeyValue
+
+	// chains are the handovers of each channel that has been accessed.
+	chains map[id.ID]*channelHandovers
+
+	mux sync.Mutex
+}
+
+// NewHandovers returns Handovers stored in the key-value store. To encrypt
+// them, the store should be an ekv.Filestore opened with the session password.
+func NewHandovers(kv ekv.KeyValue) *Handovers {
+	return &Handovers{
+		kv:     kv,
+		chains: make(map[id.ID]*channelHandovers),
+	}
+}
+
+// Chain returns the handovers of the channel in the order they were made.
+func (ho *Handovers) Chain(channel *crypto.Channel) ([]KeyHandover, error) {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	handovers, err := ho.getChain(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]KeyHandover{}, handovers.chain...), nil
+}
+
+// Key returns the channel's current RSA public key. It is the successor key of
+// the last handover or, if there are none, the key in the channel file.
+func (ho *Handovers) Key(channel *crypto.Channel) *rsa.PublicKey {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	handovers, err := ho.getChain(channel)
+	if err != nil {
+		jww.ERROR.Printf("%+v", err)
+		return channel.RsaPubKey
+	}
+
+	return handovers.key
+}
+
+// Apply verifies that the handover is signed with the channel's current key
+// and adds it to the end of the chain. Returns false if the handover is
+// already in the chain.
+func (ho *Handovers) Apply(
+	channel *crypto.Channel, h KeyHandover) (bool, error) {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	handovers, err := ho.getChain(channel)
+	if err != nil {
+		return false, err
+	}
+
+	for _, applied := range handovers.chain {
+		if bytes.Equal(applied.Marshal(), h.Marshal()) {
+			return false, nil
+		}
+	}
+
+	if err = h.Verify(channel.ReceptionID, handovers.key); err != nil {
+		return false, err
+	}
+
+	handovers.Handovers = append(handovers.Handovers, h.Marshal())
+	handovers.chain = append(handovers.chain, h)
+	handovers.key = h.Successor
+
+	return true, ho.save(channel.ReceptionID, handovers)
+}
+
+// Merge adds the handovers of the chain, such as the one in an updated channel
+// file, that are not yet in the channel's chain. The chain must start at the
+// key in the channel file and agree with the handovers already received.
+// Returns the number of handovers added.
+func (ho *Handovers) Merge(
+	channel *crypto.Channel, chain []KeyHandover) (int, error) {
+	ho.mux.Lock()
+	handovers, err := ho.getChain(channel)
+	if err != nil {
+		ho.mux.Unlock()
+		return 0, err
+	}
+
+	n := len(handovers.chain)
+	for i := 0; i < n && i < len(chain); i++ {
+		if !bytes.Equal(chain[i].Marshal(), handovers.chain[i].Marshal()) {
+			ho.mux.Unlock()
+			return 0, errors.Errorf(errHandoverFork, i,
+				RsaFingerprint(handovers.chain[i].Successor))
+		}
+	}
+	ho.mux.Unlock()
+
+	var added int
+	for i := n; i < len(chain); i++ {
+		changed, err := ho.Apply(channel, chain[i])
+		if err != nil {
+			return added, errors.Errorf(errHandoverChain, i, err)
+		} else if changed {
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+// Filter returns a channel that receives every message sent on the given
+// channel. Handover messages are applied if they are sent asymmetrically and
+// signed with the channel's current key; otherwise, they are dropped. The
+// returned channel is closed when the given channel or done is closed.
+func (ho *Handovers) Filter(channel *crypto.Channel, in chan ReceivedBroadcast,
+	done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		if r.Tag == Handover {
+			if err := ho.receive(channel, r); err != nil {
+				jww.WARN.Printf("Dropped handover message from %q on "+
+					"channel %s: %+v", r.Username, channel.ReceptionID, err)
+				return r, false
+			}
+		}
+		return r, true
+	})
+}
+
+// receive verifies the Handover message received on the channel and applies
+// it.
+func (ho *Handovers) receive(
+	channel *crypto.Channel, r ReceivedBroadcast) error {
+	if !r.Asymmetric {
+		return errors.New(errHandoverNotAsymmetric)
+	}
+
+	h, err := UnmarshalKeyHandover(r.Message)
+	if err != nil {
+		return err
+	}
+
+	changed, err := ho.Apply(channel, h)
+	if err != nil {
+		return err
+	} else if changed {
+		jww.INFO.Printf("Channel %s handed over to key %s.",
+			channel.ReceptionID, RsaFingerprint(h.Successor))
+	}
+
+	return nil
+}
+
+// save saves the handovers of the channel to storage. Must be called while the
+// lock is held.
+func (ho *Handovers) save(
+	channelID *id.ID, handovers *channelHandovers) error {
+	err := ho.kv.SetInterface(handoversKey(channelID), handovers)
+	if err != nil {
+		return errors.Errorf(errSaveHandovers, channelID, err)
+	}
+	return nil
+}
+
+// getChain returns the handovers for the channel, loading and verifying them
+// from storage if they have not yet been accessed. Must be called while the
+// lock is held.
+func (ho *Handovers) getChain(
+	channel *crypto.Channel) (*channelHandovers, error) {
+	if handovers, exists := ho.chains[*channel.ReceptionID]; exists {
+		return handovers, nil
+	}
+
+	handovers := &channelHandovers{}
+	err := ho.kv.GetInterface(handoversKey(channel.ReceptionID), handovers)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadHandovers, channel.ReceptionID, err)
+	}
+
+	for _, payload := range handovers.Handovers {
+		h, err := UnmarshalKeyHandover(payload)
+		if err != nil {
+			return nil,
+				errors.Errorf(errLoadHandovers, channel.ReceptionID, err)
+		}
+		handovers.chain = append(handovers.chain, h)
+	}
+	handovers.key, err = VerifyHandovers(channel, handovers.chain)
+	if err != nil {
+		return nil, errors.Errorf(errLoadHandovers, channel.ReceptionID, err)
+	}
+
+	ho.chains[*channel.ReceptionID] = handovers
+	return handovers, nil
+}
+
+// handoversKey returns the storage key for the handovers of a channel.
+func handoversKey(channelID *id.ID) string {
+	return handoversKeyPrefix + channelID.String()
+}
+
+// asymmetricProcessor decrypts asymmetric broadcasts of a channel with its
+// current RSA public key so that, after a handover, messages are only accepted
+// from the successor key. It replaces the processor of the broadcast library,
+// which always uses the key in the channel file.
+type asymmetricProcessor struct {
+	channel crypto.Channel
+	key     func() *rsa.PublicKey
+	cb      broadcast.ListenerFunc
+}
+
+// Process decrypts the asymmetric broadcast with the channel's current key and
+// sends the result on the callback. Adheres to the message.Processor interface.
+func (p *asymmetricProcessor) Process(msg format.Message,
+	ephID receptionID.EphemeralIdentity, round rounds.Round) {
+	unsized, err := broadcast.DecodeSizedBroadcast(msg.GetContents())
+	if err != nil {
+		jww.WARN.Printf("Failed to decode sized asymmetric broadcast on "+
+			"round %d: %+v", round.ID, err)
+		return
+	}
+
+	// The label used to decrypt only depends on the channel name and
+	// description, so a copy of the channel with the current key is used
+	c := p.channel
+	c.RsaPubKey = p.key()
+	partSize := c.RsaPubKey.Size()
+
+	var payload []byte
+	for len(unsized) >= partSize {
+		decrypted, err := c.DecryptAsymmetric(unsized[:partSize])
+		if err != nil {
+			jww.WARN.Printf("Failed to decrypt asymmetric broadcast on "+
+				"round %d with key %s; it may be sent with a key that has "+
+				"been handed over: %+v", round.ID, RsaFingerprint(c.RsaPubKey),
+				err)
+			return
+		}
+		unsized = unsized[partSize:]
+		payload = append(payload, decrypted...)
+	}
+
+	go p.cb(payload, ephID, round)
+}
+
+// String returns a string identifying the asymmetricProcessor for debugging
+// purposes. Adheres to the message.Processor interface.
+func (p *asymmetricProcessor) String() string {
+	return "asymmetricBroadcastChannel-" + p.channel.Name
+}
+
+// asymmetricClient wraps the network client passed to the asymmetric
+// broadcast client so that the asymmetricProcessor is registered in place of
+// the library's processor.
+type asymmetricClient struct {
+	broadcast.Client
+	p *asymmetricProcessor
+}
+
+// AddService registers the asymmetricProcessor for the service. The processor
+// of the broadcast library is ignored.
+func (c *asymmetricClient) AddService(
+	clientID *id.ID, service message.Service, _ message.Processor) {
+	c.Client.AddService(clientID, service, c.p)
+}
@@ -0,0 +1,323 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"gitlab.com/elixxir/client/broadcast"
+	"gitlab.com/elixxir/client/cmix/identity/receptionID"
+	"gitlab.com/elixxir/client/cmix/rounds"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestChannel returns a channel with a 1024-bit RSA key, which is smaller
+// than the key of real channels to keep the tests fast, and its private key.
+func newTestChannel(t *testing.T) (*crypto.Channel, *rsa.PrivateKey) {
+	pk := newTestRsaKey(t)
+	salt := []byte("salt")
+	channelID, err := crypto.NewChannelID("name", "description", salt,
+		rsa.CreatePublicKeyPem(pk.GetPublic()))
+	if err != nil {
+		t.Fatalf("Failed to make channel ID: %+v", err)
+	}
+
+	return &crypto.Channel{
+		ReceptionID: channelID,
+		Name:        "name",
+		Description: "description",
+		Salt:        salt,
+		RsaPubKey:   pk.GetPublic(),
+	}, pk
+}
+
+// newTestRsaKey returns a new 1024-bit RSA private key.
+func newTestRsaKey(t *testing.T) *rsa.PrivateKey {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	return pk
+}
+
+// newTestHandover returns a KeyHandover of the channel from the current key
+// to the successor key.
+func newTestHandover(t *testing.T, channelID *id.ID, current *rsa.PrivateKey,
+	successor *rsa.PublicKey) KeyHandover {
+	h, err := NewKeyHandover(
+		channelID, current, successor, time.Now(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to create handover: %+v", err)
+	}
+	return h
+}
+
+// Tests that a KeyHandover marshalled and unmarshalled matches the original
+// and that its signature is verified with the key it replaces.
+func TestKeyHandover_Marshal_Verify(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor := newTestRsaKey(t)
+
+	h := newTestHandover(t, channel.ReceptionID, pk, successor.GetPublic())
+	received, err := UnmarshalKeyHandover(h.Marshal())
+	if err != nil {
+		t.Fatalf("Failed to unmarshal handover: %+v", err)
+	}
+	if !bytes.Equal(h.Marshal(), received.Marshal()) ||
+		!h.IssuedAt.Equal(received.IssuedAt) ||
+		!EqualRsaPublicKeys(h.Successor, received.Successor) {
+		t.Errorf("Unmarshalled handover does not match original."+
+			"\nexpected: %+v\nreceived: %+v", h, received)
+	}
+
+	if err = received.Verify(channel.ReceptionID, pk.GetPublic()); err != nil {
+		t.Errorf("Failed to verify handover: %+v", err)
+	}
+}
+
+// Error path: Tests that KeyHandover.Verify rejects handovers that are
+// unsigned, changed after signing, signed for another channel or with another
+// key, and that NewKeyHandover rejects successor keys of another size.
+func TestKeyHandover_Verify_Invalid(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor := newTestRsaKey(t)
+	other := newTestRsaKey(t)
+
+	h := newTestHandover(t, channel.ReceptionID, pk, successor.GetPublic())
+	unsigned := h
+	unsigned.Signature = nil
+	changed := h
+	changed.Successor = other.GetPublic()
+
+	for i, tt := range []struct {
+		h         KeyHandover
+		channelID *id.ID
+		current   *rsa.PublicKey
+	}{
+		{unsigned, channel.ReceptionID, pk.GetPublic()},
+		{changed, channel.ReceptionID, pk.GetPublic()},
+		{h, id.NewIdFromString("other", id.User, t), pk.GetPublic()},
+		{h, channel.ReceptionID, other.GetPublic()},
+		{h, channel.ReceptionID, successor.GetPublic()},
+		{h, channel.ReceptionID, nil},
+	} {
+		if err := tt.h.Verify(tt.channelID, tt.current); err == nil {
+			t.Errorf("Verified invalid handover (%d).", i)
+		}
+	}
+
+	larger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	for i, successor := range []*rsa.PublicKey{
+		larger.GetPublic(), pk.GetPublic()} {
+		_, err = NewKeyHandover(
+			channel.ReceptionID, pk, successor, time.Now(), rand.Reader)
+		if err == nil {
+			t.Errorf("Created handover to invalid successor key (%d).", i)
+		}
+	}
+}
+
+// Tests that Handovers.Apply only extends the chain with handovers signed with
+// the current key, that Handovers.Merge adds the rest of a chain and rejects
+// conflicting ones, and that the chain is loaded from storage.
+func TestHandovers_Apply_Merge(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	second, third, fork := newTestRsaKey(t), newTestRsaKey(t), newTestRsaKey(t)
+	kv := ekv.MakeMemstore()
+	ho := NewHandovers(kv)
+
+	first := newTestHandover(t, channel.ReceptionID, pk, second.GetPublic())
+	next := newTestHandover(t, channel.ReceptionID, second, third.GetPublic())
+	forked := newTestHandover(t, channel.ReceptionID, pk, fork.GetPublic())
+
+	if !EqualRsaPublicKeys(ho.Key(channel), channel.RsaPubKey) {
+		t.Errorf("Key without handovers is not the channel file's key.")
+	}
+	if _, err := ho.Apply(channel, next); err == nil {
+		t.Errorf("Applied handover not signed with the current key.")
+	}
+
+	changed, err := ho.Apply(channel, first)
+	if err != nil || !changed {
+		t.Fatalf("Failed to apply handover: %t %+v", changed, err)
+	}
+	if changed, err = ho.Apply(channel, first); err != nil || changed {
+		t.Errorf("Applied handover twice: %t %+v", changed, err)
+	}
+	if _, err = ho.Apply(channel, forked); err == nil {
+		t.Errorf("Applied handover signed with a replaced key.")
+	}
+
+	if _, err = ho.Merge(channel, []KeyHandover{forked, next}); err == nil {
+		t.Errorf("Merged conflicting chain.")
+	}
+	added, err := ho.Merge(channel, []KeyHandover{first, next})
+	if err != nil || added != 1 {
+		t.Fatalf("Failed to merge chain: %d %+v", added, err)
+	}
+	if !EqualRsaPublicKeys(ho.Key(channel), third.GetPublic()) {
+		t.Errorf("Key is not the successor of the last handover.")
+	}
+
+	// The chain is loaded from storage by new Handovers
+	chain, err := NewHandovers(kv).Chain(channel)
+	if err != nil {
+		t.Fatalf("Failed to load chain: %+v", err)
+	}
+	if len(chain) != 2 || !bytes.Equal(chain[0].Marshal(), first.Marshal()) ||
+		!bytes.Equal(chain[1].Marshal(), next.Marshal()) {
+		t.Errorf("Unexpected chain loaded: %+v", chain)
+	}
+}
+
+// Tests that Handovers.Filter applies handovers sent asymmetrically with the
+// current key and drops the rest.
+func TestHandovers_Filter(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor, other := newTestRsaKey(t), newTestRsaKey(t)
+	ho := NewHandovers(ekv.MakeMemstore())
+
+	h := newTestHandover(t, channel.ReceptionID, pk, successor.GetPublic())
+	forged :=
+		newTestHandover(t, channel.ReceptionID, other, successor.GetPublic())
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := ho.Filter(channel, in, nil)
+	in <- ReceivedBroadcast{Tag: Handover, Message: h.Marshal()}
+	in <- ReceivedBroadcast{
+		Tag: Handover, Message: forged.Marshal(), Asymmetric: true}
+	in <- ReceivedBroadcast{
+		Tag: Handover, Message: []byte("invalid"), Asymmetric: true}
+	in <- ReceivedBroadcast{
+		Tag: Handover, Message: h.Marshal(), Asymmetric: true}
+	in <- ReceivedBroadcast{Tag: Default, Message: []byte("hello")}
+	close(in)
+
+	var received []ReceivedBroadcast
+	for r := range out {
+		received = append(received, r)
+	}
+
+	if len(received) != 2 || received[0].Tag != Handover ||
+		received[1].Tag != Default {
+		t.Errorf("Unexpected messages received: %+v", received)
+	}
+	if !EqualRsaPublicKeys(ho.Key(channel), successor.GetPublic()) {
+		t.Errorf("Handover was not applied.")
+	}
+}
+
+// Tests that a channel file written with handovers is loaded with them and
+// that a file with an invalid chain is rejected.
+func TestWriteChannel_LoadChannelFile(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor, other := newTestRsaKey(t), newTestRsaKey(t)
+	h := newTestHandover(t, channel.ReceptionID, pk, successor.GetPublic())
+	path := filepath.Join(t.TempDir(), "channel.xxchan")
+
+	if err := WriteChannel(path, channel, h); err != nil {
+		t.Fatalf("Failed to write channel: %+v", err)
+	}
+	loaded, chain, err := LoadChannelFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load channel: %+v", err)
+	}
+	if !loaded.ReceptionID.Cmp(channel.ReceptionID) ||
+		!EqualRsaPublicKeys(loaded.RsaPubKey, channel.RsaPubKey) {
+		t.Errorf("Loaded channel does not match original."+
+			"\nexpected: %+v\nreceived: %+v", channel, loaded)
+	}
+	if len(chain) != 1 || !bytes.Equal(chain[0].Marshal(), h.Marshal()) {
+		t.Errorf("Unexpected chain loaded: %+v", chain)
+	}
+
+	// Files without handovers are the marshalled channel
+	if err = WriteChannel(path, channel); err != nil {
+		t.Fatalf("Failed to write channel: %+v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read channel file: %+v", err)
+	}
+	if _, err = crypto.UnmarshalChannel(data); err != nil {
+		t.Errorf("Channel file without handovers is not a channel: %+v", err)
+	}
+
+	forged :=
+		newTestHandover(t, channel.ReceptionID, other, successor.GetPublic())
+	if err = WriteChannel(path, channel, forged); err != nil {
+		t.Fatalf("Failed to write channel: %+v", err)
+	}
+	if _, _, err = LoadChannelFile(path); err == nil {
+		t.Errorf("Loaded channel file with an invalid handover.")
+	}
+}
+
+// Tests that the asymmetricProcessor decrypts broadcasts sent with the key it
+// returns as the current key and drops those sent with a replaced key.
+func TestAsymmetricProcessor_Process(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor := newTestRsaKey(t)
+
+	received := make(chan []byte, 1)
+	p := &asymmetricProcessor{
+		channel: *channel,
+		key:     successor.GetPublic,
+		cb: func(payload []byte, _ receptionID.EphemeralIdentity,
+			_ rounds.Round) {
+			received <- payload
+		},
+	}
+
+	message := func(key *rsa.PrivateKey) format.Message {
+		payload := make([]byte, channel.MaxAsymmetricPayloadSize())
+		copy(payload, "hello")
+		encrypted, _, _, err :=
+			channel.EncryptAsymmetric(payload, key, csprng.NewSystemRNG())
+		if err != nil {
+			t.Fatalf("Failed to encrypt payload: %+v", err)
+		}
+		msg := format.NewMessage(512)
+		sized, err := broadcast.NewSizedBroadcast(msg.ContentsSize(), encrypted)
+		if err != nil {
+			t.Fatalf("Failed to make sized broadcast: %+v", err)
+		}
+		msg.SetContents(sized)
+		return msg
+	}
+
+	p.Process(message(pk), receptionID.EphemeralIdentity{}, rounds.Round{})
+	p.Process(message(successor), receptionID.EphemeralIdentity{},
+		rounds.Round{})
+
+	select {
+	case payload := <-received:
+		if !bytes.HasPrefix(payload, []byte("hello")) {
+			t.Errorf("Unexpected payload: %q", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for payload.")
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("Received payload sent with a replaced key: %q", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,400 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Storage keys.
+const (
+	historyKeyPrefix = "channelHistory/"
+	historyCountKey  = "/count"
+	historyEntryKey  = "/entry/"
+)
+
+// Error messages.
+const (
+	// History.Add
+	errHistorySaveEntry = "failed to save history entry %d for channel %s: %+v"
+	errHistorySaveCount = "failed to save history count for channel %s: %+v"
+
+	// History.redact
+	errHistoryRedact = "failed to redact history entry %d for channel %s: %+v"
+
+	// History.Load
+	errHistoryLoadCount = "failed to load history count for channel %s: %+v"
+	errHistoryLoadEntry = "failed to load history entry %d for channel %s: %+v"
+)
+
+// History persists every message received on or sent to a channel in an
+// encrypted key-value store so that the scrollback survives restarts. Entries
+// are stored individually under the channel's reception ID along with a count
+// of the total entries so that appending does not require rewriting the
+// entire history. When an accepted Delete message is added, the stored
+// message it deletes and any edits of it are redacted.
+type History struct {
+	kv       ekv.KeyValue
+	channels map[id.ID]*channelHistory
+	mux      sync.Mutex
+}
+
+// channelHistory tracks the state of the history for a single channel.
+type channelHistory struct {
+	count uint64
+
+	// seen contains the digest of every stored message so that a sent message
+	// is not stored a second time when it is received back from the network.
+	seen map[[sha256.Size]byte]struct{}
+
+	// ids maps the ID of each stored message to its entry. When several
+	// messages have the same ID, only the first is kept, as in the channel
+	// feed.
+	ids map[MessageID]historyRef
+
+	// edits maps the ID of each stored message to the entries of the Edit
+	// messages that modify it.
+	edits map[MessageID][]uint64
+
+	// deleted contains the IDs of redacted messages so that they are not
+	// stored again if they are received a second time.
+	deleted map[MessageID]struct{}
+}
+
+// historyRef is the entry of a stored message and the message without its
+// contents, which is enough to check if a change may modify it.
+type historyRef struct {
+	entry uint64
+	r     ReceivedBroadcast
+}
+
+// NewHistory returns a new History that stores its entries in the given
+// key-value store. To encrypt the history, the store should be an
+// ekv.Filestore opened with the session password.
+func NewHistory(kv ekv.KeyValue) *History {
+	return &History{
+		kv:       kv,
+		channels: make(map[id.ID]*channelHistory),
+	}
+}
+
+// Add appends the message to the history of the channel. Messages that have
+// already been stored, deleted messages and their edits, and ephemeral messages
+// are ignored. If the message is a Delete message accepted by CanModify, the
+// message it deletes and its edits are redacted from storage.
+func (h *History) Add(channelID *id.ID, r ReceivedBroadcast) error {
+	if r.Tag.IsEphemeral() {
+		return nil
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	ch, err := h.getChannel(channelID)
+	if err != nil {
+		return err
+	}
+
+	digest := historyDigest(r)
+	if _, exists := ch.seen[digest]; exists {
+		return nil
+	} else if ch.isDeleted(r) {
+		return nil
+	}
+
+	if err = h.saveEntry(channelID, ch.count, r); err != nil {
+		return errors.Errorf(errHistorySaveEntry, ch.count, channelID, err)
+	}
+
+	count := make([]byte, 8)
+	binary.LittleEndian.PutUint64(count, ch.count+1)
+	err = h.kv.Set(historyKey(channelID)+historyCountKey, historyCount(count))
+	if err != nil {
+		return errors.Errorf(errHistorySaveCount, channelID, err)
+	}
+
+	ch.index(ch.count, r)
+	ch.count++
+	ch.seen[digest] = struct{}{}
+
+	if r.Tag == Delete {
+		return h.redact(channelID, ch, r)
+	}
+
+	return nil
+}
+
+// redact removes the message deleted by the Delete message, and the text of
+// the edits of it, from the stored entries if CanModify accepts the delete.
+// Must be called while the lock is held.
+func (h *History) redact(
+	channelID *id.ID, ch *channelHistory, r ReceivedBroadcast) error {
+	original, edits, exists := ch.delete(r)
+	if !exists {
+		return nil
+	}
+
+	for _, i := range append([]uint64{original.entry}, edits...) {
+		entry, err := h.loadEntry(channelID, i)
+		if err != nil {
+			return err
+		} else if i != original.entry && !CanModify(original.r, entry) {
+			continue
+		}
+		entry.Message = nil
+		if err = h.saveEntry(channelID, i, entry); err != nil {
+			return errors.Errorf(errHistoryRedact, i, channelID, err)
+		}
+	}
+
+	return nil
+}
+
+// Load returns all the messages stored for the channel in the order they were
+// added.
+func (h *History) Load(channelID *id.ID) ([]ReceivedBroadcast, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	ch, err := h.getChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.loadEntries(channelID, ch.count)
+}
+
+// Record returns a channel that receives every message sent on the given
+// channel after it has been added to the history. Errors saving a message are
+// logged and the message is still passed on. The returned channel is closed
+// when the given channel or done is closed.
+func (h *History) Record(channelID *id.ID, in chan ReceivedBroadcast,
+	done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		if err := h.Add(channelID, r); err != nil {
+			jww.ERROR.Printf(
+				"Failed to save received message to history: %+v", err)
+		}
+		return r, true
+	})
+}
+
+// RecordSent wraps the BroadcastFn so that every successfully sent message is
+// added to the history of the channel. Set asymmetric if the BroadcastFn sends
+// asymmetric messages. Messages that change the topic or pinned messages are
+// only recorded when they are received and applied, so that re-broadcasts are
+// not saved again.
+func (h *History) RecordSent(channelID *id.ID, username string,
+	asymmetric bool, fn BroadcastFn) BroadcastFn {
+	if fn == nil {
+		return nil
+	}
+
+	return func(tag Tag, timestamp time.Time, message []byte,
+		extensions ...Extension) error {
+		if err := fn(tag, timestamp, message, extensions...); err != nil {
+			return err
+		} else if tag.IsBulletin() {
+			return nil
+		}
+
+		r := ReceivedBroadcast{
+			Tag:          tag,
+			Timestamp:    timestamp,
+			Username:     username,
+			Message:      message,
+			Extensions:   extensions,
+			ReceivedTime: netTime.Now(),
+			Asymmetric:   asymmetric,
+		}
+		if _, err := VerifySignature(channelID, r); err == nil {
+			r.Verification = Verified
+		}
+
+		if err := h.Add(channelID, r); err != nil {
+			jww.ERROR.Printf(
+				"Failed to save sent message to history: %+v", err)
+		}
+
+		return nil
+	}
+}
+
+// getChannel returns the history state for the channel, loading it from
+// storage if it has not yet been accessed. Must be called while the lock is
+// held.
+func (h *History) getChannel(channelID *id.ID) (*channelHistory, error) {
+	if ch, exists := h.channels[*channelID]; exists {
+		return ch, nil
+	}
+
+	var count historyCount
+	err := h.kv.Get(historyKey(channelID)+historyCountKey, &count)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errHistoryLoadCount, channelID, err)
+	}
+
+	ch := &channelHistory{
+		seen:    make(map[[sha256.Size]byte]struct{}),
+		ids:     make(map[MessageID]historyRef),
+		edits:   make(map[MessageID][]uint64),
+		deleted: make(map[MessageID]struct{}),
+	}
+	if len(count) == 8 {
+		ch.count = binary.LittleEndian.Uint64(count)
+	}
+
+	entries, err := h.loadEntries(channelID, ch.count)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range entries {
+		ch.seen[historyDigest(r)] = struct{}{}
+		ch.index(uint64(i), r)
+		if r.Tag == Delete {
+			ch.delete(r)
+		}
+	}
+
+	h.channels[*channelID] = ch
+
+	return ch, nil
+}
+
+// index adds the message stored in the entry to the message ID and edit
+// indexes.
+func (ch *channelHistory) index(entry uint64, r ReceivedBroadcast) {
+	if r.Tag == Edit {
+		if mid, exists := r.Extensions.EditOf(); exists {
+			ch.edits[mid] = append(ch.edits[mid], entry)
+		}
+	} else if mid, exists := r.Extensions.MessageID(); exists {
+		if _, exists = ch.ids[mid]; !exists {
+			r.Message = nil
+			ch.ids[mid] = historyRef{entry, r}
+		}
+	}
+}
+
+// isDeleted returns true if the message, or the message it edits, has been
+// deleted.
+func (ch *channelHistory) isDeleted(r ReceivedBroadcast) bool {
+	mid, exists := r.Extensions.MessageID()
+	if r.Tag == Edit {
+		mid, exists = r.Extensions.EditOf()
+	}
+	_, deleted := ch.deleted[mid]
+	return exists && deleted
+}
+
+// delete marks the message deleted by the Delete message as deleted. Returns
+// the deleted message, the entries of its edits, and true, or false if the
+// message is not stored, has already been deleted, or CanModify rejects the
+// delete.
+func (ch *channelHistory) delete(
+	r ReceivedBroadcast) (historyRef, []uint64, bool) {
+	mid, exists := r.Extensions.EditOf()
+	if !exists {
+		return historyRef{}, nil, false
+	}
+
+	original, exists := ch.ids[mid]
+	if !exists {
+		return historyRef{}, nil, false
+	} else if _, deleted := ch.deleted[mid]; deleted {
+		return historyRef{}, nil, false
+	} else if !CanModify(original.r, r) {
+		return historyRef{}, nil, false
+	}
+
+	edits := ch.edits[mid]
+	ch.deleted[mid] = struct{}{}
+	delete(ch.edits, mid)
+
+	return original, edits, true
+}
+
+// saveEntry saves the message to the entry of the channel's history.
+func (h *History) saveEntry(
+	channelID *id.ID, entry uint64, r ReceivedBroadcast) error {
+	key := historyKey(channelID) + historyEntryKey +
+		strconv.FormatUint(entry, 10)
+	return h.kv.SetInterface(key, r)
+}
+
+// loadEntries loads the first n entries of the channel's history from storage.
+func (h *History) loadEntries(
+	channelID *id.ID, n uint64) ([]ReceivedBroadcast, error) {
+	entries := make([]ReceivedBroadcast, 0, n)
+	for i := uint64(0); i < n; i++ {
+		r, err := h.loadEntry(channelID, i)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, r)
+	}
+
+	return entries, nil
+}
+
+// loadEntry loads the entry of the channel's history from storage.
+func (h *History) loadEntry(
+	channelID *id.ID, entry uint64) (ReceivedBroadcast, error) {
+	var r ReceivedBroadcast
+	key := historyKey(channelID) + historyEntryKey +
+		strconv.FormatUint(entry, 10)
+	if err := h.kv.GetInterface(key, &r); err != nil {
+		return ReceivedBroadcast{},
+			errors.Errorf(errHistoryLoadEntry, entry, channelID, err)
+	}
+	return r, nil
+}
+
+// historyKey returns the storage key prefix for the channel.
+func historyKey(channelID *id.ID) string {
+	return historyKeyPrefix + channelID.String()
+}
+
+// historyDigest returns a digest that uniquely identifies the message
+// regardless of when it was received.
+func historyDigest(r ReceivedBroadcast) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte{byte(r.Tag)})
+	b := make([]byte, timestampSize)
+	binary.LittleEndian.PutUint64(b, uint64(r.Timestamp.UnixNano()))
+	h.Write(b)
+	h.Write([]byte{uint8(len(r.Username))})
+	h.Write([]byte(r.Username))
+	h.Write(r.Message)
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
+
+// historyCount is the serialised number of entries in a channel's history. It
+// adheres to the ekv.Marshaler and ekv.Unmarshaler interfaces.
+type historyCount []byte
+
+// Marshal returns the count bytes.
+func (c historyCount) Marshal() []byte { return c }
+
+// Unmarshal copies the data into the count.
+func (c *historyCount) Unmarshal(data []byte) error {
+	*c = append((*c)[:0], data...)
+	return nil
+}
@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that messages added with History.Add are returned in order by
+// History.Load and that a new History on the same store loads them.
+func TestHistory_AddLoad(t *testing.T) {
+	kv := ekv.MakeMemstore()
+	h := NewHistory(kv)
+	channelID := id.NewIdFromString("channel", id.User, t)
+
+	expected := make([]ReceivedBroadcast, 5)
+	for i := range expected {
+		expected[i] = ReceivedBroadcast{
+			Tag:          Default,
+			Timestamp:    time.Unix(0, int64(i+1)*1e9).UTC(),
+			Username:     "user",
+			Message:      []byte{byte(i)},
+			ReceivedTime: time.Unix(0, int64(i+2)*1e9).UTC(),
+		}
+		if err := h.Add(channelID, expected[i]); err != nil {
+			t.Fatalf("Failed to add message %d: %+v", i, err)
+		}
+	}
+
+	loaded, err := NewHistory(kv).Load(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load history: %+v", err)
+	}
+
+	if !reflect.DeepEqual(expected, loaded) {
+		t.Errorf("Loaded history does not match expected."+
+			"\nexpected: %+v\nreceived: %+v", expected, loaded)
+	}
+}
+
+// Tests that History.Add does not store a message that was already stored,
+// such as a sent message that is received back from the network.
+func TestHistory_Add_Duplicate(t *testing.T) {
+	h := NewHistory(ekv.MakeMemstore())
+	channelID := id.NewIdFromString("channel", id.User, t)
+	r := ReceivedBroadcast{
+		Tag:          Default,
+		Timestamp:    netTime.Now(),
+		Username:     "user",
+		Message:      []byte("Hello"),
+		ReceivedTime: netTime.Now(),
+	}
+
+	for i := 0; i < 3; i++ {
+		r.ReceivedTime = r.ReceivedTime.Add(time.Second)
+		if err := h.Add(channelID, r); err != nil {
+			t.Fatalf("Failed to add message %d: %+v", i, err)
+		}
+	}
+
+	loaded, err := h.Load(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load history: %+v", err)
+	}
+
+	if len(loaded) != 1 {
+		t.Errorf("Unexpected number of stored messages."+
+			"\nexpected: %d\nreceived: %d", 1, len(loaded))
+	}
+}
+
+// Tests that History.Add does not store ephemeral messages.
+func TestHistory_Add_Ephemeral(t *testing.T) {
+	h := NewHistory(ekv.MakeMemstore())
+	channelID := id.NewIdFromString("channel", id.User, t)
+
+	for _, tag := range []Tag{Heartbeat, Typing} {
+		r := ReceivedBroadcast{Tag: tag, Timestamp: netTime.Now(),
+			Username: "user", ReceivedTime: netTime.Now()}
+		if err := h.Add(channelID, r); err != nil {
+			t.Fatalf("Failed to add %s message: %+v", tag, err)
+		}
+	}
+
+	loaded, err := h.Load(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load history: %+v", err)
+	}
+
+	if len(loaded) != 0 {
+		t.Errorf("Ephemeral messages were stored: %+v", loaded)
+	}
+}
+
+// Tests that History.Load returns an empty history for an unknown channel.
+func TestHistory_Load_Empty(t *testing.T) {
+	h := NewHistory(ekv.MakeMemstore())
+	channelID := id.NewIdFromString("channel", id.User, t)
+
+	loaded, err := h.Load(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load history: %+v", err)
+	}
+
+	if len(loaded) != 0 {
+		t.Errorf("Expected empty history, received: %+v", loaded)
+	}
+}
+
+// Tests that History.Add redacts a message and its edits when an accepted
+// Delete message is added, does not redact on a rejected delete, and does not
+// store the deleted message again.
+func TestHistory_Add_Delete(t *testing.T) {
+	kv := ekv.MakeMemstore()
+	h := NewHistory(kv)
+	channelID := id.NewIdFromString("channel", id.User, t)
+
+	original, other := MessageID{1}, MessageID{2}
+	messages := []ReceivedBroadcast{
+		{Tag: Default, Username: "alice", Message: []byte("secret"),
+			Extensions: Extensions{NewMessageIDExtension(original)}},
+		{Tag: Default, Username: "bob", Message: []byte("hello"),
+			Extensions: Extensions{NewMessageIDExtension(other)}},
+		{Tag: Edit, Username: "alice", Message: []byte("secret 2"),
+			Extensions: Extensions{NewEditOfExtension(original)}},
+		{Tag: Delete, Username: "mallory",
+			Extensions: Extensions{NewEditOfExtension(other)}},
+		{Tag: Delete, Username: "alice",
+			Extensions: Extensions{NewEditOfExtension(original)}},
+	}
+	for i, r := range messages {
+		r.Timestamp = time.Unix(int64(i), 0)
+		if err := h.Add(channelID, r); err != nil {
+			t.Fatalf("Failed to add message %d: %+v", i, err)
+		}
+	}
+
+	// Receiving the deleted message and its edit again is ignored
+	for _, i := range []int{0, 2} {
+		r := messages[i]
+		r.Timestamp = time.Unix(100, 0)
+		if err := h.Add(channelID, r); err != nil {
+			t.Fatalf("Failed to add message %d again: %+v", i, err)
+		}
+	}
+
+	for i, hist := range []*History{h, NewHistory(kv)} {
+		loaded, err := hist.Load(channelID)
+		if err != nil {
+			t.Fatalf("Failed to load history (%d): %+v", i, err)
+		} else if len(loaded) != len(messages) {
+			t.Fatalf("Expected %d entries, found %d (%d).",
+				len(messages), len(loaded), i)
+		}
+
+		for j, r := range loaded {
+			expected := messages[j].Message
+			if j == 0 || j == 2 {
+				expected = nil
+			}
+			if !reflect.DeepEqual(expected, r.Message) {
+				t.Errorf("Unexpected message in entry %d (%d)."+
+					"\nexpected: %q\nreceived: %q", j, i, expected, r.Message)
+			}
+		}
+	}
+}
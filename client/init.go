@@ -12,6 +12,9 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/client/xxdk"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/crypto/large"
+	"gitlab.com/xx_network/primitives/ndf"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -49,6 +52,33 @@ func InitClient(password []byte, storeDir, ndfPath string) (*xxdk.Cmix, error) {
 	return client, nil
 }
 
+// MaxMessageLength returns the maximum size of the contents of a cMix message
+// on the network described by the NDF file, or by the default NDF if no path is
+// supplied. It is the size used by the client of a session created with the
+// NDF and is found without loading a session or connecting to the network.
+func MaxMessageLength(ndfPath string) (int, error) {
+	data := ndfJSON
+	if ndfPath != "" {
+		var err error
+		data, err = ioutil.ReadFile(ndfPath)
+		if err != nil {
+			return 0, errors.Errorf("failed to read NDF file: %+v", err)
+		}
+	}
+
+	def, err := ndf.Unmarshal(data)
+	if err != nil {
+		return 0, errors.Errorf("failed to unmarshal NDF: %+v", err)
+	}
+
+	prime := large.NewIntFromString(def.CMIX.Prime, 16)
+	if prime == nil {
+		return 0, errors.New("invalid cMix group prime in NDF")
+	}
+
+	return format.NewMessage(prime.ByteLen()).ContentsSize(), nil
+}
+
 // ConnectToNetwork connects the client to the network.
 func ConnectToNetwork(client *xxdk.Cmix, timeout time.Duration) error {
 	// Start the network follower
@@ -57,11 +87,14 @@ func ConnectToNetwork(client *xxdk.Cmix, timeout time.Duration) error {
 		return errors.Errorf("failed to start the network follower: %+v", err)
 	}
 
-	// Wait until connected or crash on timeout
+	// Wait until connected or return an error on timeout
 	connected := make(chan bool, 10)
 	client.GetCmix().AddHealthCallback(
 		func(isConnected bool) { connected <- isConnected })
-	waitUntilConnected(connected, timeout)
+	err = waitUntilConnected(connected, timeout)
+	if err != nil {
+		return err
+	}
 
 	// After connection, wait until registered with at least 85% of nodes
 	for numReg, total := 1, 100; numReg < (total*3)/4; {
@@ -79,17 +112,22 @@ func ConnectToNetwork(client *xxdk.Cmix, timeout time.Duration) error {
 	return nil
 }
 
-// waitUntilConnected waits until the network is connected.
-func waitUntilConnected(connected chan bool, timeout time.Duration) {
+// waitUntilConnected waits until the network is connected. Returns an error if
+// the timeout is reached first.
+func waitUntilConnected(connected chan bool, timeout time.Duration) error {
 	timeoutTimer := time.NewTimer(timeout)
-	// Wait until connected or panic after time out is reached
+	defer timeoutTimer.Stop()
+
+	// Wait until connected or return an error after time out is reached
 	for isConnected := false; !isConnected; {
 		select {
 		case isConnected = <-connected:
 			jww.INFO.Printf("Network status: %t", isConnected)
 		case <-timeoutTimer.C:
-			jww.FATAL.Panicf("Timed out after %s while waiting for network "+
-				"connection.", timeout)
+			return errors.Errorf("timed out after %s while waiting for "+
+				"network connection", timeout)
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,142 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"io"
+	"strings"
+)
+
+// InvitePrefix is the scheme that starts every channel invite link.
+const InvitePrefix = "xxchan://"
+
+// Invite payload constants.
+const (
+	inviteVersion      = 0
+	inviteVersionSize  = 1
+	inviteChecksumSize = 4
+	inviteMinSize      = inviteVersionSize + inviteChecksumSize
+
+	// maxInviteChannelSize is the maximum size, in bytes, of the decompressed
+	// channel file of an invite so that a malicious invite cannot exhaust the
+	// memory.
+	maxInviteChannelSize = 1 << 20
+)
+
+// Error messages.
+const (
+	// NewInvite
+	errCompressInvite = "failed to compress channel: %+v"
+
+	// ParseInvite
+	errNotInvite      = "invite does not start with %q"
+	errDecodeInvite   = "failed to decode invite: %+v"
+	errInviteLen      = "invite of size %d shorter than minimum size %d"
+	errInviteChecksum = "invite checksum does not match; check that it " +
+		"was copied in full"
+	errInviteVersion    = "unsupported invite version %d"
+	errDecompressInvite = "failed to decompress invite: %+v"
+	errInviteTooLarge   = "invite channel larger than maximum size %d"
+)
+
+/*
++-----------------------------------------------+
+|                Invite Payload                 |
++-----------+------------------------+----------+
+|  version  |   compressed channel   | checksum |
+|  1 byte   |       variable         | 4 bytes  |
++-----------+------------------------+----------+
+
+The compressed channel is the contents of the channel file, as returned by
+MarshalChannelFile, compressed with DEFLATE. The checksum is the first four
+bytes of the SHA-256 hash of the version and compressed channel, so that
+mistyped or truncated invites are rejected. The payload is encoded with
+unpadded URL-safe base64 and prefixed with InvitePrefix.
+*/
+
+// NewInvite returns the invite link of the channel and the chain of handovers
+// of its RSA key. The invite contains everything in the channel file, so that
+// it can be joined in place of the file.
+func NewInvite(c *crypto.Channel, handovers []KeyHandover) (string, error) {
+	data, err := MarshalChannelFile(c, handovers)
+	if err != nil {
+		return "", err
+	}
+
+	var buff bytes.Buffer
+	buff.WriteByte(inviteVersion)
+	w, err := flate.NewWriter(&buff, flate.BestCompression)
+	if err != nil {
+		return "", errors.Errorf(errCompressInvite, err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return "", errors.Errorf(errCompressInvite, err)
+	} else if err = w.Close(); err != nil {
+		return "", errors.Errorf(errCompressInvite, err)
+	}
+	buff.Write(inviteChecksum(buff.Bytes()))
+
+	return InvitePrefix + base64.RawURLEncoding.EncodeToString(buff.Bytes()),
+		nil
+}
+
+// ParseInvite returns the channel and the chain of handovers of its RSA key in
+// the invite link. Whitespace in the invite, such as line breaks added when it
+// is pasted, is ignored.
+func ParseInvite(invite string) (*crypto.Channel, []KeyHandover, error) {
+	invite = strings.Join(strings.Fields(invite), "")
+	if !IsInvite(invite) {
+		return nil, nil, errors.Errorf(errNotInvite, InvitePrefix)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimPrefix(invite, InvitePrefix))
+	if err != nil {
+		return nil, nil, errors.Errorf(errDecodeInvite, err)
+	} else if len(payload) < inviteMinSize {
+		return nil, nil, errors.Errorf(
+			errInviteLen, len(payload), inviteMinSize)
+	}
+
+	body := payload[:len(payload)-inviteChecksumSize]
+	if !bytes.Equal(inviteChecksum(body),
+		payload[len(payload)-inviteChecksumSize:]) {
+		return nil, nil, errors.New(errInviteChecksum)
+	} else if body[0] != inviteVersion {
+		return nil, nil, errors.Errorf(errInviteVersion, body[0])
+	}
+
+	r := flate.NewReader(bytes.NewReader(body[inviteVersionSize:]))
+	data, err := io.ReadAll(io.LimitReader(r, maxInviteChannelSize+1))
+	if err != nil {
+		return nil, nil, errors.Errorf(errDecompressInvite, err)
+	} else if len(data) > maxInviteChannelSize {
+		return nil, nil, errors.Errorf(
+			errInviteTooLarge, maxInviteChannelSize)
+	}
+
+	return UnmarshalChannelFile(data)
+}
+
+// IsInvite returns true if the string is an invite link rather than the path
+// to a channel file.
+func IsInvite(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), InvitePrefix)
+}
+
+// inviteChecksum returns the checksum of the invite payload preceding it.
+func inviteChecksum(body []byte) []byte {
+	h := sha256.Sum256(body)
+	return h[:inviteChecksumSize]
+}
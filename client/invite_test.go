@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests that a channel and its handovers in an invite made with NewInvite are
+// returned by ParseInvite, also when the invite is wrapped over several lines.
+func TestNewInvite_ParseInvite(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	successor := newTestRsaKey(t)
+	chain := []KeyHandover{
+		newTestHandover(t, channel.ReceptionID, pk, successor.GetPublic())}
+
+	invite, err := NewInvite(channel, chain)
+	if err != nil {
+		t.Fatalf("Failed to make invite: %+v", err)
+	}
+	if !IsInvite(invite) {
+		t.Errorf("Invite %q is not recognised as an invite.", invite)
+	}
+
+	wrapped := invite[:20] + "\n" + invite[20:40] + "\r\n  " + invite[40:]
+	for i, s := range []string{invite, wrapped, " " + invite + "\n"} {
+		c, handovers, err := ParseInvite(s)
+		if err != nil {
+			t.Fatalf("Failed to parse invite (%d): %+v", i, err)
+		}
+		if !reflect.DeepEqual(channel, c) {
+			t.Errorf("Parsed channel does not match original (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, channel, c)
+		}
+		if len(handovers) != 1 || !bytes.Equal(
+			chain[0].Marshal(), handovers[0].Marshal()) {
+			t.Errorf("Parsed handovers do not match original (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, chain, handovers)
+		}
+	}
+}
+
+// Tests that LoadChannelFile loads a channel from an invite given in place of
+// the path and from a file containing an invite.
+func TestLoadChannelFile_Invite(t *testing.T) {
+	channel, _ := newTestChannel(t)
+	invite, err := NewInvite(channel, nil)
+	if err != nil {
+		t.Fatalf("Failed to make invite: %+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "invite.xxchan")
+	if err = os.WriteFile(path, []byte(invite+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write invite file: %+v", err)
+	}
+
+	for i, p := range []string{invite, path} {
+		c, _, err := LoadChannelFile(p)
+		if err != nil {
+			t.Errorf("Failed to load channel (%d): %+v", i, err)
+		} else if !reflect.DeepEqual(channel, c) {
+			t.Errorf("Loaded channel does not match original (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, channel, c)
+		}
+	}
+}
+
+// Error path: Tests that ParseInvite rejects invites with the wrong prefix,
+// invalid encoding, a changed character, truncation, or an unknown version.
+func TestParseInvite_Invalid(t *testing.T) {
+	channel, _ := newTestChannel(t)
+	invite, err := NewInvite(channel, nil)
+	if err != nil {
+		t.Fatalf("Failed to make invite: %+v", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimPrefix(invite, InvitePrefix))
+	if err != nil {
+		t.Fatalf("Failed to decode invite: %+v", err)
+	}
+	payload[0] = inviteVersion + 1
+	copy(payload[len(payload)-inviteChecksumSize:],
+		inviteChecksum(payload[:len(payload)-inviteChecksumSize]))
+	wrongVersion :=
+		InvitePrefix + base64.RawURLEncoding.EncodeToString(payload)
+
+	changed := []byte(invite)
+	if changed[len(InvitePrefix)+10] == 'A' {
+		changed[len(InvitePrefix)+10] = 'B'
+	} else {
+		changed[len(InvitePrefix)+10] = 'A'
+	}
+
+	tests := []string{
+		"",
+		"https://example.com",
+		strings.TrimPrefix(invite, InvitePrefix),
+		invite + "!",
+		string(changed),
+		invite[:len(invite)-10],
+		InvitePrefix + "AAAA",
+		wrongVersion,
+	}
+	for i, tt := range tests {
+		if _, _, err = ParseInvite(tt); err == nil {
+			t.Errorf("Parsed invalid invite %q (%d).", tt, i)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKeyParams are cheap key derivation parameters to keep the tests fast.
+var testKeyParams = KeyParams{Time: 1, Memory: 64, Threads: 1}
+
+// Tests that an RSA private key encrypted with EncryptRsaPrivateKey is
+// decrypted with DecryptRsaPrivateKey using the same passphrase.
+func TestEncryptRsaPrivateKey_DecryptRsaPrivateKey(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+
+	data, err := EncryptRsaPrivateKey(
+		pk, []byte("hunter2"), testKeyParams, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %+v", err)
+	}
+	if !IsEncryptedRsaPrivateKey(data) {
+		t.Errorf("Encrypted key is not recognised as encrypted.")
+	} else if IsEncryptedRsaPrivateKey(rsa.CreatePrivateKeyPem(pk)) {
+		t.Errorf("Plaintext key is recognised as encrypted.")
+	}
+	if bytes.Contains(data, rsa.CreatePrivateKeyPem(pk)) {
+		t.Errorf("Encrypted key contains the plaintext key.")
+	}
+
+	decrypted, err := DecryptRsaPrivateKey(data, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt key: %+v", err)
+	}
+	if !bytes.Equal(rsa.CreatePrivateKeyPem(pk),
+		rsa.CreatePrivateKeyPem(decrypted)) {
+		t.Errorf("Decrypted key does not match original.")
+	}
+}
+
+// Error path: Tests that DecryptRsaPrivateKey fails with the wrong passphrase,
+// changed headers or ciphertext, and plaintext keys.
+func TestDecryptRsaPrivateKey_Invalid(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	data, err := EncryptRsaPrivateKey(
+		pk, []byte("hunter2"), testKeyParams, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %+v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	block.Bytes[len(block.Bytes)-1] ^= 1
+	changed := string(pem.EncodeToMemory(block))
+
+	for i, tt := range []struct {
+		data       string
+		passphrase string
+	}{
+		{string(data), "hunter3"},
+		{string(data), ""},
+		{strings.Replace(string(data), "Time: 1", "Time: 2", 1), "hunter2"},
+		{strings.Replace(string(data), "KDF: argon2id", "KDF: md5", 1),
+			"hunter2"},
+		{strings.Replace(string(data), "Memory: 64", "Memory: 1<<40", 1),
+			"hunter2"},
+		{changed, "hunter2"},
+		{string(rsa.CreatePrivateKeyPem(pk)), "hunter2"},
+		{"", "hunter2"},
+	} {
+		_, err = DecryptRsaPrivateKey([]byte(tt.data), []byte(tt.passphrase))
+		if err == nil {
+			t.Errorf("Decrypted invalid key file (%d).", i)
+		}
+	}
+}
+
+// Error path: Tests that EncryptRsaPrivateKey rejects an empty passphrase and
+// invalid parameters.
+func TestEncryptRsaPrivateKey_Invalid(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+
+	for i, tt := range []struct {
+		passphrase string
+		params     KeyParams
+	}{
+		{"", testKeyParams},
+		{"hunter2", KeyParams{Time: 0, Memory: 64, Threads: 1}},
+		{"hunter2", KeyParams{Time: 1, Memory: 4, Threads: 1}},
+		{"hunter2", KeyParams{Time: 1, Memory: 64, Threads: 0}},
+		{"hunter2", KeyParams{Time: 11, Memory: 64, Threads: 1}},
+		{"hunter2", KeyParams{Time: 1, Memory: 1<<20 + 1, Threads: 1}},
+	} {
+		_, err = EncryptRsaPrivateKey(
+			pk, []byte(tt.passphrase), tt.params, rand.Reader)
+		if err == nil {
+			t.Errorf("Encrypted key with invalid input (%d).", i)
+		}
+	}
+}
+
+// Tests that ReadRsaPrivateKey reads keys written by WriteRsaPrivateKey and
+// only asks for the passphrase of encrypted keys.
+func TestWriteRsaPrivateKey_ReadRsaPrivateKey(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+
+	for _, passphrase := range []string{"", "hunter2"} {
+		err = WriteRsaPrivateKey(path, "", pk, []byte(passphrase), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to write key: %+v", err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat key file: %+v", err)
+		} else if info.Mode().Perm() != keyFilePerms {
+			t.Errorf("Unexpected key file permissions.\nexpected: %s"+
+				"\nreceived: %s", os.FileMode(keyFilePerms), info.Mode())
+		}
+
+		asked := false
+		read, err := ReadRsaPrivateKey(path, "", func() ([]byte, error) {
+			asked = true
+			return []byte(passphrase), nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to read key: %+v", err)
+		}
+		if asked != (passphrase != "") {
+			t.Errorf("Passphrase asked for: %t", asked)
+		}
+		if !bytes.Equal(rsa.CreatePrivateKeyPem(pk),
+			rsa.CreatePrivateKeyPem(read)) {
+			t.Errorf("Read key does not match original.")
+		}
+	}
+
+	if _, err = ReadRsaPrivateKey(path, "", nil); err == nil {
+		t.Errorf("Read encrypted key without a passphrase.")
+	}
+}
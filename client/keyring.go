@@ -0,0 +1,342 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Storage keys.
+const (
+	identityKey       = "identity/ed25519PrivateKey"
+	bindingsKeyPrefix = "identityBindings/"
+)
+
+// Error messages.
+const (
+	// LoadKeyring
+	errLoadIdentity     = "failed to load identity key: %+v"
+	errGenerateIdentity = "failed to generate identity key: %+v"
+	errSaveIdentity     = "failed to save identity key: %+v"
+	errIdentityKeySize  = "identity key of size %d does not match %d"
+
+	// Keyring.SignBroadcastFn
+	errSignMessage = "failed to encode message for signing: %+v"
+
+	// VerifySignature
+	errNotSigned        = "message is not signed"
+	errSignatureNotLast = "signature is not the last extension"
+	errSigningKeySize   = "signing key of size %d does not match %d"
+	errSignatureSize    = "signature of size %d does not match %d"
+	errInvalidSignature = "signature does not match message"
+
+	// Keyring.getBindings
+	errLoadBindings = "failed to load identity bindings for channel %s: %+v"
+	errSaveBindings = "failed to save identity bindings for channel %s: %+v"
+)
+
+// Verification describes whether the sender of a received message proved they
+// own the identity key bound to their username.
+type Verification uint8
+
+const (
+	// Unverified indicates that the message is not signed and its username
+	// has never been used with an identity key.
+	Unverified Verification = 0
+
+	// Verified indicates that the message is signed with the identity key
+	// bound to its username.
+	Verified Verification = 1
+
+	// Impersonation indicates that the username is bound to an identity key
+	// but the message is not signed by that key.
+	Impersonation Verification = 2
+)
+
+// verificationStringMap correlates each Verification to a human-readable name.
+var verificationStringMap = map[Verification]string{
+	Unverified:    "unverified",
+	Verified:      "verified",
+	Impersonation: "impersonation",
+}
+
+// String returns a human-readable name for the Verification. Adheres to the
+// fmt.Stringer interface.
+func (v Verification) String() string {
+	str, exists := verificationStringMap[v]
+	if exists {
+		return str
+	}
+
+	return "INVALID VERIFICATION: " + strconv.FormatUint(uint64(v), 10)
+}
+
+// Keyring contains the user's identity key, used to sign sent messages, and
+// the identity keys bound to each username seen in each channel, used to
+// verify received messages. The first key seen for a username in a channel is
+// bound to it and every later message under that name must be signed with the
+// same key. The identity key and bindings are persisted in a key-value store.
+type Keyring struct {
+	kv ekv.KeyValue
+
+	// privateKey is nil if sent messages are not signed.
+	privateKey ed25519.PrivateKey
+
+	// bindings maps the username to the bound identity key for each channel.
+	bindings map[id.ID]map[string]ed25519.PublicKey
+
+	mux sync.Mutex
+}
+
+// LoadKeyring returns a Keyring stored in the key-value store. If sign is true,
+// then the identity key is loaded, or generated if it does not yet exist, and
+// used to sign sent messages. To encrypt the keyring, the store should be an
+// ekv.Filestore opened with the session password.
+func LoadKeyring(kv ekv.KeyValue, sign bool) (*Keyring, error) {
+	kr := &Keyring{
+		kv:       kv,
+		bindings: make(map[id.ID]map[string]ed25519.PublicKey),
+	}
+
+	if !sign {
+		return kr, nil
+	}
+
+	var privateKey []byte
+	err := kv.GetInterface(identityKey, &privateKey)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadIdentity, err)
+	} else if err != nil {
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Errorf(errGenerateIdentity, err)
+		}
+
+		if err = kv.SetInterface(identityKey, privateKey); err != nil {
+			return nil, errors.Errorf(errSaveIdentity, err)
+		}
+
+		jww.INFO.Printf("Generated new identity key %s.",
+			Fingerprint(ed25519.PrivateKey(privateKey).Public().(ed25519.PublicKey)))
+	} else if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.Errorf(
+			errIdentityKeySize, len(privateKey), ed25519.PrivateKeySize)
+	}
+
+	kr.privateKey = privateKey
+
+	return kr, nil
+}
+
+// PublicKey returns the user's identity public key or nil if sent messages are
+// not signed.
+func (kr *Keyring) PublicKey() ed25519.PublicKey {
+	if kr.privateKey == nil {
+		return nil
+	}
+	return kr.privateKey.Public().(ed25519.PublicKey)
+}
+
+// SignBroadcastFn wraps the BroadcastFn so that every message sent to the
+// channel is signed with the identity key. The signing key and signature are
+// added as the last extensions of the message. Returns the BroadcastFn
+// unchanged if it is nil or sent messages are not signed.
+func (kr *Keyring) SignBroadcastFn(
+	channelID *id.ID, username string, fn BroadcastFn) BroadcastFn {
+	if fn == nil || kr.privateKey == nil {
+		return fn
+	}
+
+	return func(tag Tag, timestamp time.Time, message []byte,
+		extensions ...Extension) error {
+		extensions = append(extensions[:len(extensions):len(extensions)],
+			Extension{SigningKeyExt, kr.PublicKey()})
+
+		data, err := signedData(
+			channelID, tag, timestamp, username, message, extensions)
+		if err != nil {
+			return errors.Errorf(errSignMessage, err)
+		}
+
+		signature := ed25519.Sign(kr.privateKey, data)
+		extensions = append(extensions, Extension{SignatureExt, signature})
+
+		return fn(tag, timestamp, message, extensions...)
+	}
+}
+
+// Verify returns the Verification of the message received on the channel. If
+// the message is validly signed and its username has not been seen in the
+// channel before, then the signing key is bound to the username.
+func (kr *Keyring) Verify(channelID *id.ID, r ReceivedBroadcast) Verification {
+	key, sigErr := VerifySignature(channelID, r)
+
+	kr.mux.Lock()
+	defer kr.mux.Unlock()
+
+	bindings, err := kr.getBindings(channelID)
+	if err != nil {
+		jww.ERROR.Printf("%+v", err)
+		return Unverified
+	}
+
+	bound, exists := bindings[r.Username]
+	switch {
+	case sigErr != nil && !exists:
+		return Unverified
+	case sigErr != nil:
+		jww.WARN.Printf("Message from %q on channel %s is not signed with "+
+			"the bound key %s: %+v",
+			r.Username, channelID, Fingerprint(bound), sigErr)
+		return Impersonation
+	case !exists:
+		bindings[r.Username] = key
+		if err = kr.saveBindings(channelID, bindings); err != nil {
+			jww.ERROR.Printf("%+v", err)
+		}
+		jww.INFO.Printf("Bound identity key %s to %q on channel %s.",
+			Fingerprint(key), r.Username, channelID)
+		return Verified
+	case !bytes.Equal(bound, key):
+		jww.WARN.Printf("Message from %q on channel %s is signed with key %s "+
+			"instead of the bound key %s.", r.Username, channelID,
+			Fingerprint(key), Fingerprint(bound))
+		return Impersonation
+	default:
+		return Verified
+	}
+}
+
+// BoundKey returns the identity key bound to the username in the channel.
+// Returns false if no verified message has been received from the username.
+func (kr *Keyring) BoundKey(
+	channelID *id.ID, username string) (ed25519.PublicKey, bool) {
+	kr.mux.Lock()
+	defer kr.mux.Unlock()
+
+	bindings, err := kr.getBindings(channelID)
+	if err != nil {
+		jww.ERROR.Printf("%+v", err)
+		return nil, false
+	}
+
+	key, exists := bindings[username]
+	return key, exists
+}
+
+// VerifyAll returns a channel that receives every message sent on the given
+// channel with its Verification set. The returned channel is closed when the
+// given channel or done is closed.
+func (kr *Keyring) VerifyAll(channelID *id.ID, in chan ReceivedBroadcast,
+	done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		r.Verification = kr.Verify(channelID, r)
+		return r, true
+	})
+}
+
+// getBindings returns the identity bindings for the channel, loading them from
+// storage if they have not yet been accessed. Must be called while the lock is
+// held.
+func (kr *Keyring) getBindings(
+	channelID *id.ID) (map[string]ed25519.PublicKey, error) {
+	if bindings, exists := kr.bindings[*channelID]; exists {
+		return bindings, nil
+	}
+
+	bindings := make(map[string]ed25519.PublicKey)
+	err := kr.kv.GetInterface(bindingsKey(channelID), &bindings)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadBindings, channelID, err)
+	}
+
+	kr.bindings[*channelID] = bindings
+	return bindings, nil
+}
+
+// saveBindings saves the identity bindings for the channel to storage. Must be
+// called while the lock is held.
+func (kr *Keyring) saveBindings(
+	channelID *id.ID, bindings map[string]ed25519.PublicKey) error {
+	if err := kr.kv.SetInterface(bindingsKey(channelID), bindings); err != nil {
+		return errors.Errorf(errSaveBindings, channelID, err)
+	}
+	return nil
+}
+
+// bindingsKey returns the storage key for the identity bindings of a channel.
+func bindingsKey(channelID *id.ID) string {
+	return bindingsKeyPrefix + channelID.String()
+}
+
+// VerifySignature checks that the message received on the channel is signed by
+// the signing key it contains and returns that key.
+func VerifySignature(
+	channelID *id.ID, r ReceivedBroadcast) (ed25519.PublicKey, error) {
+	n := len(r.Extensions)
+	signature, signed := r.Extensions.Get(SignatureExt)
+	if !signed {
+		return nil, errors.New(errNotSigned)
+	} else if r.Extensions[n-1].Type != SignatureExt {
+		return nil, errors.New(errSignatureNotLast)
+	} else if len(signature) != ed25519.SignatureSize {
+		return nil, errors.Errorf(
+			errSignatureSize, len(signature), ed25519.SignatureSize)
+	}
+
+	key, _ := r.Extensions[:n-1].Get(SigningKeyExt)
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.Errorf(
+			errSigningKeySize, len(key), ed25519.PublicKeySize)
+	}
+
+	data, err := signedData(channelID, r.Tag, r.Timestamp, r.Username,
+		r.Message, r.Extensions[:n-1])
+	if err != nil {
+		return nil, err
+	}
+
+	if !ed25519.Verify(key, data, signature) {
+		return nil, errors.New(errInvalidSignature)
+	}
+
+	return key, nil
+}
+
+// signedData returns the data signed for a message sent to the channel. It is
+// made up of the channel ID followed by the encoded message with every
+// extension preceding the signature.
+func signedData(channelID *id.ID, tag Tag, timestamp time.Time,
+	username string, message []byte, extensions Extensions) ([]byte, error) {
+	encoded, err := NewMessage(
+		math.MaxInt, tag, timestamp, username, message, extensions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(channelID.Marshal(), encoded...), nil
+}
+
+// Fingerprint returns a short human-readable identifier for the identity key.
+func Fingerprint(key ed25519.PublicKey) string {
+	if len(key) < 8 {
+		return base64.RawStdEncoding.EncodeToString(key)
+	}
+	return base64.RawStdEncoding.EncodeToString(key[:8])
+}
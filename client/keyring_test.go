@@ -0,0 +1,160 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+	"testing"
+	"time"
+)
+
+// signedBroadcast sends the message through a BroadcastFn signed by the
+// Keyring and returns it as it would be received.
+func signedBroadcast(t *testing.T, kr *Keyring, channelID *id.ID,
+	username string, message []byte) ReceivedBroadcast {
+	var r ReceivedBroadcast
+	fn := kr.SignBroadcastFn(channelID, username, func(tag Tag,
+		timestamp time.Time, message []byte, extensions ...Extension) error {
+		r = ReceivedBroadcast{
+			Tag:        tag,
+			Timestamp:  timestamp,
+			Username:   username,
+			Message:    message,
+			Extensions: extensions,
+		}
+		return nil
+	})
+
+	if err := fn(Default, netTime.Now(), message); err != nil {
+		t.Fatalf("Failed to send signed message: %+v", err)
+	}
+
+	return r
+}
+
+// Tests that LoadKeyring generates an identity key once and loads the same key
+// from storage afterwards.
+func TestLoadKeyring(t *testing.T) {
+	kv := ekv.MakeMemstore()
+	kr, err := LoadKeyring(kv, true)
+	if err != nil {
+		t.Fatalf("Failed to load new keyring: %+v", err)
+	}
+
+	loaded, err := LoadKeyring(kv, true)
+	if err != nil {
+		t.Fatalf("Failed to load existing keyring: %+v", err)
+	}
+
+	if !bytes.Equal(kr.PublicKey(), loaded.PublicKey()) {
+		t.Errorf("Loaded identity key does not match generated key."+
+			"\nexpected: %s\nreceived: %s",
+			Fingerprint(kr.PublicKey()), Fingerprint(loaded.PublicKey()))
+	}
+
+	unsigned, err := LoadKeyring(kv, false)
+	if err != nil {
+		t.Fatalf("Failed to load keyring without signing: %+v", err)
+	}
+	if unsigned.PublicKey() != nil {
+		t.Errorf("Keyring without signing has identity key %s.",
+			Fingerprint(unsigned.PublicKey()))
+	}
+}
+
+// Tests that a message signed with Keyring.SignBroadcastFn is verified by
+// VerifySignature and binds the username on first use.
+func TestKeyring_SignBroadcastFn_Verify(t *testing.T) {
+	kr, _ := LoadKeyring(ekv.MakeMemstore(), true)
+	channelID := id.NewIdFromString("channel", id.User, t)
+	r := signedBroadcast(t, kr, channelID, "alice", []byte("Hello"))
+
+	key, err := VerifySignature(channelID, r)
+	if err != nil {
+		t.Fatalf("Failed to verify signature: %+v", err)
+	}
+	if !bytes.Equal(kr.PublicKey(), key) {
+		t.Errorf("Unexpected signing key.\nexpected: %s\nreceived: %s",
+			Fingerprint(kr.PublicKey()), Fingerprint(key))
+	}
+
+	receiver, _ := LoadKeyring(ekv.MakeMemstore(), false)
+	for i := 0; i < 2; i++ {
+		if v := receiver.Verify(channelID, r); v != Verified {
+			t.Errorf("Unexpected verification (%d).\nexpected: %s\nreceived: %s",
+				i, Verified, v)
+		}
+	}
+
+	// The signature must not be valid on another channel
+	otherID := id.NewIdFromString("other", id.User, t)
+	if _, err = VerifySignature(otherID, r); err == nil {
+		t.Errorf("Signature verified on a different channel.")
+	}
+}
+
+// Tests that Keyring.Verify marks messages under a bound username as
+// impersonation when they are signed by another key, are not signed, or have
+// been modified, and that bindings are kept in storage.
+func TestKeyring_Verify_Impersonation(t *testing.T) {
+	alice, _ := LoadKeyring(ekv.MakeMemstore(), true)
+	mallory, _ := LoadKeyring(ekv.MakeMemstore(), true)
+	channelID := id.NewIdFromString("channel", id.User, t)
+
+	kv := ekv.MakeMemstore()
+	receiver, _ := LoadKeyring(kv, false)
+	r := signedBroadcast(t, alice, channelID, "alice", []byte("Hello"))
+	if v := receiver.Verify(channelID, r); v != Verified {
+		t.Fatalf("Unexpected verification.\nexpected: %s\nreceived: %s",
+			Verified, v)
+	}
+
+	modified := r
+	modified.Message = []byte("Goodbye")
+
+	tests := map[string]ReceivedBroadcast{
+		"other key": signedBroadcast(t, mallory, channelID, "alice", nil),
+		"unsigned":  {Tag: Default, Username: "alice", Message: []byte("Hi")},
+		"modified":  modified,
+	}
+
+	// A new keyring on the same store must load the binding
+	reloaded, _ := LoadKeyring(kv, false)
+	for name, r := range tests {
+		for _, kr := range []*Keyring{receiver, reloaded} {
+			if v := kr.Verify(channelID, r); v != Impersonation {
+				t.Errorf("Unexpected verification for %s message."+
+					"\nexpected: %s\nreceived: %s", name, Impersonation, v)
+			}
+		}
+	}
+
+	// The binding must only apply to the channel it was made on
+	otherID := id.NewIdFromString("other", id.User, t)
+	r = signedBroadcast(t, mallory, otherID, "alice", nil)
+	if v := receiver.Verify(otherID, r); v != Verified {
+		t.Errorf("Unexpected verification on other channel."+
+			"\nexpected: %s\nreceived: %s", Verified, v)
+	}
+}
+
+// Tests that Keyring.Verify marks unsigned messages under an unbound username
+// as unverified.
+func TestKeyring_Verify_Unverified(t *testing.T) {
+	kr, _ := LoadKeyring(ekv.MakeMemstore(), false)
+	channelID := id.NewIdFromString("channel", id.User, t)
+	r := ReceivedBroadcast{Tag: Default, Username: "bob", Message: []byte("Hi")}
+
+	if v := kr.Verify(channelID, r); v != Unverified {
+		t.Errorf("Unexpected verification.\nexpected: %s\nreceived: %s",
+			Unverified, v)
+	}
+}
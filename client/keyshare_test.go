@@ -0,0 +1,180 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that every combination of threshold shares of a key split with
+// SplitRsaPrivateKey reassembles the key with CombineKeyShares, as do all the
+// shares together.
+func TestSplitRsaPrivateKey_CombineKeyShares(t *testing.T) {
+	channel, pk := newTestChannel(t)
+
+	shares, err := SplitRsaPrivateKey(channel.ReceptionID, pk, 3, 5, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split key: %+v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Received %d shares, expected %d.", len(shares), 5)
+	}
+
+	combinations := [][]int{{0, 1, 2}, {0, 2, 4}, {1, 3, 4}, {4, 3, 2},
+		{0, 1, 2, 3, 4}}
+	for i, indexes := range combinations {
+		subset := make([]KeyShare, len(indexes))
+		for j, index := range indexes {
+			subset[j] = shares[index]
+		}
+
+		combined, err := CombineKeyShares(subset)
+		if err != nil {
+			t.Errorf("Failed to combine shares %v (%d): %+v", indexes, i, err)
+		} else if !bytes.Equal(rsa.CreatePrivateKeyPem(pk),
+			rsa.CreatePrivateKeyPem(combined)) {
+			t.Errorf("Shares %v reassembled the wrong key (%d).", indexes, i)
+		}
+	}
+
+	for i, s := range shares {
+		if bytes.Contains(s.Data, rsa.CreatePrivateKeyPem(pk)[:32]) {
+			t.Errorf("Share %d contains the key.", i)
+		}
+	}
+}
+
+// Error path: Tests that CombineKeyShares fails with too few shares, repeated
+// shares, shares of different splits, and corrupted shares.
+func TestCombineKeyShares_Invalid(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	shares, err := SplitRsaPrivateKey(channel.ReceptionID, pk, 3, 5, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split key: %+v", err)
+	}
+	other, err := SplitRsaPrivateKey(channel.ReceptionID, pk, 3, 5, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split key: %+v", err)
+	}
+
+	corrupted := shares[2]
+	corrupted.Data = append([]byte{}, corrupted.Data...)
+	corrupted.Data[0] ^= 0xFF
+
+	tests := [][]KeyShare{
+		nil,
+		shares[:2],
+		{shares[0], shares[1], shares[1]},
+		{shares[0], shares[1], other[2]},
+		{shares[0], shares[1], corrupted},
+	}
+	for i, tt := range tests {
+		if _, err = CombineKeyShares(tt); err == nil {
+			t.Errorf("Combined invalid shares (%d).", i)
+		}
+	}
+}
+
+// Error path: Tests that SplitRsaPrivateKey rejects invalid thresholds and
+// numbers of shares.
+func TestSplitRsaPrivateKey_Invalid(t *testing.T) {
+	channel, pk := newTestChannel(t)
+
+	tests := []struct{ threshold, shares int }{
+		{1, 3}, {4, 3}, {2, 256}, {0, 0},
+	}
+	for i, tt := range tests {
+		_, err := SplitRsaPrivateKey(
+			channel.ReceptionID, pk, tt.threshold, tt.shares, rand.Reader)
+		if err == nil {
+			t.Errorf("Split key into %d shares with threshold %d (%d).",
+				tt.shares, tt.threshold, i)
+		}
+	}
+}
+
+// Tests that a KeyShare written with WriteKeyShare is read back with
+// ReadKeyShare and that the file is only readable by its owner.
+func TestWriteKeyShare_ReadKeyShare(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	shares, err := SplitRsaPrivateKey(channel.ReceptionID, pk, 2, 2, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split key: %+v", err)
+	}
+
+	read := make([]KeyShare, len(shares))
+	for i, s := range shares {
+		path := filepath.Join(t.TempDir(), "share.pem")
+		if err = WriteKeyShare(path, s); err != nil {
+			t.Fatalf("Failed to write share %d: %+v", i, err)
+		}
+		if info, err := os.Stat(path); err != nil {
+			t.Errorf("Failed to stat share file %d: %+v", i, err)
+		} else if info.Mode().Perm() != keyFilePerms {
+			t.Errorf("Unexpected permissions of share file %d."+
+				"\nexpected: %s\nreceived: %s",
+				i, os.FileMode(keyFilePerms), info.Mode())
+		}
+
+		read[i], err = ReadKeyShare(path)
+		if err != nil {
+			t.Fatalf("Failed to read share %d: %+v", i, err)
+		}
+		if !bytes.Equal(s.Marshal(), read[i].Marshal()) {
+			t.Errorf("Read share %d does not match original."+
+				"\nexpected: %+v\nreceived: %+v", i, s, read[i])
+		}
+	}
+
+	combined, err := CombineKeyShares(read)
+	if err != nil {
+		t.Fatalf("Failed to combine read shares: %+v", err)
+	} else if !bytes.Equal(rsa.CreatePrivateKeyPem(pk),
+		rsa.CreatePrivateKeyPem(combined)) {
+		t.Errorf("Read shares reassembled the wrong key.")
+	}
+}
+
+// Error path: Tests that UnmarshalKeyShare rejects other PEM blocks and invalid
+// headers.
+func TestUnmarshalKeyShare_Invalid(t *testing.T) {
+	channel, pk := newTestChannel(t)
+	shares, err := SplitRsaPrivateKey(channel.ReceptionID, pk, 2, 2, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to split key: %+v", err)
+	}
+	data := shares[0].Marshal()
+
+	tests := [][]byte{
+		nil,
+		rsa.CreatePrivateKeyPem(pk),
+		bytes.Replace(data, []byte("Index: 1"), []byte("Index: 3"), 1),
+		bytes.Replace(data, []byte("Index: 1"), []byte("Index: x"), 1),
+		bytes.Replace(data, []byte("Channel: "), []byte("Channel: !"), 1),
+	}
+	for i, tt := range tests {
+		if _, err = UnmarshalKeyShare(tt); err == nil {
+			t.Errorf("Unmarshalled invalid key share (%d).", i)
+		}
+	}
+}
+
+// Tests that gfInv returns the multiplicative inverse of every non-zero
+// element of GF(256).
+func Test_gfInv(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if p := gfMul(byte(a), gfInv(byte(a))); p != 1 {
+			t.Errorf("%d * inverse %d = %d, expected 1.", a, gfInv(byte(a)), p)
+		}
+	}
+}
@@ -10,17 +10,44 @@ package client
 import (
 	"bytes"
 	"encoding/binary"
-	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/pkg/errors"
 	"math"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Size constants.
 const (
+	versionSize     = 1
 	tagSize         = 1
 	timestampSize   = 8
 	usernameLenSize = 1
 	minSize         = tagSize + timestampSize + usernameLenSize
+
+	extensionsLenSize = 2
+	extTypeSize       = 1
+	extLenSize        = 2
+	extHeaderSize     = extTypeSize + extLenSize
+	minSizeV1         = versionSize + minSize + extensionsLenSize
+)
+
+// Message versions.
+const (
+	// versionFlag is set on the first byte of every versioned message. Because
+	// every Tag is smaller than versionFlag, a first byte without it is the tag
+	// of a v0 message.
+	versionFlag = 0x80
+
+	// Version0 is the original unversioned message layout without extensions.
+	Version0 = 0
+
+	// Version1 is the layout with a version byte and extensions.
+	Version1 = 1
+
+	// CurrentVersion is the newest message version that can be decoded.
+	CurrentVersion = Version1
 )
 
 // Error messages.
@@ -29,41 +56,97 @@ const (
 	errNewMessageSize = "max size of payload (%d) must be greater than %d"
 	errUsernameLen    = "length of username (%d) cannot exceed %d"
 	errPayloadLen     = "combined size of payload (%d) cannot exceed %d"
+	errExtensionLen   = "length of %s extension (%d) cannot exceed %d"
+	errExtensionsLen  = "combined size of extensions (%d) cannot exceed %d"
+
+	// UnmarshalMessage
+	errUnsupportedVersion = "unsupported message version %d"
+	errMessageLen         = "message of size %d too short to contain %s"
+	errUnknownTag         = "unknown message tag %d"
+
+	// ValidateUsername
+	errUsernameUTF8    = "username %q is not valid UTF-8"
+	errUsernameControl = "username %q cannot contain control characters"
 )
 
 /*
 +------------------------------------------------------------------------+
-|                            Broadcast Payload                           |
+|                       Broadcast Payload (Version 0)                    |
 +--------+-----------+-------------+-------------------+-----------------+
 |  tag   | timestamp | usernameLen |     username      |     payload     |
 | 1 byte |  8 bytes  |   1 byte    | usernameLen bytes | remaining bytes |
 +--------+-----------+-------------+-------------------+-----------------+
+
++-------------------------------------------------------------------------------------------------------+
+|                                     Broadcast Payload (Version 1)                                     |
++---------+--------+-----------+-------------+-------------------+---------+------------+---------------+
+| version |  tag   | timestamp | usernameLen |     username      | extLen  | extensions |    payload    |
+| 1 byte  | 1 byte |  8 bytes  |   1 byte    | usernameLen bytes | 2 bytes | extLen     |   remaining   |
++---------+--------+-----------+-------------+-------------------+---------+------------+---------------+
+
+The version byte is versionFlag | 1. The extensions are a list of type-length-
+value fields, each made up of a 1 byte type, a 2 byte length, and the value.
+Extensions of unknown types are kept but otherwise ignored so that new
+extensions can be added without breaking older clients. Messages without
+extensions are encoded as version 0 so that they can still be read by clients
+that predate versioning.
 */
 
+// Message is a broadcast message and its metadata.
+type Message struct {
+	// Version is the layout the message was decoded from.
+	Version uint8
+
+	Tag        Tag
+	Timestamp  time.Time
+	Username   string
+	Extensions Extensions
+	Payload    []byte
+}
+
 // MaxMessagePayloadSize returns the maximum size of a payload for the given
-// max payload size and username.
+// max payload size and username when no extensions are included.
 func MaxMessagePayloadSize(maxPayloadSize int, username string) int {
 	return maxPayloadSize - (minSize + len(username))
 }
 
 // NewMessage generates a new message containing the payload and the metadata.
+// If any extensions are provided, then the message is encoded as Version1.
+// Otherwise, it is encoded as Version0.
 func NewMessage(maxPayloadSize int, tag Tag, timestamp time.Time,
-	username string, payload []byte) ([]byte, error) {
+	username string, payload []byte, extensions ...Extension) ([]byte, error) {
 	if maxPayloadSize < minSize {
 		return nil, errors.Errorf(errNewMessageSize, maxPayloadSize, minSize)
 	}
 
 	if len(username) > math.MaxUint8 {
 		return nil, errors.Errorf(errUsernameLen, len(username), math.MaxUint8)
+	} else if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+
+	var ext []byte
+	headerSize := minSize
+	if len(extensions) > 0 {
+		var err error
+		ext, err = Extensions(extensions).marshal()
+		if err != nil {
+			return nil, err
+		}
+		headerSize = minSizeV1 + len(ext)
 	}
 
-	payloadSize := minSize + len(username) + len(payload)
+	payloadSize := headerSize + len(username) + len(payload)
 	if payloadSize > maxPayloadSize {
 		return nil, errors.Errorf(errPayloadLen, payloadSize, maxPayloadSize)
 	}
 
 	buff := bytes.NewBuffer(nil)
-	buff.Grow(minSize + len(username) + len(payload))
+	buff.Grow(payloadSize)
+
+	if len(extensions) > 0 {
+		buff.WriteByte(versionFlag | Version1)
+	}
 
 	buff.WriteByte(byte(tag))
 
@@ -73,22 +156,117 @@ func NewMessage(maxPayloadSize int, tag Tag, timestamp time.Time,
 
 	buff.WriteByte(uint8(len(username)))
 	buff.WriteString(username)
+
+	if len(extensions) > 0 {
+		b = make([]byte, extensionsLenSize)
+		binary.LittleEndian.PutUint16(b, uint16(len(ext)))
+		buff.Write(b)
+		buff.Write(ext)
+	}
+
 	buff.Write(payload)
 
 	return buff.Bytes(), nil
 }
 
-// UnmarshalMessage decodes the data into a payload and its metadata.
-func UnmarshalMessage(data []byte) (tag Tag, timestamp time.Time,
-	username string, payload []byte) {
+// UnmarshalMessage decodes the data into a payload and its metadata. Both
+// Version0 and Version1 messages can be decoded. Returns an error if the data is
+// too short for any of the lengths it contains, if the tag is unknown, or if
+// the username is not valid.
+func UnmarshalMessage(data []byte) (Message, error) {
+	var m Message
+	var err error
+	if len(data) > 0 && data[0]&versionFlag != 0 {
+		m, err = unmarshalVersioned(data)
+	} else {
+		m, err = unmarshalV0(data)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	if !m.Tag.IsValid() {
+		return Message{}, errors.Errorf(errUnknownTag, m.Tag)
+	} else if err = ValidateUsername(m.Username); err != nil {
+		return Message{}, err
+	}
+
+	return m, nil
+}
+
+// ValidateUsername returns an error if the username is not valid UTF-8 or
+// contains control characters, such as the escape sequences that would change
+// how the terminal displays it.
+func ValidateUsername(username string) error {
+	if !utf8.ValidString(username) {
+		return errors.Errorf(errUsernameUTF8, username)
+	} else if strings.IndexFunc(username, unicode.IsControl) != -1 {
+		return errors.Errorf(errUsernameControl, username)
+	}
+	return nil
+}
+
+// unmarshalV0 decodes a message without a version byte.
+func unmarshalV0(data []byte) (Message, error) {
+	if len(data) < minSize {
+		return Message{}, errors.Errorf(errMessageLen, len(data), "header")
+	}
+
 	buff := bytes.NewBuffer(data)
 
-	tag = Tag(buff.Next(tagSize)[0])
-	timestamp = time.Unix(
+	var m Message
+	m.Version = Version0
+	m.Tag = Tag(buff.Next(tagSize)[0])
+	m.Timestamp = time.Unix(
+		0, int64(binary.LittleEndian.Uint64(buff.Next(timestampSize))))
+
+	usernameLen := int(buff.Next(usernameLenSize)[0])
+	if buff.Len() < usernameLen {
+		return Message{}, errors.Errorf(errMessageLen, len(data), "username")
+	}
+	m.Username = string(buff.Next(usernameLen))
+	m.Payload = buff.Bytes()
+
+	return m, nil
+}
+
+// unmarshalVersioned decodes a message that starts with a version byte.
+func unmarshalVersioned(data []byte) (Message, error) {
+	version := data[0] &^ versionFlag
+	if version != Version1 {
+		return Message{}, errors.Errorf(errUnsupportedVersion, version)
+	}
+
+	if len(data) < minSizeV1 {
+		return Message{}, errors.Errorf(errMessageLen, len(data), "header")
+	}
+
+	buff := bytes.NewBuffer(data[versionSize:])
+
+	var m Message
+	m.Version = version
+	m.Tag = Tag(buff.Next(tagSize)[0])
+	m.Timestamp = time.Unix(
 		0, int64(binary.LittleEndian.Uint64(buff.Next(timestampSize))))
+
 	usernameLen := int(buff.Next(usernameLenSize)[0])
-	username = string(buff.Next(usernameLen))
-	payload = buff.Bytes()
+	if buff.Len() < usernameLen+extensionsLenSize {
+		return Message{}, errors.Errorf(errMessageLen, len(data), "username")
+	}
+	m.Username = string(buff.Next(usernameLen))
+
+	extLen := int(binary.LittleEndian.Uint16(buff.Next(extensionsLenSize)))
+	if buff.Len() < extLen {
+		return Message{}, errors.Errorf(errMessageLen, len(data), "extensions")
+	}
+
+	var err error
+	m.Extensions, err = unmarshalExtensions(buff.Next(extLen))
+	if err != nil {
+		return Message{}, err
+	}
+
+	m.Payload = buff.Bytes()
 
-	return tag, timestamp, username, payload
+	return m, nil
 }
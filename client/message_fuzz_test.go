@@ -0,0 +1,84 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build go1.18
+
+package client
+
+import (
+	"bytes"
+	"gitlab.com/xx_network/primitives/netTime"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// FuzzUnmarshalMessage tests that UnmarshalMessage never panics and that every
+// message it successfully decodes is encoded back into a message that decodes
+// to the same values. The seed corpus is made of the messages generated in
+// TestNewMessageUnmarshalMessage and the files in
+// testdata/fuzz/FuzzUnmarshalMessage.
+func FuzzUnmarshalMessage(f *testing.F) {
+	timestamp := netTime.Now()
+	username := "myUsername"
+	payload := []byte("This is my payload.")
+	mid, err := NewMessageID()
+	if err != nil {
+		f.Fatalf("Failed to generate message ID: %+v", err)
+	}
+
+	seeds := [][]Extension{
+		nil,
+		{NewMessageIDExtension(mid)},
+		{NewMessageIDExtension(mid), NewReplyToExtension(mid),
+			NewContentTypeExtension("text/plain")},
+	}
+	tags := []Tag{Default, Join, Exit, Admin, Fragment, File, Edit, Delete,
+		Reaction, Heartbeat, Typing, Moderate, Topic, Pin, Unpin,
+		Grant, Revoke, Handover}
+	for _, tag := range tags {
+		for _, extensions := range seeds {
+			message, err := NewMessage(
+				1024, tag, timestamp, username, payload, extensions...)
+			if err != nil {
+				f.Fatalf("Failed to create new message: %+v", err)
+			}
+			f.Add(message)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := UnmarshalMessage(data)
+		if err != nil {
+			return
+		}
+
+		if !m.Tag.IsValid() {
+			t.Errorf("Decoded message has unknown tag %d.", m.Tag)
+		}
+
+		message, err := NewMessage(math.MaxInt, m.Tag, m.Timestamp,
+			m.Username, m.Payload, m.Extensions...)
+		if err != nil {
+			t.Fatalf("Failed to encode decoded message: %+v", err)
+		}
+
+		received, err := UnmarshalMessage(message)
+		if err != nil {
+			t.Fatalf("Failed to decode re-encoded message: %+v", err)
+		}
+
+		if m.Tag != received.Tag || !m.Timestamp.Equal(received.Timestamp) ||
+			m.Username != received.Username ||
+			!bytes.Equal(m.Payload, received.Payload) ||
+			(len(m.Extensions) > 0 &&
+				!reflect.DeepEqual(m.Extensions, received.Extensions)) {
+			t.Errorf("Re-encoded message does not match decoded message."+
+				"\nexpected: %+v\nreceived: %+v", m, received)
+		}
+	})
+}
@@ -10,7 +10,9 @@ package client
 import (
 	"bytes"
 	"gitlab.com/xx_network/primitives/netTime"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // Tests that the payload and metadata encoded with NewMessage can be decoded
@@ -26,8 +28,12 @@ func TestNewMessageUnmarshalMessage(t *testing.T) {
 		t.Errorf("Failed to create new message: %+v", err)
 	}
 
+	m, err := UnmarshalMessage(message)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal message: %+v", err)
+	}
 	receivedTag, receivedTimestamp, receivedUsername, receivedPayload :=
-		UnmarshalMessage(message)
+		m.Tag, m.Timestamp, m.Username, m.Payload
 
 	if tag != receivedTag {
 		t.Errorf("Received tag does not match expected."+
@@ -49,3 +55,165 @@ func TestNewMessageUnmarshalMessage(t *testing.T) {
 			"\nexpected: %q\nreceived: %q", payload, receivedPayload)
 	}
 }
+
+// Tests that a message with extensions encoded with NewMessage is a Version1
+// message that can be decoded with UnmarshalMessage.
+func TestNewMessageUnmarshalMessage_Extensions(t *testing.T) {
+	mid, err := NewMessageID()
+	if err != nil {
+		t.Fatalf("Failed to generate message ID: %+v", err)
+	}
+	expected := Message{
+		Version:   Version1,
+		Tag:       Default,
+		Timestamp: time.Unix(0, netTime.Now().UnixNano()),
+		Username:  "myUsername",
+		Extensions: Extensions{
+			NewMessageIDExtension(mid),
+			NewContentTypeExtension("text/plain"),
+			{Type: 200, Value: []byte("unknown extension")},
+		},
+		Payload: []byte("This is my payload."),
+	}
+
+	message, err := NewMessage(1024, expected.Tag, expected.Timestamp,
+		expected.Username, expected.Payload, expected.Extensions...)
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+
+	if message[0] != versionFlag|Version1 {
+		t.Errorf("Unexpected version byte.\nexpected: %#x\nreceived: %#x",
+			versionFlag|Version1, message[0])
+	}
+
+	received, err := UnmarshalMessage(message)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal message: %+v", err)
+	}
+
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unmarshalled message does not match expected."+
+			"\nexpected: %+v\nreceived: %+v", expected, received)
+	}
+
+	receivedID, exists := received.Extensions.MessageID()
+	if !exists || receivedID != mid {
+		t.Errorf("Unexpected message ID.\nexpected: %s\nreceived: %s",
+			mid, receivedID)
+	}
+
+	if _, exists = received.Extensions.ReplyTo(); exists {
+		t.Errorf("Found reply-to extension that was not added.")
+	}
+}
+
+// Tests that NewMessage encodes messages without extensions in the Version0
+// layout.
+func TestNewMessage_Version0(t *testing.T) {
+	message, err := NewMessage(1024, Default, netTime.Now(), "myUsername",
+		[]byte("This is my payload."))
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+
+	if message[0] != byte(Default) {
+		t.Errorf("First byte of message is not the tag."+
+			"\nexpected: %d\nreceived: %d", Default, message[0])
+	}
+}
+
+// Error path: Tests that UnmarshalMessage returns an error for a version newer
+// than CurrentVersion and for truncated extensions.
+func TestUnmarshalMessage_VersionError(t *testing.T) {
+	message, err := NewMessage(1024, Default, netTime.Now(), "myUsername",
+		[]byte("This is my payload."), NewContentTypeExtension("text/plain"))
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+
+	unsupported := append([]byte{}, message...)
+	unsupported[0] = versionFlag | (CurrentVersion + 1)
+	if _, err = UnmarshalMessage(unsupported); err == nil {
+		t.Errorf("Did not receive error for unsupported version.")
+	}
+
+	// Cut the message within the extensions
+	truncated := message[:minSizeV1+len("myUsername")+extHeaderSize]
+	if _, err = UnmarshalMessage(truncated); err == nil {
+		t.Errorf("Did not receive error for truncated extensions.")
+	}
+}
+
+// Error path: Tests that UnmarshalMessage returns an error, instead of
+// panicking, for every truncation of a message that cuts into its header.
+func TestUnmarshalMessage_Truncated(t *testing.T) {
+	username := "myUsername"
+	messages := map[string]int{}
+
+	v0, err := NewMessage(1024, Default, netTime.Now(), username, nil)
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+	messages[string(v0)] = minSize + len(username)
+
+	ext := NewContentTypeExtension("text/plain")
+	v1, err := NewMessage(1024, Default, netTime.Now(), username, nil, ext)
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+	messages[string(v1)] = len(v1)
+
+	for message, headerSize := range messages {
+		for i := 0; i < headerSize; i++ {
+			if _, err = UnmarshalMessage([]byte(message[:i])); err == nil {
+				t.Errorf("Did not receive error for message truncated to %d "+
+					"of %d bytes.", i, headerSize)
+			}
+		}
+	}
+}
+
+// Error path: Tests that UnmarshalMessage returns an error for an unknown tag.
+func TestUnmarshalMessage_UnknownTag(t *testing.T) {
+	message, err := NewMessage(1024, Tag(100), netTime.Now(), "myUsername",
+		[]byte("This is my payload."))
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+
+	if _, err = UnmarshalMessage(message); err == nil {
+		t.Errorf("Did not receive error for unknown tag.")
+	}
+}
+
+// Error path: Tests that NewMessage and UnmarshalMessage return an error for
+// usernames that contain control characters, such as terminal escape
+// sequences, or are not valid UTF-8.
+func TestUnmarshalMessage_InvalidUsername(t *testing.T) {
+	valid, err := NewMessage(1024, Default, netTime.Now(), "myUsername",
+		[]byte("This is my payload."))
+	if err != nil {
+		t.Fatalf("Failed to create new message: %+v", err)
+	}
+	start := minSize - usernameLenSize
+
+	for i, username := range []string{
+		"\x1b[2Jadmin", "user\nname", "user\u009bname", "\xffname"} {
+		_, err = NewMessage(1024, Default, netTime.Now(), username, nil)
+		if err == nil {
+			t.Errorf("Created message with invalid username %q (%d).",
+				username, i)
+		}
+
+		// Replace the username in the encoded message
+		message := append([]byte{}, valid[:start]...)
+		message = append(message, byte(len(username)))
+		message = append(message, username...)
+		message = append(message, valid[minSize+len("myUsername"):]...)
+		if _, err = UnmarshalMessage(message); err == nil {
+			t.Errorf("Unmarshalled message with invalid username %q (%d).",
+				username, i)
+		}
+	}
+}
@@ -0,0 +1,645 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Size constants.
+const (
+	modActionSize      = 1
+	modTimestampSize   = 8
+	modUsernameLenSize = 1
+	modKeyLenSize      = 1
+	modMinSize         = modActionSize + modTimestampSize +
+		modUsernameLenSize + modKeyLenSize
+)
+
+// Storage keys.
+const moderationKeyPrefix = "moderation/"
+
+// maxModerationSkew is how far past the time it is received that a moderation
+// command may be issued, to allow for clocks that are not in sync.
+const maxModerationSkew = 5 * time.Minute
+
+// Error messages.
+const (
+	// NewModerationCommand
+	errModAction      = "invalid moderation action %d"
+	errModTarget      = "exactly one of a username or identity key is required"
+	errModUsernameLen = "length of username %q cannot exceed %d"
+	errModKeySize     = "identity key of size %d does not match %d"
+
+	// ModerationCommand.Sign
+	errModSign = "failed to sign moderation command: %+v"
+
+	// ModerationCommand.Verify
+	errModNotSigned = "moderation command is not signed"
+	errModNoKey     = "channel has no RSA public key"
+	errModSignature = "moderation command signature is invalid: %+v"
+
+	// UnmarshalModerationCommand
+	errModLen = "moderation command of size %d shorter than minimum size %d"
+
+	// Moderation.receive
+	errModNotModerator = "moderation command is not sent by the channel " +
+		"admin or a moderator"
+	errModFuture = "moderation command issued at %s, more than %s after it " +
+		"was received at %s"
+	errModGrant = "moderation command issued at %s outside of the " +
+		"moderator's role grant from %s to %s"
+
+	// Moderation.Apply
+	errSaveModeration = "failed to save moderation lists for channel %s: %+v"
+
+	// Moderation.getLists
+	errLoadModeration = "failed to load moderation lists for channel %s: %+v"
+)
+
+// ModerationAction is the change a ModerationCommand makes to the mute and ban
+// lists of a channel.
+type ModerationAction uint8
+
+const (
+	// Mute hides the messages of the user.
+	Mute ModerationAction = 1
+
+	// Unmute removes the user from the mute list.
+	Unmute ModerationAction = 2
+
+	// Ban drops every message from the user on reception so that they are
+	// never displayed or saved to the history.
+	Ban ModerationAction = 3
+
+	// Unban removes the user from the ban list.
+	Unban ModerationAction = 4
+)
+
+// moderationActionStringMap correlates each ModerationAction to a
+// human-readable name.
+var moderationActionStringMap = map[ModerationAction]string{
+	Mute:   "mute",
+	Unmute: "unmute",
+	Ban:    "ban",
+	Unban:  "unban",
+}
+
+// ModerationActionByName returns the ModerationAction with the human-readable
+// name.
+func ModerationActionByName(name string) (ModerationAction, bool) {
+	for action, str := range moderationActionStringMap {
+		if str == name {
+			return action, true
+		}
+	}
+	return 0, false
+}
+
+// String returns a human-readable name for the ModerationAction. Adheres to
+// the fmt.Stringer interface.
+func (a ModerationAction) String() string {
+	str, exists := moderationActionStringMap[a]
+	if exists {
+		return str
+	}
+
+	return "INVALID MODERATION ACTION: " + strconv.FormatUint(uint64(a), 10)
+}
+
+/*
++-----------------------------------------------------------------------------+
+|                         Moderation Command Payload                          |
++--------+----------+-------------+-------------+--------+--------+-----------+
+| action | issuedAt | usernameLen |  username   | keyLen |  key   | signature |
+| 1 byte | 8 bytes  |   1 byte    | usernameLen | 1 byte | keyLen | remaining |
++--------+----------+-------------+-------------+--------+--------+-----------+
+
+Exactly one of the username or the ed25519 identity key is set. The issued time
+is in Unix nanoseconds. The signature is an RSA-PSS signature, made with the
+channel's RSA private key, of the SHA-256 hash of the channel ID followed by the
+payload preceding the signature. Commands are sent asymmetrically with the
+Moderate tag.
+
+A command is only applied if it is issued after the last command applied to the
+same user and list so that a replayed command cannot undo a later one.
+
+Moderators send commands symmetrically without the signature. Instead, the
+message is signed with their identity key and includes their RoleGrant in the
+GrantExt extension.
+*/
+
+// ModerationCommand is a signed admin instruction to add or remove a user from
+// the mute or ban list of a channel. The user is identified either by their
+// username or by the identity key they sign their messages with.
+type ModerationCommand struct {
+	Action ModerationAction
+
+	// IssuedAt is when the command was made.
+	IssuedAt time.Time
+
+	// Username is the username of the user. It is empty if Key is set.
+	Username string
+
+	// Key is the identity key of the user. It is nil if Username is set.
+	Key ed25519.PublicKey
+
+	// Signature is the channel admin's signature of the command.
+	Signature []byte
+}
+
+// NewModerationCommand returns an unsigned ModerationCommand for the user with
+// the username or identity key issued at the given time. Exactly one of the
+// username or key must be provided.
+func NewModerationCommand(action ModerationAction, username string,
+	key ed25519.PublicKey, issuedAt time.Time) (ModerationCommand, error) {
+	if _, exists := moderationActionStringMap[action]; !exists {
+		return ModerationCommand{}, errors.Errorf(errModAction, action)
+	} else if (username == "") == (key == nil) {
+		return ModerationCommand{}, errors.New(errModTarget)
+	} else if len(username) > math.MaxUint8 {
+		return ModerationCommand{}, errors.Errorf(
+			errModUsernameLen, username, math.MaxUint8)
+	} else if key != nil && len(key) != ed25519.PublicKeySize {
+		return ModerationCommand{}, errors.Errorf(
+			errModKeySize, len(key), ed25519.PublicKeySize)
+	}
+
+	// The time is truncated to its encoded precision so that unmarshalled
+	// commands are equal to the original
+	return ModerationCommand{
+		Action:   action,
+		IssuedAt: time.Unix(0, issuedAt.UnixNano()),
+		Username: username,
+		Key:      key,
+	}, nil
+}
+
+// Target returns a human-readable description of the user the command applies
+// to.
+func (mc ModerationCommand) Target() string {
+	if mc.Key != nil {
+		return "key " + Fingerprint(mc.Key)
+	}
+	return mc.Username
+}
+
+// Sign returns a copy of the command signed with the channel's RSA private
+// key.
+func (mc ModerationCommand) Sign(channelID *id.ID, pk *rsa.PrivateKey,
+	rng io.Reader) (ModerationCommand, error) {
+	hashed := sha256.Sum256(mc.signedData(channelID))
+	signature, err := rsa.Sign(rng, pk, crypto.SHA256, hashed[:], nil)
+	if err != nil {
+		return ModerationCommand{}, errors.Errorf(errModSign, err)
+	}
+
+	mc.Signature = signature
+	return mc, nil
+}
+
+// Verify checks that the command is signed with the RSA private key of the
+// channel.
+func (mc ModerationCommand) Verify(
+	channelID *id.ID, pub *rsa.PublicKey) error {
+	if len(mc.Signature) == 0 {
+		return errors.New(errModNotSigned)
+	} else if pub == nil {
+		return errors.New(errModNoKey)
+	}
+
+	hashed := sha256.Sum256(mc.signedData(channelID))
+	err := rsa.Verify(pub, crypto.SHA256, hashed[:], mc.Signature, nil)
+	if err != nil {
+		return errors.Errorf(errModSignature, err)
+	}
+
+	return nil
+}
+
+// Marshal encodes the ModerationCommand into a payload that can be sent with
+// the Moderate tag.
+func (mc ModerationCommand) Marshal() []byte {
+	return append(mc.marshalUnsigned(), mc.Signature...)
+}
+
+// UnmarshalModerationCommand decodes the payload of a message with the
+// Moderate tag into a ModerationCommand. The signature is not verified.
+func UnmarshalModerationCommand(payload []byte) (ModerationCommand, error) {
+	if len(payload) < modMinSize {
+		return ModerationCommand{}, errors.Errorf(
+			errModLen, len(payload), modMinSize)
+	}
+
+	buff := bytes.NewBuffer(payload)
+	action := ModerationAction(buff.Next(modActionSize)[0])
+	issuedAt := time.Unix(0,
+		int64(binary.BigEndian.Uint64(buff.Next(modTimestampSize))))
+	usernameLen := int(buff.Next(modUsernameLenSize)[0])
+	if buff.Len() < usernameLen+modKeyLenSize {
+		return ModerationCommand{}, errors.Errorf(
+			errModLen, len(payload), modMinSize+usernameLen)
+	}
+	username := string(buff.Next(usernameLen))
+
+	keyLen := int(buff.Next(modKeyLenSize)[0])
+	if buff.Len() < keyLen {
+		return ModerationCommand{}, errors.Errorf(
+			errModLen, len(payload), modMinSize+usernameLen+keyLen)
+	}
+	var key ed25519.PublicKey
+	if keyLen > 0 {
+		key = append(ed25519.PublicKey{}, buff.Next(keyLen)...)
+	}
+
+	mc, err := NewModerationCommand(action, username, key, issuedAt)
+	if err != nil {
+		return ModerationCommand{}, err
+	}
+
+	if buff.Len() > 0 {
+		mc.Signature = append([]byte{}, buff.Bytes()...)
+	}
+
+	return mc, nil
+}
+
+// marshalUnsigned encodes every field of the command except the signature.
+func (mc ModerationCommand) marshalUnsigned() []byte {
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(modMinSize + len(mc.Username) + len(mc.Key) + len(mc.Signature))
+
+	buff.WriteByte(uint8(mc.Action))
+	b := make([]byte, modTimestampSize)
+	binary.BigEndian.PutUint64(b, uint64(mc.IssuedAt.UnixNano()))
+	buff.Write(b)
+	buff.WriteByte(uint8(len(mc.Username)))
+	buff.WriteString(mc.Username)
+	buff.WriteByte(uint8(len(mc.Key)))
+	buff.Write(mc.Key)
+
+	return buff.Bytes()
+}
+
+// signedData returns the data signed for the command. It is made up of the
+// channel ID followed by the encoded command, including the time it was issued,
+// without the signature.
+func (mc ModerationCommand) signedData(channelID *id.ID) []byte {
+	return append(channelID.Marshal(), mc.marshalUnsigned()...)
+}
+
+// ModerationList is a list of users identified by their username or identity
+// key.
+type ModerationList struct {
+	Usernames []string            `json:"usernames,omitempty"`
+	Keys      []ed25519.PublicKey `json:"keys,omitempty"`
+}
+
+// Matches determines if the sender of the message is on the list. Identity
+// keys only match messages that are verified to be signed by that key.
+func (l ModerationList) Matches(r ReceivedBroadcast) bool {
+	for _, username := range l.Usernames {
+		if username == r.Username {
+			return true
+		}
+	}
+
+	if r.Verification != Verified {
+		return false
+	}
+	key, _ := r.Extensions.Get(SigningKeyExt)
+	for _, k := range l.Keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsEmpty determines if there are no users on the list.
+func (l ModerationList) IsEmpty() bool {
+	return len(l.Usernames) == 0 && len(l.Keys) == 0
+}
+
+// add adds the user the command applies to. Returns false if they are already
+// on the list.
+func (l *ModerationList) add(mc ModerationCommand) bool {
+	if l.index(mc) >= 0 {
+		return false
+	}
+
+	if mc.Key != nil {
+		l.Keys = append(l.Keys, mc.Key)
+	} else {
+		l.Usernames = append(l.Usernames, mc.Username)
+		sort.Strings(l.Usernames)
+	}
+
+	return true
+}
+
+// remove removes the user the command applies to. Returns false if they are
+// not on the list.
+func (l *ModerationList) remove(mc ModerationCommand) bool {
+	i := l.index(mc)
+	if i < 0 {
+		return false
+	}
+
+	if mc.Key != nil {
+		l.Keys = append(l.Keys[:i:i], l.Keys[i+1:]...)
+	} else {
+		l.Usernames = append(l.Usernames[:i:i], l.Usernames[i+1:]...)
+	}
+
+	return true
+}
+
+// index returns the position of the user the command applies to in the list
+// of usernames or keys. Returns -1 if they are not on the list.
+func (l *ModerationList) index(mc ModerationCommand) int {
+	if mc.Key != nil {
+		for i, k := range l.Keys {
+			if bytes.Equal(k, mc.Key) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for i, username := range l.Usernames {
+		if username == mc.Username {
+			return i
+		}
+	}
+	return -1
+}
+
+// ModerationLists are the users muted and banned in a channel.
+type ModerationLists struct {
+	Muted  ModerationList `json:"muted"`
+	Banned ModerationList `json:"banned"`
+
+	// Applied is the issue time of the last command applied to each user on
+	// each list, keyed by appliedKey.
+	Applied map[string]time.Time `json:"applied,omitempty"`
+}
+
+// appliedKey returns the key in ModerationLists.Applied for the list and user
+// the command applies to.
+func appliedKey(mc ModerationCommand) string {
+	list := "muted/"
+	if mc.Action == Ban || mc.Action == Unban {
+		list = "banned/"
+	}
+	if mc.Key != nil {
+		return list + "key/" + base64.StdEncoding.EncodeToString(mc.Key)
+	}
+	return list + "username/" + mc.Username
+}
+
+// Moderation contains the mute and ban lists of each channel. The lists are
+// changed by ModerationCommand messages signed by the channel admin or sent by
+// a moderator and are persisted in a key-value store.
+type Moderation struct {
+	kv ekv.KeyValue
+
+	// lists are the moderation lists of each channel that has been accessed.
+	lists map[id.ID]*ModerationLists
+
+	mux sync.Mutex
+}
+
+// NewModeration returns a Moderation stored in the key-value store. To encrypt
+// the lists, the store should be an ekv.Filestore opened with the session
+// password.
+func NewModeration(kv ekv.KeyValue) *Moderation {
+	return &Moderation{
+		kv:    kv,
+		lists: make(map[id.ID]*ModerationLists),
+	}
+}
+
+// Lists returns a copy of the mute and ban lists of the channel.
+func (m *Moderation) Lists(channelID *id.ID) (ModerationLists, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lists, err := m.getLists(channelID)
+	if err != nil {
+		return ModerationLists{}, err
+	}
+
+	return ModerationLists{
+		Muted: ModerationList{
+			Usernames: append([]string{}, lists.Muted.Usernames...),
+			Keys:      append([]ed25519.PublicKey{}, lists.Muted.Keys...),
+		},
+		Banned: ModerationList{
+			Usernames: append([]string{}, lists.Banned.Usernames...),
+			Keys:      append([]ed25519.PublicKey{}, lists.Banned.Keys...),
+		},
+	}, nil
+}
+
+// Apply changes the lists of the channel as described by the command and saves
+// them. The signature of the command must already be verified. Returns false
+// if the lists were not changed, including when the command is not issued
+// after the last command applied to the same user and list.
+func (m *Moderation) Apply(
+	channelID *id.ID, mc ModerationCommand) (bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lists, err := m.getLists(channelID)
+	if err != nil {
+		return false, err
+	}
+
+	key := appliedKey(mc)
+	if last, exists := lists.Applied[key]; exists &&
+		!mc.IssuedAt.After(last) {
+		return false, nil
+	}
+
+	var changed bool
+	switch mc.Action {
+	case Mute:
+		changed = lists.Muted.add(mc)
+	case Unmute:
+		changed = lists.Muted.remove(mc)
+	case Ban:
+		changed = lists.Banned.add(mc)
+	case Unban:
+		changed = lists.Banned.remove(mc)
+	default:
+		return false, errors.Errorf(errModAction, mc.Action)
+	}
+
+	// The time is recorded even if the lists are unchanged so that older
+	// commands are still dropped
+	if lists.Applied == nil {
+		lists.Applied = make(map[string]time.Time)
+	}
+	lists.Applied[key] = mc.IssuedAt
+
+	if err = m.kv.SetInterface(moderationKey(channelID), lists); err != nil {
+		return false, errors.Errorf(errSaveModeration, channelID, err)
+	}
+
+	return changed, nil
+}
+
+// IsMuted determines if the sender of the message is muted in the channel.
+// Admin messages are never muted.
+func (m *Moderation) IsMuted(channelID *id.ID, r ReceivedBroadcast) bool {
+	return m.matches(channelID, r, func(l *ModerationLists) ModerationList {
+		return l.Muted
+	})
+}
+
+// IsBanned determines if the sender of the message is banned from the
+// channel. Admin messages are never banned.
+func (m *Moderation) IsBanned(channelID *id.ID, r ReceivedBroadcast) bool {
+	return m.matches(channelID, r, func(l *ModerationLists) ModerationList {
+		return l.Banned
+	})
+}
+
+// Filter returns a channel that receives every message sent on the given
+// channel except those from banned users. Moderation messages are applied to
+// the lists if they are sent asymmetrically and signed with the channel's RSA
+// private key or their sender has the Moderator role; otherwise, they are
+// dropped. The role and its grant must already be set by Roles.Filter.
+// Signatures are verified with the key returned by key, which is the channel's
+// current RSA public key. The returned channel is closed when the given channel
+// or done is closed.
+func (m *Moderation) Filter(channelID *id.ID, key func() *rsa.PublicKey,
+	in chan ReceivedBroadcast, done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		if r.Tag == Moderate {
+			if err := m.receive(channelID, key, r); err != nil {
+				jww.WARN.Printf("Dropped moderation message from %q on "+
+					"channel %s: %+v", r.Username, channelID, err)
+				return r, false
+			}
+		} else if m.IsBanned(channelID, r) {
+			jww.DEBUG.Printf("Dropped %s message from banned user %q on "+
+				"channel %s.", r.Tag, r.Username, channelID)
+			return r, false
+		}
+		return r, true
+	})
+}
+
+// receive verifies the moderation message received on the channel and applies
+// its command. The command must not be issued more than maxModerationSkew
+// after it is received and, if it is sent by a moderator, must be issued while
+// the moderator's role grant is valid.
+func (m *Moderation) receive(
+	channelID *id.ID, key func() *rsa.PublicKey, r ReceivedBroadcast) error {
+	if !r.Asymmetric && r.Role != Moderator {
+		return errors.New(errModNotModerator)
+	}
+
+	mc, err := UnmarshalModerationCommand(r.Message)
+	if err != nil {
+		return err
+	}
+	if r.Asymmetric {
+		if err = mc.Verify(channelID, key()); err != nil {
+			return err
+		}
+	}
+
+	// Commands are bound to when they are received and, for moderators, to
+	// their grant so that a moderator cannot issue a command that outlasts
+	// their role or takes precedence over later commands from the admin
+	if mc.IssuedAt.After(r.ReceivedTime.Add(maxModerationSkew)) {
+		return errors.Errorf(
+			errModFuture, mc.IssuedAt, maxModerationSkew, r.ReceivedTime)
+	}
+	if !r.Asymmetric && (r.Grant == nil || !r.Grant.Covers(mc.IssuedAt)) {
+		var from, to time.Time
+		if r.Grant != nil {
+			from, to = r.Grant.IssuedAt, r.Grant.Expires
+		}
+		return errors.Errorf(errModGrant, mc.IssuedAt, from, to)
+	}
+
+	changed, err := m.Apply(channelID, mc)
+	if err != nil {
+		return err
+	}
+	if changed {
+		jww.INFO.Printf("Applied moderation command %s %s from %q on "+
+			"channel %s.", mc.Action, mc.Target(), r.Username, channelID)
+	}
+
+	return nil
+}
+
+// matches determines if the sender of the message is on the list of the
+// channel returned by get. Asymmetric messages never match.
+func (m *Moderation) matches(channelID *id.ID, r ReceivedBroadcast,
+	get func(*ModerationLists) ModerationList) bool {
+	if r.Asymmetric {
+		return false
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lists, err := m.getLists(channelID)
+	if err != nil {
+		jww.ERROR.Printf("%+v", err)
+		return false
+	}
+
+	return get(lists).Matches(r)
+}
+
+// getLists returns the moderation lists for the channel, loading them from
+// storage if they have not yet been accessed. Must be called while the lock is
+// held.
+func (m *Moderation) getLists(channelID *id.ID) (*ModerationLists, error) {
+	if lists, exists := m.lists[*channelID]; exists {
+		return lists, nil
+	}
+
+	lists := &ModerationLists{}
+	err := m.kv.GetInterface(moderationKey(channelID), lists)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadModeration, channelID, err)
+	}
+
+	m.lists[*channelID] = lists
+	return lists, nil
+}
+
+// moderationKey returns the storage key for the moderation lists of a channel.
+func moderationKey(channelID *id.ID) string {
+	return moderationKeyPrefix + channelID.String()
+}
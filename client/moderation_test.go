@@ -0,0 +1,366 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// signedCommand returns a ModerationCommand issued now and signed with the
+// private key.
+func signedCommand(t *testing.T, channelID *id.ID, pk *rsa.PrivateKey,
+	action ModerationAction, username string,
+	key ed25519.PublicKey) ModerationCommand {
+	return signedCommandAt(t, channelID, pk, action, username, key, time.Now())
+}
+
+// signedCommandAt returns a ModerationCommand issued at the given time and
+// signed with the private key.
+func signedCommandAt(t *testing.T, channelID *id.ID, pk *rsa.PrivateKey,
+	action ModerationAction, username string, key ed25519.PublicKey,
+	issuedAt time.Time) ModerationCommand {
+	mc, err := NewModerationCommand(action, username, key, issuedAt)
+	if err != nil {
+		t.Fatalf("Failed to create moderation command: %+v", err)
+	}
+
+	mc, err = mc.Sign(channelID, pk, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to sign moderation command: %+v", err)
+	}
+
+	return mc
+}
+
+// Tests that a ModerationCommand marshalled and unmarshalled matches the
+// original and that its signature is verified with the channel's public key.
+func TestModerationCommand_Marshal_Verify(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, mc := range []ModerationCommand{
+		signedCommand(t, channelID, pk, Mute, "alice", nil),
+		signedCommand(t, channelID, pk, Unban, "", key),
+	} {
+		received, err := UnmarshalModerationCommand(mc.Marshal())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal moderation command: %+v", err)
+		}
+		if !reflect.DeepEqual(mc, received) {
+			t.Errorf("Unmarshalled command does not match original."+
+				"\nexpected: %+v\nreceived: %+v", mc, received)
+		}
+
+		if err = received.Verify(channelID, pk.GetPublic()); err != nil {
+			t.Errorf("Failed to verify command: %+v", err)
+		}
+	}
+}
+
+// Error path: Tests that ModerationCommand.Verify rejects commands that are
+// unsigned, changed after signing, or signed for another channel or with
+// another key.
+func TestModerationCommand_Verify_Invalid(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+
+	mc := signedCommand(t, channelID, pk, Ban, "alice", nil)
+	changed := mc
+	changed.Username = "bob"
+	replayed := mc
+	replayed.IssuedAt = mc.IssuedAt.Add(time.Hour)
+	unsigned := mc
+	unsigned.Signature = nil
+
+	tests := []struct {
+		mc        ModerationCommand
+		channelID *id.ID
+		pub       *rsa.PublicKey
+	}{
+		{unsigned, channelID, pk.GetPublic()},
+		{changed, channelID, pk.GetPublic()},
+		{replayed, channelID, pk.GetPublic()},
+		{mc, id.NewIdFromString("other", id.User, t), pk.GetPublic()},
+		{mc, channelID, other.GetPublic()},
+		{mc, channelID, nil},
+	}
+
+	for i, tt := range tests {
+		if err = tt.mc.Verify(tt.channelID, tt.pub); err == nil {
+			t.Errorf("Verified invalid command (%d).", i)
+		}
+	}
+}
+
+// Error path: Tests that NewModerationCommand requires a valid action and
+// exactly one of a username or identity key.
+func TestNewModerationCommand_Invalid(t *testing.T) {
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		action   ModerationAction
+		username string
+		key      ed25519.PublicKey
+	}{
+		{0, "alice", nil},
+		{Mute, "", nil},
+		{Mute, "alice", key},
+		{Mute, "", key[:16]},
+	}
+
+	for i, tt := range tests {
+		_, err := NewModerationCommand(
+			tt.action, tt.username, tt.key, time.Now())
+		if err == nil {
+			t.Errorf("Created invalid command (%d).", i)
+		}
+	}
+}
+
+// Tests that Moderation.Filter applies signed moderation messages, drops
+// unsigned ones, and drops messages from banned users while muted users are
+// only reported as muted.
+func TestModeration_Filter(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	kv := ekv.MakeMemstore()
+	m := NewModeration(kv)
+
+	signer, _, _ := ed25519.GenerateKey(rand.Reader)
+	signed := ReceivedBroadcast{Tag: Default, Username: "mallory",
+		Verification: Verified,
+		Extensions:   Extensions{{SigningKeyExt, signer}}}
+	admin := func(mc ModerationCommand, asymmetric bool) ReceivedBroadcast {
+		return ReceivedBroadcast{Tag: Moderate, Username: "admin",
+			Message: mc.Marshal(), ReceivedTime: time.Now(),
+			Asymmetric: asymmetric}
+	}
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := m.Filter(channelID, pk.GetPublic, in, nil)
+	in <- admin(signedCommand(t, channelID, pk, Mute, "alice", nil), true)
+	in <- admin(signedCommand(t, channelID, pk, Ban, "", signer), true)
+	in <- admin(signedCommand(t, channelID, pk, Ban, "bob", nil), false)
+	in <- ReceivedBroadcast{Tag: Default, Username: "alice"}
+	in <- ReceivedBroadcast{Tag: Default, Username: "bob"}
+	in <- signed
+	close(in)
+
+	var received []ReceivedBroadcast
+	for r := range out {
+		received = append(received, r)
+	}
+
+	if len(received) != 4 {
+		t.Fatalf("Unexpected number of messages received."+
+			"\nexpected: %d\nreceived: %d", 4, len(received))
+	}
+	if received[2].Username != "alice" || received[3].Username != "bob" {
+		t.Errorf("Unexpected messages received: %+v", received[2:])
+	}
+	if !m.IsMuted(channelID, received[2]) {
+		t.Errorf("Message from alice is not muted.")
+	}
+	if m.IsMuted(channelID, received[3]) ||
+		m.IsBanned(channelID, received[3]) {
+		t.Errorf("Message from bob is muted or banned.")
+	}
+
+	unverified := signed
+	unverified.Verification = Impersonation
+	if m.IsBanned(channelID, unverified) {
+		t.Errorf("Message that is not verified banned by identity key.")
+	}
+
+	// The lists are loaded from storage by a new Moderation
+	lists, err := NewModeration(kv).Lists(channelID)
+	if err != nil {
+		t.Fatalf("Failed to load lists: %+v", err)
+	}
+	expected := ModerationLists{
+		Muted:  ModerationList{Usernames: []string{"alice"}},
+		Banned: ModerationList{Keys: []ed25519.PublicKey{signer}},
+	}
+	if !reflect.DeepEqual(expected.Muted.Usernames, lists.Muted.Usernames) ||
+		!reflect.DeepEqual(expected.Banned.Keys, lists.Banned.Keys) ||
+		len(lists.Muted.Keys) != 0 || len(lists.Banned.Usernames) != 0 {
+		t.Errorf("Unexpected lists.\nexpected: %+v\nreceived: %+v",
+			expected, lists)
+	}
+}
+
+// Tests that Moderation.Filter drops commands issued more than
+// maxModerationSkew after they are received and commands from moderators
+// issued outside of their role grant, such as after it expires.
+func TestModeration_Filter_IssuedAt(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	m := NewModeration(ekv.MakeMemstore())
+
+	received := time.Unix(10000, 0)
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	expiring, err := NewRoleGrant(Moderator, key, received.Add(-time.Hour),
+		received.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create role grant: %+v", err)
+	}
+	valid, err := NewRoleGrant(
+		Moderator, key, received.Add(-time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create role grant: %+v", err)
+	}
+
+	command := func(username string, issuedAt time.Time) []byte {
+		mc, err := NewModerationCommand(Ban, username, nil, issuedAt)
+		if err != nil {
+			t.Fatalf("Failed to create moderation command: %+v", err)
+		}
+		return mc.Marshal()
+	}
+	future := received.Add(maxModerationSkew + time.Second)
+
+	for i, tt := range []struct {
+		r       ReceivedBroadcast
+		applied bool
+	}{
+		{ReceivedBroadcast{Message: signedCommandAt(t, channelID, pk, Ban,
+			"alice", nil, future).Marshal(), Asymmetric: true}, false},
+		{ReceivedBroadcast{Message: command("bob", future), Role: Moderator,
+			Grant: &valid}, false},
+		{ReceivedBroadcast{Message: command("carol",
+			received.Add(2*time.Minute)), Role: Moderator,
+			Grant: &expiring}, false},
+		{ReceivedBroadcast{Message: command("dave",
+			received.Add(-90*time.Minute)), Role: Moderator,
+			Grant: &valid}, false},
+		{ReceivedBroadcast{Message: command("erin",
+			received.Add(-time.Minute)), Role: Moderator}, false},
+		{ReceivedBroadcast{Message: command("frank",
+			received.Add(maxModerationSkew)), Role: Moderator,
+			Grant: &valid}, true},
+	} {
+		tt.r.Tag, tt.r.ReceivedTime = Moderate, received
+		err = m.receive(channelID, pk.GetPublic, tt.r)
+		if tt.applied && err != nil {
+			t.Errorf("Failed to apply command (%d): %+v", i, err)
+		} else if !tt.applied && err == nil {
+			t.Errorf("Applied command that should be dropped (%d).", i)
+		}
+	}
+
+	for _, username := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		if m.IsBanned(channelID, ReceivedBroadcast{Username: username}) {
+			t.Errorf("User %q banned by a dropped command.", username)
+		}
+	}
+}
+
+// Tests that Moderation.Apply removes users added to the lists and reports
+// when the lists are unchanged.
+func TestModeration_Apply(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	m := NewModeration(ekv.MakeMemstore())
+
+	issuedAt := time.Unix(1000, 0)
+	for i, tt := range []struct {
+		action  ModerationAction
+		changed bool
+	}{{Mute, true}, {Mute, false}, {Unmute, true}, {Unmute, false}} {
+		issuedAt = issuedAt.Add(time.Second)
+		mc, err := NewModerationCommand(tt.action, "alice", nil, issuedAt)
+		if err != nil {
+			t.Fatalf("Failed to create moderation command: %+v", err)
+		}
+
+		changed, err := m.Apply(channelID, mc)
+		if err != nil {
+			t.Errorf("Failed to apply command (%d): %+v", i, err)
+		} else if changed != tt.changed {
+			t.Errorf("Unexpected change (%d).\nexpected: %t\nreceived: %t",
+				i, tt.changed, changed)
+		}
+	}
+
+	if m.IsMuted(channelID, ReceivedBroadcast{Username: "alice"}) {
+		t.Errorf("User is muted after being unmuted.")
+	}
+}
+
+// Tests that Moderation.Apply drops commands that are not issued after the last
+// command applied to the same user and list so that a replayed Unban cannot
+// undo a later Ban, while commands for other lists and users still apply.
+func TestModeration_Apply_Replay(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	kv := ekv.MakeMemstore()
+	m := NewModeration(kv)
+	bob := ReceivedBroadcast{Username: "bob"}
+
+	command := func(action ModerationAction, username string,
+		issuedAt int64) ModerationCommand {
+		mc, err := NewModerationCommand(
+			action, username, nil, time.Unix(issuedAt, 0))
+		if err != nil {
+			t.Fatalf("Failed to create moderation command: %+v", err)
+		}
+		return mc
+	}
+
+	unban := command(Unban, "bob", 10)
+	for i, tt := range []struct {
+		mc      ModerationCommand
+		changed bool
+	}{
+		{command(Ban, "bob", 5), true},
+		{unban, true},
+		{command(Ban, "bob", 20), true},
+		{unban, false},
+		{command(Unban, "bob", 20), false},
+		{command(Mute, "bob", 1), true},
+		{command(Ban, "alice", 1), true},
+	} {
+		changed, err := m.Apply(channelID, tt.mc)
+		if err != nil {
+			t.Errorf("Failed to apply command (%d): %+v", i, err)
+		} else if changed != tt.changed {
+			t.Errorf("Unexpected change (%d).\nexpected: %t\nreceived: %t",
+				i, tt.changed, changed)
+		}
+	}
+
+	if !m.IsBanned(channelID, bob) || !m.IsMuted(channelID, bob) {
+		t.Errorf("Replayed command undid a later command.")
+	}
+
+	// The times are loaded from storage by a new Moderation
+	if changed, _ := NewModeration(kv).Apply(channelID, unban); changed {
+		t.Errorf("Replayed command applied after reloading the lists.")
+	}
+}
@@ -0,0 +1,158 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HeartbeatInterval is how often a Heartbeat message is sent while in a
+	// channel.
+	HeartbeatInterval = 30 * time.Second
+
+	// PresenceTimeout is how long a user is considered online after the last
+	// message received from them. It allows one heartbeat to be lost and is
+	// the default idle period of a Roster.
+	PresenceTimeout = 2*HeartbeatInterval + 15*time.Second
+
+	// TypingInterval is the minimum time between Typing messages sent while a
+	// message is being written.
+	TypingInterval = 4 * time.Second
+
+	// TypingTimeout is how long a user is considered to be typing after the
+	// last Typing message received from them.
+	TypingTimeout = 2*TypingInterval + 2*time.Second
+)
+
+// Presence tracks which users in a channel are online and typing from the
+// messages received from them. Users expire when no message has been received
+// from them within PresenceTimeout, so that users whose client crashed without
+// sending an Exit message are eventually removed.
+type Presence struct {
+	// online and typing map the username of each user to the time they were
+	// last seen online or typing.
+	online map[string]time.Time
+	typing map[string]time.Time
+
+	mux sync.Mutex
+}
+
+// NewPresence returns a new Presence with no users.
+func NewPresence() *Presence {
+	return &Presence{
+		online: make(map[string]time.Time),
+		typing: make(map[string]time.Time),
+	}
+}
+
+// Update updates the presence of the sender of the received message. Any
+// message marks the sender as online; an Exit message removes them. Typing
+// messages mark the sender as typing until they send a message or the
+// indicator expires. Messages from impersonators are ignored.
+func (p *Presence) Update(r ReceivedBroadcast) {
+	if r.Verification == Impersonation {
+		return
+	}
+	seen := seenAt(r)
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	switch r.Tag {
+	case Exit:
+		delete(p.online, r.Username)
+		delete(p.typing, r.Username)
+		return
+	case Typing:
+		if seen.After(p.typing[r.Username]) {
+			p.typing[r.Username] = seen
+		}
+	case Default, Admin, File:
+		delete(p.typing, r.Username)
+	}
+
+	if seen.After(p.online[r.Username]) {
+		p.online[r.Username] = seen
+	}
+}
+
+// Online returns the sorted usernames of the users online at the given time.
+func (p *Presence) Online(now time.Time) []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return active(p.online, now, PresenceTimeout)
+}
+
+// Typing returns the sorted usernames of the users typing at the given time.
+func (p *Presence) Typing(now time.Time) []string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return active(p.typing, now, TypingTimeout)
+}
+
+// active removes every user last seen before the timeout and returns the
+// sorted usernames of the remaining users.
+func active(users map[string]time.Time, now time.Time,
+	timeout time.Duration) []string {
+	usernames := make([]string, 0, len(users))
+	for username, seen := range users {
+		if now.Sub(seen) > timeout {
+			delete(users, username)
+		} else {
+			usernames = append(usernames, username)
+		}
+	}
+
+	sort.Strings(usernames)
+	return usernames
+}
+
+// seenAt returns the time the sender of the received message was last seen.
+// The sender's clock is not trusted beyond the time the message arrived.
+func seenAt(r ReceivedBroadcast) time.Time {
+	if r.Timestamp.IsZero() || r.Timestamp.After(r.ReceivedTime) {
+		return r.ReceivedTime
+	}
+	return r.Timestamp
+}
+
+// Throttle limits how often an action is performed.
+type Throttle struct {
+	interval time.Duration
+	last     time.Time
+	mux      sync.Mutex
+}
+
+// NewThrottle returns a Throttle that allows an action at most once per
+// interval.
+func NewThrottle(interval time.Duration) *Throttle {
+	return &Throttle{interval: interval}
+}
+
+// Allow determines if the action may be performed at the given time. If it
+// may, then the time is recorded as the last time it was performed.
+func (t *Throttle) Allow(now time.Time) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		return false
+	}
+	t.last = now
+	return true
+}
+
+// Reset allows the next action immediately.
+func (t *Throttle) Reset() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.last = time.Time{}
+}
@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that Presence.Update marks senders online and typing and that
+// Presence.Online and Presence.Typing expire them after their timeouts.
+func TestPresence_Update(t *testing.T) {
+	p := NewPresence()
+	start := time.Unix(1000, 0)
+
+	p.Update(ReceivedBroadcast{Tag: Join, Username: "alice",
+		Timestamp: start, ReceivedTime: start})
+	p.Update(ReceivedBroadcast{Tag: Typing, Username: "bob",
+		Timestamp: start, ReceivedTime: start})
+
+	if online := p.Online(start); !reflect.DeepEqual(
+		online, []string{"alice", "bob"}) {
+		t.Errorf("Unexpected online users: %v", online)
+	}
+	if typing := p.Typing(start); !reflect.DeepEqual(typing, []string{"bob"}) {
+		t.Errorf("Unexpected typing users: %v", typing)
+	}
+
+	expired := start.Add(TypingTimeout + time.Second)
+	if typing := p.Typing(expired); len(typing) != 0 {
+		t.Errorf("Typing indicator did not expire: %v", typing)
+	}
+
+	heartbeat := start.Add(HeartbeatInterval)
+	p.Update(ReceivedBroadcast{Tag: Heartbeat, Username: "alice",
+		Timestamp: heartbeat, ReceivedTime: heartbeat})
+
+	online := p.Online(start.Add(PresenceTimeout + time.Second))
+	if !reflect.DeepEqual(online, []string{"alice"}) {
+		t.Errorf("Unexpected online users after timeout: %v", online)
+	}
+}
+
+// Tests that sending a message clears the typing indicator of the sender and
+// that an Exit message removes them.
+func TestPresence_Update_MessageAndExit(t *testing.T) {
+	p := NewPresence()
+	now := time.Unix(1000, 0)
+
+	p.Update(ReceivedBroadcast{Tag: Typing, Username: "alice",
+		Timestamp: now, ReceivedTime: now})
+	p.Update(ReceivedBroadcast{Tag: Default, Username: "alice",
+		Timestamp: now, ReceivedTime: now})
+
+	if typing := p.Typing(now); len(typing) != 0 {
+		t.Errorf("Typing indicator not cleared by message: %v", typing)
+	}
+
+	p.Update(ReceivedBroadcast{Tag: Exit, Username: "alice",
+		Timestamp: now, ReceivedTime: now})
+	if online := p.Online(now); len(online) != 0 {
+		t.Errorf("User still online after exit: %v", online)
+	}
+}
+
+// Tests that Presence.Update ignores impersonators and does not let a sender
+// extend their presence with a timestamp in the future.
+func TestPresence_Update_Untrusted(t *testing.T) {
+	p := NewPresence()
+	now := time.Unix(1000, 0)
+
+	p.Update(ReceivedBroadcast{Tag: Heartbeat, Username: "alice",
+		Timestamp: now, ReceivedTime: now, Verification: Impersonation})
+	if online := p.Online(now); len(online) != 0 {
+		t.Errorf("Impersonator marked online: %v", online)
+	}
+
+	p.Update(ReceivedBroadcast{Tag: Heartbeat, Username: "bob",
+		Timestamp: now.Add(time.Hour), ReceivedTime: now})
+	expired := now.Add(PresenceTimeout + time.Second)
+	if online := p.Online(expired); len(online) != 0 {
+		t.Errorf("Future timestamp extended presence: %v", online)
+	}
+}
+
+// Tests that Throttle.Allow allows at most one action per interval and that
+// Throttle.Reset allows the next action immediately.
+func TestThrottle_Allow(t *testing.T) {
+	th := NewThrottle(time.Second)
+	now := time.Unix(1000, 0)
+
+	if !th.Allow(now) {
+		t.Errorf("First action not allowed.")
+	}
+	if th.Allow(now.Add(500 * time.Millisecond)) {
+		t.Errorf("Action allowed before interval elapsed.")
+	}
+	if !th.Allow(now.Add(time.Second)) {
+		t.Errorf("Action not allowed after interval elapsed.")
+	}
+
+	th.Reset()
+	if !th.Allow(now.Add(time.Second + time.Millisecond)) {
+		t.Errorf("Action not allowed after reset.")
+	}
+}
@@ -0,0 +1,47 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxReactionLen is the maximum length, in bytes, of a reaction.
+const MaxReactionLen = 32
+
+// Error messages.
+const (
+	// ValidateReaction
+	errReactionEmpty   = "reaction cannot be empty"
+	errReactionLen     = "reaction of %d bytes exceeds maximum of %d bytes"
+	errReactionUTF8    = "reaction is not valid UTF-8"
+	errReactionControl = "reaction cannot contain control characters"
+	errReactionSpace   = "reaction cannot start or end with whitespace"
+)
+
+// ValidateReaction returns an error if the reaction is not a short, single line
+// of text that can be sent in a Reaction message.
+func ValidateReaction(reaction string) error {
+	switch {
+	case len(reaction) == 0:
+		return errors.New(errReactionEmpty)
+	case len(reaction) > MaxReactionLen:
+		return errors.Errorf(errReactionLen, len(reaction), MaxReactionLen)
+	case !utf8.ValidString(reaction):
+		return errors.New(errReactionUTF8)
+	case strings.IndexFunc(reaction, unicode.IsControl) != -1:
+		return errors.New(errReactionControl)
+	case strings.TrimSpace(reaction) != reaction:
+		return errors.New(errReactionSpace)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests that ValidateReaction accepts short single-line reactions.
+func TestValidateReaction(t *testing.T) {
+	reactions := []string{"seen", "on it", "👍", "+1",
+		strings.Repeat("a", MaxReactionLen)}
+
+	for _, reaction := range reactions {
+		if err := ValidateReaction(reaction); err != nil {
+			t.Errorf("Failed to validate reaction %q: %+v", reaction, err)
+		}
+	}
+}
+
+// Error path: Tests that ValidateReaction rejects empty, long, multi-line, and
+// padded reactions.
+func TestValidateReaction_Invalid(t *testing.T) {
+	reactions := []string{"", strings.Repeat("a", MaxReactionLen+1),
+		"on\nit", "seen\x1b[31m", " seen", "seen ", "\xff"}
+
+	for _, reaction := range reactions {
+		if err := ValidateReaction(reaction); err == nil {
+			t.Errorf("Validated invalid reaction %q.", reaction)
+		}
+	}
+}
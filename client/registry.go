@@ -0,0 +1,275 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/ekv"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Storage keys.
+const registryKey = "registry"
+
+// Error messages.
+const (
+	// Registry.Add
+	errRegistryNoChannel = "no channel file or invite for alias %q"
+	errRegistryExists    = "alias %q is already registered"
+	errRegistryAbsPath   = "failed to get absolute path of %q: %+v"
+
+	// Registry.Remove and Registry.Rename
+	errRegistryNoAlias = "alias %q is not registered"
+
+	// CheckAlias
+	errRegistryAlias = "invalid alias %q: an alias is 1 to 64 letters, " +
+		"digits, dots, dashes, or underscores and cannot start with a dot or " +
+		"dash"
+
+	// Registry.save
+	errSaveRegistry = "failed to save channel registry: %+v"
+
+	// Registry.getEntries
+	errLoadRegistry = "failed to load channel registry: %+v"
+)
+
+// aliasRegex matches valid aliases. Aliases cannot contain path separators so
+// that they are never mistaken for paths.
+var aliasRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`)
+
+// RegistryEntry is a channel registered under an alias.
+type RegistryEntry struct {
+	// Alias is the short name the channel is registered under.
+	Alias string `json:"alias"`
+
+	// Name is the name of the channel when it was registered.
+	Name string `json:"name"`
+
+	// Channel is the absolute path to the channel file or an invite link.
+	Channel string `json:"channel"`
+
+	// Key is the absolute path to the RSA private key PEM file of the
+	// channel. It is empty if the default location is used.
+	Key string `json:"key,omitempty"`
+
+	// Username is the username to join the channel with by default.
+	Username string `json:"username,omitempty"`
+}
+
+// registryEntries are the entries in the Registry.
+type registryEntries struct {
+	// Entries are the registered channels in order of alias.
+	Entries []RegistryEntry `json:"entries,omitempty"`
+}
+
+// Registry is a local address book of channels that maps short aliases to
+// channel files, RSA private keys, and default usernames. It is persisted in a
+// key-value store.
+type Registry struct {
+	kv ekv.KeyValue
+
+	// entries are the registered channels, or nil if they have not yet been
+	// loaded from storage.
+	entries map[string]RegistryEntry
+
+	mux sync.Mutex
+}
+
+// NewRegistry returns a Registry stored in the key-value store. To encrypt it,
+// the store should be an ekv.Filestore opened with the session password.
+func NewRegistry(kv ekv.KeyValue) *Registry {
+	return &Registry{kv: kv}
+}
+
+// CheckAlias returns an error if the alias is not a valid alias.
+func CheckAlias(alias string) error {
+	if !aliasRegex.MatchString(alias) {
+		return errors.Errorf(errRegistryAlias, alias)
+	}
+	return nil
+}
+
+// Add registers the channel under its alias. Relative paths to the channel
+// file and key are made absolute so that the entry can be used from any
+// directory. Returns an error if the alias is invalid or already registered.
+func (r *Registry) Add(e RegistryEntry) error {
+	if err := CheckAlias(e.Alias); err != nil {
+		return err
+	} else if e.Channel == "" {
+		return errors.Errorf(errRegistryNoChannel, e.Alias)
+	}
+
+	var err error
+	if !IsInvite(e.Channel) {
+		if e.Channel, err = absPath(e.Channel); err != nil {
+			return err
+		}
+	}
+	if e.Key != "" {
+		if e.Key, err = absPath(e.Key); err != nil {
+			return err
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries, err := r.getEntries()
+	if err != nil {
+		return err
+	} else if _, exists := entries[e.Alias]; exists {
+		return errors.Errorf(errRegistryExists, e.Alias)
+	}
+
+	entries[e.Alias] = e
+	if err = r.save(); err != nil {
+		delete(entries, e.Alias)
+		return err
+	}
+	return nil
+}
+
+// Get returns the channel registered under the alias and true, or false if
+// the alias is not registered.
+func (r *Registry) Get(alias string) (RegistryEntry, bool, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries, err := r.getEntries()
+	if err != nil {
+		return RegistryEntry{}, false, err
+	}
+
+	e, exists := entries[alias]
+	return e, exists, nil
+}
+
+// List returns every registered channel in order of alias.
+func (r *Registry) List() ([]RegistryEntry, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries, err := r.getEntries()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEntries(entries), nil
+}
+
+// Remove removes the channel registered under the alias. The channel file and
+// key are not deleted. Returns an error if the alias is not registered.
+func (r *Registry) Remove(alias string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries, err := r.getEntries()
+	if err != nil {
+		return err
+	}
+
+	e, exists := entries[alias]
+	if !exists {
+		return errors.Errorf(errRegistryNoAlias, alias)
+	}
+
+	delete(entries, alias)
+	if err = r.save(); err != nil {
+		entries[alias] = e
+		return err
+	}
+	return nil
+}
+
+// Rename moves the channel registered under the old alias to the new alias.
+// Returns an error if the old alias is not registered or if the new alias is
+// invalid or already registered.
+func (r *Registry) Rename(oldAlias, newAlias string) error {
+	if err := CheckAlias(newAlias); err != nil {
+		return err
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries, err := r.getEntries()
+	if err != nil {
+		return err
+	}
+
+	e, exists := entries[oldAlias]
+	if !exists {
+		return errors.Errorf(errRegistryNoAlias, oldAlias)
+	} else if _, exists = entries[newAlias]; exists {
+		return errors.Errorf(errRegistryExists, newAlias)
+	}
+
+	delete(entries, oldAlias)
+	e.Alias = newAlias
+	entries[newAlias] = e
+	if err = r.save(); err != nil {
+		delete(entries, newAlias)
+		e.Alias = oldAlias
+		entries[oldAlias] = e
+		return err
+	}
+	return nil
+}
+
+// save saves the entries to storage. Must be called while the lock is held.
+func (r *Registry) save() error {
+	err := r.kv.SetInterface(
+		registryKey, &registryEntries{sortedEntries(r.entries)})
+	if err != nil {
+		return errors.Errorf(errSaveRegistry, err)
+	}
+	return nil
+}
+
+// getEntries returns the registered channels, loading them from storage if
+// they have not yet been loaded. Must be called while the lock is held.
+func (r *Registry) getEntries() (map[string]RegistryEntry, error) {
+	if r.entries != nil {
+		return r.entries, nil
+	}
+
+	stored := &registryEntries{}
+	err := r.kv.GetInterface(registryKey, stored)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadRegistry, err)
+	}
+
+	r.entries = make(map[string]RegistryEntry, len(stored.Entries))
+	for _, e := range stored.Entries {
+		r.entries[e.Alias] = e
+	}
+	return r.entries, nil
+}
+
+// sortedEntries returns the entries in order of alias.
+func sortedEntries(entries map[string]RegistryEntry) []RegistryEntry {
+	list := make([]RegistryEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Alias < list[j].Alias
+	})
+	return list
+}
+
+// absPath returns the absolute path of the path.
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Errorf(errRegistryAbsPath, path, err)
+	}
+	return abs, nil
+}
@@ -0,0 +1,153 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/elixxir/ekv"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that channels added to a Registry are returned by Get and List, with
+// relative paths made absolute, and are loaded by a new Registry on the same
+// store.
+func TestRegistry_Add_Get_List(t *testing.T) {
+	kv := ekv.MakeMemstore()
+	r := NewRegistry(kv)
+
+	channel, _ := newTestChannel(t)
+	invite, err := NewInvite(channel, nil)
+	if err != nil {
+		t.Fatalf("Failed to make invite: %+v", err)
+	}
+
+	added := []RegistryEntry{
+		{Alias: "team", Name: "Team", Channel: "team.xxchan",
+			Key: "keys/team.pem", Username: "alice"},
+		{Alias: "news", Name: "News", Channel: invite},
+	}
+	for _, e := range added {
+		if err = r.Add(e); err != nil {
+			t.Fatalf("Failed to add %q: %+v", e.Alias, err)
+		}
+	}
+
+	team, exists, err := r.Get("team")
+	if err != nil || !exists {
+		t.Fatalf("Failed to get %q (exists: %t): %+v", "team", exists, err)
+	}
+	for _, path := range []string{team.Channel, team.Key} {
+		if !filepath.IsAbs(path) {
+			t.Errorf("Path %q is not absolute.", path)
+		}
+	}
+	if filepath.Base(team.Channel) != "team.xxchan" {
+		t.Errorf("Unexpected channel path %q.", team.Channel)
+	}
+
+	news, _, _ := r.Get("news")
+	if news.Channel != invite {
+		t.Errorf("Invite changed.\nexpected: %q\nreceived: %q",
+			invite, news.Channel)
+	}
+
+	if _, exists, _ = r.Get("missing"); exists {
+		t.Errorf("Got unregistered alias.")
+	}
+
+	expected := []RegistryEntry{news, team}
+	for i, reg := range []*Registry{r, NewRegistry(kv)} {
+		list, err := reg.List()
+		if err != nil {
+			t.Fatalf("Failed to list entries (%d): %+v", i, err)
+		}
+		if !reflect.DeepEqual(expected, list) {
+			t.Errorf("Unexpected entries (%d).\nexpected: %+v\nreceived: %+v",
+				i, expected, list)
+		}
+	}
+}
+
+// Error path: Tests that Registry.Add rejects invalid and duplicate aliases
+// and entries without a channel.
+func TestRegistry_Add_Invalid(t *testing.T) {
+	r := NewRegistry(ekv.MakeMemstore())
+	err := r.Add(RegistryEntry{Alias: "team", Channel: "a.xxchan"})
+	if err != nil {
+		t.Fatalf("Failed to add alias: %+v", err)
+	}
+
+	tests := []RegistryEntry{
+		{Alias: "team", Channel: "b.xxchan"},
+		{Alias: "", Channel: "b.xxchan"},
+		{Alias: "dir/team", Channel: "b.xxchan"},
+		{Alias: ".team", Channel: "b.xxchan"},
+		{Alias: "-team", Channel: "b.xxchan"},
+		{Alias: "my team", Channel: "b.xxchan"},
+		{Alias: InvitePrefix + "team", Channel: "b.xxchan"},
+		{Alias: "other"},
+	}
+	for i, e := range tests {
+		if err = r.Add(e); err == nil {
+			t.Errorf("Added invalid entry %+v (%d).", e, i)
+		}
+	}
+
+	list, _ := r.List()
+	if len(list) != 1 {
+		t.Errorf("Expected 1 entry, found %d: %+v", len(list), list)
+	}
+}
+
+// Tests that Registry.Rename moves an entry to the new alias and that
+// Registry.Remove removes it, and that both persist to storage.
+func TestRegistry_Rename_Remove(t *testing.T) {
+	kv := ekv.MakeMemstore()
+	r := NewRegistry(kv)
+	for _, alias := range []string{"team", "news"} {
+		err := r.Add(RegistryEntry{Alias: alias, Channel: alias + ".xxchan"})
+		if err != nil {
+			t.Fatalf("Failed to add %q: %+v", alias, err)
+		}
+	}
+
+	if err := r.Rename("team", "team.dev"); err != nil {
+		t.Fatalf("Failed to rename alias: %+v", err)
+	}
+	e, exists, _ := NewRegistry(kv).Get("team.dev")
+	if !exists || e.Alias != "team.dev" ||
+		filepath.Base(e.Channel) != "team.xxchan" {
+		t.Errorf("Unexpected renamed entry (exists: %t): %+v", exists, e)
+	}
+	if _, exists, _ = NewRegistry(kv).Get("team"); exists {
+		t.Errorf("Old alias still registered after rename.")
+	}
+
+	for i, names := range [][2]string{
+		{"team", "other"}, {"news", "team.dev"}, {"news", "bad/alias"}} {
+		if err := r.Rename(names[0], names[1]); err == nil {
+			t.Errorf("Renamed %q to %q (%d).", names[0], names[1], i)
+		}
+	}
+
+	if err := r.Remove("news"); err != nil {
+		t.Fatalf("Failed to remove alias: %+v", err)
+	}
+	if err := r.Remove("news"); err == nil {
+		t.Errorf("Removed alias that is not registered.")
+	}
+
+	list, err := NewRegistry(kv).List()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %+v", err)
+	}
+	if len(list) != 1 || list[0].Alias != "team.dev" {
+		t.Errorf("Unexpected entries after remove: %+v", list)
+	}
+}
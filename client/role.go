@@ -0,0 +1,612 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Size constants.
+const (
+	grantRoleSize      = 1
+	grantTimestampSize = 8
+	grantMinSize       = grantRoleSize + 2*grantTimestampSize +
+		ed25519.PublicKeySize
+)
+
+// Storage keys.
+const rolesKeyPrefix = "roles/"
+
+// Error messages.
+const (
+	// NewRoleGrant
+	errGrantRole    = "invalid role %d"
+	errGrantKeySize = "identity key of size %d does not match %d"
+	errGrantExpires = "grant expires at %s before it is issued at %s"
+
+	// RoleGrant.Sign
+	errGrantSign = "failed to sign role grant: %+v"
+
+	// RoleGrant.Verify
+	errGrantNotSigned = "role grant is not signed"
+	errGrantNoKey     = "channel has no RSA public key"
+	errGrantSignature = "role grant signature is invalid: %+v"
+	errGrantExpired   = "role grant expired at %s"
+
+	// UnmarshalRoleGrant
+	errGrantLen = "role grant of size %d shorter than minimum size %d"
+
+	// UnmarshalRevocation
+	errRevocationLen = "revocation of size %d does not match %d"
+
+	// Roles.receive
+	errRoleNotSigned = "%s message is not sent by the channel admin"
+
+	// Roles.save
+	errSaveRoles = "failed to save roles for channel %s: %+v"
+
+	// Roles.getRoles and Roles.Revocations
+	errLoadRoles = "failed to load roles for channel %s: %+v"
+)
+
+// Role is a set of rights in a channel granted by the channel admin to the
+// owner of an identity key.
+type Role uint8
+
+const (
+	// NoRole is the Role of members that have not been granted one.
+	NoRole Role = 0
+
+	// Moderator can mute, unmute, ban, and unban users.
+	Moderator Role = 1
+)
+
+// roleStringMap correlates each Role to a human-readable name.
+var roleStringMap = map[Role]string{
+	NoRole:    "none",
+	Moderator: "moderator",
+}
+
+// String returns a human-readable name for the Role. Adheres to the
+// fmt.Stringer interface.
+func (r Role) String() string {
+	str, exists := roleStringMap[r]
+	if exists {
+		return str
+	}
+
+	return "INVALID ROLE: " + strconv.FormatUint(uint64(r), 10)
+}
+
+/*
++----------------------------------------------------------------+
+|                       Role Grant Payload                       |
++--------+-----------+-----------+-------------+-----------------+
+|  role  | issuedAt  |  expires  |     key     |    signature    |
+| 1 byte |  8 bytes  |  8 bytes  |  32 bytes   |    remaining    |
++--------+-----------+-----------+-------------+-----------------+
+
+The timestamps are in Unix nanoseconds; an expiry of zero means the grant never
+expires. The key is the ed25519 identity key granted the role. The signature is
+an RSA-PSS signature, made with the channel's RSA private key, of the SHA-256
+hash of the channel ID followed by the payload preceding the signature.
+
+Grants are announced asymmetrically with the Grant tag. Members acting under a
+role include their grant in the GrantExt extension of their signed messages so
+that the chain from the channel's RSA key to the message can be verified by
+members who missed the announcement.
+
+Revocations are sent asymmetrically with the Revoke tag and contain only the
+identity key. They invalidate every grant to the key issued before them.
+*/
+
+// RoleGrant is a statement signed by the channel admin that gives a Role to
+// the owner of an identity key until it expires.
+type RoleGrant struct {
+	Role Role
+
+	// Key is the identity key granted the role.
+	Key ed25519.PublicKey
+
+	// IssuedAt is when the grant was made.
+	IssuedAt time.Time
+
+	// Expires is when the grant expires. It is zero if the grant does not
+	// expire.
+	Expires time.Time
+
+	// Signature is the channel admin's signature of the grant.
+	Signature []byte
+}
+
+// NewRoleGrant returns an unsigned RoleGrant of the role to the identity key
+// issued at the given time. Pass a zero expiry for a grant that never expires.
+func NewRoleGrant(role Role, key ed25519.PublicKey, issuedAt,
+	expires time.Time) (RoleGrant, error) {
+	if _, exists := roleStringMap[role]; !exists || role == NoRole {
+		return RoleGrant{}, errors.Errorf(errGrantRole, role)
+	} else if len(key) != ed25519.PublicKeySize {
+		return RoleGrant{}, errors.Errorf(
+			errGrantKeySize, len(key), ed25519.PublicKeySize)
+	} else if !expires.IsZero() && !expires.After(issuedAt) {
+		return RoleGrant{}, errors.Errorf(errGrantExpires, expires, issuedAt)
+	}
+
+	// Timestamps are truncated to their encoded precision so that unmarshalled
+	// grants are equal to the original
+	return RoleGrant{
+		Role:     role,
+		Key:      key,
+		IssuedAt: time.Unix(0, issuedAt.UnixNano()),
+		Expires:  unixNano(expires),
+	}, nil
+}
+
+// IsExpired determines if the grant has expired at the given time.
+func (g RoleGrant) IsExpired(now time.Time) bool {
+	return !g.Expires.IsZero() && !now.Before(g.Expires)
+}
+
+// Covers determines if the given time falls between when the grant was issued
+// and when it expires.
+func (g RoleGrant) Covers(t time.Time) bool {
+	return !t.Before(g.IssuedAt) && !g.IsExpired(t)
+}
+
+// Sign returns a copy of the grant signed with the channel's RSA private key.
+func (g RoleGrant) Sign(channelID *id.ID, pk *rsa.PrivateKey,
+	rng io.Reader) (RoleGrant, error) {
+	hashed := sha256.Sum256(g.signedData(channelID))
+	signature, err := rsa.Sign(rng, pk, crypto.SHA256, hashed[:], nil)
+	if err != nil {
+		return RoleGrant{}, errors.Errorf(errGrantSign, err)
+	}
+
+	g.Signature = signature
+	return g, nil
+}
+
+// Verify checks that the grant is signed with the RSA private key of the
+// channel and has not expired at the given time.
+func (g RoleGrant) Verify(
+	channelID *id.ID, pub *rsa.PublicKey, now time.Time) error {
+	if len(g.Signature) == 0 {
+		return errors.New(errGrantNotSigned)
+	} else if pub == nil {
+		return errors.New(errGrantNoKey)
+	}
+
+	hashed := sha256.Sum256(g.signedData(channelID))
+	err := rsa.Verify(pub, crypto.SHA256, hashed[:], g.Signature, nil)
+	if err != nil {
+		return errors.Errorf(errGrantSignature, err)
+	}
+
+	if g.IsExpired(now) {
+		return errors.Errorf(errGrantExpired, g.Expires)
+	}
+
+	return nil
+}
+
+// Marshal encodes the RoleGrant into a payload that can be sent with the Grant
+// tag or in the GrantExt extension.
+func (g RoleGrant) Marshal() []byte {
+	return append(g.marshalUnsigned(), g.Signature...)
+}
+
+// UnmarshalRoleGrant decodes the payload of a message with the Grant tag or
+// the value of a GrantExt extension into a RoleGrant. The signature is not
+// verified.
+func UnmarshalRoleGrant(payload []byte) (RoleGrant, error) {
+	if len(payload) < grantMinSize {
+		return RoleGrant{}, errors.Errorf(
+			errGrantLen, len(payload), grantMinSize)
+	}
+
+	buff := bytes.NewBuffer(payload)
+	role := Role(buff.Next(grantRoleSize)[0])
+	issuedAt := time.Unix(0,
+		int64(binary.BigEndian.Uint64(buff.Next(grantTimestampSize))))
+	var expires time.Time
+	if ns := binary.BigEndian.Uint64(buff.Next(grantTimestampSize)); ns != 0 {
+		expires = time.Unix(0, int64(ns))
+	}
+	key := append(ed25519.PublicKey{}, buff.Next(ed25519.PublicKeySize)...)
+
+	g, err := NewRoleGrant(role, key, issuedAt, expires)
+	if err != nil {
+		return RoleGrant{}, err
+	}
+
+	if buff.Len() > 0 {
+		g.Signature = append([]byte{}, buff.Bytes()...)
+	}
+
+	return g, nil
+}
+
+// UnmarshalRevocation decodes the payload of a message with the Revoke tag
+// into the identity key whose roles are revoked.
+func UnmarshalRevocation(payload []byte) (ed25519.PublicKey, error) {
+	if len(payload) != ed25519.PublicKeySize {
+		return nil, errors.Errorf(
+			errRevocationLen, len(payload), ed25519.PublicKeySize)
+	}
+	return append(ed25519.PublicKey{}, payload...), nil
+}
+
+// marshalUnsigned encodes every field of the grant except the signature.
+func (g RoleGrant) marshalUnsigned() []byte {
+	buff := bytes.NewBuffer(nil)
+	buff.Grow(grantMinSize + len(g.Signature))
+
+	buff.WriteByte(uint8(g.Role))
+	b := make([]byte, grantTimestampSize)
+	binary.BigEndian.PutUint64(b, uint64(g.IssuedAt.UnixNano()))
+	buff.Write(b)
+	b = make([]byte, grantTimestampSize)
+	if !g.Expires.IsZero() {
+		binary.BigEndian.PutUint64(b, uint64(g.Expires.UnixNano()))
+	}
+	buff.Write(b)
+	buff.Write(g.Key)
+
+	return buff.Bytes()
+}
+
+// signedData returns the data signed for the grant. It is made up of the
+// channel ID followed by the encoded grant without the signature.
+func (g RoleGrant) signedData(channelID *id.ID) []byte {
+	return append(channelID.Marshal(), g.marshalUnsigned()...)
+}
+
+// unixNano returns the time truncated to nanoseconds since the Unix epoch.
+// The zero time is returned unchanged.
+func unixNano(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Unix(0, t.UnixNano())
+}
+
+// channelRoles are the grants and revocations received in a channel.
+type channelRoles struct {
+	// Grants are the latest grant to each identity key, ordered by when they
+	// were issued.
+	Grants []RoleGrant `json:"grants,omitempty"`
+
+	// Revoked is when the roles of each base64-encoded identity key were last
+	// revoked.
+	Revoked map[string]time.Time `json:"revoked,omitempty"`
+}
+
+// Revocation is when the roles of an identity key in a channel were last
+// revoked.
+type Revocation struct {
+	Key       ed25519.PublicKey
+	RevokedAt time.Time
+}
+
+// Roles contains the roles granted by the admin of each channel. Roles are
+// changed by Grant and Revoke messages sent asymmetrically by the channel
+// admin and by grants included in the messages of members acting under them.
+// They are persisted in a key-value store.
+type Roles struct {
+	kv ekv.KeyValue
+
+	// roles are the roles of each channel that has been accessed.
+	roles map[id.ID]*channelRoles
+
+	mux sync.Mutex
+}
+
+// NewRoles returns Roles stored in the key-value store. To encrypt them, the
+// store should be an ekv.Filestore opened with the session password.
+func NewRoles(kv ekv.KeyValue) *Roles {
+	return &Roles{
+		kv:    kv,
+		roles: make(map[id.ID]*channelRoles),
+	}
+}
+
+// Grants returns every grant in the channel that has not expired at the given
+// time or been revoked, ordered by when they were issued.
+func (ro *Roles) Grants(channelID *id.ID, now time.Time) ([]RoleGrant, error) {
+	ro.mux.Lock()
+	defer ro.mux.Unlock()
+
+	roles, err := ro.getRoles(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]RoleGrant, 0, len(roles.Grants))
+	for _, g := range roles.Grants {
+		if roles.isValid(g, now) {
+			grants = append(grants, g)
+		}
+	}
+
+	return grants, nil
+}
+
+// Revocations returns when the roles of each identity key in the channel were
+// last revoked, ordered by when they were revoked.
+func (ro *Roles) Revocations(channelID *id.ID) ([]Revocation, error) {
+	ro.mux.Lock()
+	defer ro.mux.Unlock()
+
+	roles, err := ro.getRoles(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := make([]Revocation, 0, len(roles.Revoked))
+	for encoded, at := range roles.Revoked {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Errorf(errLoadRoles, channelID, err)
+		}
+		revocations = append(revocations, Revocation{key, at})
+	}
+	sort.Slice(revocations, func(i, j int) bool {
+		return revocations[i].RevokedAt.Before(revocations[j].RevokedAt)
+	})
+
+	return revocations, nil
+}
+
+// Get returns the grant to the identity key in the channel. Returns false if
+// the key has no grant that has not expired at the given time or been
+// revoked.
+func (ro *Roles) Get(channelID *id.ID, key ed25519.PublicKey,
+	now time.Time) (RoleGrant, bool) {
+	ro.mux.Lock()
+	defer ro.mux.Unlock()
+
+	roles, err := ro.getRoles(channelID)
+	if err != nil {
+		jww.ERROR.Printf("%+v", err)
+		return RoleGrant{}, false
+	}
+
+	if i := roles.index(key); i >= 0 && roles.isValid(roles.Grants[i], now) {
+		return roles.Grants[i], true
+	}
+
+	return RoleGrant{}, false
+}
+
+// Apply saves the grant in the channel, replacing any earlier grant to the
+// same identity key. The signature of the grant must already be verified.
+// Returns false if the grant is not newer than the one stored or it is issued
+// before the key's roles were last revoked.
+func (ro *Roles) Apply(channelID *id.ID, g RoleGrant) (bool, error) {
+	ro.mux.Lock()
+	defer ro.mux.Unlock()
+
+	roles, err := ro.getRoles(channelID)
+	if err != nil {
+		return false, err
+	}
+
+	revoked, exists := roles.Revoked[base64.StdEncoding.EncodeToString(g.Key)]
+	if exists && !g.IssuedAt.After(revoked) {
+		return false, nil
+	}
+
+	if i := roles.index(g.Key); i >= 0 {
+		if !g.IssuedAt.After(roles.Grants[i].IssuedAt) {
+			return false, nil
+		}
+		roles.Grants = append(roles.Grants[:i:i], roles.Grants[i+1:]...)
+	}
+
+	roles.Grants = append(roles.Grants, g)
+	sort.SliceStable(roles.Grants, func(i, j int) bool {
+		return roles.Grants[i].IssuedAt.Before(roles.Grants[j].IssuedAt)
+	})
+
+	return true, ro.save(channelID, roles)
+}
+
+// Revoke revokes the roles granted to the identity key in the channel before
+// the given time. Returns false if they were already revoked at or after that
+// time.
+func (ro *Roles) Revoke(channelID *id.ID, key ed25519.PublicKey,
+	at time.Time) (bool, error) {
+	ro.mux.Lock()
+	defer ro.mux.Unlock()
+
+	roles, err := ro.getRoles(channelID)
+	if err != nil {
+		return false, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key)
+	if revoked, exists := roles.Revoked[encoded]; exists &&
+		!at.After(revoked) {
+		return false, nil
+	}
+
+	if roles.Revoked == nil {
+		roles.Revoked = make(map[string]time.Time)
+	}
+	roles.Revoked[encoded] = at
+	if i := roles.index(key); i >= 0 &&
+		roles.Grants[i].IssuedAt.Before(at) {
+		roles.Grants = append(roles.Grants[:i:i], roles.Grants[i+1:]...)
+	}
+
+	return true, ro.save(channelID, roles)
+}
+
+// Filter returns a channel that receives every message sent on the given
+// channel with the Role of its sender set. Grant and Revoke messages are
+// applied if they are sent asymmetrically and, for grants, signed with the
+// channel's RSA private key; otherwise, they are dropped. They are also dropped
+// if they were already applied, so that re-broadcasts are only received once.
+// Other messages are given the role of a grant to their signing key, taken
+// from their GrantExt extension or from those stored, that is signed by the
+// channel admin and valid when the message is received. Signatures are
+// verified with the key returned by key, which is the channel's current RSA
+// public key. The returned channel is closed when the given channel or done is
+// closed.
+func (ro *Roles) Filter(channelID *id.ID, key func() *rsa.PublicKey,
+	in chan ReceivedBroadcast, done <-chan struct{}) chan ReceivedBroadcast {
+	return pipe(in, done, func(r ReceivedBroadcast) (ReceivedBroadcast, bool) {
+		r.Role, r.Grant = NoRole, nil
+		if r.Tag.IsRole() {
+			changed, err := ro.receive(channelID, key(), r)
+			if err != nil {
+				jww.WARN.Printf("Dropped %s message from %q on channel %s: %+v",
+					r.Tag, r.Username, channelID, err)
+				return r, false
+			} else if !changed {
+				jww.DEBUG.Printf("Dropped %s message on channel %s that was "+
+					"already applied.", r.Tag, channelID)
+				return r, false
+			}
+		} else if !r.Asymmetric {
+			if g, exists := ro.senderGrant(channelID, key, r); exists {
+				r.Role, r.Grant = g.Role, &g
+			}
+		}
+		return r, true
+	})
+}
+
+// receive verifies the Grant or Revoke message received on the channel and
+// applies it. Returns false if the roles were not changed.
+func (ro *Roles) receive(
+	channelID *id.ID, pub *rsa.PublicKey, r ReceivedBroadcast) (bool, error) {
+	if !r.Asymmetric {
+		return false, errors.Errorf(errRoleNotSigned, r.Tag)
+	}
+
+	var changed bool
+	if r.Tag == Revoke {
+		key, err := UnmarshalRevocation(r.Message)
+		if err != nil {
+			return false, err
+		}
+		if changed, err = ro.Revoke(channelID, key, r.Timestamp); err != nil {
+			return false, err
+		}
+	} else {
+		g, err := UnmarshalRoleGrant(r.Message)
+		if err != nil {
+			return false, err
+		}
+		if err = g.Verify(channelID, pub, r.ReceivedTime); err != nil {
+			return false, err
+		}
+		if changed, err = ro.Apply(channelID, g); err != nil {
+			return false, err
+		}
+	}
+
+	if changed {
+		jww.INFO.Printf("Applied %s message on channel %s.", r.Tag, channelID)
+	}
+
+	return changed, nil
+}
+
+// senderGrant returns the grant of the role of the sender of the message
+// received on the channel. The message must be signed and its signing key
+// granted a role by the channel admin that is valid when the message was
+// received. A grant in the GrantExt extension of the message is saved if it is
+// newer than the one stored. Returns false if the sender has no role.
+func (ro *Roles) senderGrant(channelID *id.ID,
+	channelKey func() *rsa.PublicKey, r ReceivedBroadcast) (RoleGrant, bool) {
+	key, err := VerifySignature(channelID, r)
+	if err != nil {
+		return RoleGrant{}, false
+	}
+
+	if ext, exists := r.Extensions.Get(GrantExt); exists {
+		g, err := UnmarshalRoleGrant(ext)
+		if err == nil && bytes.Equal(g.Key, key) &&
+			g.Verify(channelID, channelKey(), r.ReceivedTime) == nil {
+			if _, err = ro.Apply(channelID, g); err != nil {
+				jww.ERROR.Printf("%+v", err)
+			}
+		} else {
+			jww.WARN.Printf("Message from %q on channel %s has an invalid "+
+				"role grant.", r.Username, channelID)
+		}
+	}
+
+	return ro.Get(channelID, key, r.ReceivedTime)
+}
+
+// isValid determines if the grant has not expired at the given time or been
+// revoked.
+func (roles *channelRoles) isValid(g RoleGrant, now time.Time) bool {
+	revoked, exists := roles.Revoked[base64.StdEncoding.EncodeToString(g.Key)]
+	return !g.IsExpired(now) && (!exists || g.IssuedAt.After(revoked))
+}
+
+// index returns the position of the grant to the identity key. Returns -1 if
+// there is none.
+func (roles *channelRoles) index(key ed25519.PublicKey) int {
+	for i, g := range roles.Grants {
+		if bytes.Equal(g.Key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// save saves the roles of the channel to storage. Must be called while the
+// lock is held.
+func (ro *Roles) save(channelID *id.ID, roles *channelRoles) error {
+	if err := ro.kv.SetInterface(rolesKey(channelID), roles); err != nil {
+		return errors.Errorf(errSaveRoles, channelID, err)
+	}
+	return nil
+}
+
+// getRoles returns the roles for the channel, loading them from storage if
+// they have not yet been accessed. Must be called while the lock is held.
+func (ro *Roles) getRoles(channelID *id.ID) (*channelRoles, error) {
+	if roles, exists := ro.roles[*channelID]; exists {
+		return roles, nil
+	}
+
+	roles := &channelRoles{}
+	err := ro.kv.GetInterface(rolesKey(channelID), roles)
+	if err != nil && ekv.Exists(err) {
+		return nil, errors.Errorf(errLoadRoles, channelID, err)
+	}
+
+	ro.roles[*channelID] = roles
+	return roles, nil
+}
+
+// rolesKey returns the storage key for the roles of a channel.
+func rolesKey(channelID *id.ID) string {
+	return rolesKeyPrefix + channelID.String()
+}
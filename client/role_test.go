@@ -0,0 +1,367 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// signedGrant returns a RoleGrant of the Moderator role to the key signed with
+// the private key.
+func signedGrant(t *testing.T, channelID *id.ID, pk *rsa.PrivateKey,
+	key ed25519.PublicKey, issuedAt, expires time.Time) RoleGrant {
+	g, err := NewRoleGrant(Moderator, key, issuedAt, expires)
+	if err != nil {
+		t.Fatalf("Failed to create role grant: %+v", err)
+	}
+
+	g, err = g.Sign(channelID, pk, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to sign role grant: %+v", err)
+	}
+
+	return g
+}
+
+// signMessage returns the message signed with the identity key.
+func signMessage(t *testing.T, channelID *id.ID, priv ed25519.PrivateKey,
+	r ReceivedBroadcast) ReceivedBroadcast {
+	r.Extensions = append(r.Extensions,
+		Extension{SigningKeyExt, priv.Public().(ed25519.PublicKey)})
+	data, err := signedData(channelID, r.Tag, r.Timestamp, r.Username,
+		r.Message, r.Extensions)
+	if err != nil {
+		t.Fatalf("Failed to encode message for signing: %+v", err)
+	}
+	r.Extensions = append(r.Extensions,
+		Extension{SignatureExt, ed25519.Sign(priv, data)})
+
+	return r
+}
+
+// Tests that a RoleGrant marshalled and unmarshalled matches the original and
+// that its signature is verified with the channel's public key.
+func TestRoleGrant_Marshal_Verify(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+
+	for _, g := range []RoleGrant{
+		signedGrant(t, channelID, pk, key, now, time.Time{}),
+		signedGrant(t, channelID, pk, key, now, now.Add(time.Hour)),
+	} {
+		received, err := UnmarshalRoleGrant(g.Marshal())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal role grant: %+v", err)
+		}
+		if !reflect.DeepEqual(g, received) {
+			t.Errorf("Unmarshalled grant does not match original."+
+				"\nexpected: %+v\nreceived: %+v", g, received)
+		}
+
+		if err = received.Verify(channelID, pk.GetPublic(), now); err != nil {
+			t.Errorf("Failed to verify grant: %+v", err)
+		}
+	}
+}
+
+// Error path: Tests that RoleGrant.Verify rejects grants that are unsigned,
+// changed after signing, signed for another channel or with another key, or
+// expired.
+func TestRoleGrant_Verify_Invalid(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+
+	g := signedGrant(t, channelID, pk, key, now, now.Add(time.Hour))
+	unsigned := g
+	unsigned.Signature = nil
+	extended := g
+	extended.Expires = now.Add(2 * time.Hour)
+
+	for i, tt := range []struct {
+		g         RoleGrant
+		channelID *id.ID
+		pub       *rsa.PublicKey
+		now       time.Time
+	}{
+		{unsigned, channelID, pk.GetPublic(), now},
+		{extended, channelID, pk.GetPublic(), now},
+		{g, id.NewIdFromString("other", id.User, t), pk.GetPublic(), now},
+		{g, channelID, other.GetPublic(), now},
+		{g, channelID, nil, now},
+		{g, channelID, pk.GetPublic(), now.Add(time.Hour)},
+	} {
+		if err = tt.g.Verify(tt.channelID, tt.pub, tt.now); err == nil {
+			t.Errorf("Verified invalid grant (%d).", i)
+		}
+	}
+}
+
+// Tests that Roles.Filter applies grants and revocations from the channel
+// admin, drops forged ones, and sets the role of messages signed with a key
+// granted a role, including by a grant only carried in the message.
+func TestRoles_Filter(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	kv := ekv.MakeMemstore()
+	ro := NewRoles(kv)
+
+	alicePub, alice, _ := ed25519.GenerateKey(rand.Reader)
+	bobPub, bob, _ := ed25519.GenerateKey(rand.Reader)
+	_, mallory, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+
+	aliceGrant := signedGrant(t, channelID, pk, alicePub, now, time.Time{})
+	bobGrant := signedGrant(t, channelID, pk, bobPub, now, time.Time{})
+	admin := func(tag Tag, payload []byte, asymmetric bool) ReceivedBroadcast {
+		return ReceivedBroadcast{Tag: tag, Username: "admin", Message: payload,
+			Timestamp: now, ReceivedTime: now, Asymmetric: asymmetric}
+	}
+	message := func(username string, priv ed25519.PrivateKey,
+		g *RoleGrant) ReceivedBroadcast {
+		r := ReceivedBroadcast{Tag: Default, Username: username,
+			Message: []byte("hello"), Timestamp: now, ReceivedTime: now}
+		if g != nil {
+			r.Extensions = Extensions{{GrantExt, g.Marshal()}}
+		}
+		return signMessage(t, channelID, priv, r)
+	}
+	revoke := admin(Revoke, alicePub, true)
+	revoke.Timestamp = now.Add(time.Second)
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := ro.Filter(channelID, pk.GetPublic, in, nil)
+	in <- admin(Grant, aliceGrant.Marshal(), true)
+	in <- admin(Grant, bobGrant.Marshal(), false)
+	in <- message("alice", alice, nil)
+	in <- message("bob", bob, nil)
+	in <- message("bob", bob, &bobGrant)
+	in <- message("mallory", mallory, &bobGrant)
+	in <- revoke
+	in <- message("alice", alice, &aliceGrant)
+	close(in)
+
+	var received []ReceivedBroadcast
+	for r := range out {
+		received = append(received, r)
+	}
+
+	expected := []struct {
+		tag  Tag
+		role Role
+	}{{Grant, NoRole}, {Default, Moderator}, {Default, NoRole},
+		{Default, Moderator}, {Default, NoRole}, {Revoke, NoRole},
+		{Default, NoRole}}
+	if len(received) != len(expected) {
+		t.Fatalf("Unexpected number of messages received."+
+			"\nexpected: %d\nreceived: %d", len(expected), len(received))
+	}
+	for i, r := range received {
+		if r.Tag != expected[i].tag || r.Role != expected[i].role {
+			t.Errorf("Unexpected message %d.\nexpected: %s %s"+
+				"\nreceived: %s %s", i, expected[i].tag, expected[i].role,
+				r.Tag, r.Role)
+		}
+	}
+
+	// The grants are loaded from storage by new Roles
+	grants, err := NewRoles(kv).Grants(channelID, now)
+	if err != nil {
+		t.Fatalf("Failed to load grants: %+v", err)
+	}
+	if len(grants) != 1 ||
+		!reflect.DeepEqual(bobGrant.Marshal(), grants[0].Marshal()) {
+		t.Errorf("Unexpected grants.\nexpected: %+v\nreceived: %+v",
+			[]RoleGrant{bobGrant}, grants)
+	}
+}
+
+// Tests that Roles.Apply only replaces a grant with a newer one and ignores
+// grants issued before the key was revoked.
+func TestRoles_Apply(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	ro := NewRoles(ekv.MakeMemstore())
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+
+	grant := func(issuedAt time.Time) RoleGrant {
+		g, err := NewRoleGrant(Moderator, key, issuedAt, time.Time{})
+		if err != nil {
+			t.Fatalf("Failed to create role grant: %+v", err)
+		}
+		return g
+	}
+
+	for i, tt := range []struct {
+		g       RoleGrant
+		changed bool
+	}{
+		{grant(now), true},
+		{grant(now.Add(-time.Hour)), false},
+		{grant(now.Add(time.Hour)), true},
+	} {
+		changed, err := ro.Apply(channelID, tt.g)
+		if err != nil {
+			t.Errorf("Failed to apply grant (%d): %+v", i, err)
+		} else if changed != tt.changed {
+			t.Errorf("Unexpected change (%d).\nexpected: %t\nreceived: %t",
+				i, tt.changed, changed)
+		}
+	}
+
+	changed, err := ro.Revoke(channelID, key, now.Add(2*time.Hour))
+	if err != nil || !changed {
+		t.Fatalf("Failed to revoke grant: %t %+v", changed, err)
+	}
+	if _, exists := ro.Get(channelID, key, now); exists {
+		t.Errorf("Revoked grant is still valid.")
+	}
+
+	changed, err = ro.Apply(channelID, grant(now.Add(time.Hour)))
+	if err != nil || changed {
+		t.Errorf("Applied grant issued before revocation: %t %+v",
+			changed, err)
+	}
+	changed, err = ro.Apply(channelID, grant(now.Add(3*time.Hour)))
+	if err != nil || !changed {
+		t.Errorf("Failed to apply grant issued after revocation: %t %+v",
+			changed, err)
+	}
+}
+
+// Tests that the revocations of a channel replayed as Revoke messages to fresh
+// Roles, which only received the grant, revoke it and are only received once.
+func TestRoles_Revocations_Replay(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	admin := NewRoles(ekv.MakeMemstore())
+	member := NewRoles(ekv.MakeMemstore())
+
+	alice, _, _ := ed25519.GenerateKey(rand.Reader)
+	bob, _, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now()
+	grant := signedGrant(t, channelID, pk, alice, now, time.Time{})
+	for _, ro := range []*Roles{admin, member} {
+		if _, err = ro.Apply(channelID, grant); err != nil {
+			t.Fatalf("Failed to apply grant: %+v", err)
+		}
+	}
+	for i, key := range []ed25519.PublicKey{bob, alice} {
+		at := now.Add(time.Duration(i+1) * time.Second)
+		if _, err = admin.Revoke(channelID, key, at); err != nil {
+			t.Fatalf("Failed to revoke grant: %+v", err)
+		}
+	}
+
+	revocations, err := admin.Revocations(channelID)
+	if err != nil {
+		t.Fatalf("Failed to get revocations: %+v", err)
+	}
+	if len(revocations) != 2 || !bytes.Equal(revocations[0].Key, bob) ||
+		!bytes.Equal(revocations[1].Key, alice) {
+		t.Fatalf("Unexpected revocations: %+v", revocations)
+	}
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := member.Filter(channelID, pk.GetPublic, in, nil)
+	for i := 0; i < 2; i++ {
+		for _, rv := range revocations {
+			in <- ReceivedBroadcast{Tag: Revoke, Message: rv.Key,
+				Timestamp: rv.RevokedAt, ReceivedTime: time.Now(),
+				Asymmetric: true}
+		}
+	}
+	close(in)
+
+	var received int
+	for range out {
+		received++
+	}
+
+	if received != len(revocations) {
+		t.Errorf("Unexpected number of messages received."+
+			"\nexpected: %d\nreceived: %d", len(revocations), received)
+	}
+	if _, exists := member.Get(channelID, alice, now); exists {
+		t.Errorf("Replayed revocation did not revoke grant.")
+	}
+}
+
+// Tests that Moderation.Filter applies unsigned moderation commands from
+// moderators and drops them from other users.
+func TestModeration_Filter_Moderator(t *testing.T) {
+	channelID := id.NewIdFromString("channel", id.User, t)
+	m := NewModeration(ekv.MakeMemstore())
+
+	mute, err := NewModerationCommand(Mute, "alice", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create moderation command: %+v", err)
+	}
+	ban, err := NewModerationCommand(Ban, "bob", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create moderation command: %+v", err)
+	}
+
+	key, _, _ := ed25519.GenerateKey(rand.Reader)
+	g, err := NewRoleGrant(
+		Moderator, key, time.Now().Add(-time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create role grant: %+v", err)
+	}
+
+	in := make(chan ReceivedBroadcast, 10)
+	out := m.Filter(channelID, nil, in, nil)
+	in <- ReceivedBroadcast{Tag: Moderate, Username: "carol",
+		Message: mute.Marshal(), ReceivedTime: time.Now(), Role: Moderator,
+		Grant: &g}
+	in <- ReceivedBroadcast{Tag: Moderate, Username: "dave",
+		Message: ban.Marshal(), ReceivedTime: time.Now()}
+	close(in)
+
+	var received []ReceivedBroadcast
+	for r := range out {
+		received = append(received, r)
+	}
+
+	if len(received) != 1 || received[0].Username != "carol" {
+		t.Errorf("Unexpected messages received: %+v", received)
+	}
+	if !m.IsMuted(channelID, ReceivedBroadcast{Username: "alice"}) {
+		t.Errorf("Command from moderator not applied.")
+	}
+	if m.IsBanned(channelID, ReceivedBroadcast{Username: "bob"}) {
+		t.Errorf("Command from user without a role applied.")
+	}
+}
@@ -0,0 +1,116 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Member describes a user seen in a channel.
+type Member struct {
+	Username string
+
+	// FirstSeen and LastSeen are the times of the first and most recent
+	// messages received from the user.
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// Messages is the number of chat messages and files received from the
+	// user.
+	Messages int
+}
+
+// Roster is an in-memory list of the users in a channel built from the
+// messages received from them. Members are removed when they exit or when no
+// message has been received from them within the idle period, so that users
+// whose client crashed without sending an Exit message are eventually
+// removed.
+type Roster struct {
+	idle    time.Duration
+	members map[string]*Member
+	mux     sync.Mutex
+}
+
+// NewRoster returns a new empty Roster whose members expire after the idle
+// period.
+func NewRoster(idle time.Duration) *Roster {
+	return &Roster{
+		idle:    idle,
+		members: make(map[string]*Member),
+	}
+}
+
+// Update updates the member that sent the received message. Messages from
+// impersonators and admin messages, which are not sent by a member, are
+// ignored.
+func (r *Roster) Update(rb ReceivedBroadcast) {
+	if rb.Verification == Impersonation || rb.Asymmetric {
+		return
+	}
+	seen := seenAt(rb)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if rb.Tag == Exit {
+		delete(r.members, rb.Username)
+		return
+	}
+
+	m, exists := r.members[rb.Username]
+	if !exists {
+		m = &Member{Username: rb.Username, FirstSeen: seen}
+		r.members[rb.Username] = m
+	}
+
+	if seen.After(m.LastSeen) {
+		m.LastSeen = seen
+	}
+	if seen.Before(m.FirstSeen) {
+		m.FirstSeen = seen
+	}
+	if rb.Tag == Default || rb.Tag == File {
+		m.Messages++
+	}
+}
+
+// Members removes every member idle at the given time and returns the
+// remaining members sorted by username.
+func (r *Roster) Members(now time.Time) []Member {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	members := make([]Member, 0, len(r.members))
+	for username, m := range r.members {
+		if now.Sub(m.LastSeen) > r.idle {
+			delete(r.members, username)
+		} else {
+			members = append(members, *m)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+	return members
+}
+
+// Get returns the member with the username. Returns false if the user is not
+// in the roster.
+func (r *Roster) Get(username string) (Member, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	m, exists := r.members[username]
+	if !exists {
+		return Member{}, false
+	}
+	return *m, true
+}
@@ -0,0 +1,96 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that Roster.Update tracks the first-seen and last-seen times and
+// message counts of each member.
+func TestRoster_Update(t *testing.T) {
+	r := NewRoster(time.Minute)
+	start := time.Unix(1000, 0)
+
+	updates := []ReceivedBroadcast{
+		{Tag: Join, Username: "alice"},
+		{Tag: Default, Username: "alice"},
+		{Tag: Heartbeat, Username: "alice"},
+		{Tag: File, Username: "alice"},
+		{Tag: Default, Username: "bob"},
+	}
+	for i, u := range updates {
+		u.Timestamp = start.Add(time.Duration(i) * time.Second)
+		u.ReceivedTime = u.Timestamp
+		r.Update(u)
+	}
+
+	expected := []Member{
+		{"alice", start, start.Add(3 * time.Second), 2},
+		{"bob", start.Add(4 * time.Second), start.Add(4 * time.Second), 1},
+	}
+	if members := r.Members(start); !reflect.DeepEqual(expected, members) {
+		t.Errorf("Unexpected members.\nexpected: %+v\nreceived: %+v",
+			expected, members)
+	}
+
+	if m, exists := r.Get("bob"); !exists || m.Messages != 1 {
+		t.Errorf("Unexpected member for bob: %+v", m)
+	}
+}
+
+// Tests that Roster.Members removes members that exited or have been idle
+// longer than the idle period.
+func TestRoster_Members_Expiry(t *testing.T) {
+	r := NewRoster(time.Minute)
+	now := time.Unix(1000, 0)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		r.Update(ReceivedBroadcast{Tag: Join, Username: username,
+			Timestamp: now, ReceivedTime: now})
+	}
+
+	later := now.Add(50 * time.Second)
+	r.Update(ReceivedBroadcast{Tag: Heartbeat, Username: "alice",
+		Timestamp: later, ReceivedTime: later})
+	r.Update(ReceivedBroadcast{Tag: Exit, Username: "bob",
+		Timestamp: later, ReceivedTime: later})
+
+	members := r.Members(now.Add(time.Minute + time.Second))
+	if len(members) != 1 || members[0].Username != "alice" {
+		t.Errorf("Unexpected members after expiry: %+v", members)
+	}
+
+	if _, exists := r.Get("carol"); exists {
+		t.Errorf("Idle member carol was not removed.")
+	}
+}
+
+// Tests that Roster.Update ignores impersonators and admin messages and does
+// not let a sender extend their presence with a timestamp in the future.
+func TestRoster_Update_Untrusted(t *testing.T) {
+	r := NewRoster(time.Minute)
+	now := time.Unix(1000, 0)
+
+	r.Update(ReceivedBroadcast{Tag: Default, Username: "alice",
+		Timestamp: now, ReceivedTime: now, Verification: Impersonation})
+	r.Update(ReceivedBroadcast{Tag: Admin, Username: "admin",
+		Timestamp: now, ReceivedTime: now, Asymmetric: true})
+	if members := r.Members(now); len(members) != 0 {
+		t.Errorf("Untrusted senders added to roster: %+v", members)
+	}
+
+	r.Update(ReceivedBroadcast{Tag: Heartbeat, Username: "bob",
+		Timestamp: now.Add(time.Hour), ReceivedTime: now})
+	expired := now.Add(time.Minute + time.Second)
+	if members := r.Members(expired); len(members) != 0 {
+		t.Errorf("Future timestamp extended presence: %+v", members)
+	}
+}
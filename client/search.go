@@ -0,0 +1,241 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Search filter prefixes.
+const (
+	searchFrom   = "from:"
+	searchTag    = "tag:"
+	searchAfter  = "after:"
+	searchBefore = "before:"
+)
+
+// searchTimeLayouts are the layouts accepted for absolute times in the after
+// and before filters. Times are in the local time zone.
+var searchTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// Error messages.
+const (
+	// ParseSearchQuery
+	errSearchRegexpEnd = "regular expression starting at %d is missing the " +
+		"closing /"
+	errSearchRegexp        = "invalid regular expression %q: %+v"
+	errSearchTag           = "unknown tag %q"
+	errSearchTextAndRegexp = "search text and a regular expression cannot " +
+		"be combined"
+	errSearchRange = "after time %s is not before the before time %s"
+	errSearchEmpty = "search query is empty"
+
+	// parseSearchTime
+	errSearchTime = "invalid time %q: must be a duration (e.g. 2h), a time " +
+		"of day (15:04), or a date (2006-01-02[T15:04[:05]])"
+)
+
+// SearchQuery describes the messages to find when searching a channel's
+// history. Every filter that is set must match.
+type SearchQuery struct {
+	// Pattern matches the text of the message. It is nil if any text
+	// matches.
+	Pattern *regexp.Regexp
+
+	// Username matches the username of the sender, ignoring case.
+	Username string
+
+	// Tags matches any of the tags. It is empty if any tag matches.
+	Tags []Tag
+
+	// After and Before limit the time the message was sent. They are ignored
+	// if zero.
+	After, Before time.Time
+}
+
+// ParseSearchQuery parses the search query. The query is made of either words
+// that are matched as a case-insensitive substring of the message text or a
+// regular expression between slashes, and these filters:
+//
+//	from:<username>   messages sent by the user
+//	tag:<tag>         messages with the tag, e.g. tag:file; may be repeated
+//	after:<time>      messages sent after the time
+//	before:<time>     messages sent before the time
+//
+// Times are either a duration before now (e.g. 2h), a time of day today
+// (15:04), or a date and optional time (2006-01-02T15:04).
+func ParseSearchQuery(query string, now time.Time) (*SearchQuery, error) {
+	var q SearchQuery
+	var words []string
+	var err error
+	for i := 0; i < len(query); {
+		switch {
+		case query[i] == ' ':
+			i++
+			continue
+		case query[i] == '/':
+			end := regexpEnd(query, i+1)
+			if end < 0 {
+				return nil, errors.Errorf(errSearchRegexpEnd, i)
+			}
+			expr := query[i+1 : end]
+			if q.Pattern, err = regexp.Compile(expr); err != nil {
+				return nil, errors.Errorf(errSearchRegexp, expr, err)
+			}
+			i = end + 1
+			continue
+		}
+
+		end := strings.IndexByte(query[i:], ' ')
+		if end < 0 {
+			end = len(query) - i
+		}
+		token := query[i : i+end]
+		i += end
+
+		switch {
+		case strings.HasPrefix(token, searchFrom):
+			q.Username = strings.TrimPrefix(token, searchFrom)
+		case strings.HasPrefix(token, searchTag):
+			tag, exists := tagByName(strings.TrimPrefix(token, searchTag))
+			if !exists {
+				return nil, errors.Errorf(
+					errSearchTag, strings.TrimPrefix(token, searchTag))
+			}
+			q.Tags = append(q.Tags, tag)
+		case strings.HasPrefix(token, searchAfter):
+			q.After, err = parseSearchTime(
+				strings.TrimPrefix(token, searchAfter), now)
+			if err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(token, searchBefore):
+			q.Before, err = parseSearchTime(
+				strings.TrimPrefix(token, searchBefore), now)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			words = append(words, token)
+		}
+	}
+
+	if len(words) > 0 {
+		if q.Pattern != nil {
+			return nil, errors.New(errSearchTextAndRegexp)
+		}
+		q.Pattern = regexp.MustCompile(
+			"(?i)" + regexp.QuoteMeta(strings.Join(words, " ")))
+	}
+
+	if !q.After.IsZero() && !q.Before.IsZero() && !q.After.Before(q.Before) {
+		return nil, errors.Errorf(errSearchRange, q.After, q.Before)
+	} else if q.Pattern == nil && q.Username == "" && len(q.Tags) == 0 &&
+		q.After.IsZero() && q.Before.IsZero() {
+		return nil, errors.New(errSearchEmpty)
+	}
+
+	return &q, nil
+}
+
+// Match determines if the message matches every filter of the query.
+func (q *SearchQuery) Match(r ReceivedBroadcast) bool {
+	if q.Username != "" && !strings.EqualFold(q.Username, r.Username) {
+		return false
+	} else if !q.After.IsZero() && !r.Timestamp.After(q.After) {
+		return false
+	} else if !q.Before.IsZero() && !r.Timestamp.Before(q.Before) {
+		return false
+	}
+
+	if len(q.Tags) > 0 {
+		var found bool
+		for _, tag := range q.Tags {
+			found = found || r.Tag == tag
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return q.Pattern == nil || q.Pattern.MatchString(SearchText(r))
+}
+
+// FindAll returns the start and end index of every match of the text pattern
+// in the text. Returns nil if the query has no text pattern.
+func (q *SearchQuery) FindAll(text string) [][]int {
+	if q.Pattern == nil {
+		return nil
+	}
+	return q.Pattern.FindAllStringIndex(text, -1)
+}
+
+// SearchText returns the text of the message that is searched. For files, it
+// is the name of the attachment.
+func SearchText(r ReceivedBroadcast) string {
+	if r.Tag == File {
+		if a, err := UnmarshalAttachment(r.Message); err == nil {
+			return a.Name
+		}
+		return ""
+	}
+	return string(r.Message)
+}
+
+// regexpEnd returns the index of the first slash in the query at or after the
+// start that is not escaped with a backslash. Returns -1 if there is none.
+func regexpEnd(query string, start int) int {
+	for i := start; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '/':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSearchTime parses a time in a search filter relative to now.
+func parseSearchTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		year, month, day := now.Date()
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0,
+			now.Location()), nil
+	}
+
+	for _, layout := range searchTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf(errSearchTime, s)
+}
+
+// tagByName returns the Tag with the human-readable name.
+func tagByName(name string) (Tag, bool) {
+	for tag, str := range tagStringMap {
+		if strings.EqualFold(str, name) {
+			return tag, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that ParseSearchQuery parses the text, regular expression, and filters
+// of a search query.
+func TestParseSearchQuery(t *testing.T) {
+	now := time.Date(2022, 7, 7, 12, 0, 0, 0, time.UTC)
+
+	q, err := ParseSearchQuery(
+		"from:alice  tag:file tag:default after:2h before:2022-07-07T11:30 "+
+			"release notes", now)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %+v", err)
+	}
+
+	expected := &SearchQuery{
+		Username: "alice",
+		Tags:     []Tag{File, Default},
+		After:    now.Add(-2 * time.Hour),
+		Before:   time.Date(2022, 7, 7, 11, 30, 0, 0, time.UTC),
+	}
+	if q.Pattern == nil || q.Pattern.String() != `(?i)release notes` {
+		t.Errorf("Unexpected pattern: %v", q.Pattern)
+	}
+	q.Pattern = nil
+	if !reflect.DeepEqual(expected, q) {
+		t.Errorf("Unexpected query.\nexpected: %+v\nreceived: %+v", expected, q)
+	}
+
+	q, err = ParseSearchQuery(`after:09:15 /deploy(ed)? \/api/`, now)
+	if err != nil {
+		t.Fatalf("Failed to parse query with regular expression: %+v", err)
+	}
+	if q.Pattern.String() != `deploy(ed)? \/api` {
+		t.Errorf("Unexpected regular expression: %s", q.Pattern)
+	}
+	if at := time.Date(2022, 7, 7, 9, 15, 0, 0, time.UTC); !q.After.Equal(at) {
+		t.Errorf("Unexpected after time.\nexpected: %s\nreceived: %s",
+			at, q.After)
+	}
+}
+
+// Error path: Tests that ParseSearchQuery rejects invalid queries.
+func TestParseSearchQuery_Invalid(t *testing.T) {
+	now := time.Date(2022, 7, 7, 12, 0, 0, 0, time.UTC)
+	queries := []string{
+		"",
+		"   ",
+		"/unterminated",
+		"/[/",
+		"text /regexp/",
+		"tag:unknown",
+		"after:yesterday",
+		"after:1h before:2h",
+	}
+
+	for _, query := range queries {
+		if _, err := ParseSearchQuery(query, now); err == nil {
+			t.Errorf("Parsed invalid query %q.", query)
+		}
+	}
+}
+
+// Tests that SearchQuery.Match only matches messages that match every filter.
+func TestSearchQuery_Match(t *testing.T) {
+	now := time.Date(2022, 7, 7, 12, 0, 0, 0, time.UTC)
+	file, err := NewAttachment("Release-Notes.txt", []byte("data"))
+	if err != nil {
+		t.Fatalf("Failed to create attachment: %+v", err)
+	}
+	fileData := file.Marshal()
+
+	text := ReceivedBroadcast{Tag: Default, Username: "Alice",
+		Message: []byte("See the release notes"), Timestamp: now}
+
+	tests := []struct {
+		query string
+		r     ReceivedBroadcast
+		match bool
+	}{
+		{"RELEASE", text, true},
+		{"release from:alice", text, true},
+		{"release from:bob", text, false},
+		{"/^See/", text, true},
+		{"/^see/", text, false},
+		{"tag:admin", text, false},
+		{"after:1h", text, true},
+		{"before:1h", text, false},
+		{"notes tag:file", ReceivedBroadcast{Tag: File, Username: "alice",
+			Message: fileData, Timestamp: now}, true},
+		{"notes", ReceivedBroadcast{Tag: Join, Username: "notes",
+			Timestamp: now}, false},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseSearchQuery(tt.query, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to parse query %q: %+v", tt.query, err)
+		}
+		if match := q.Match(tt.r); match != tt.match {
+			t.Errorf("Unexpected match for %q.\nexpected: %t\nreceived: %t",
+				tt.query, tt.match, match)
+		}
+	}
+}
+
+// Tests that SearchQuery.FindAll returns every match in the text.
+func TestSearchQuery_FindAll(t *testing.T) {
+	q, err := ParseSearchQuery("ab", time.Now())
+	if err != nil {
+		t.Fatalf("Failed to parse query: %+v", err)
+	}
+
+	expected := [][]int{{0, 2}, {4, 6}}
+	if spans := q.FindAll("abc AB"); !reflect.DeepEqual(expected, spans) {
+		t.Errorf("Unexpected matches.\nexpected: %v\nreceived: %v",
+			expected, spans)
+	}
+}
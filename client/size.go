@@ -0,0 +1,78 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/client/broadcast"
+	"gitlab.com/elixxir/client/cmix"
+	"gitlab.com/elixxir/client/cmix/message"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/id/ephemeral"
+	"time"
+)
+
+// Error messages.
+const (
+	// MaxPayloadSizes
+	errSizeSymmetricChannel  = "failed to make symmetric channel: %+v"
+	errSizeAsymmetricChannel = "failed to make asymmetric channel: %+v"
+)
+
+// MaxPayloadSizes returns the maximum sizes of the message text of symmetric
+// and asymmetric messages sent to the channel by the username, as set on a
+// JoinedChannel, on a network with the maximum cMix message length. The sizes
+// are found without joining the channel. Returns an error if the channel's
+// reception ID is not derived from its other fields.
+func MaxPayloadSizes(c *crypto.Channel, username string,
+	maxMessageLength int) (symmetric, asymmetric int, err error) {
+	net := sizingClient{maxMessageLength}
+
+	symClient, err := broadcast.NewBroadcastChannel(*c, nil, net, nil,
+		broadcast.Param{Method: broadcast.Symmetric})
+	if err != nil {
+		return 0, 0, errors.Errorf(errSizeSymmetricChannel, err)
+	}
+	asymClient, err := broadcast.NewBroadcastChannel(*c, nil, net, nil,
+		broadcast.Param{Method: broadcast.Asymmetric})
+	if err != nil {
+		return 0, 0, errors.Errorf(errSizeAsymmetricChannel, err)
+	}
+
+	_, symmetric = SymmetricBroadcastFn(symClient, username)
+	_, asymmetric = AsymmetricBroadcastFn(asymClient, username, nil)
+
+	return symmetric, asymmetric, nil
+}
+
+// sizingClient is a broadcast.Client that only reports the maximum cMix
+// message length so that the payload sizes of a channel can be found. It does
+// not send or receive messages.
+type sizingClient struct {
+	maxMessageLength int
+}
+
+func (s sizingClient) GetMaxMessageLength() int {
+	return s.maxMessageLength
+}
+
+func (sizingClient) Send(*id.ID, format.Fingerprint, message.Service, []byte,
+	[]byte, cmix.CMIXParams) (id.Round, ephemeral.Id, error) {
+	return 0, ephemeral.Id{}, errors.New("cannot send on sizing client")
+}
+
+func (sizingClient) IsHealthy() bool {
+	return false
+}
+
+func (sizingClient) AddIdentity(*id.ID, time.Time, bool)                   {}
+func (sizingClient) AddService(*id.ID, message.Service, message.Processor) {}
+func (sizingClient) DeleteClientService(*id.ID)                            {}
+func (sizingClient) RemoveIdentity(*id.ID)                                 {}
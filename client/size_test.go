@@ -0,0 +1,78 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package client
+
+import (
+	"gitlab.com/elixxir/client/broadcast"
+	"gitlab.com/elixxir/primitives/format"
+	"testing"
+)
+
+// Tests that MaxPayloadSizes returns the payload sizes of the channel's
+// broadcast functions for the username and that longer usernames leave less
+// room for the message.
+func TestMaxPayloadSizes(t *testing.T) {
+	channel, _ := newTestChannel(t)
+	maxMessageLength := format.NewMessage(512).ContentsSize()
+
+	symmetric, asymmetric, err :=
+		MaxPayloadSizes(channel, "alice", maxMessageLength)
+	if err != nil {
+		t.Fatalf("Failed to get payload sizes: %+v", err)
+	}
+
+	expected := MaxFragmentedPayloadSize(
+		broadcast.MaxSizedBroadcastPayloadSize(maxMessageLength), "alice")
+	if symmetric != expected {
+		t.Errorf("Unexpected symmetric size.\nexpected: %d\nreceived: %d",
+			expected, symmetric)
+	}
+	if asymmetric <= 0 || asymmetric >= symmetric {
+		t.Errorf("Asymmetric size %d not in (0, %d).", asymmetric, symmetric)
+	}
+
+	longSym, longAsym, err :=
+		MaxPayloadSizes(channel, "alice-with-a-longer-name", maxMessageLength)
+	if err != nil {
+		t.Fatalf("Failed to get payload sizes: %+v", err)
+	}
+	if longSym >= symmetric || longAsym >= asymmetric {
+		t.Errorf("Sizes for a longer username (%d, %d) are not smaller than "+
+			"(%d, %d).", longSym, longAsym, symmetric, asymmetric)
+	}
+}
+
+// Error path: Tests that MaxPayloadSizes fails for a channel whose reception
+// ID is not derived from its other fields.
+func TestMaxPayloadSizes_InvalidID(t *testing.T) {
+	channel, _ := newTestChannel(t)
+	channel.Name = "changed"
+
+	_, _, err := MaxPayloadSizes(
+		channel, "alice", format.NewMessage(512).ContentsSize())
+	if err == nil {
+		t.Errorf("Got payload sizes of channel with invalid reception ID.")
+	}
+}
+
+// Tests that MaxMessageLength returns the contents size of a cMix message in
+// the group of the default NDF and fails for a missing NDF file.
+func TestMaxMessageLength(t *testing.T) {
+	length, err := MaxMessageLength("")
+	if err != nil {
+		t.Fatalf("Failed to get max message length: %+v", err)
+	}
+	if expected := format.NewMessage(512).ContentsSize(); length != expected {
+		t.Errorf("Unexpected max message length.\nexpected: %d\nreceived: %d",
+			expected, length)
+	}
+
+	if _, err = MaxMessageLength("missing-ndf.json"); err == nil {
+		t.Errorf("Got max message length from missing NDF file.")
+	}
+}
@@ -28,14 +28,111 @@ const (
 	// Admin indicates that the sender has a private key and the message is sent
 	// asymmetrically.
 	Admin Tag = 3
+
+	// Fragment indicates the message is one part of a larger message that
+	// must be reassembled before it is handled.
+	Fragment Tag = 4
+
+	// File indicates the message contains an Attachment.
+	File Tag = 5
+
+	// Edit indicates the message replaces the text of an earlier message. The
+	// ID of the edited message is in the EditOfExt extension.
+	Edit Tag = 6
+
+	// Delete indicates the message retracts an earlier message. The ID of the
+	// retracted message is in the EditOfExt extension.
+	Delete Tag = 7
+
+	// Reaction indicates the message is a short reaction, such as "seen" or
+	// "on it", to an earlier message. The ID of the message reacted to is in
+	// the ReplyToExt extension.
+	Reaction Tag = 8
+
+	// Heartbeat is sent periodically to indicate the user is still in the
+	// channel. It is ephemeral.
+	Heartbeat Tag = 9
+
+	// Typing indicates the user is writing a message. It is ephemeral.
+	Typing Tag = 10
+
+	// Moderate indicates the message is a ModerationCommand that changes the
+	// mute or ban list of the channel. It is only accepted when sent
+	// asymmetrically and signed by the channel admin.
+	Moderate Tag = 11
+
+	// Topic sets the topic of the channel to the message text. An empty text
+	// clears the topic. It is only accepted when sent asymmetrically.
+	Topic Tag = 12
+
+	// Pin pins a message to the channel. The message contains a copy of the
+	// pinned message and the ID of the pinned message is in the ReplyToExt
+	// extension. It is only accepted when sent asymmetrically.
+	Pin Tag = 13
+
+	// Unpin unpins the message whose ID is in the ReplyToExt extension. It is
+	// only accepted when sent asymmetrically.
+	Unpin Tag = 14
+
+	// Grant indicates the message is a RoleGrant that gives a role to the
+	// owner of an identity key. It is only accepted when sent asymmetrically
+	// and signed by the channel admin.
+	Grant Tag = 15
+
+	// Revoke revokes every role granted to the identity key in the message.
+	// It is only accepted when sent asymmetrically.
+	Revoke Tag = 16
+
+	// Handover indicates the message is a Handover that replaces the channel's
+	// RSA key with a successor key. It is only accepted when sent
+	// asymmetrically and signed with the key it replaces.
+	Handover Tag = 17
 )
 
 // tagStringMap correlates each Tag to a human-readable name.
 var tagStringMap = map[Tag]string{
-	Default: "default",
-	Join:    "join",
-	Exit:    "exit",
-	Admin:   "admin",
+	Default:   "default",
+	Join:      "join",
+	Exit:      "exit",
+	Admin:     "admin",
+	Fragment:  "fragment",
+	File:      "file",
+	Edit:      "edit",
+	Delete:    "delete",
+	Reaction:  "reaction",
+	Heartbeat: "heartbeat",
+	Typing:    "typing",
+	Moderate:  "moderate",
+	Topic:     "topic",
+	Pin:       "pin",
+	Unpin:     "unpin",
+	Grant:     "grant",
+	Revoke:    "revoke",
+	Handover:  "handover",
+}
+
+// IsValid determines if the Tag is one known to this client.
+func (t Tag) IsValid() bool {
+	_, exists := tagStringMap[t]
+	return exists
+}
+
+// IsEphemeral determines if messages with the Tag only describe the current
+// state of the sender and expire instead of being kept in the history.
+func (t Tag) IsEphemeral() bool {
+	return t == Heartbeat || t == Typing
+}
+
+// IsBulletin determines if messages with the Tag change the topic or pinned
+// messages of the channel.
+func (t Tag) IsBulletin() bool {
+	return t == Topic || t == Pin || t == Unpin
+}
+
+// IsRole determines if messages with the Tag grant or revoke roles in the
+// channel.
+func (t Tag) IsRole() bool {
+	return t == Grant || t == Revoke
 }
 
 // String returns a human-readable name for the Tag for debugging purposes.
@@ -0,0 +1,652 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/utils"
+	"os"
+	"time"
+)
+
+// Admin command actions that are not moderation actions.
+const (
+	// adminList prints the mute and ban lists, topic, and pinned messages
+	// stored in the session.
+	adminList = "list"
+
+	// adminTopic sets the topic of the channel.
+	adminTopic = "topic"
+
+	// adminPin and adminUnpin pin and unpin a message by its message ID.
+	adminPin   = "pin"
+	adminUnpin = "unpin"
+
+	// adminGrant and adminRevoke grant and revoke the moderator role.
+	adminGrant  = "grant"
+	adminRevoke = "revoke"
+
+	// adminRotate hands the channel over to a new RSA key.
+	adminRotate = "rotate"
+
+	// adminRotations prints the handovers of the channel's RSA key stored in
+	// the session.
+	adminRotations = "rotations"
+)
+
+var bCastAdmin = &cobra.Command{
+	Use: "admin {mute | unmute | ban | unban | topic | pin | unpin | grant | " +
+		"revoke | rotate | list | rotations} -o file [username | " +
+		"--identity key | topic | messageID]",
+	Short: "Moderate a broadcast channel, set its topic and pinned " +
+		"messages, grant moderators, and rotate its key.",
+	Long: "Moderate a broadcast channel, set its topic and pinned " +
+		"messages, grant moderators, and rotate its key. Each command is " +
+		"sent to the " +
+		"channel with the channel's RSA private key. Moderators may send " +
+		"the mute, unmute, ban, and unban actions without the key.\n\n" +
+		"The mute, unmute, ban, and unban actions add the user to or remove " +
+		"them from the mute or ban list kept by every client. Messages " +
+		"from muted users are hidden and messages from banned users are " +
+		"dropped on reception. Users are identified by their username or, " +
+		"with --identity, by the base64-encoded identity key they sign " +
+		"their messages with.\n\n" +
+		"The topic action sets the topic of the channel; an empty topic " +
+		"clears it. The pin and unpin actions pin and unpin the message with " +
+		"the message ID, as printed by listen. Only messages in the history " +
+		"can be pinned.\n\n" +
+		"The grant action makes the user a moderator until the duration " +
+		"given with --expires elapses, or indefinitely if it is not given, " +
+		"and the revoke action revokes it. A user given by username must " +
+		"have been seen signing their messages.\n\n" +
+		"The rotate action hands the channel over to a new RSA key. The " +
+		"handover is signed with the current key and sent to the channel, " +
+		"after which members only accept admin messages from the new key. " +
+		"By default, a new key is generated and replaces the current key " +
+		"file; use --newKey to save it elsewhere or --successor to hand the " +
+		"channel over to the public key of a new owner, as printed by " +
+		"\"key generate\". The channel file is updated with the handover " +
+		"so that members who join later learn the new key. If the current " +
+		"key is reassembled from key shares given with --keyShare, then " +
+		"the new key is not saved but split the same way into key shares " +
+		"saved to --shareDir.\n\n" +
+		"The list action prints the lists, topic, pinned messages, and " +
+		"moderators stored in this session and the rotations action prints " +
+		"the handovers of the channel's key, both without connecting to " +
+		"the network.",
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		// Use the channel file registered under the alias if one is given
+		resolveChannelAlias()
+
+		password := parsePassword(viper.GetString("password"))
+
+		handoversKV, err := openStore(handoversDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel handovers: %+v", err)
+		}
+		handovers := client.NewHandovers(handoversKV)
+
+		// Load channel from file
+		channel, err := loadChannel(viper.GetString("open"), handovers)
+		if err != nil {
+			jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+		}
+
+		moderationKV, err := openStore(moderationDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open moderation lists: %+v", err)
+		}
+		moderation := client.NewModeration(moderationKV)
+
+		bulletinsKV, err := openStore(bulletinDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel bulletins: %+v", err)
+		}
+		bulletins := client.NewBulletins(bulletinsKV)
+
+		rolesKV, err := openStore(rolesDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel roles: %+v", err)
+		}
+		roles := client.NewRoles(rolesKV)
+
+		if args[0] == adminList {
+			if len(args) > 1 || viper.IsSet("identity") {
+				printUsageError(cmd, errors.Errorf(
+					"%q does not take an argument", adminList))
+			}
+			printAdminState(
+				channel.ReceptionID, moderation, bulletins, roles)
+			return
+		} else if args[0] == adminRotations {
+			if len(args) > 1 {
+				printUsageError(cmd, errors.Errorf(
+					"%q does not take an argument", adminRotations))
+			}
+			printHandovers(channel, handovers)
+			return
+		}
+
+		isRoleAction := args[0] == adminGrant || args[0] == adminRevoke
+		if viper.IsSet("identity") &&
+			!isModerationAction(args[0]) && !isRoleAction {
+			printUsageError(cmd, errors.Errorf(
+				"%q does not take an identity key", args[0]))
+		} else if viper.IsSet("expires") && args[0] != adminGrant {
+			printUsageError(cmd, errors.Errorf(
+				"%q does not take an expiry", args[0]))
+		} else if (viper.IsSet("successor") || viper.IsSet("newKey")) &&
+			args[0] != adminRotate {
+			printUsageError(cmd, errors.Errorf(
+				"%q does not take a successor key", args[0]))
+		} else if viper.IsSet("successor") && viper.IsSet("newKey") {
+			printUsageError(cmd, errors.New(
+				"cannot supply both a successor key and a new key file"))
+		} else if viper.GetString("daemon") != "" {
+			jww.FATAL.Panic("Admin commands cannot be sent through the daemon.")
+		}
+
+		historyKV, err := openStore(historyDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open message history: %+v", err)
+		}
+		history := client.NewHistory(historyKV)
+
+		identityKV, err := openStore(identityDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open identity keyring: %+v", err)
+		}
+		keyring, err := client.LoadKeyring(identityKV, !viper.GetBool("noSign"))
+		if err != nil {
+			jww.FATAL.Panicf("Failed to load identity keyring: %+v", err)
+		}
+
+		// Build the command before connecting so that invalid arguments are
+		// reported first
+		var send func(jc *client.JoinedChannel) error
+		var description string
+		var successor *rsa.PublicKey
+		switch args[0] {
+		case adminTopic:
+			if len(args) != 2 {
+				printUsageError(cmd, errors.New("a topic is required; use "+
+					"\"\" to clear the topic"))
+			}
+			topic := args[1]
+			if err = client.ValidateTopic(topic); err != nil {
+				printUsageError(cmd, err)
+			}
+			send = func(jc *client.JoinedChannel) error {
+				return jc.SetTopic(topic)
+			}
+			description = fmt.Sprintf("topic %q", topic)
+		case adminPin:
+			if len(args) != 2 {
+				printUsageError(cmd, errors.New("a message ID is required"))
+			}
+			r, err := findMessage(history, channel.ReceptionID, args[1])
+			if err != nil {
+				jww.FATAL.Panicf("Cannot pin message: %+v", err)
+			}
+			send = func(jc *client.JoinedChannel) error {
+				return jc.PinMessage(r)
+			}
+			description = "pin of message " + args[1]
+		case adminUnpin:
+			if len(args) != 2 {
+				printUsageError(cmd, errors.New("a message ID is required"))
+			}
+			mid, err := findPin(bulletins, channel.ReceptionID, args[1])
+			if err != nil {
+				jww.FATAL.Panicf("Cannot unpin message: %+v", err)
+			}
+			send = func(jc *client.JoinedChannel) error {
+				return jc.UnpinMessage(mid)
+			}
+			description = "unpin of message " + args[1]
+		case adminGrant, adminRevoke:
+			key, err := parseRoleTarget(
+				keyring, channel.ReceptionID, args[1:])
+			if err != nil {
+				printUsageError(cmd, err)
+			}
+			var expires time.Time
+			if d := viper.GetDuration("expires"); d > 0 {
+				expires = time.Now().Add(d)
+			} else if d < 0 {
+				printUsageError(cmd, errors.New("expiry cannot be negative"))
+			}
+			send = func(jc *client.JoinedChannel) error {
+				if args[0] == adminRevoke {
+					return jc.Revoke(key)
+				}
+				return jc.Grant(client.Moderator, key, expires)
+			}
+			description = args[0] + " of moderator to key " +
+				client.Fingerprint(key)
+		case adminRotate:
+			if len(args) > 1 {
+				printUsageError(cmd, errors.Errorf(
+					"%q does not take an argument", adminRotate))
+			}
+			if path := viper.GetString("successor"); path != "" {
+				successor, err = loadPublicKey(path)
+				if err != nil {
+					jww.FATAL.Panicf("Cannot load successor key: %+v", err)
+				}
+			}
+			send = func(jc *client.JoinedChannel) error {
+				_, err := jc.HandOver(successor)
+				return err
+			}
+		default:
+			action, exists := client.ModerationActionByName(args[0])
+			if !exists {
+				printUsageError(
+					cmd, errors.Errorf("unknown action %q", args[0]))
+			}
+			username, key, err := parseModerationTarget(
+				args[1:], viper.GetString("identity"))
+			if err != nil {
+				printUsageError(cmd, err)
+			}
+			send = func(jc *client.JoinedChannel) error {
+				return jc.Moderate(action, username, key)
+			}
+			description = action.String() + " " + username
+			if key != nil {
+				description =
+					action.String() + " key " + client.Fingerprint(key)
+			}
+		}
+
+		// Moderators can send moderation actions without the RSA private key
+		privateKey, shares, err := readChannelKey(channel,
+			viper.GetString("key"), viper.GetStringSlice("keyShare"))
+		if err != nil && !isModerationAction(args[0]) {
+			jww.FATAL.Panicf("Cannot send admin commands to channel %q "+
+				"without its RSA private key: %+v", channel.Name, err)
+		} else if err != nil {
+			jww.INFO.Printf("Cannot get RSA private key of channel %q; "+
+				"moderating with a moderator grant: %+v", channel.Name, err)
+		}
+
+		// The new key is only generated once the current key is read and is
+		// saved next to the current key file until the handover is sent. A key
+		// reassembled from key shares is replaced by the shares of the new key
+		// split the same way, so that neither key is written to disk.
+		keyPath := client.RsaPrivateKeyPath(viper.GetString("key"), channel.Name)
+		newKeyPath := viper.GetString("newKey")
+		var sharePaths []string
+		if args[0] == adminRotate && successor == nil &&
+			shares != nil && newKeyPath == "" {
+			newKey, err := rsa.GenerateKey(
+				csprng.NewSystemRNG(), channelKeyBits)
+			if err != nil {
+				jww.FATAL.Panicf("Could not generate new RSA key: %+v", err)
+			}
+			sharePaths, err = writeKeyShares(channel, newKey,
+				shares[0].Threshold, shares[0].Shares,
+				viper.GetString("shareDir"))
+			if err != nil {
+				jww.FATAL.Panicf("Could not split new RSA key: %+v", err)
+			}
+			successor = newKey.GetPublic()
+		} else if args[0] == adminRotate && successor == nil {
+			if newKeyPath == "" {
+				newKeyPath = keyPath + ".new"
+			}
+			newKey, err := generateChannelKey(newKeyPath)
+			if err != nil {
+				jww.FATAL.Panicf("Could not generate new RSA key: %+v", err)
+			}
+			successor = newKey.GetPublic()
+		}
+		if args[0] == adminRotate {
+			description = "handover to key " + client.RsaFingerprint(successor)
+		}
+
+		streamGen := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+
+		// Initialise a new client
+		cMixClient, broadcastClient, err := initNetwork(password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to initialise client: %+v", err)
+		}
+
+		jc, err := client.JoinChannel(channel, viper.GetString("username"),
+			privateKey, broadcastClient, streamGen, client.ChannelStores{
+				History:    history,
+				Keyring:    keyring,
+				Moderation: moderation,
+				Bulletins:  bulletins,
+				Roles:      roles,
+				Handovers:  handovers,
+			})
+		if err != nil {
+			jww.FATAL.Panicf("Failed to join channel: %+v", err)
+		} else if !jc.IsModerator() {
+			jww.FATAL.Panicf("Cannot moderate channel %q without its RSA "+
+				"private key or a moderator grant.", channel.Name)
+		}
+
+		err = connectNetwork(cMixClient)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to connect to network: %+v", err)
+		}
+
+		if err = send(jc); err != nil {
+			jww.FATAL.Panicf("Failed to send %s: %+v", description, err)
+		}
+
+		// The topic and pins are saved when they are received back so that
+		// they are stored the same way as those sent by other admin clients
+		if args[0] == adminTopic || args[0] == adminPin ||
+			args[0] == adminUnpin {
+			waitForBulletin(jc, viper.GetDuration("waitTimeout"))
+		}
+
+		jww.INFO.Printf("Sent %s to channel %q.", description, channel.Name)
+		fmt.Printf("Sent %s to channel %q.\n", description, channel.Name)
+
+		if args[0] == adminRotate {
+			finishRotation(jc, viper.GetString("open"), keyPath, newKeyPath)
+			printNewKeyShares(sharePaths, shares)
+		}
+
+		jc.Leave()
+		stopNetwork(cMixClient)
+	},
+}
+
+// isModerationAction determines if the admin command action is a moderation
+// action.
+func isModerationAction(action string) bool {
+	_, exists := client.ModerationActionByName(action)
+	return exists
+}
+
+// findMessage returns the message with the message ID in the history of the
+// channel.
+func findMessage(history *client.History, channelID *id.ID,
+	messageID string) (client.ReceivedBroadcast, error) {
+	messages, err := history.Load(channelID)
+	if err != nil {
+		return client.ReceivedBroadcast{}, err
+	}
+
+	for _, r := range messages {
+		if mid, exists := r.Extensions.MessageID(); exists &&
+			mid.String() == messageID {
+			return r, nil
+		}
+	}
+
+	return client.ReceivedBroadcast{}, errors.Errorf(
+		"no message with ID %q in the history", messageID)
+}
+
+// findPin returns the ID of the pinned message with the message ID in the
+// bulletin of the channel.
+func findPin(bulletins *client.Bulletins, channelID *id.ID,
+	messageID string) (client.MessageID, error) {
+	bulletin, err := bulletins.Get(channelID)
+	if err != nil {
+		return client.MessageID{}, err
+	}
+
+	for _, p := range bulletin.Pins {
+		if p.MessageID.String() == messageID {
+			return p.MessageID, nil
+		}
+	}
+
+	return client.MessageID{}, errors.Errorf(
+		"message %q is not pinned", messageID)
+}
+
+// waitForBulletin waits until a change to the topic or pinned messages is
+// received on the channel or the timeout elapses.
+func waitForBulletin(jc *client.JoinedChannel, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case r := <-jc.Received:
+			if r.Tag.IsBulletin() {
+				return
+			}
+		case <-deadline:
+			jww.WARN.Printf("Sent command was not received back within %s. "+
+				"It will be saved once it is received.", timeout)
+			return
+		}
+	}
+}
+
+// printAdminState prints the mute and ban lists, topic, pinned messages, and
+// moderators of the channel stored in the session.
+func printAdminState(channelID *id.ID, moderation *client.Moderation,
+	bulletins *client.Bulletins, roles *client.Roles) {
+	lists, err := moderation.Lists(channelID)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to load moderation lists: %+v", err)
+	}
+	bulletin, err := bulletins.Get(channelID)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to load channel bulletin: %+v", err)
+	}
+	grants, err := roles.Grants(channelID, time.Now())
+	if err != nil {
+		jww.FATAL.Panicf("Failed to load channel roles: %+v", err)
+	}
+
+	printModerationList("Muted", lists.Muted)
+	printModerationList("Banned", lists.Banned)
+	fmt.Println("Topic:")
+	if bulletin.Topic != "" {
+		fmt.Println("  " + bulletin.Topic)
+	}
+	fmt.Println("Pinned:")
+	for _, p := range bulletin.Pins {
+		fmt.Printf("  %s %s: %s\n", p.MessageID, p.Username, p.Text)
+	}
+	fmt.Println("Moderators:")
+	for _, g := range grants {
+		expires := "never expires"
+		if !g.Expires.IsZero() {
+			expires = "expires " + g.Expires.Format(time.RFC3339)
+		}
+		fmt.Printf("  key %s (%s)\n",
+			base64.StdEncoding.EncodeToString(g.Key), expires)
+	}
+}
+
+// printHandovers prints the channel's RSA key in the channel file, the
+// handovers of it stored in the session, and the channel's current key.
+func printHandovers(channel *crypto.Channel, handovers *client.Handovers) {
+	chain, err := handovers.Chain(channel)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to load channel handovers: %+v", err)
+	}
+
+	fmt.Printf("Channel key: %s\n", client.RsaFingerprint(channel.RsaPubKey))
+	fmt.Println("Handovers:")
+	for i, h := range chain {
+		fmt.Printf("  %d. %s to key %s\n", i+1,
+			h.IssuedAt.Format(time.RFC3339), client.RsaFingerprint(h.Successor))
+	}
+	fmt.Printf("Current key: %s\n",
+		client.RsaFingerprint(handovers.Key(channel)))
+}
+
+// finishRotation replaces the current RSA private key file with the newly
+// generated one, if it was saved next to it, and writes the handovers of the
+// channel's key to the channel file. If the channel was opened from an invite
+// link, then the updated invite is printed instead.
+func finishRotation(
+	jc *client.JoinedChannel, channelPath, keyPath, newKeyPath string) {
+	if newKeyPath == keyPath+".new" {
+		if err := os.Rename(newKeyPath, keyPath); err != nil {
+			jww.FATAL.Panicf("Failed to replace RSA private key file %q with "+
+				"%q: %+v", keyPath, newKeyPath, err)
+		}
+		newKeyPath = keyPath
+	}
+
+	chain, err := jc.Handovers()
+	if err != nil {
+		jww.FATAL.Panicf("Failed to load channel handovers: %+v", err)
+	}
+
+	if newKeyPath != "" {
+		fmt.Printf("Saved the new RSA private key to %q.\n", newKeyPath)
+	}
+
+	if client.IsInvite(channelPath) {
+		invite, err := client.NewInvite(jc.Channel, chain)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to make invite: %+v", err)
+		}
+		fmt.Printf("Updated invite; share it with members so that those who "+
+			"join later accept the new key:\n%s\n", invite)
+		return
+	}
+
+	err = client.WriteChannel(channelPath, jc.Channel, chain...)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to write channel file: %+v", err)
+	}
+	fmt.Printf("Updated channel file %q; share it with members so that "+
+		"those who join later accept the new key.\n", channelPath)
+}
+
+// printNewKeyShares prints the key share files of the new key that the
+// channel was handed over to, if it was split into shares.
+func printNewKeyShares(paths []string, shares []client.KeyShare) {
+	if len(paths) == 0 {
+		return
+	}
+
+	fmt.Printf("Split the new RSA private key into %d shares, any %d of "+
+		"which reassemble it:\n", len(paths), shares[0].Threshold)
+	for _, path := range paths {
+		fmt.Println("  " + path)
+	}
+	fmt.Println("Give each share to a different person. The shares of the " +
+		"previous key no longer control the channel.")
+}
+
+// loadPublicKey loads the RSA public key PEM from the file.
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.LoadPublicKeyFromPem(data)
+}
+
+// parseModerationTarget returns the username in the arguments or the identity
+// key decoded from base64. Exactly one of them must be supplied.
+func parseModerationTarget(
+	args []string, identity string) (string, ed25519.PublicKey, error) {
+	switch {
+	case len(args) > 0 && identity != "":
+		return "", nil, errors.New(
+			"cannot supply both a username and an identity key")
+	case len(args) > 0:
+		return args[0], nil, nil
+	case identity == "":
+		return "", nil, errors.New("a username or identity key is required")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(identity)
+	if err != nil {
+		return "", nil, errors.Errorf("invalid identity key: %+v", err)
+	} else if len(key) != ed25519.PublicKeySize {
+		return "", nil, errors.Errorf("identity key of size %d does not "+
+			"match %d", len(key), ed25519.PublicKeySize)
+	}
+
+	return "", key, nil
+}
+
+// parseRoleTarget returns the identity key of the user to grant or revoke a
+// role. The user is given by the identity flag or by a username, which is
+// resolved to the identity key bound to it in the keyring.
+func parseRoleTarget(keyring *client.Keyring, channelID *id.ID,
+	args []string) (ed25519.PublicKey, error) {
+	username, key, err := parseModerationTarget(
+		args, viper.GetString("identity"))
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	key, exists := keyring.BoundKey(channelID, username)
+	if !exists {
+		return nil, errors.Errorf("no identity key is known for %q; use "+
+			"--identity instead", username)
+	}
+	return key, nil
+}
+
+// printModerationList prints the users on the list under the heading.
+// Identity keys are printed in full so that they can be passed to --identity.
+func printModerationList(heading string, l client.ModerationList) {
+	fmt.Println(heading + ":")
+	for _, username := range l.Usernames {
+		fmt.Println("  " + username)
+	}
+	for _, key := range l.Keys {
+		fmt.Println("  key " + base64.StdEncoding.EncodeToString(key))
+	}
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastAdmin.Flags().String("identity", "",
+		"The base64-encoded identity key of the user to moderate instead of "+
+			"their username.")
+	bindPFlag(bCastAdmin.Flags(), "identity", bCastAdmin.Use)
+
+	bCastAdmin.Flags().Duration("expires", 0,
+		"How long a moderator grant lasts. By default, it does not expire.")
+	bindPFlag(bCastAdmin.Flags(), "expires", bCastAdmin.Use)
+
+	bCastAdmin.Flags().String("successor", "",
+		"The RSA public key PEM file of the new owner to hand the channel "+
+			"over to. By default, a new key is generated.")
+	bindPFlag(bCastAdmin.Flags(), "successor", bCastAdmin.Use)
+
+	bCastAdmin.Flags().String("newKey", "",
+		"Location to save the newly generated RSA private key. By default, "+
+			"it replaces the current key file.")
+	bindPFlag(bCastAdmin.Flags(), "newKey", bCastAdmin.Use)
+
+	bCast.AddCommand(bCastAdmin)
+}
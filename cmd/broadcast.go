@@ -19,11 +19,39 @@ import (
 	"gitlab.com/elixxir/client/xxdk"
 	crypto "gitlab.com/elixxir/crypto/broadcast"
 	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/elixxir/ekv"
 	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
 	"gitlab.com/xx_network/primitives/netTime"
+	"path/filepath"
 	"time"
 )
 
+// Directories inside the session directory where each store is saved.
+const (
+	// historyDir contains the message history.
+	historyDir = "channelHistory"
+
+	// identityDir contains the identity key and the identity keys of other
+	// users.
+	identityDir = "identity"
+
+	// moderationDir contains the mute and ban lists of each channel.
+	moderationDir = "moderation"
+
+	// bulletinDir contains the topic and pinned messages of each channel.
+	bulletinDir = "bulletin"
+
+	// rolesDir contains the roles granted in each channel.
+	rolesDir = "roles"
+
+	// handoversDir contains the handovers of the RSA key of each channel.
+	handoversDir = "handovers"
+
+	// registryDir contains the channel registry of aliases.
+	registryDir = "registry"
+)
+
 func loadingDots(quit chan struct{}) {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	for {
@@ -50,6 +78,11 @@ var bCast = &cobra.Command{
 		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
 		jww.INFO.Printf(Version())
 
+		// Use the channel file registered under the alias if one is given
+		if viper.GetBool("load") {
+			resolveChannelAlias()
+		}
+
 		streamGen := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
 		filePath := viper.GetString("open")
 
@@ -70,7 +103,6 @@ var bCast = &cobra.Command{
 			if err != nil {
 				jww.FATAL.Panicf("Could not make new channel: %+v", err)
 			}
-			rng.Close()
 
 			jww.INFO.Printf(
 				"Generated new channel %q: %+v", name, channel)
@@ -80,105 +112,158 @@ var bCast = &cobra.Command{
 				jww.FATAL.Panicf("Could not write channel to file: %+v", err)
 			}
 
-			err = client.WriteRsaPrivateKey(
-				viper.GetString("key"), name, rsaPrivKey)
+			// Encrypt the RSA private key unless a plaintext key is requested
+			var passphrase []byte
+			if !viper.GetBool("plaintextKey") {
+				passphrase, err = newPassphrase(
+					viper.GetString("passphraseFile"),
+					fmt.Sprintf("for the RSA private key of channel %q", name))
+				if err != nil {
+					jww.FATAL.Panicf("Could not get passphrase to encrypt "+
+						"RSA private key: %+v", err)
+				}
+			}
+
+			err = client.WriteRsaPrivateKey(viper.GetString("key"), name,
+				rsaPrivKey, passphrase, rng)
 			if err != nil {
 				jww.FATAL.Panicf(
 					"Could not write RSA private key to file: %+v", err)
 			}
+			rng.Close()
 
 			return
 		}
 
 		// Join existing channel
 		if viper.GetBool("load") {
+			password := parsePassword(viper.GetString("password"))
+
+			// Open the handovers of each channel's RSA key so that those in
+			// the channel files are saved as the channels are loaded
+			handoversKV, err := openStore(handoversDir, password)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to open channel handovers: %+v", err)
+			}
+			handovers := client.NewHandovers(handoversKV)
+
+			// The key reassembled from key shares is only used for a single
+			// admin message so that it is not held in memory for a session
+			sharePaths := viper.GetStringSlice("keyShare")
+			if len(sharePaths) > 0 && !viper.IsSet("admin") {
+				printUsageError(cmd, errors.Errorf(
+					"flag %q requires flag %q", "keyShare", "admin"))
+			}
+
+			// Load every channel and its RSA private key before showing the
+			// loading dots since encrypted keys prompt for their passphrase
+			channelPaths := append(
+				[]string{filePath}, viper.GetStringSlice("join")...)
+			loaded := make([]*crypto.Channel, len(channelPaths))
+			privateKeys := make([]*rsa.PrivateKey, len(channelPaths))
+			for i, path := range channelPaths {
+				// Only the first channel uses the key specified by the key and
+				// keyShare flags
+				keyPath, keySharePaths := "", []string(nil)
+				if i == 0 {
+					keyPath, keySharePaths = viper.GetString("key"), sharePaths
+				} else if e, exists := lookupChannelAlias(path); exists {
+					path, keyPath = e.Channel, e.Key
+					channelPaths[i] = path
+				}
+
+				loaded[i], privateKeys[i], err =
+					loadUIChannel(path, keyPath, keySharePaths, handovers)
+				if err != nil {
+					jww.FATAL.Panicf("Failed to load channel from file %q: %+v",
+						path, err)
+				}
+			}
 
 			quit := make(chan struct{})
 			go loadingDots(quit)
 
 			// Initialise a new client
-			var cMixClient *xxdk.Cmix
-			var broadcastClient broadcast.Client
-			var err error
-			if viper.GetBool("test") {
-				// Initialise mock client for testing the UI
-				broadcastClient = newMockCmix(newMockCmixHandler())
-				jww.INFO.Printf("Initialised mock client for testing.")
-			} else {
-				// Initialise the real client
-				cMixClient, err = client.InitClient(
-					parsePassword(viper.GetString("password")),
-					viper.GetString("session"),
-					viper.GetString("ndf"),
-				)
-				if err != nil {
-					jww.FATAL.Panicf("Failed to initialise client: %+v", err)
-				}
-				broadcastClient = cMixClient.GetCmix()
-				jww.INFO.Printf("Initialised client.")
+			cMixClient, broadcastClient, err := initNetwork(password)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise client: %+v", err)
 			}
 
-			// Load channel from file
-			channel, err := client.LoadChannel(filePath)
+			// Open the message history
+			historyKV, err := openStore(historyDir, password)
 			if err != nil {
-				jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+				jww.FATAL.Panicf("Failed to open message history: %+v", err)
 			}
+			history := client.NewHistory(historyKV)
 
-			cb, cbChan := client.ReceptionCallback()
+			// Open the identity keyring
+			identityKV, err := openStore(identityDir, password)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to open identity keyring: %+v", err)
+			}
+			keyring, err :=
+				client.LoadKeyring(identityKV, !viper.GetBool("noSign"))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to load identity keyring: %+v", err)
+			}
 
-			symParams := broadcast.Param{Method: broadcast.Symmetric}
-			symClient, err := broadcast.NewBroadcastChannel(
-				*channel, cb, broadcastClient, streamGen, symParams)
+			// Open the moderation lists
+			moderationKV, err := openStore(moderationDir, password)
 			if err != nil {
-				jww.FATAL.Panicf(
-					"Failed to start new symmetric broadcast client: %+v", err)
+				jww.FATAL.Panicf("Failed to open moderation lists: %+v", err)
 			}
+			moderation := client.NewModeration(moderationKV)
 
-			asymParams := broadcast.Param{Method: broadcast.Asymmetric}
-			asymClient, err := broadcast.NewBroadcastChannel(
-				*channel, cb, broadcastClient, streamGen, asymParams)
+			// Open the channel topics and pinned messages
+			bulletinsKV, err := openStore(bulletinDir, password)
 			if err != nil {
-				jww.FATAL.Panicf(
-					"Failed to start new asymmetric broadcast client: %+v", err)
+				jww.FATAL.Panicf("Failed to open channel bulletins: %+v", err)
 			}
+			bulletins := client.NewBulletins(bulletinsKV)
 
-			// Connect to the network
-			if !viper.GetBool("test") {
-				waitTimeout := viper.GetDuration("waitTimeout")
-				err = client.ConnectToNetwork(cMixClient, waitTimeout)
+			// Open the roles granted in each channel
+			rolesKV, err := openStore(rolesDir, password)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to open channel roles: %+v", err)
+			}
+			roles := client.NewRoles(rolesKV)
+
+			// Join the channel and every additional channel, in order
+			stores := client.ChannelStores{
+				History:    history,
+				Keyring:    keyring,
+				Moderation: moderation,
+				Bulletins:  bulletins,
+				Roles:      roles,
+				Handovers:  handovers,
+			}
+			username := viper.GetString("username")
+			channels := make([]ui.Channel, len(loaded))
+			for i, channel := range loaded {
+				channels[i], err = joinUIChannel(channel, privateKeys[i],
+					username, broadcastClient, streamGen, stores)
 				if err != nil {
-					jww.FATAL.Panicf("Failed to connect to network: %+v", err)
+					jww.FATAL.Panicf("Failed to join channel in file %q: %+v",
+						channelPaths[i], err)
 				}
 			}
+			jc := channels[0].JoinedChannel
 
-			username := viper.GetString("username")
-
-			symBroadcastFn, maxPayloadSize := client.SymmetricBroadcastFn(
-				symClient, username)
-
-			var asymBroadcastFn client.BroadcastFn
-			var asymMaxPayloadSize int
-
-			privateKey, err := client.ReadRsaPrivateKey(
-				viper.GetString("key"), channel.Name)
+			// Connect to the network
+			err = connectNetwork(cMixClient)
 			if err != nil {
-				jww.WARN.Printf("Cannot join channel as admin. Cannot "+
-					"get RSA private key: %+v", err)
-			} else {
-				asymBroadcastFn, asymMaxPayloadSize =
-					client.AsymmetricBroadcastFn(asymClient, username, privateKey)
+				jww.FATAL.Panicf("Failed to connect to network: %+v", err)
 			}
 
-			// Load RSA private key from file
 			if viper.IsSet("admin") {
-				if asymBroadcastFn == nil {
+				if jc.AsymBroadcastFn == nil {
 					jww.FATAL.Panic(
 						"Failed to initialise asymmetric broadcast function.")
 				}
 
 				message := viper.GetString("admin")
 
-				err = asymBroadcastFn(
+				err = jc.AsymBroadcastFn(
 					client.Admin, netTime.Now(), []byte(message))
 				quit <- struct{}{}
 				if err != nil {
@@ -187,34 +272,141 @@ var bCast = &cobra.Command{
 				}
 			} else {
 				quit <- struct{}{}
-				m := ui.NewManager(channel, cbChan, symBroadcastFn, asymBroadcastFn,
-					username, maxPayloadSize, asymMaxPayloadSize)
+				m := ui.NewManager(
+					username, channels, viper.GetBool("showMalformed"),
+					!viper.GetBool("noPresence"),
+					viper.GetDuration("rosterIdle"))
 				m.MakeUI()
 			}
 
-			if !viper.GetBool("test") {
-				// Stop network follower
-				if cMixClient != nil {
-					err := cMixClient.StopNetworkFollower()
-					if err != nil {
-						jww.WARN.Printf(
-							"Failed to stop network follower: %+v", err)
-					}
-				}
+			for _, c := range channels {
+				c.Leave()
 			}
+			stopNetwork(cMixClient)
 		}
 	},
 }
 
+// loadUIChannel loads the channel from the file and its RSA private key with
+// readChannelKey from the key share files, if any, or the key path. If the key
+// cannot be read, then it is nil so that the channel is joined without admin
+// privileges. Handovers in the channel file are saved to the Handovers.
+func loadUIChannel(path, keyPath string, sharePaths []string,
+	handovers *client.Handovers) (*crypto.Channel, *rsa.PrivateKey, error) {
+	channel, err := loadChannel(path, handovers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKey, _, err := readChannelKey(channel, keyPath, sharePaths)
+	if err != nil {
+		jww.WARN.Printf("Cannot join channel %q as admin. Cannot get RSA "+
+			"private key: %+v", channel.Name, err)
+	}
+
+	return channel, privateKey, nil
+}
+
+// joinUIChannel joins the channel, with admin privileges if the RSA private
+// key is not nil, and loads its stored messages.
+func joinUIChannel(channel *crypto.Channel, privateKey *rsa.PrivateKey,
+	username string, net broadcast.Client, rng *fastRNG.StreamGenerator,
+	stores client.ChannelStores) (ui.Channel, error) {
+	backlog, err := stores.History.Load(channel.ReceptionID)
+	if err != nil {
+		return ui.Channel{}, err
+	}
+
+	jc, err := client.JoinChannel(
+		channel, username, privateKey, net, rng, stores)
+	if err != nil {
+		return ui.Channel{}, err
+	}
+
+	return ui.Channel{JoinedChannel: jc, Backlog: backlog}, nil
+}
+
+// initNetwork initialises the cMix client from the session. When testing, a
+// mock client is returned instead and the cMix client is nil.
+func initNetwork(password []byte) (*xxdk.Cmix, broadcast.Client, error) {
+	if viper.GetBool("test") {
+		// Initialise mock client for testing the UI
+		jww.INFO.Printf("Initialised mock client for testing.")
+		return nil, newMockCmix(newMockCmixHandler()), nil
+	}
+
+	// Initialise the real client
+	cMixClient, err := client.InitClient(password,
+		viper.GetString("session"), viper.GetString("ndf"))
+	if err != nil {
+		return nil, nil, err
+	}
+	jww.INFO.Printf("Initialised client.")
+
+	return cMixClient, cMixClient.GetCmix(), nil
+}
+
+// connectNetwork connects the cMix client to the network. Does nothing when
+// testing.
+func connectNetwork(cMixClient *xxdk.Cmix) error {
+	if cMixClient == nil {
+		return nil
+	}
+
+	return client.ConnectToNetwork(
+		cMixClient, viper.GetDuration("waitTimeout"))
+}
+
+// stopNetwork stops the network follower of the cMix client. Does nothing when
+// testing.
+func stopNetwork(cMixClient *xxdk.Cmix) {
+	if cMixClient == nil {
+		return
+	}
+
+	err := cMixClient.StopNetworkFollower()
+	if err != nil {
+		jww.WARN.Printf("Failed to stop network follower: %+v", err)
+	}
+}
+
+// openStore opens the store in the directory inside the session directory,
+// encrypted with the session password. When testing, and for the history when
+// it is disabled, the store is only kept in memory.
+func openStore(dir string, password []byte) (ekv.KeyValue, error) {
+	if viper.GetBool("test") ||
+		(dir == historyDir && viper.GetBool("noHistory")) {
+		return ekv.MakeMemstore(), nil
+	}
+
+	path := filepath.Join(viper.GetString("session"), dir)
+	return ekv.NewFilestore(path, string(password))
+}
+
+// loadChannel loads the channel from the file and saves the handovers of its
+// RSA key in the file to the Handovers so that the channel's current key is
+// used.
+func loadChannel(
+	path string, handovers *client.Handovers) (*crypto.Channel, error) {
+	channel, chain, err := client.LoadChannelFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	added, err := handovers.Merge(channel, chain)
+	if err != nil {
+		return nil, err
+	} else if added > 0 {
+		jww.INFO.Printf("Learned %d handovers of channel %q from file %q.",
+			added, channel.Name, path)
+	}
+
+	return channel, nil
+}
+
 // init is the initialization function for Cobra which defines commands and
 // flags.
 func init() {
-	bCast.Flags().Bool("test", false,
-		"Skips creating a client and connecting to network so that the UI "+
-			"can be tested on its own.")
-	bindPFlag(bCast.Flags(), "test", bCast.Use)
-	hidePFlag(bCast.Flags(), "test", bCast.Use)
-
 	bCast.Flags().Bool("new", false,
 		"Creates a new broadcast channel with the specified name and "+
 			"description.")
@@ -224,6 +416,28 @@ func init() {
 		"Joins an existing broadcast channel.")
 	bindPFlag(bCast.Flags(), "load", bCast.Use)
 
+	bCast.Flags().StringArrayP("join", "j", nil,
+		"Additional channel information file, invite link, or alias to join "+
+			"in the UI. May be specified multiple times. The RSA private key "+
+			"of each channel is read from its default location or the "+
+			"location registered with its alias.")
+	bindPFlag(bCast.Flags(), "join", bCast.Use)
+
+	bCast.Flags().Bool("showMalformed", false,
+		"Prints a notice to the channel feed for every received message that "+
+			"cannot be decoded.")
+	bindPFlag(bCast.Flags(), "showMalformed", bCast.Use)
+
+	bCast.Flags().Bool("noPresence", false,
+		"Disables sending heartbeats and typing indicators. Other users will "+
+			"not see you as online or typing.")
+	bindPFlag(bCast.Flags(), "noPresence", bCast.Use)
+
+	bCast.Flags().Duration("rosterIdle", client.PresenceTimeout,
+		"How long a user is listed in the member roster after the last "+
+			"message received from them.")
+	bindPFlag(bCast.Flags(), "rosterIdle", bCast.Use)
+
 	bCast.Flags().StringP("name", "n", "",
 		"The name of the channel.")
 	bindPFlag(bCast.Flags(), "name", bCast.Use)
@@ -232,15 +446,45 @@ func init() {
 		"Description of the channel.")
 	bindPFlag(bCast.Flags(), "description", bCast.Use)
 
-	bCast.Flags().StringP("open", "o", "",
+	bCast.PersistentFlags().StringP("open", "o", "",
 		"Location to output/open channel information file. Prints to stdout "+
-			"if no path is supplied.")
-	bindPFlag(bCast.Flags(), "open", bCast.Use)
+			"if no path is supplied. An invite link or an alias in the channel "+
+			"registry may be opened in place of a file.")
+	bindPFlag(bCast.PersistentFlags(), "open", bCast.Use)
 
-	bCast.Flags().StringP("key", "k", "",
+	bCast.PersistentFlags().StringP("key", "k", "",
 		"Location to save/load the RSA private key PEM file. Uses the name of "+
 			"the channel if no path is supplied.")
-	bindPFlag(bCast.Flags(), "key", bCast.Use)
+	bindPFlag(bCast.PersistentFlags(), "key", bCast.Use)
+
+	bCast.PersistentFlags().String("passphraseFile", "",
+		"File containing the passphrase of the encrypted RSA private key. By "+
+			"default, it is prompted for when an encrypted key is read or a "+
+			"new channel is created.")
+	bindPFlag(bCast.PersistentFlags(), "passphraseFile", bCast.Use)
+
+	bCast.PersistentFlags().String("newPassphraseFile", "",
+		"File containing the passphrase to encrypt a re-encrypted or newly "+
+			"generated RSA private key with by the key and admin rotate "+
+			"commands. By default, it is prompted for.")
+	bindPFlag(bCast.PersistentFlags(), "newPassphraseFile", bCast.Use)
+
+	bCast.PersistentFlags().StringArray("keyShare", nil,
+		"Key share file of the channel's split RSA private key. May be "+
+			"specified multiple times. The key is reassembled from the shares "+
+			"in memory instead of being read from a key file. Only used "+
+			"with --admin and by the admin and key split commands.")
+	bindPFlag(bCast.PersistentFlags(), "keyShare", bCast.Use)
+
+	bCast.PersistentFlags().String("shareDir", ".",
+		"Directory to save the key shares of a split RSA private key to by "+
+			"the key split and admin rotate commands.")
+	bindPFlag(bCast.PersistentFlags(), "shareDir", bCast.Use)
+
+	bCast.Flags().Bool("plaintextKey", false,
+		"Saves the RSA private key of a new channel without encrypting it. "+
+			"Anyone who can read the file can send admin messages.")
+	bindPFlag(bCast.Flags(), "plaintextKey", bCast.Use)
 
 	bCast.Flags().StringP("admin", "a", "",
 		"Sends the given message as an admin. Either an RSA private key PEM "+
@@ -248,7 +492,11 @@ func init() {
 			"the \"key\" flag.")
 	bindPFlag(bCast.Flags(), "admin", bCast.Use)
 
-	bCast.Flags().StringP("username", "u", "",
+	bCast.PersistentFlags().StringP("username", "u", "",
 		"Join the channel with this username.")
-	bindPFlag(bCast.Flags(), "username", bCast.Use)
+	bindPFlag(bCast.PersistentFlags(), "username", bCast.Use)
+
+	bCast.PersistentFlags().Bool("noHistory", false,
+		"Disables saving the channel message history to the session.")
+	bindPFlag(bCast.PersistentFlags(), "noHistory", bCast.Use)
 }
@@ -0,0 +1,497 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Results of checking an RSA private key against a channel's key.
+const (
+	// keyMatches is the result for a key that matches the channel's current
+	// key.
+	keyMatches = "matches"
+
+	// keyReplaced is the result for a key that was the channel's key but has
+	// since been handed over.
+	keyReplaced = "replaced"
+
+	// keyMismatch is the result for a key that was never the channel's key.
+	keyMismatch = "mismatch"
+
+	// keyUnreadable is the result for a key that cannot be read.
+	keyUnreadable = "unreadable"
+)
+
+var bCastChannel = &cobra.Command{
+	Use:   "channel",
+	Short: "Inspect and register broadcast channel files.",
+	Long: "Inspect broadcast channel files and manage the channel registry. " +
+		"The registry maps short aliases to channel files, or invite links, " +
+		"RSA private keys, and default usernames. An alias can be given to " +
+		"--open in place of a channel file. The key and username registered " +
+		"with the alias are then used unless --key, --keyShare, or " +
+		"--username is set. An alias takes precedence over a file of the " +
+		"same name in the current directory; use ./name to open the file.",
+	Args: cobra.NoArgs,
+}
+
+var bCastChannelInspect = &cobra.Command{
+	Use:   "inspect -o file [-k key | --keyShare share] [-u username] [--json]",
+	Short: "Validate a channel file and print its details.",
+	Long: "Validate a channel file, or invite link, and print the channel's " +
+		"name, description, reception ID, the fingerprint of its RSA public " +
+		"key and of the current key after any handovers in the file, and " +
+		"the maximum size of the messages and admin messages sent by the " +
+		"user given with --username. The file is invalid if its reception " +
+		"ID is not derived from the rest of the channel or if its handovers " +
+		"are not validly signed. The channel is not joined and the network " +
+		"is not contacted.\n\n" +
+		"The RSA private key given with --key or --keyShare is checked " +
+		"against the channel's current key. The command exits with a " +
+		"non-zero code if the key does not match. Use --json to print the " +
+		"details as JSON.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		if viper.GetString("open") == "" {
+			printUsageError(cmd, errors.Errorf(
+				"required flag %q not set", "open"))
+		}
+		resolveChannelAlias()
+
+		channel, chain, err := client.LoadChannelFile(viper.GetString("open"))
+		if err != nil {
+			jww.FATAL.Panicf("Invalid channel file: %+v", err)
+		}
+
+		maxLength, err := maxMessageLength()
+		if err != nil {
+			jww.FATAL.Panicf("Cannot get maximum message length: %+v", err)
+		}
+
+		info, err := inspectChannel(
+			channel, chain, viper.GetString("username"), maxLength)
+		if err != nil {
+			jww.FATAL.Panicf("Invalid channel file: %+v", err)
+		}
+
+		info.PrivateKey = checkChannelKey(channel, chain,
+			viper.GetString("key"), viper.GetStringSlice("keyShare"))
+
+		if viper.GetBool("json") {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				jww.FATAL.Panicf("Failed to marshal channel JSON: %+v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printChannelInspection(info)
+		}
+
+		if info.PrivateKey != nil && info.PrivateKey.Result != keyMatches {
+			os.Exit(1)
+		}
+	},
+}
+
+var bCastChannelAdd = &cobra.Command{
+	Use:   "add alias -o file [-k key] [-u username]",
+	Short: "Register a channel file under an alias.",
+	Long: "Register the channel file, or invite link, given with --open " +
+		"under the alias. The RSA private key file given with --key and the " +
+		"username given with --username are also registered and used by " +
+		"default when the alias is opened. Relative paths are saved as " +
+		"absolute paths. The channel file is validated but not copied.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		if viper.GetString("open") == "" {
+			printUsageError(cmd, errors.Errorf(
+				"required flag %q not set", "open"))
+		} else if err := client.CheckAlias(args[0]); err != nil {
+			printUsageError(cmd, err)
+		}
+
+		channel, err := client.LoadChannel(viper.GetString("open"))
+		if err != nil {
+			jww.FATAL.Panicf("Invalid channel file: %+v", err)
+		}
+
+		keyPath := viper.GetString("key")
+		if keyPath != "" {
+			if _, err = os.Stat(keyPath); err != nil {
+				jww.FATAL.Panicf("Cannot find RSA private key: %+v", err)
+			}
+		}
+
+		registry := openChannelRegistry()
+		err = registry.Add(client.RegistryEntry{
+			Alias:    args[0],
+			Name:     channel.Name,
+			Channel:  viper.GetString("open"),
+			Key:      keyPath,
+			Username: viper.GetString("username"),
+		})
+		if err != nil {
+			jww.FATAL.Panicf("Failed to register channel: %+v", err)
+		}
+
+		fmt.Printf("Registered channel %q as %q.\n", channel.Name, args[0])
+	},
+}
+
+var bCastChannelList = &cobra.Command{
+	Use:   "list [--json]",
+	Short: "List the channels in the registry.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		entries, err := openChannelRegistry().List()
+		if err != nil {
+			jww.FATAL.Panicf("Failed to list channels: %+v", err)
+		}
+
+		if viper.GetBool("json") {
+			if entries == nil {
+				entries = []client.RegistryEntry{}
+			}
+			data, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				jww.FATAL.Panicf("Failed to marshal channel JSON: %+v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printRegistry(entries)
+		}
+	},
+}
+
+var bCastChannelRemove = &cobra.Command{
+	Use:   "remove alias",
+	Short: "Remove an alias from the registry.",
+	Long: "Remove the alias from the registry. The channel file and RSA " +
+		"private key are not deleted.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		err := openChannelRegistry().Remove(args[0])
+		if err != nil {
+			jww.FATAL.Panicf("Failed to remove channel: %+v", err)
+		}
+
+		fmt.Printf("Removed %q from the registry.\n", args[0])
+	},
+}
+
+var bCastChannelRename = &cobra.Command{
+	Use:   "rename alias newAlias",
+	Short: "Rename an alias in the registry.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		if err := client.CheckAlias(args[1]); err != nil {
+			printUsageError(cmd, err)
+		}
+
+		err := openChannelRegistry().Rename(args[0], args[1])
+		if err != nil {
+			jww.FATAL.Panicf("Failed to rename channel: %+v", err)
+		}
+
+		fmt.Printf("Renamed %q to %q.\n", args[0], args[1])
+	},
+}
+
+// channelInspection is the details of a channel printed by the inspect
+// command.
+type channelInspection struct {
+	Name                  string    `json:"name"`
+	Description           string    `json:"description"`
+	ReceptionID           string    `json:"receptionID"`
+	KeyFingerprint        string    `json:"keyFingerprint"`
+	KeyBits               int       `json:"keyBits"`
+	Handovers             int       `json:"handovers"`
+	CurrentKeyFingerprint string    `json:"currentKeyFingerprint"`
+	Username              string    `json:"username"`
+	MaxPayloadSize        int       `json:"maxPayloadSize"`
+	MaxAdminPayloadSize   int       `json:"maxAdminPayloadSize"`
+	PrivateKey            *keyCheck `json:"privateKey,omitempty"`
+}
+
+// keyCheck is the result of checking an RSA private key against the
+// channel's current key.
+type keyCheck struct {
+	// Source is the key file or key share files the key was read from.
+	Source string `json:"source"`
+
+	// Fingerprint is the RsaFingerprint of the key's public key.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Result is keyMatches, keyReplaced, keyMismatch, or keyUnreadable.
+	Result string `json:"result"`
+
+	// Error is the reason the key cannot be read.
+	Error string `json:"error,omitempty"`
+}
+
+// inspectChannel returns the details of the channel and the chain of
+// handovers of its RSA key. Returns an error if the channel's reception ID is
+// not derived from its other fields.
+func inspectChannel(channel *crypto.Channel, chain []client.KeyHandover,
+	username string, maxMessageLength int) (channelInspection, error) {
+	symmetric, asymmetric, err :=
+		client.MaxPayloadSizes(channel, username, maxMessageLength)
+	if err != nil {
+		return channelInspection{}, err
+	}
+
+	current, err := client.VerifyHandovers(channel, chain)
+	if err != nil {
+		return channelInspection{}, err
+	}
+
+	return channelInspection{
+		Name:                  channel.Name,
+		Description:           channel.Description,
+		ReceptionID:           channel.ReceptionID.String(),
+		KeyFingerprint:        client.RsaFingerprint(channel.RsaPubKey),
+		KeyBits:               channel.RsaPubKey.Size() * 8,
+		Handovers:             len(chain),
+		CurrentKeyFingerprint: client.RsaFingerprint(current),
+		Username:              username,
+		MaxPayloadSize:        symmetric,
+		MaxAdminPayloadSize:   asymmetric,
+	}, nil
+}
+
+// checkChannelKey checks the RSA private key read with readChannelKey against
+// the channel's current key. Returns nil if neither a key path nor key shares
+// are given.
+func checkChannelKey(channel *crypto.Channel, chain []client.KeyHandover,
+	keyPath string, sharePaths []string) *keyCheck {
+	source := keyPath
+	if len(sharePaths) > 0 {
+		source = fmt.Sprintf("%d key shares", len(sharePaths))
+	} else if keyPath == "" {
+		return nil
+	}
+
+	// Only the first line of the error is kept since the rest is the stack
+	// trace of the wrapped errors
+	privateKey, _, err := readChannelKey(channel, keyPath, sharePaths)
+	if err != nil {
+		jww.ERROR.Printf("Cannot read RSA private key %s: %+v", source, err)
+		return &keyCheck{Source: source, Result: keyUnreadable,
+			Error: strings.SplitN(err.Error(), "\n", 2)[0]}
+	}
+
+	check := &keyCheck{
+		Source:      source,
+		Fingerprint: client.RsaFingerprint(privateKey.GetPublic()),
+		Result:      keyMismatch,
+	}
+
+	keys := []*rsa.PublicKey{channel.RsaPubKey}
+	for _, h := range chain {
+		keys = append(keys, h.Successor)
+	}
+	for i, key := range keys {
+		if client.EqualRsaPublicKeys(privateKey.GetPublic(), key) {
+			check.Result = keyReplaced
+			if i == len(keys)-1 {
+				check.Result = keyMatches
+			}
+		}
+	}
+
+	return check
+}
+
+// printChannelInspection prints the details of the channel as text.
+func printChannelInspection(info channelInspection) {
+	fmt.Printf("Name:                %s\n", info.Name)
+	fmt.Printf("Description:         %s\n", info.Description)
+	fmt.Printf("Reception ID:        %s\n", info.ReceptionID)
+	fmt.Printf("Channel key:         %s (%d bits)\n",
+		info.KeyFingerprint, info.KeyBits)
+	fmt.Printf("Handovers:           %d\n", info.Handovers)
+	fmt.Printf("Current key:         %s\n", info.CurrentKeyFingerprint)
+	username := info.Username
+	if username == "" {
+		username = "(none)"
+	}
+	fmt.Printf("Username:            %s\n", username)
+	fmt.Printf("Max message size:    %d bytes\n", info.MaxPayloadSize)
+	fmt.Printf("Max admin size:      %d bytes\n", info.MaxAdminPayloadSize)
+
+	check := info.PrivateKey
+	if check == nil {
+		return
+	}
+	switch check.Result {
+	case keyMatches:
+		fmt.Printf("Private key:         %s (%s) matches the current key\n",
+			check.Fingerprint, check.Source)
+	case keyReplaced:
+		fmt.Printf("Private key:         %s (%s) has been handed over; it "+
+			"does not match the current key\n", check.Fingerprint,
+			check.Source)
+	case keyMismatch:
+		fmt.Printf("Private key:         %s (%s) does not match the "+
+			"channel\n", check.Fingerprint, check.Source)
+	default:
+		fmt.Printf("Private key:         %s cannot be read: %s\n",
+			check.Source, check.Error)
+	}
+}
+
+// printRegistry prints the registered channels as a table.
+func printRegistry(entries []client.RegistryEntry) {
+	if len(entries) == 0 {
+		fmt.Println("No channels registered.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ALIAS\tNAME\tUSERNAME\tCHANNEL\tKEY")
+	for _, e := range entries {
+		channel, key, username := e.Channel, e.Key, e.Username
+		if client.IsInvite(channel) {
+			channel = "(invite link)"
+		}
+		if key == "" {
+			key = "(default)"
+		}
+		if username == "" {
+			username = "(none)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			e.Alias, e.Name, username, channel, key)
+	}
+	_ = w.Flush()
+}
+
+// openChannelRegistry opens the channel registry with the session password.
+// When testing, the registry is only kept in memory.
+func openChannelRegistry() *client.Registry {
+	kv, err := openStore(
+		registryDir, parsePassword(viper.GetString("password")))
+	if err != nil {
+		jww.FATAL.Panicf("Failed to open channel registry: %+v", err)
+	}
+	return client.NewRegistry(kv)
+}
+
+// lookupChannelAlias returns the channel registered under the alias and true,
+// or false if the path is not a registered alias. Paths containing a path
+// separator and invite links are never looked up, and the registry is not
+// created if it does not exist.
+func lookupChannelAlias(path string) (client.RegistryEntry, bool) {
+	if client.CheckAlias(path) != nil {
+		return client.RegistryEntry{}, false
+	}
+
+	dir := filepath.Join(viper.GetString("session"), registryDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return client.RegistryEntry{}, false
+	}
+
+	e, exists, err := openChannelRegistry().Get(path)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to look up channel alias %q: %+v", path, err)
+	} else if exists {
+		jww.INFO.Printf("Opening channel %q registered as %q from %q.",
+			e.Name, e.Alias, e.Channel)
+	}
+	return e, exists
+}
+
+// resolveChannelAlias replaces the open flag with the channel file registered
+// under it if it is an alias. The key and username registered with the alias
+// are set unless they, or the keyShare flag, are already set.
+func resolveChannelAlias() {
+	e, exists := lookupChannelAlias(viper.GetString("open"))
+	if !exists {
+		return
+	}
+
+	viper.Set("open", e.Channel)
+	if e.Key != "" && !viper.IsSet("key") && !viper.IsSet("keyShare") {
+		viper.Set("key", e.Key)
+	}
+	if e.Username != "" && !viper.IsSet("username") {
+		viper.Set("username", e.Username)
+	}
+}
+
+// maxMessageLength returns the maximum size of the contents of a cMix message
+// on the network given by the NDF flag, or on the mock network when testing.
+func maxMessageLength() (int, error) {
+	if viper.GetBool("test") {
+		return newMockCmix(newMockCmixHandler()).GetMaxMessageLength(), nil
+	}
+	return client.MaxMessageLength(viper.GetString("ndf"))
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastChannel.PersistentFlags().Bool("json", false,
+		"Prints the channel details or registered channels as JSON.")
+	bindPFlag(bCastChannel.PersistentFlags(), "json", bCastChannel.Use)
+
+	bCastChannel.AddCommand(bCastChannelInspect)
+	bCastChannel.AddCommand(bCastChannelAdd)
+	bCastChannel.AddCommand(bCastChannelList)
+	bCastChannel.AddCommand(bCastChannelRemove)
+	bCastChannel.AddCommand(bCastChannelRename)
+	bCast.AddCommand(bCastChannel)
+}
@@ -0,0 +1,188 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"git.xx.network/elixxir/cli-client/daemon"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/utils"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// defaultDaemonAddress is the Unix socket the daemon listens on when no
+// address is specified.
+const defaultDaemonAddress = "cli-client.sock"
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [--daemon address]",
+	Short: "Run a daemon that keeps the client connected and serves a local API.",
+	Long: "Run a daemon that keeps a single client connected to the network, " +
+		"joins any number of broadcast channels, and exposes them over HTTP " +
+		"on a Unix socket or loopback TCP address. The broadcast send and " +
+		"listen commands use the daemon when the --daemon flag is set.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		address := viper.GetString("daemon")
+		if address == "" {
+			address = defaultDaemonAddress
+		}
+
+		streamGen := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+
+		// Initialise a new client and connect to the network
+		password := parsePassword(viper.GetString("password"))
+		cMixClient, broadcastClient, err := initNetwork(password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to initialise client: %+v", err)
+		}
+
+		historyKV, err := openStore(historyDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open message history: %+v", err)
+		}
+		history := client.NewHistory(historyKV)
+
+		identityKV, err := openStore(identityDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open identity keyring: %+v", err)
+		}
+		keyring, err := client.LoadKeyring(identityKV, !viper.GetBool("noSign"))
+		if err != nil {
+			jww.FATAL.Panicf("Failed to load identity keyring: %+v", err)
+		}
+
+		moderationKV, err := openStore(moderationDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open moderation lists: %+v", err)
+		}
+		moderation := client.NewModeration(moderationKV)
+
+		bulletinsKV, err := openStore(bulletinDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel bulletins: %+v", err)
+		}
+		bulletins := client.NewBulletins(bulletinsKV)
+
+		rolesKV, err := openStore(rolesDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel roles: %+v", err)
+		}
+		roles := client.NewRoles(rolesKV)
+
+		handoversKV, err := openStore(handoversDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel handovers: %+v", err)
+		}
+		handovers := client.NewHandovers(handoversKV)
+
+		err = connectNetwork(cMixClient)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to connect to network: %+v", err)
+		}
+
+		s := daemon.NewServer(broadcastClient, streamGen, client.ChannelStores{
+			History:    history,
+			Keyring:    keyring,
+			Moderation: moderation,
+			Bulletins:  bulletins,
+			Roles:      roles,
+			Handovers:  handovers,
+		})
+
+		l, err := daemon.Listen(address)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to start daemon: %+v", err)
+		}
+
+		// Only clients that can read the token file may call the API
+		token, err := daemon.WriteToken(address)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to start daemon: %+v", err)
+		}
+
+		srv := &http.Server{Handler: s.Handler(token)}
+		go func() {
+			jww.INFO.Printf("Daemon listening on %q.", address)
+			if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+				jww.FATAL.Panicf("Daemon stopped serving: %+v", err)
+			}
+		}()
+
+		// Run until interrupted
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		jww.INFO.Printf("Shutting down daemon.")
+		if err = srv.Close(); err != nil {
+			jww.WARN.Printf("Failed to close daemon server: %+v", err)
+		}
+		s.LeaveAll()
+		stopNetwork(cMixClient)
+		if path, err := daemon.TokenPath(address); err == nil {
+			_ = os.Remove(path)
+		}
+	},
+}
+
+// joinViaDaemon joins the channel in the channel file, or invite link, on the
+// daemon at the address and returns the daemon client and the joined channel's
+// information. The channel is joined without its private key, so admin
+// messages cannot be sent through it.
+func joinViaDaemon(address, channelPath, username string) (
+	*daemon.Client, daemon.ChannelInfo, error) {
+	channelData := []byte(channelPath)
+	if !client.IsInvite(channelPath) {
+		var err error
+		channelData, err = utils.ReadFile(channelPath)
+		if err != nil {
+			return nil, daemon.ChannelInfo{}, err
+		}
+	}
+
+	req := daemon.JoinRequest{
+		Channel:  string(channelData),
+		Username: username,
+	}
+
+	dc, err := daemon.NewClient(address)
+	if err != nil {
+		return nil, daemon.ChannelInfo{}, err
+	}
+
+	info, err := dc.Join(req)
+	if err != nil {
+		return nil, daemon.ChannelInfo{}, err
+	}
+
+	jww.INFO.Printf("Joined channel %q (%s) on daemon %q.",
+		info.Name, info.ChannelID, address)
+
+	return dc, info, nil
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
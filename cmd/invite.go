@@ -0,0 +1,104 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"fmt"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+)
+
+var bCastInvite = &cobra.Command{
+	Use:   "invite -o file [--qr]",
+	Short: "Print an invite link and QR code for a broadcast channel.",
+	Long: "Print an invite link for a broadcast channel. The link is a " +
+		"compact, checksummed form of the channel file, including the " +
+		"handovers of the channel's key known to the session, that starts " +
+		"with \"" + client.InvitePrefix + "\". It can be passed to --open, " +
+		"and to --join, in place of a channel file, for example:\n\n" +
+		"  cli-client broadcast --load -o \"" + client.InvitePrefix +
+		"...\" -u username\n\n" +
+		"With --qr, the link is also printed as a QR code drawn with " +
+		"block characters. The QR code is drawn for terminals with a dark " +
+		"background; use --invertQR on light backgrounds.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		// Use the channel file registered under the alias if one is given
+		resolveChannelAlias()
+
+		password := parsePassword(viper.GetString("password"))
+
+		handoversKV, err := openStore(handoversDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel handovers: %+v", err)
+		}
+		handovers := client.NewHandovers(handoversKV)
+
+		channel, err := loadChannel(viper.GetString("open"), handovers)
+		if err != nil {
+			jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+		}
+
+		chain, err := handovers.Chain(channel)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to load channel handovers: %+v", err)
+		}
+
+		invite, err := client.NewInvite(channel, chain)
+		if err != nil {
+			jww.FATAL.Panicf("Could not make invite: %+v", err)
+		}
+
+		fmt.Println(invite)
+
+		if viper.GetBool("qr") || viper.GetBool("invertQR") {
+			qr, err := inviteQRCode(invite, viper.GetBool("invertQR"))
+			if err != nil {
+				jww.FATAL.Panicf("Could not make QR code of invite: %+v", err)
+			}
+			fmt.Print(qr)
+		}
+	},
+}
+
+// inviteQRCode returns the invite link as a QR code drawn with block
+// characters, two modules per line. Unless inverted, dark modules are drawn as
+// blanks so that the code reads correctly on a dark background.
+func inviteQRCode(invite string, invert bool) (string, error) {
+	qr, err := qrcode.New(invite, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+
+	return qr.ToSmallString(invert), nil
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastInvite.Flags().Bool("qr", false,
+		"Also prints the invite link as a QR code.")
+	bindPFlag(bCastInvite.Flags(), "qr", bCastInvite.Use)
+
+	bCastInvite.Flags().Bool("invertQR", false,
+		"Prints the QR code for terminals with a light background. Implies "+
+			"--qr.")
+	bindPFlag(bCastInvite.Flags(), "invertQR", bCastInvite.Use)
+
+	bCast.AddCommand(bCastInvite)
+}
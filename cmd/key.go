@@ -0,0 +1,397 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/utils"
+	"golang.org/x/term"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Key command actions.
+const (
+	// keyEncrypt encrypts a plaintext RSA private key file.
+	keyEncrypt = "encrypt"
+
+	// keyPasswd changes the passphrase of an encrypted RSA private key file.
+	keyPasswd = "passwd"
+
+	// keyGenerate generates a new encrypted RSA private key file that a
+	// channel can be handed over to.
+	keyGenerate = "generate"
+
+	// keySplit splits a channel's RSA private key into key share files.
+	keySplit = "split"
+)
+
+// channelKeyBits is the size, in bits, of the RSA keys of new channels. Keys
+// that channels are handed over to must be the same size.
+const channelKeyBits = 4096
+
+var bCastKey = &cobra.Command{
+	Use: "key {encrypt | passwd | generate | split} {-o file | -k key}",
+	Short: "Encrypt, change the passphrase of, generate, or split a " +
+		"channel's RSA private key file.",
+	Long: "Encrypt a channel's RSA private key file, change its passphrase, " +
+		"generate a new one, or split it into shares. The key file is " +
+		"given with --key or, if it " +
+		"is not given, is the default key file of the channel given with " +
+		"--open.\n\n" +
+		"The encrypt action encrypts a plaintext key file with a new " +
+		"passphrase. The encryption key is derived from the passphrase " +
+		"with Argon2id and the key is encrypted with XChaCha20-Poly1305. " +
+		"The passwd action decrypts an encrypted key file with its current " +
+		"passphrase and encrypts it with a new one. Passphrases are " +
+		"prompted for without echo or read from the files given with " +
+		"--passphraseFile and --newPassphraseFile.\n\n" +
+		"The generate action saves a new encrypted key to the file given " +
+		"with --key and prints its public key PEM. Give the public key to " +
+		"the admin of a channel to have the channel handed over to it with " +
+		"\"admin rotate --successor\".\n\n" +
+		"The split action splits the key of the channel given with --open " +
+		"into the number of key share files given with --shares, any " +
+		"--threshold of which reassemble the key while fewer reveal " +
+		"nothing about it. The shares are saved to --shareDir. Give each " +
+		"share to a different person and delete the key file so that no " +
+		"single person holds the key. The shares are combined in memory, " +
+		"without writing the key to disk, by giving --keyShare once per " +
+		"share to \"--load --admin\" or the admin command. An existing split " +
+		"can be split again with new parameters by giving its shares with " +
+		"--keyShare.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		// Use the channel file registered under the alias if one is given
+		resolveChannelAlias()
+
+		switch args[0] {
+		case keyEncrypt, keyPasswd:
+		case keyGenerate:
+			path := viper.GetString("key")
+			if path == "" {
+				printUsageError(cmd,
+					errors.Errorf("required flag %q not set", "key"))
+			}
+
+			privateKey, err := generateChannelKey(path)
+			if err != nil {
+				jww.FATAL.Panicf("Could not generate RSA private key: %+v", err)
+			}
+
+			fmt.Printf("%s", rsa.CreatePublicKeyPem(privateKey.GetPublic()))
+			fmt.Fprintf(os.Stderr, "Saved RSA private key to %q. Its public "+
+				"key has fingerprint %s.\n", path,
+				client.RsaFingerprint(privateKey.GetPublic()))
+			return
+		case keySplit:
+			splitChannelKey(cmd)
+			return
+		default:
+			printUsageError(cmd, errors.Errorf("unknown action %q", args[0]))
+		}
+
+		path := viper.GetString("key")
+		if path == "" {
+			if viper.GetString("open") == "" {
+				printUsageError(cmd, errors.Errorf(
+					"required flag %q or %q not set", "key", "open"))
+			}
+			channel, err := client.LoadChannel(viper.GetString("open"))
+			if err != nil {
+				jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+			}
+			path = client.RsaPrivateKeyPath("", channel.Name)
+		}
+
+		data, err := utils.ReadFile(path)
+		if err != nil {
+			jww.FATAL.Panicf("Could not read RSA private key file: %+v", err)
+		}
+		encrypted := client.IsEncryptedRsaPrivateKey(data)
+		if args[0] == keyEncrypt && encrypted {
+			jww.FATAL.Panicf("RSA private key file %q is already encrypted. "+
+				"Use %q to change its passphrase.", path, keyPasswd)
+		} else if args[0] == keyPasswd && !encrypted {
+			jww.FATAL.Panicf("RSA private key file %q is not encrypted. Use "+
+				"%q to encrypt it.", path, keyEncrypt)
+		}
+
+		privateKey, err := client.ReadRsaPrivateKey(path, "",
+			keyPassphrase("Current passphrase for "+path+": "))
+		if err != nil {
+			jww.FATAL.Panicf("Could not load RSA private key: %+v", err)
+		}
+
+		passphrase, err := newPassphrase(
+			viper.GetString("newPassphraseFile"), "for "+path)
+		if err != nil {
+			jww.FATAL.Panicf("Could not get new passphrase: %+v", err)
+		}
+
+		rng := csprng.NewSystemRNG()
+		err = client.WriteRsaPrivateKey(path, "", privateKey, passphrase, rng)
+		if err != nil {
+			jww.FATAL.Panicf("Could not write RSA private key: %+v", err)
+		}
+
+		if args[0] == keyEncrypt {
+			fmt.Printf("Encrypted RSA private key file %q.\n", path)
+		} else {
+			fmt.Printf("Changed passphrase of RSA private key file %q.\n", path)
+		}
+	},
+}
+
+// generateChannelKey generates a new RSA private key the size of channel keys
+// and saves it to the path encrypted with a new passphrase. Returns an error if
+// the file already exists.
+func generateChannelKey(path string) (*rsa.PrivateKey, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, errors.Errorf("file %q already exists", path)
+	}
+
+	passphrase, err := newPassphrase(
+		viper.GetString("newPassphraseFile"), "for "+path)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := csprng.NewSystemRNG()
+	privateKey, err := rsa.GenerateKey(rng, channelKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.WriteRsaPrivateKey(path, "", privateKey, passphrase, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
+
+// splitChannelKey splits the RSA private key of the channel given by the open
+// flag into key share files.
+func splitChannelKey(cmd *cobra.Command) {
+	if viper.GetString("open") == "" {
+		printUsageError(cmd, errors.Errorf("required flag %q not set", "open"))
+	}
+	channel, err := client.LoadChannel(viper.GetString("open"))
+	if err != nil {
+		jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+	}
+
+	privateKey, shares, err := readChannelKey(channel,
+		viper.GetString("key"), viper.GetStringSlice("keyShare"))
+	if err != nil {
+		jww.FATAL.Panicf("Could not load RSA private key: %+v", err)
+	}
+
+	paths, err := writeKeyShares(channel, privateKey,
+		viper.GetInt("threshold"), viper.GetInt("shares"),
+		viper.GetString("shareDir"))
+	if err != nil {
+		jww.FATAL.Panicf("Could not split RSA private key: %+v", err)
+	}
+
+	fmt.Printf("Split the RSA private key of channel %q into %d shares, any "+
+		"%d of which reassemble it:\n", channel.Name, len(paths),
+		viper.GetInt("threshold"))
+	for _, path := range paths {
+		fmt.Println("  " + path)
+	}
+	if shares == nil {
+		fmt.Printf("Give each share to a different person and delete %q.\n",
+			client.RsaPrivateKeyPath(viper.GetString("key"), channel.Name))
+	} else {
+		fmt.Println("The shares of the previous split remain valid; delete " +
+			"them unless they are still needed.")
+	}
+}
+
+// readChannelKey returns the channel's RSA private key. If key share files are
+// given, then the key is reassembled from them in memory and the shares are
+// also returned. Otherwise, the key is read from the key path, or from the
+// default location when no path is supplied, prompting for its passphrase if
+// it is encrypted.
+func readChannelKey(channel *crypto.Channel, keyPath string,
+	sharePaths []string) (*rsa.PrivateKey, []client.KeyShare, error) {
+	if len(sharePaths) == 0 {
+		privateKey, err := client.ReadRsaPrivateKey(
+			keyPath, channel.Name, channelKeyPassphrase(channel.Name))
+		return privateKey, nil, err
+	}
+
+	shares := make([]client.KeyShare, len(sharePaths))
+	for i, path := range sharePaths {
+		s, err := client.ReadKeyShare(path)
+		if err != nil {
+			return nil, nil, errors.Errorf("%q: %+v", path, err)
+		} else if !s.ChannelID.Cmp(channel.ReceptionID) {
+			return nil, nil, errors.Errorf("key share %q is not of channel "+
+				"%q", path, channel.Name)
+		}
+		shares[i] = s
+	}
+
+	privateKey, err := client.CombineKeyShares(shares)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jww.INFO.Printf("Reassembled RSA private key of channel %q from %d key "+
+		"shares.", channel.Name, len(shares))
+
+	return privateKey, shares, nil
+}
+
+// writeKeyShares splits the channel's RSA private key into the number of
+// shares, any threshold of which reassemble it, and saves them to the
+// directory. Returns the paths of the share files. No file is written if any
+// of them already exists.
+func writeKeyShares(channel *crypto.Channel, privateKey *rsa.PrivateKey,
+	threshold, n int, dir string) ([]string, error) {
+	shares, err := client.SplitRsaPrivateKey(channel.ReceptionID, privateKey,
+		threshold, n, csprng.NewSystemRNG())
+	if err != nil {
+		return nil, err
+	}
+
+	// Share files are named after the channel and the split so that the
+	// shares of different splits can be kept in the same directory
+	paths := make([]string, len(shares))
+	name := strings.Join(strings.Fields(channel.Name), "")
+	for i, s := range shares {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%s-share-%s-%d.pem",
+			name, hex.EncodeToString(s.SplitID[:4]), s.Index))
+		if _, err = os.Stat(paths[i]); err == nil {
+			return nil, errors.Errorf("file %q already exists", paths[i])
+		}
+	}
+
+	for i, s := range shares {
+		if err = client.WriteKeyShare(paths[i], s); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// keyPassphrase returns a function that returns the passphrase of an encrypted
+// RSA private key file. It is read from the file given by the passphraseFile
+// flag or, if it is not set, prompted for with the prompt.
+func keyPassphrase(prompt string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if path := viper.GetString("passphraseFile"); path != "" {
+			return readPassphraseFile(path)
+		}
+		return promptPassphrase(prompt)
+	}
+}
+
+// channelKeyPassphrase returns a function that returns the passphrase of the
+// channel's encrypted RSA private key file, prompting for it by the channel's
+// name.
+func channelKeyPassphrase(channelName string) func() ([]byte, error) {
+	return keyPassphrase(fmt.Sprintf(
+		"Passphrase for the RSA private key of channel %q: ", channelName))
+}
+
+// newPassphrase returns a new passphrase to encrypt an RSA private key file
+// with. It is read from the file, if one is given, or prompted for twice,
+// describing the key with the description.
+func newPassphrase(path, description string) ([]byte, error) {
+	if path != "" {
+		return readPassphraseFile(path)
+	}
+
+	passphrase, err := promptPassphrase("New passphrase " + description + ": ")
+	if err != nil {
+		return nil, err
+	} else if len(passphrase) == 0 {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+
+	confirmation, err := promptPassphrase("Confirm new passphrase: ")
+	if err != nil {
+		return nil, err
+	} else if !bytes.Equal(passphrase, confirmation) {
+		return nil, errors.New("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+// readPassphraseFile returns the passphrase stored in the file without the
+// trailing newline.
+func readPassphraseFile(path string) ([]byte, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("failed to read passphrase file: %+v", err)
+	}
+
+	passphrase := bytes.TrimRight(data, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, errors.Errorf("passphrase file %q is empty", path)
+	}
+
+	return passphrase, nil
+}
+
+// promptPassphrase prints the prompt to stderr and reads a passphrase from the
+// terminal without echoing it. Returns an error if stdin is not a terminal.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("cannot prompt for passphrase since stdin " +
+			"is not a terminal; read it from a file instead")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, errors.Errorf("failed to read passphrase: %+v", err)
+	}
+
+	return passphrase, nil
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastKey.Flags().Int("threshold", 2,
+		"The number of key shares required to reassemble a split key.")
+	bindPFlag(bCastKey.Flags(), "threshold", bCastKey.Use)
+
+	bCastKey.Flags().Int("shares", 3,
+		"The number of key shares to split a key into.")
+	bindPFlag(bCastKey.Flags(), "shares", bCastKey.Use)
+
+	bCast.AddCommand(bCastKey)
+}
@@ -0,0 +1,237 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"git.xx.network/elixxir/cli-client/client"
+	"git.xx.network/elixxir/cli-client/daemon"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/csprng"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var bCastListen = &cobra.Command{
+	Use:     "listen -o file [--out file] [--history]",
+	Aliases: []string{"tail"},
+	Short: "Join a broadcast channel and print every received message as " +
+		"JSON Lines.",
+	Long: "Join a broadcast channel and print every received message as one " +
+		"JSON object per line to stdout or to the file specified by --out. " +
+		"Runs until interrupted.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		// Use the channel file registered under the alias if one is given
+		resolveChannelAlias()
+
+		streamGen := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+
+		// Open the output
+		var out io.Writer = os.Stdout
+		if outPath := viper.GetString("out"); outPath != "" {
+			f, err := os.OpenFile(
+				outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				jww.FATAL.Panicf(
+					"Failed to open output file %q: %+v", outPath, err)
+			}
+			defer func() {
+				if err = f.Close(); err != nil {
+					jww.ERROR.Printf("Failed to close output file: %+v", err)
+				}
+			}()
+			out = f
+		}
+		enc := json.NewEncoder(out)
+
+		// Receive the messages from the daemon if one is set
+		if address := viper.GetString("daemon"); address != "" {
+			listenViaDaemon(address, enc)
+			return
+		}
+
+		// Initialise a new client
+		password := parsePassword(viper.GetString("password"))
+		cMixClient, broadcastClient, err := initNetwork(password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to initialise client: %+v", err)
+		}
+
+		handoversKV, err := openStore(handoversDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel handovers: %+v", err)
+		}
+		handovers := client.NewHandovers(handoversKV)
+
+		// Load channel from file
+		channel, err := loadChannel(viper.GetString("open"), handovers)
+		if err != nil {
+			jww.FATAL.Panicf("Could not load channel from file: %+v", err)
+		}
+
+		historyKV, err := openStore(historyDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open message history: %+v", err)
+		}
+		history := client.NewHistory(historyKV)
+
+		identityKV, err := openStore(identityDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open identity keyring: %+v", err)
+		}
+		keyring, err := client.LoadKeyring(identityKV, !viper.GetBool("noSign"))
+		if err != nil {
+			jww.FATAL.Panicf("Failed to load identity keyring: %+v", err)
+		}
+
+		moderationKV, err := openStore(moderationDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open moderation lists: %+v", err)
+		}
+		moderation := client.NewModeration(moderationKV)
+
+		bulletinsKV, err := openStore(bulletinDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel bulletins: %+v", err)
+		}
+		bulletins := client.NewBulletins(bulletinsKV)
+
+		rolesKV, err := openStore(rolesDir, password)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to open channel roles: %+v", err)
+		}
+		roles := client.NewRoles(rolesKV)
+
+		// Print the stored messages first if requested
+		if viper.GetBool("history") {
+			backlog, err := history.Load(channel.ReceptionID)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to load message history: %+v", err)
+			}
+			for _, r := range client.ApplyChanges(backlog) {
+				if moderation.IsMuted(channel.ReceptionID, r) {
+					continue
+				}
+				writeListenRecord(enc, daemon.NewMessage(channel.ReceptionID, r))
+			}
+		}
+
+		jc, err := client.JoinChannel(channel, viper.GetString("username"),
+			nil, broadcastClient, streamGen, client.ChannelStores{
+				History:    history,
+				Keyring:    keyring,
+				Moderation: moderation,
+				Bulletins:  bulletins,
+				Roles:      roles,
+				Handovers:  handovers,
+			})
+		if err != nil {
+			jww.FATAL.Panicf("Failed to join channel: %+v", err)
+		}
+
+		err = connectNetwork(cMixClient)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to connect to network: %+v", err)
+		}
+
+		// Print messages until interrupted
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		for done := false; !done; {
+			select {
+			case r := <-jc.Received:
+				if jc.IsMuted(r) {
+					continue
+				}
+				writeListenRecord(enc, daemon.NewMessage(channel.ReceptionID, r))
+			case <-stop:
+				done = true
+			}
+		}
+
+		jc.Leave()
+		stopNetwork(cMixClient)
+	},
+}
+
+// listenViaDaemon joins the channel on the daemon at the address and writes
+// the messages it receives until interrupted.
+func listenViaDaemon(address string, enc *json.Encoder) {
+	dc, info, err := joinViaDaemon(address, viper.GetString("open"),
+		viper.GetString("username"))
+	if err != nil {
+		jww.FATAL.Panicf("Failed to join channel on daemon: %+v", err)
+	}
+
+	if viper.GetBool("history") {
+		backlog, err := dc.History(info.ChannelID)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to load message history: %+v", err)
+		}
+		for _, m := range backlog {
+			writeListenRecord(enc, m)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	err = dc.Subscribe(ctx, info.ChannelID, func(m daemon.Message) {
+		writeListenRecord(enc, m)
+	})
+	if err != nil {
+		jww.FATAL.Panicf("Subscription to daemon ended: %+v", err)
+	}
+}
+
+// writeListenRecord writes the received message as a single line of JSON.
+// Heartbeats and typing indicators are skipped.
+func writeListenRecord(enc *json.Encoder, m daemon.Message) {
+	if m.Tag == client.Heartbeat.String() || m.Tag == client.Typing.String() {
+		return
+	}
+
+	if err := enc.Encode(m); err != nil {
+		jww.ERROR.Printf("Failed to write received message: %+v", err)
+	}
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastListen.Flags().String("out", "",
+		"File to append the received messages to. Prints to stdout if no "+
+			"path is supplied.")
+	bindPFlag(bCastListen.Flags(), "out", bCastListen.Use)
+
+	bCastListen.Flags().Bool("history", false,
+		"Prints the messages stored in the channel history before printing "+
+			"new messages.")
+	bindPFlag(bCastListen.Flags(), "history", bCastListen.Use)
+
+	bCast.AddCommand(bCastListen)
+}
@@ -190,6 +190,23 @@ func init() {
 		"Duration to wait for messages to arrive.")
 	bindPFlag(rootCmd.PersistentFlags(), "waitTimeout", rootCmd.Use)
 
+	rootCmd.PersistentFlags().Bool("test", false,
+		"Skips creating a client and connecting to network so that the UI "+
+			"can be tested on its own.")
+	bindPFlag(rootCmd.PersistentFlags(), "test", rootCmd.Use)
+	hidePFlag(rootCmd.PersistentFlags(), "test", rootCmd.Use)
+
+	rootCmd.PersistentFlags().Bool("noSign", false,
+		"Disables signing sent messages with the identity key stored in the "+
+			"session. Received messages are still verified.")
+	bindPFlag(rootCmd.PersistentFlags(), "noSign", rootCmd.Use)
+
+	rootCmd.PersistentFlags().String("daemon", "",
+		"Unix socket path or loopback address of the daemon. The daemon "+
+			"command listens on it and other commands that support it send "+
+			"their requests to it instead of starting their own client.")
+	bindPFlag(rootCmd.PersistentFlags(), "daemon", rootCmd.Use)
+
 	rootCmd.AddCommand(bCast)
 }
 
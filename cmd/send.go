@@ -0,0 +1,274 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/netTime"
+	"io/ioutil"
+	"os"
+)
+
+// Exit codes returned by the send command.
+const (
+	// exitInvalidInput indicates that the message could not be read or that
+	// the command was used incorrectly.
+	exitInvalidInput = 2
+
+	// exitJoinFailed indicates that the client could not be started or the
+	// channel could not be joined.
+	exitJoinFailed = 3
+
+	// exitSendFailed indicates that one or more messages failed to send.
+	exitSendFailed = 4
+)
+
+// sendError is the machine-readable error printed to stderr when the send
+// command fails.
+type sendError struct {
+	// Error is a short, stable identifier for the kind of failure.
+	Error string `json:"error"`
+
+	// Message is the human-readable description of the error.
+	Message string `json:"message"`
+
+	// Sent is the number of messages that were sent before the failure.
+	Sent int `json:"sent"`
+
+	// Total is the number of messages that were to be sent.
+	Total int `json:"total"`
+}
+
+var bCastSend = &cobra.Command{
+	Use: "send -o file -u username [message | -f file] [--lines]",
+	Short: "Send a message to a broadcast channel without starting the " +
+		"interactive UI.",
+	Long: "Send a message to a broadcast channel without starting the " +
+		"interactive UI. The message is read from the argument, from the file " +
+		"specified by --file, or from stdin if neither is supplied. On " +
+		"failure, a JSON error is printed to stderr and the command exits " +
+		"with a non-zero code.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Initiate config file
+		initConfig(viper.GetString("config"))
+
+		// Initialize logging and print version
+		initLog(viper.GetString("logPath"), viper.GetInt("logLevel"))
+		jww.INFO.Printf(Version())
+
+		// Use the channel file registered under the alias if one is given
+		resolveChannelAlias()
+
+		messages, err := readSendMessages(args,
+			viper.GetString("file"), viper.GetBool("lines"))
+		if err != nil {
+			exitWithSendError(exitInvalidInput, "invalid_input", err, 0, 0)
+		}
+
+		// Send the messages through the daemon if one is set
+		if address := viper.GetString("daemon"); address != "" {
+			sendViaDaemon(address, messages)
+			return
+		}
+
+		streamGen := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+
+		// Initialise a new client
+		password := parsePassword(viper.GetString("password"))
+		cMixClient, broadcastClient, err := initNetwork(password)
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "client_init_failed", err, 0, len(messages))
+		}
+
+		// Load channel from file
+		channel, err := client.LoadChannel(viper.GetString("open"))
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "channel_load_failed", err, 0, len(messages))
+		}
+
+		historyKV, err := openStore(historyDir, password)
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "history_open_failed", err, 0, len(messages))
+		}
+		history := client.NewHistory(historyKV)
+
+		identityKV, err := openStore(identityDir, password)
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "keyring_open_failed", err, 0, len(messages))
+		}
+		keyring, err := client.LoadKeyring(identityKV, !viper.GetBool("noSign"))
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "keyring_open_failed", err, 0, len(messages))
+		}
+
+		jc, err := client.JoinChannel(channel, viper.GetString("username"),
+			nil, broadcastClient, streamGen,
+			client.ChannelStores{History: history, Keyring: keyring})
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "channel_join_failed", err, 0, len(messages))
+		}
+
+		// Reject messages that are too long before sending any
+		for _, message := range messages {
+			if len(message) > jc.SymMaxPayloadSize {
+				exitWithSendError(exitInvalidInput, "message_too_long",
+					errors.Errorf("message of size %d exceeds maximum of %d",
+						len(message), jc.SymMaxPayloadSize), 0, len(messages))
+			}
+		}
+
+		err = connectNetwork(cMixClient)
+		if err != nil {
+			exitWithSendError(
+				exitJoinFailed, "network_connect_failed", err, 0, len(messages))
+		}
+
+		for i, message := range messages {
+			err = jc.SymBroadcastFn(client.Default, netTime.Now(), message)
+			if err != nil {
+				stopNetwork(cMixClient)
+				exitWithSendError(
+					exitSendFailed, "send_failed", err, i, len(messages))
+			}
+		}
+
+		jww.INFO.Printf("Sent %d messages to channel %q.",
+			len(messages), channel.Name)
+
+		stopNetwork(cMixClient)
+	},
+}
+
+// sendViaDaemon sends the messages to the channel through the daemon at the
+// address.
+func sendViaDaemon(address string, messages [][]byte) {
+	dc, info, err := joinViaDaemon(address, viper.GetString("open"),
+		viper.GetString("username"))
+	if err != nil {
+		exitWithSendError(
+			exitJoinFailed, "channel_join_failed", err, 0, len(messages))
+	}
+
+	for _, message := range messages {
+		if len(message) > info.MaxPayloadSize {
+			exitWithSendError(exitInvalidInput, "message_too_long",
+				errors.Errorf("message of size %d exceeds maximum of %d",
+					len(message), info.MaxPayloadSize), 0, len(messages))
+		}
+	}
+
+	for i, message := range messages {
+		err = dc.Send(info.ChannelID, string(message))
+		if err != nil {
+			exitWithSendError(
+				exitSendFailed, "send_failed", err, i, len(messages))
+		}
+	}
+
+	jww.INFO.Printf("Sent %d messages to channel %q through daemon.",
+		len(messages), info.Name)
+}
+
+// readSendMessages returns the messages to send. The message is taken from the
+// argument if one is supplied, otherwise it is read from the file or from
+// stdin if no file is supplied. If splitLines is true, each non-empty line is
+// returned as a separate message.
+func readSendMessages(
+	args []string, filePath string, splitLines bool) ([][]byte, error) {
+	var data []byte
+	var err error
+	if len(args) > 0 {
+		if filePath != "" {
+			return nil, errors.New(
+				"cannot supply both a message argument and a file")
+		}
+		data = []byte(args[0])
+	} else if filePath != "" && filePath != "-" {
+		data, err = ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Errorf("failed to read message file: %+v", err)
+		}
+	} else {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, errors.Errorf("failed to read from stdin: %+v", err)
+		}
+	}
+
+	var messages [][]byte
+	if splitLines {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) > 0 {
+				messages = append(messages, append([]byte{}, line...))
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, errors.Errorf("failed to split lines: %+v", err)
+		}
+	} else if message := bytes.TrimSpace(data); len(message) > 0 {
+		messages = append(messages, message)
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("no message to send")
+	}
+
+	return messages, nil
+}
+
+// exitWithSendError prints the error to stderr as JSON and exits with the
+// given code.
+func exitWithSendError(code int, kind string, err error, sent, total int) {
+	jww.ERROR.Printf("Failed to send message (%s): %+v", kind, err)
+
+	data, jsonErr := json.Marshal(sendError{
+		Error:   kind,
+		Message: err.Error(),
+		Sent:    sent,
+		Total:   total,
+	})
+	if jsonErr != nil {
+		jww.FATAL.Panicf("Failed to marshal error JSON: %+v", jsonErr)
+	}
+
+	_, _ = os.Stderr.Write(append(data, '\n'))
+	os.Exit(code)
+}
+
+// init is the initialization function for Cobra which defines commands and
+// flags.
+func init() {
+	bCastSend.Flags().StringP("file", "f", "",
+		"Path to a file containing the message to send. Use \"-\" to read "+
+			"from stdin.")
+	bindPFlag(bCastSend.Flags(), "file", bCastSend.Use)
+
+	bCastSend.Flags().Bool("lines", false,
+		"Sends each non-empty line of the input as a separate message.")
+	bindPFlag(bCastSend.Flags(), "lines", bCastSend.Use)
+
+	bCast.AddCommand(bCastSend)
+}
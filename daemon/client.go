@@ -0,0 +1,225 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/id"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Error messages.
+const (
+	errRequest        = "request to %s failed: %+v"
+	errResponse       = "request to %s failed with status %d: %s"
+	errDecodeResponse = "failed to decode response from %s: %+v"
+)
+
+// Client calls the API of a running daemon.
+type Client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// NewClient returns a Client that connects to the daemon at the address. The
+// address has the same format as the one passed to Listen. Returns an error if
+// the daemon's token file cannot be read.
+func NewClient(address string) (*Client, error) {
+	token, err := ReadToken(address)
+	if err != nil {
+		return nil, err
+	}
+
+	network, addr := parseAddress(address)
+
+	c := &Client{http: &http.Client{}, token: token}
+	if network == "unix" {
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", addr)
+			},
+		}
+		c.baseURL = "http://" + unixHost
+	} else {
+		c.baseURL = "http://" + addr
+	}
+
+	return c, nil
+}
+
+// Join joins the channel on the daemon.
+func (c *Client) Join(req JoinRequest) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.post(joinPath, req, &info)
+}
+
+// Leave leaves the channel on the daemon.
+func (c *Client) Leave(channelID *id.ID) error {
+	return c.post(leavePath, ChannelRequest{channelID}, nil)
+}
+
+// Channels returns the channels joined by the daemon.
+func (c *Client) Channels() ([]ChannelInfo, error) {
+	var infos []ChannelInfo
+	return infos, c.get(channelsPath, nil, &infos)
+}
+
+// Send sends the message to the channel.
+func (c *Client) Send(channelID *id.ID, message string) error {
+	return c.post(sendPath, SendRequest{channelID, message}, nil)
+}
+
+// SendAdmin sends the message to the channel as an admin.
+func (c *Client) SendAdmin(channelID *id.ID, message string) error {
+	return c.post(sendAdminPath, SendRequest{channelID, message}, nil)
+}
+
+// History returns the stored messages of the channel.
+func (c *Client) History(channelID *id.ID) ([]Message, error) {
+	var messages []Message
+	return messages, c.get(historyPath, channelQuery(channelID), &messages)
+}
+
+// Subscribe calls the callback for every new message on the channel, or on all
+// channels if the channel ID is nil, until the context is cancelled or the
+// connection is closed.
+func (c *Client) Subscribe(
+	ctx context.Context, channelID *id.ID, cb func(Message)) error {
+	u := c.baseURL + subscribePath
+	if q := channelQuery(channelID); q != nil {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Errorf(errRequest, subscribePath, err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return errors.Errorf(errRequest, subscribePath, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err = checkResponse(subscribePath, resp); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var m Message
+		if err = json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return errors.Errorf(errDecodeResponse, subscribePath, err)
+		}
+		cb(m)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// post sends the body as JSON to the endpoint and decodes the response into
+// out if it is not nil.
+func (c *Client) post(path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Errorf(errRequest, path, err)
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return errors.Errorf(errRequest, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return errors.Errorf(errRequest, path, err)
+	}
+
+	return decodeResponse(path, resp, out)
+}
+
+// get requests the endpoint with the query and decodes the response into out.
+func (c *Client) get(path string, query url.Values, out interface{}) error {
+	u := c.baseURL + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Errorf(errRequest, path, err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return errors.Errorf(errRequest, path, err)
+	}
+
+	return decodeResponse(path, resp, out)
+}
+
+// do sends the request with the daemon's bearer token.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", bearerPrefix+c.token)
+	return c.http.Do(req)
+}
+
+// decodeResponse checks the response status and decodes the body into out if
+// it is not nil.
+func decodeResponse(path string, resp *http.Response, out interface{}) error {
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := checkResponse(path, resp); err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Errorf(errDecodeResponse, path, err)
+		}
+	}
+
+	return nil
+}
+
+// checkResponse returns the error in the response body if the request failed.
+func checkResponse(path string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errResp errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		errResp.Error = resp.Status
+	}
+
+	return errors.Errorf(errResponse, path, resp.StatusCode, errResp.Error)
+}
+
+// channelQuery returns the query that specifies the channel or nil if the ID
+// is nil.
+func channelQuery(channelID *id.ID) url.Values {
+	if channelID == nil {
+		return nil
+	}
+	return url.Values{channelIDQuery: {channelID.String()}}
+}
@@ -0,0 +1,369 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API endpoints.
+const (
+	joinPath      = "/join"
+	leavePath     = "/leave"
+	channelsPath  = "/channels"
+	sendPath      = "/send"
+	sendAdminPath = "/send-admin"
+	historyPath   = "/history"
+	subscribePath = "/subscribe"
+
+	// channelIDQuery is the query parameter used to specify the channel ID on
+	// GET requests.
+	channelIDQuery = "channelID"
+)
+
+// unixPrefix may be prepended to an address to explicitly mark it as a Unix
+// socket path.
+const unixPrefix = "unix:"
+
+// unixHost is the host of requests sent over a Unix socket.
+const unixHost = "unix"
+
+// bearerPrefix precedes the token in the Authorization header.
+const bearerPrefix = "Bearer "
+
+// Error messages.
+const (
+	errNonLoopback   = "address %q is not a loopback address"
+	errListen        = "failed to listen on %q: %+v"
+	errRemoveSocket  = "failed to remove stale socket %q: %+v"
+	errDecodeRequest = "failed to decode request: %+v"
+	errDecodeID      = "invalid channel ID %q: %+v"
+	errMissingID     = "channel ID required"
+	errUnauthorized  = "missing or invalid bearer token"
+	errHost          = "host %q is not a loopback host"
+	errContentType   = "content type %q is not application/json"
+)
+
+// Listen opens the listener for the address. Addresses that start with
+// "unix:" or do not contain a port are treated as Unix socket paths and all
+// others as TCP addresses, which must be on the loopback interface.
+func Listen(address string) (net.Listener, error) {
+	network, addr := parseAddress(address)
+
+	if network == "unix" {
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Errorf(errRemoveSocket, addr, err)
+		}
+	} else if !isLoopback(addr) {
+		return nil, errors.Errorf(errNonLoopback, addr)
+	}
+
+	// Only allow the current user to connect to the socket
+	var l net.Listener
+	var err error
+	if network == "unix" {
+		l, err = listenUnix(addr)
+	} else {
+		l, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return nil, errors.Errorf(errListen, address, err)
+	}
+
+	return l, nil
+}
+
+// Handler returns the HTTP handler that serves the API of the server. Requests
+// must have the bearer token and a loopback host, so that web pages in a
+// browser cannot call the API, and POST requests must have a JSON body.
+func (s *Server) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(joinPath, post(s.handleJoin))
+	mux.HandleFunc(leavePath, post(s.handleLeave))
+	mux.HandleFunc(channelsPath, s.handleChannels)
+	mux.HandleFunc(sendPath, post(s.handleSend))
+	mux.HandleFunc(sendAdminPath, post(s.handleSendAdmin))
+	mux.HandleFunc(historyPath, s.handleHistory)
+	mux.HandleFunc(subscribePath, s.handleSubscribe)
+	return authorize(token, mux)
+}
+
+// handleJoin joins the channel in the JoinRequest.
+func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
+	var req JoinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf(errDecodeRequest, err))
+		return
+	}
+
+	info, err := s.Join(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, info)
+}
+
+// handleLeave leaves the channel in the ChannelRequest.
+func (s *Server) handleLeave(w http.ResponseWriter, r *http.Request) {
+	var req ChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf(errDecodeRequest, err))
+		return
+	} else if req.ChannelID == nil {
+		writeError(w, http.StatusBadRequest, errors.New(errMissingID))
+		return
+	}
+
+	if err := s.Leave(req.ChannelID); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	writeJSON(w, struct{}{})
+}
+
+// handleChannels returns the list of joined channels.
+func (s *Server) handleChannels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.Channels())
+}
+
+// handleSend sends the message in the SendRequest.
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	s.handleSendFn(w, r, s.Send)
+}
+
+// handleSendAdmin sends the message in the SendRequest as an admin.
+func (s *Server) handleSendAdmin(w http.ResponseWriter, r *http.Request) {
+	s.handleSendFn(w, r, s.SendAdmin)
+}
+
+// handleSendFn decodes the SendRequest and sends it with the send function.
+func (s *Server) handleSendFn(w http.ResponseWriter, r *http.Request,
+	send func(channelID *id.ID, message string) error) {
+	var req SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Errorf(errDecodeRequest, err))
+		return
+	} else if req.ChannelID == nil {
+		writeError(w, http.StatusBadRequest, errors.New(errMissingID))
+		return
+	}
+
+	if err := send(req.ChannelID, req.Message); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	writeJSON(w, struct{}{})
+}
+
+// handleHistory returns the stored messages of the channel in the query.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	channelID, err := queryChannelID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if channelID == nil {
+		writeError(w, http.StatusBadRequest, errors.New(errMissingID))
+		return
+	}
+
+	messages, err := s.History(channelID)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	writeJSON(w, messages)
+}
+
+// handleSubscribe streams every new message on the channel in the query, or on
+// all channels if none is specified, as JSON Lines until the client
+// disconnects.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	channelID, err := queryChannelID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	messages, unsubscribe, err := s.Subscribe(channelID)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case m := <-messages:
+			if err = enc.Encode(m); err != nil {
+				jww.DEBUG.Printf("Ending subscription: %+v", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// authorize wraps the handler so that it only accepts requests with the bearer
+// token and a loopback host. The host is checked so that a web page cannot
+// reach the API through DNS rebinding.
+func authorize(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, errors.Errorf(errHost, r.Host))
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		given := []byte(strings.TrimPrefix(auth, bearerPrefix))
+		if !strings.HasPrefix(auth, bearerPrefix) ||
+			subtle.ConstantTimeCompare(given, []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New(errUnauthorized))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// post wraps the handler so that it only accepts POST requests with a JSON
+// body. Browsers can send other content types across sites without a
+// preflight request.
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed,
+				errors.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil ||
+			mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType,
+				errors.Errorf(errContentType, contentType))
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// queryChannelID returns the channel ID in the request query or nil if none is
+// set.
+func queryChannelID(r *http.Request) (*id.ID, error) {
+	idStr := r.URL.Query().Get(channelIDQuery)
+	if idStr == "" {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(idStr)
+	if err != nil {
+		return nil, errors.Errorf(errDecodeID, idStr, err)
+	}
+
+	channelID, err := id.Unmarshal(data)
+	if err != nil {
+		return nil, errors.Errorf(errDecodeID, idStr, err)
+	}
+
+	return channelID, nil
+}
+
+// statusFor returns the HTTP status code for the server error.
+func statusFor(err error) int {
+	switch err {
+	case errChannelNotJoined:
+		return http.StatusNotFound
+	case errNoPrivateKey:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON writes the object as the JSON response body.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		jww.ERROR.Printf("Failed to write response: %+v", err)
+	}
+}
+
+// writeError writes the error as a JSON response with the status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	jww.DEBUG.Printf("Request failed with status %d: %+v", status, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(errorResponse{err.Error()}); err != nil {
+		jww.ERROR.Printf("Failed to write error response: %+v", err)
+	}
+}
+
+// parseAddress returns the network and address for the daemon address.
+func parseAddress(address string) (network, addr string) {
+	if strings.HasPrefix(address, unixPrefix) {
+		return "unix", strings.TrimPrefix(address, unixPrefix)
+	} else if _, _, err := net.SplitHostPort(address); err != nil {
+		return "unix", address
+	}
+	return "tcp", address
+}
+
+// isLoopback determines if the TCP address is on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackHost determines if the Host header of a request names the Unix
+// socket or a loopback address.
+func isLoopbackHost(host string) bool {
+	if host == unixHost {
+		return true
+	} else if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "0")
+	}
+	return isLoopback(host)
+}
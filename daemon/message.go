@@ -0,0 +1,264 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package daemon
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// Message is the JSON representation of a received broadcast message returned
+// by the history and subscribe methods.
+type Message struct {
+	ChannelID    *id.ID    `json:"channelID"`
+	Tag          string    `json:"tag"`
+	Timestamp    time.Time `json:"timestamp"`
+	ReceivedTime time.Time `json:"receivedTime"`
+	Username     string    `json:"username"`
+	Message      string    `json:"message"`
+	RoundID      uint64    `json:"roundID"`
+	EphemeralID  int64     `json:"ephemeralID"`
+
+	// MessageID is the ID assigned to the message by the sender, if it has
+	// one.
+	MessageID string `json:"messageID,omitempty"`
+
+	// ReplyTo is the ID of the message that this message replies to, if it is
+	// a reply, the ID of the message a reaction reacts to, or the ID of the
+	// message that is pinned or unpinned.
+	ReplyTo string `json:"replyTo,omitempty"`
+
+	// EditOf is the ID of the message that an edit or delete message
+	// modifies.
+	EditOf string `json:"editOf,omitempty"`
+
+	// ContentType is the MIME type of the message, if the sender included
+	// one.
+	ContentType string `json:"contentType,omitempty"`
+
+	// Attachment is the file contained in messages with the file tag. It is
+	// nil for all other messages.
+	Attachment *Attachment `json:"attachment,omitempty"`
+
+	// Moderation is the command contained in messages with the moderate tag.
+	// It is nil for all other messages.
+	Moderation *Moderation `json:"moderation,omitempty"`
+
+	// Pin is the message contained in messages with the pin tag. It is nil
+	// for all other messages.
+	Pin *Pin `json:"pin,omitempty"`
+
+	// Grant is the role grant contained in messages with the grant tag or the
+	// identity key whose roles are revoked by messages with the revoke tag. It
+	// is nil for all other messages.
+	Grant *Grant `json:"grant,omitempty"`
+
+	// Handover is the handover of the channel's RSA key contained in messages
+	// with the handover tag. It is nil for all other messages.
+	Handover *Handover `json:"handover,omitempty"`
+
+	// Verification is whether the sender signed the message with the identity
+	// key bound to their username: "verified", "unverified", or
+	// "impersonation".
+	Verification string `json:"verification"`
+
+	// SigningKey is the identity key the message is signed with, if it is
+	// signed. It can be used to mute or ban the sender by key.
+	SigningKey []byte `json:"signingKey,omitempty"`
+
+	// Role is the role the channel admin granted the sender, such as
+	// "moderator", if they have one.
+	Role string `json:"role,omitempty"`
+}
+
+// Moderation is the JSON representation of an admin command that changes the
+// mute or ban list of a channel.
+type Moderation struct {
+	// Action is "mute", "unmute", "ban", or "unban".
+	Action string `json:"action"`
+
+	// IssuedAt is when the command was made.
+	IssuedAt time.Time `json:"issuedAt"`
+
+	// Username or Key identify the user the command applies to.
+	Username string `json:"username,omitempty"`
+	Key      []byte `json:"key,omitempty"`
+}
+
+// Pin is the JSON representation of a message pinned by the channel admin.
+type Pin struct {
+	MessageID string    `json:"messageID"`
+	Username  string    `json:"username"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// Grant is the JSON representation of a role granted by the channel admin.
+// For revocations, only the key is set.
+type Grant struct {
+	Role     string     `json:"role,omitempty"`
+	Key      []byte     `json:"key"`
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// Handover is the JSON representation of the channel admin handing the channel
+// over to a successor RSA key.
+type Handover struct {
+	// Fingerprint is the fingerprint of the successor key.
+	Fingerprint string `json:"fingerprint"`
+
+	// Key is the PEM of the successor key.
+	Key string `json:"key"`
+
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// Attachment is the JSON representation of a file shared in a channel.
+type Attachment struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 []byte `json:"sha256"`
+	Data   []byte `json:"data"`
+}
+
+// NewMessage converts the received broadcast on the channel to a Message.
+func NewMessage(channelID *id.ID, r client.ReceivedBroadcast) Message {
+	m := Message{
+		ChannelID:    channelID,
+		Tag:          r.Tag.String(),
+		Timestamp:    r.Timestamp,
+		ReceivedTime: r.ReceivedTime,
+		Username:     r.Username,
+		Message:      string(r.Message),
+		RoundID:      uint64(r.RoundID),
+		EphemeralID:  r.EphID.Int64(),
+		Verification: r.Verification.String(),
+	}
+	if mid, exists := r.Extensions.MessageID(); exists {
+		m.MessageID = mid.String()
+	}
+	if replyTo, exists := r.Extensions.ReplyTo(); exists {
+		m.ReplyTo = replyTo.String()
+	}
+	if editOf, exists := r.Extensions.EditOf(); exists {
+		m.EditOf = editOf.String()
+	}
+	m.ContentType, _ = r.Extensions.ContentType()
+	m.SigningKey, _ = r.Extensions.Get(client.SigningKeyExt)
+	if r.Role != client.NoRole {
+		m.Role = r.Role.String()
+	}
+
+	// Files, moderation commands, pinned messages, roles, and handovers are
+	// returned separately instead of as the message text
+	switch r.Tag {
+	case client.File:
+		m.Message = ""
+		if a, err := client.UnmarshalAttachment(r.Message); err == nil {
+			m.Attachment = &Attachment{
+				Name:   a.Name,
+				Size:   len(a.Data),
+				SHA256: a.Hash[:],
+				Data:   a.Data,
+			}
+		}
+	case client.Moderate:
+		m.Message = ""
+		if mc, err := client.UnmarshalModerationCommand(r.Message); err == nil {
+			m.Moderation = &Moderation{
+				Action:   mc.Action.String(),
+				IssuedAt: mc.IssuedAt,
+				Username: mc.Username,
+				Key:      mc.Key,
+			}
+		}
+	case client.Pin:
+		m.Message = ""
+		if p, err := client.UnmarshalPinnedMessage(r); err == nil {
+			m.Pin = &Pin{
+				MessageID: p.MessageID.String(),
+				Username:  p.Username,
+				Timestamp: p.Timestamp,
+				Message:   p.Text,
+			}
+		}
+	case client.Grant:
+		m.Message = ""
+		if g, err := client.UnmarshalRoleGrant(r.Message); err == nil {
+			m.Grant = &Grant{
+				Role:     g.Role.String(),
+				Key:      g.Key,
+				IssuedAt: &g.IssuedAt,
+			}
+			if !g.Expires.IsZero() {
+				m.Grant.Expires = &g.Expires
+			}
+		}
+	case client.Revoke:
+		m.Message = ""
+		if key, err := client.UnmarshalRevocation(r.Message); err == nil {
+			m.Grant = &Grant{Key: key}
+		}
+	case client.Handover:
+		m.Message = ""
+		if h, err := client.UnmarshalKeyHandover(r.Message); err == nil {
+			m.Handover = &Handover{
+				Fingerprint: client.RsaFingerprint(h.Successor),
+				Key:         string(rsa.CreatePublicKeyPem(h.Successor)),
+				IssuedAt:    h.IssuedAt,
+			}
+		}
+	}
+
+	return m
+}
+
+// JoinRequest is the body of a join request.
+type JoinRequest struct {
+	// Channel is the contents of the channel (.xxchan) file or an invite
+	// link.
+	Channel string `json:"channel"`
+
+	// Username is the name messages are sent under.
+	Username string `json:"username"`
+
+	// PrivateKey is the optional unencrypted RSA private key PEM of the
+	// channel. It is required to send admin messages.
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+// ChannelInfo describes a channel joined by the daemon.
+type ChannelInfo struct {
+	ChannelID           *id.ID `json:"channelID"`
+	Name                string `json:"name"`
+	Description         string `json:"description"`
+	Username            string `json:"username"`
+	Admin               bool   `json:"admin"`
+	MaxPayloadSize      int    `json:"maxPayloadSize"`
+	MaxAdminPayloadSize int    `json:"maxAdminPayloadSize"`
+	MalformedMessages   uint64 `json:"malformedMessages"`
+}
+
+// ChannelRequest is the body of requests that only reference a channel.
+type ChannelRequest struct {
+	ChannelID *id.ID `json:"channelID"`
+}
+
+// SendRequest is the body of a send or send-admin request.
+type SendRequest struct {
+	ChannelID *id.ID `json:"channelID"`
+	Message   string `json:"message"`
+}
+
+// errorResponse is the body returned when a request fails.
+type errorResponse struct {
+	Error string `json:"error"`
+}
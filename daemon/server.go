@@ -0,0 +1,331 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package daemon contains a long-running server that keeps a single cMix
+// client connected, joins any number of broadcast channels, and exposes them
+// over a local HTTP API, along with the client used to talk to it.
+package daemon
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/client/broadcast"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+	"sync"
+)
+
+// subscriberBufferSize is the number of messages buffered for each subscriber.
+// Messages are dropped for subscribers that fall further behind.
+const subscriberBufferSize = 100
+
+// Error messages.
+const (
+	// Server.Join
+	errUnmarshalChannel = "failed to unmarshal channel: %+v"
+	errMergeHandovers   = "failed to save handovers of channel: %+v"
+	errLoadPrivateKey   = "failed to load RSA private key: %+v"
+	errEncryptedKey     = "RSA private key is encrypted; the daemon only " +
+		"accepts unencrypted keys"
+	errUsername = "channel %q is already joined as %q; leave it to " +
+		"join as %q"
+	errKeyMismatch = "RSA private key does not match the current key %s of " +
+		"channel %q"
+)
+
+var (
+	// errChannelNotJoined is returned when a request references a channel
+	// that has not been joined.
+	errChannelNotJoined = errors.New("channel has not been joined")
+
+	// errNoPrivateKey is returned when sending an admin message on a channel
+	// joined without the private key.
+	errNoPrivateKey = errors.New("channel was joined without a private key")
+)
+
+// Server manages the channels joined by the daemon. All channels share the
+// same cMix client and stores.
+type Server struct {
+	net    broadcast.Client
+	rng    *fastRNG.StreamGenerator
+	stores client.ChannelStores
+
+	channels    map[id.ID]*joinedChannel
+	subscribers map[uint64]*subscriber
+	nextSubID   uint64
+	mux         sync.RWMutex
+}
+
+// joinedChannel is a channel joined by the server.
+type joinedChannel struct {
+	jc   *client.JoinedChannel
+	quit chan struct{}
+}
+
+// subscriber receives messages from one or all channels.
+type subscriber struct {
+	channelID *id.ID
+	c         chan Message
+}
+
+// NewServer returns a new Server that joins channels using the given network
+// client and stores. The history and handovers are required, since the history
+// is served to clients and the handovers of every joined channel are saved.
+func NewServer(net broadcast.Client, rng *fastRNG.StreamGenerator,
+	stores client.ChannelStores) *Server {
+	return &Server{
+		net:         net,
+		rng:         rng,
+		stores:      stores,
+		channels:    make(map[id.ID]*joinedChannel),
+		subscribers: make(map[uint64]*subscriber),
+	}
+}
+
+// Join joins the channel. If the channel has already been joined, then the
+// existing channel is returned. Returns an error if it was joined under a
+// different username. If the existing channel was joined without the private
+// key and the request has the channel's current key, then the channel is
+// joined again with it so that admin messages can be sent.
+func (s *Server) Join(req JoinRequest) (ChannelInfo, error) {
+	channel, chain, err := client.UnmarshalChannelFile([]byte(req.Channel))
+	if err != nil {
+		return ChannelInfo{}, errors.Errorf(errUnmarshalChannel, err)
+	}
+	if _, err = s.stores.Handovers.Merge(channel, chain); err != nil {
+		return ChannelInfo{}, errors.Errorf(errMergeHandovers, err)
+	}
+
+	var pk *rsa.PrivateKey
+	if client.IsEncryptedRsaPrivateKey([]byte(req.PrivateKey)) {
+		return ChannelInfo{}, errors.New(errEncryptedKey)
+	} else if req.PrivateKey != "" {
+		pk, err = rsa.LoadPrivateKeyFromPem([]byte(req.PrivateKey))
+		if err != nil {
+			return ChannelInfo{}, errors.Errorf(errLoadPrivateKey, err)
+		}
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if c, exists := s.channels[*channel.ReceptionID]; exists {
+		if req.Username != c.jc.Username {
+			return ChannelInfo{}, errors.Errorf(
+				errUsername, channel.Name, c.jc.Username, req.Username)
+		} else if pk == nil || c.jc.AsymBroadcastFn != nil {
+			return channelInfo(c.jc), nil
+		}
+
+		key := s.stores.Handovers.Key(channel)
+		if !client.EqualRsaPublicKeys(pk.GetPublic(), key) {
+			return ChannelInfo{}, errors.Errorf(errKeyMismatch,
+				client.RsaFingerprint(key), channel.Name)
+		}
+
+		// The sending functions of a joined channel cannot be replaced while
+		// it is in use, so it is left and joined again with the key
+		s.leave(channel.ReceptionID)
+	}
+
+	jc, err := client.JoinChannel(
+		channel, req.Username, pk, s.net, s.rng, s.stores)
+	if err != nil {
+		return ChannelInfo{}, err
+	}
+
+	c := &joinedChannel{jc: jc, quit: make(chan struct{})}
+	s.channels[*channel.ReceptionID] = c
+	go s.forward(c)
+
+	return channelInfo(jc), nil
+}
+
+// Leave leaves the channel so that no more messages are received from it.
+func (s *Server) Leave(channelID *id.ID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.leave(channelID)
+}
+
+// leave leaves the channel. Must be called while the lock is held.
+func (s *Server) leave(channelID *id.ID) error {
+	c, exists := s.channels[*channelID]
+	if !exists {
+		return errChannelNotJoined
+	}
+
+	close(c.quit)
+	c.jc.Leave()
+	delete(s.channels, *channelID)
+
+	return nil
+}
+
+// LeaveAll leaves every joined channel.
+func (s *Server) LeaveAll() {
+	for _, info := range s.Channels() {
+		if err := s.Leave(info.ChannelID); err != nil {
+			jww.WARN.Printf("Failed to leave channel %s: %+v",
+				info.ChannelID, err)
+		}
+	}
+}
+
+// Channels returns the information of every joined channel.
+func (s *Server) Channels() []ChannelInfo {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	infos := make([]ChannelInfo, 0, len(s.channels))
+	for _, c := range s.channels {
+		infos = append(infos, channelInfo(c.jc))
+	}
+
+	return infos
+}
+
+// Send sends the message to the channel as a normal symmetric message.
+func (s *Server) Send(channelID *id.ID, message string) error {
+	jc, err := s.getChannel(channelID)
+	if err != nil {
+		return err
+	}
+
+	return jc.SymBroadcastFn(client.Default, netTime.Now(), []byte(message))
+}
+
+// SendAdmin sends the message to the channel as an asymmetric admin message.
+func (s *Server) SendAdmin(channelID *id.ID, message string) error {
+	jc, err := s.getChannel(channelID)
+	if err != nil {
+		return err
+	}
+
+	if jc.AsymBroadcastFn == nil {
+		return errNoPrivateKey
+	}
+
+	return jc.AsymBroadcastFn(client.Admin, netTime.Now(), []byte(message))
+}
+
+// History returns all the stored messages of the channel, except those from
+// muted users, with edits and deletes applied.
+func (s *Server) History(channelID *id.ID) ([]Message, error) {
+	jc, err := s.getChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.stores.History.Load(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries = client.ApplyChanges(entries)
+	messages := make([]Message, 0, len(entries))
+	for _, r := range entries {
+		if !jc.IsMuted(r) {
+			messages = append(messages, NewMessage(channelID, r))
+		}
+	}
+
+	return messages, nil
+}
+
+// Subscribe returns a channel that receives all new messages on the given
+// channel, or on all channels if the channel ID is nil, and a function that
+// ends the subscription.
+func (s *Server) Subscribe(channelID *id.ID) (<-chan Message, func(), error) {
+	if channelID != nil {
+		if _, err := s.getChannel(channelID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	subID := s.nextSubID
+	s.nextSubID++
+	sub := &subscriber{
+		channelID: channelID,
+		c:         make(chan Message, subscriberBufferSize),
+	}
+	s.subscribers[subID] = sub
+
+	unsubscribe := func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		delete(s.subscribers, subID)
+	}
+
+	return sub.c, unsubscribe, nil
+}
+
+// forward passes every message received on the channel to the subscribers
+// until the channel is left.
+func (s *Server) forward(c *joinedChannel) {
+	channelID := c.jc.Channel.ReceptionID
+	for {
+		select {
+		case r, ok := <-c.jc.Received:
+			if !ok {
+				return
+			} else if c.jc.IsMuted(r) {
+				continue
+			}
+			m := NewMessage(channelID, r)
+
+			s.mux.RLock()
+			for _, sub := range s.subscribers {
+				if sub.channelID != nil && !sub.channelID.Cmp(channelID) {
+					continue
+				}
+				select {
+				case sub.c <- m:
+				default:
+					jww.WARN.Printf("Dropped message on channel %s for slow "+
+						"subscriber.", channelID)
+				}
+			}
+			s.mux.RUnlock()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// getChannel returns the joined channel with the ID.
+func (s *Server) getChannel(channelID *id.ID) (*client.JoinedChannel, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	c, exists := s.channels[*channelID]
+	if !exists {
+		return nil, errChannelNotJoined
+	}
+
+	return c.jc, nil
+}
+
+// channelInfo returns the ChannelInfo for the joined channel.
+func channelInfo(jc *client.JoinedChannel) ChannelInfo {
+	return ChannelInfo{
+		ChannelID:           jc.Channel.ReceptionID,
+		Name:                jc.Channel.Name,
+		Description:         jc.Channel.Description,
+		Username:            jc.Username,
+		Admin:               jc.AsymBroadcastFn != nil,
+		MaxPayloadSize:      jc.SymMaxPayloadSize,
+		MaxAdminPayloadSize: jc.AsymMaxPayloadSize,
+		MalformedMessages:   jc.MalformedCount(),
+	}
+}
@@ -0,0 +1,127 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package daemon
+
+import (
+	"crypto/rand"
+	"git.xx.network/elixxir/cli-client/client"
+	"gitlab.com/elixxir/client/cmix"
+	"gitlab.com/elixxir/client/cmix/message"
+	crypto "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/elixxir/ekv"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/id/ephemeral"
+	"testing"
+	"time"
+)
+
+// Tests that Server.Join returns the existing channel when it is joined again
+// under the same username, rejects a different username or a key that is not
+// the channel's, and joins the channel again with a matching private key.
+func TestServer_Join_Rejoin(t *testing.T) {
+	s := NewServer(&mockNet{},
+		fastRNG.NewStreamGenerator(1, 1, csprng.NewSystemRNG),
+		client.ChannelStores{
+			History:   client.NewHistory(ekv.MakeMemstore()),
+			Handovers: client.NewHandovers(ekv.MakeMemstore()),
+		})
+	channel, pk := newTestChannel(t)
+	data, err := client.MarshalChannelFile(channel, nil)
+	if err != nil {
+		t.Fatalf("Failed to marshal channel: %+v", err)
+	}
+	req := JoinRequest{Channel: string(data), Username: "alice"}
+
+	info, err := s.Join(req)
+	if err != nil {
+		t.Fatalf("Failed to join channel: %+v", err)
+	} else if info.Admin {
+		t.Errorf("Channel joined as admin without private key.")
+	}
+
+	if _, err = s.Join(JoinRequest{req.Channel, "bob", ""}); err == nil {
+		t.Errorf("Joined channel again under a different username.")
+	}
+
+	other := newTestRsaKey(t)
+	_, err = s.Join(JoinRequest{
+		req.Channel, "alice", string(rsa.CreatePrivateKeyPem(other))})
+	if err == nil {
+		t.Errorf("Joined channel again with a key that is not its own.")
+	}
+
+	for i, key := range []string{string(rsa.CreatePrivateKeyPem(pk)), ""} {
+		info, err = s.Join(JoinRequest{req.Channel, "alice", key})
+		if err != nil {
+			t.Fatalf("Failed to join channel again (%d): %+v", i, err)
+		} else if !info.Admin || info.Username != "alice" {
+			t.Errorf("Unexpected channel info (%d): %+v", i, info)
+		}
+	}
+
+	if channels := s.Channels(); len(channels) != 1 {
+		t.Errorf("Expected 1 joined channel, found %d.", len(channels))
+	}
+	s.LeaveAll()
+}
+
+// newTestChannel returns a new channel and its RSA private key.
+func newTestChannel(t *testing.T) (*crypto.Channel, *rsa.PrivateKey) {
+	pk := newTestRsaKey(t)
+	salt := []byte("salt")
+	channelID, err := crypto.NewChannelID("name", "description", salt,
+		rsa.CreatePublicKeyPem(pk.GetPublic()))
+	if err != nil {
+		t.Fatalf("Failed to make channel ID: %+v", err)
+	}
+
+	return &crypto.Channel{
+		ReceptionID: channelID,
+		Name:        "name",
+		Description: "description",
+		Salt:        salt,
+		RsaPubKey:   pk.GetPublic(),
+	}, pk
+}
+
+// newTestRsaKey returns a new 1024-bit RSA private key.
+func newTestRsaKey(t *testing.T) *rsa.PrivateKey {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	return pk
+}
+
+// mockNet is a broadcast.Client that drops every sent message.
+type mockNet struct{}
+
+func (m *mockNet) GetMaxMessageLength() int {
+	return format.NewMessage(1024).ContentsSize()
+}
+
+func (m *mockNet) Send(*id.ID, format.Fingerprint, message.Service, []byte,
+	[]byte, cmix.CMIXParams) (id.Round, ephemeral.Id, error) {
+	return 0, ephemeral.Id{}, nil
+}
+
+func (m *mockNet) IsHealthy() bool {
+	return true
+}
+
+func (m *mockNet) AddIdentity(*id.ID, time.Time, bool) {}
+
+func (m *mockNet) AddService(*id.ID, message.Service, message.Processor) {}
+
+func (m *mockNet) DeleteClientService(*id.ID) {}
+
+func (m *mockNet) RemoveIdentity(*id.ID) {}
@@ -0,0 +1,116 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tokenSize is the size, in bytes, of the random bearer token.
+const tokenSize = 32
+
+// tokenSuffix is appended to the Unix socket path to get the path of its
+// token file.
+const tokenSuffix = ".token"
+
+// tokenDir is the directory inside the user's cache directory where the token
+// files of daemons listening on TCP addresses are stored.
+const tokenDir = "cli-client"
+
+// tokenFilePerms are the permissions of the token file, which is only readable
+// and writable by its owner.
+const tokenFilePerms = 0600
+
+// Error messages.
+const (
+	errGenerateToken = "failed to generate daemon token: %+v"
+	errTokenPath     = "failed to get path of daemon token file: %+v"
+	errWriteToken    = "failed to write daemon token file %q: %+v"
+	errReadToken     = "failed to read daemon token file %q; is the daemon " +
+		"running? %+v"
+)
+
+// WriteToken generates a new bearer token for the daemon at the address and
+// writes it to the token file of the address, replacing any existing file. The
+// file is only readable by the current user, so only they can call the API.
+// Returns the token.
+func WriteToken(address string) (string, error) {
+	path, err := TokenPath(address)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, tokenSize)
+	if _, err = rand.Read(b); err != nil {
+		return "", errors.Errorf(errGenerateToken, err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	// Remove the old file so that it is recreated with the permissions below
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", errors.Errorf(errWriteToken, path, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", errors.Errorf(errWriteToken, path, err)
+	}
+
+	f, err := os.OpenFile(
+		path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, tokenFilePerms)
+	if err != nil {
+		return "", errors.Errorf(errWriteToken, path, err)
+	}
+	if _, err = f.WriteString(token); err != nil {
+		_ = f.Close()
+		return "", errors.Errorf(errWriteToken, path, err)
+	}
+	if err = f.Close(); err != nil {
+		return "", errors.Errorf(errWriteToken, path, err)
+	}
+
+	return token, nil
+}
+
+// ReadToken reads the bearer token of the daemon at the address from its
+// token file.
+func ReadToken(address string) (string, error) {
+	path, err := TokenPath(address)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Errorf(errReadToken, path, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// TokenPath returns the path of the token file of the daemon at the address.
+// The token of a Unix socket is stored next to the socket and the token of a
+// TCP address in the user's cache directory.
+func TokenPath(address string) (string, error) {
+	network, addr := parseAddress(address)
+	if network == "unix" {
+		return addr + tokenSuffix, nil
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Errorf(errTokenPath, err)
+	}
+
+	name := "daemon-" + strings.NewReplacer(":", "_", "[", "", "]", "").
+		Replace(addr) + tokenSuffix
+	return filepath.Join(cacheDir, tokenDir, name), nil
+}
@@ -0,0 +1,34 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMux serialises changes to the process umask, which is shared by every
+// goroutine.
+var umaskMux sync.Mutex
+
+// listenUnix listens on the Unix socket with a umask that only allows the
+// current user to connect, so that the socket is never created with broader
+// permissions.
+func listenUnix(addr string) (net.Listener, error) {
+	umaskMux.Lock()
+	defer umaskMux.Unlock()
+
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", addr)
+}
@@ -0,0 +1,21 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build windows
+// +build windows
+
+package daemon
+
+import (
+	"net"
+)
+
+// listenUnix listens on the Unix socket. Windows has no umask, so access to
+// the socket is only restricted by the bearer token.
+func listenUnix(addr string) (net.Listener, error) {
+	return net.Listen("unix", addr)
+}
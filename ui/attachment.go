@@ -0,0 +1,176 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"fmt"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/netTime"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Commands that can be entered into the message input.
+const (
+	uploadCmd = "/upload"
+	saveCmd   = "/save"
+)
+
+// runCommand runs the command in the message input on the channel. Returns
+// false if the input is not a command and should be sent as a message.
+func (m *Manager) runCommand(c *channelState, input string) (bool, error) {
+	fields := strings.SplitN(input, " ", 3)
+	switch fields[0] {
+	case uploadCmd:
+		path := strings.TrimSpace(strings.TrimPrefix(input, uploadCmd))
+		if path == "" {
+			return true, m.printNotice("Usage: %s <path>", uploadCmd)
+		}
+		return true, m.upload(c, path)
+	case saveCmd:
+		if len(fields) < 2 {
+			return true, m.printNotice("Usage: %s <number> [path]", saveCmd)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 {
+			return true, m.printNotice("Invalid attachment number %q.", fields[1])
+		}
+		var path string
+		if len(fields) == 3 {
+			path = strings.TrimSpace(fields[2])
+		}
+		return true, m.save(c, n, path)
+	case muteCmd, unmuteCmd, banCmd, unbanCmd:
+		username := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		return true, m.moderate(c, moderationCmds[fields[0]], username)
+	case modCmd:
+		return true, m.printModeration(c)
+	case grantCmd:
+		if len(fields) < 2 {
+			return true, m.printNotice("Usage: %s <username> [duration]",
+				grantCmd)
+		}
+		var duration string
+		if len(fields) == 3 {
+			duration = strings.TrimSpace(fields[2])
+		}
+		return true, m.grant(c, fields[1], duration)
+	case revokeCmd:
+		username := strings.TrimSpace(strings.TrimPrefix(input, revokeCmd))
+		return true, m.revoke(c, username)
+	case moderatorsCmd:
+		return true, m.printModerators(c)
+	case topicCmd:
+		topic := strings.TrimSpace(strings.TrimPrefix(input, topicCmd))
+		return true, m.setTopic(c, topic)
+	case unpinCmd:
+		if len(fields) < 2 {
+			return true, m.printNotice("Usage: %s <number>", unpinCmd)
+		}
+		return true, m.unpin(c, fields[1])
+	default:
+		return false, nil
+	}
+}
+
+// upload reads the file at the path and sends it to the channel. The file is
+// sent in the background so that the UI does not block while its fragments are
+// sent.
+func (m *Manager) upload(c *channelState, path string) error {
+	a, err := client.ReadAttachment(path, c.SymMaxPayloadSize)
+	if err != nil {
+		return m.printNotice("Cannot upload file: %v", err)
+	}
+
+	if err = m.printNotice("Uploading %q (%s)...",
+		a.Name, formatSize(len(a.Data))); err != nil {
+		return err
+	}
+
+	var extensions []client.Extension
+	if contentType := mime.TypeByExtension(filepath.Ext(a.Name)); contentType != "" {
+		extensions = append(extensions, client.NewContentTypeExtension(contentType))
+	}
+
+	go func() {
+		err := c.SymBroadcastFn(
+			client.File, netTime.Now(), a.Marshal(), extensions...)
+		m.g.UpdateAsync(func(g *gocui.Gui) error {
+			if err != nil {
+				jww.ERROR.Printf("Failed to upload file %q: %+v", path, err)
+				return m.printNotice("Failed to upload %q: %v", a.Name, err)
+			}
+			return nil
+		})
+	}()
+
+	return nil
+}
+
+// save saves the attachment with the given number in the channel to the path.
+// If n is 0, then the most recent attachment is saved.
+func (m *Manager) save(c *channelState, n int, path string) error {
+	r, exists := c.getAttachment(n)
+	if !exists {
+		if n == 0 {
+			return m.printNotice("No attachments in this channel.")
+		}
+		return m.printNotice("No attachment #%d in this channel.", n)
+	}
+
+	if len(r.Message) == 0 {
+		return m.printNotice("Attachment was deleted.")
+	}
+
+	a, err := client.UnmarshalAttachment(r.Message)
+	if err != nil {
+		return m.printNotice("Cannot save attachment: %v", err)
+	}
+
+	path, err = a.Save(path)
+	if err != nil {
+		return m.printNotice("Cannot save attachment: %v", err)
+	}
+
+	return m.printNotice("Saved %q to %q.", a.Name, path)
+}
+
+// saveLatest saves the most recent attachment in the channel being displayed
+// under its own name in the current directory.
+func (m *Manager) saveLatest(*gocui.Gui, *gocui.View) error {
+	return m.save(m.currentChannel(), 0, "")
+}
+
+// formatAttachment returns the attachment payload formatted for the channel
+// feed.
+func formatAttachment(payload []byte, n int) string {
+	a, err := client.UnmarshalAttachment(payload)
+	if err != nil {
+		return "\x1b[31m[invalid attachment: " + err.Error() + "]\x1b[0m"
+	}
+
+	return fmt.Sprintf("\x1b[38;5;117m[file] %s (%s)\x1b[0m "+
+		"\x1b[38;5;242m#%d — %s %d [path]\x1b[0m",
+		stripControl(a.Name), formatSize(len(a.Data)), n, saveCmd, n)
+}
+
+// formatSize returns the size in bytes in a human-readable format.
+func formatSize(size int) string {
+	switch {
+	case size < 1<<10:
+		return strconv.Itoa(size) + " B"
+	case size < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	}
+}
@@ -0,0 +1,247 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	"github.com/mattn/go-runewidth"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commands that can be entered into the message input by the channel admin to
+// change the topic and pinned messages of the channel.
+const (
+	topicCmd = "/topic"
+	unpinCmd = "/unpin"
+)
+
+// pinSnippetLen is the maximum number of characters of a pinned message shown
+// in the title box.
+const pinSnippetLen = 60
+
+// bulletinDelay is how long after starting the UI the admin first
+// re-broadcasts the topic and pinned messages of each channel.
+const bulletinDelay = 5 * time.Second
+
+// initBulletinKeybindings initializes the key bindings used to pin messages in
+// the channel feed.
+func (m *Manager) initBulletinKeybindings(g *gocui.Gui) error {
+	err := g.SetKeybinding(channelFeed, 'p', gocui.ModNone, m.pinSelected)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for p: %+v", err)
+	}
+
+	return nil
+}
+
+// pinSelected pins the message selected in the channel feed or unpins it if
+// it is already pinned. If no message is selected, then the most recent
+// message is selected first. Only the channel admin can pin messages.
+func (m *Manager) pinSelected(g *gocui.Gui, v *gocui.View) error {
+	c := m.currentChannel()
+	if !c.isAdmin() {
+		return m.printNotice("Only the channel admin can pin messages.")
+	}
+
+	if c.getSelected() < 0 {
+		if err := m.moveSelection(0)(g, v); err != nil {
+			return err
+		}
+	}
+
+	i := c.getSelected()
+	r, exists := c.getMessage(i)
+	if !exists {
+		return nil
+	} else if state := c.getState(i); state == deleted || state == retracted {
+		return m.printNotice("Cannot pin a deleted message.")
+	}
+
+	bulletin, err := c.Bulletin()
+	if err != nil {
+		return m.printNotice("Cannot load pinned messages: %v", err)
+	}
+	mid, _ := r.Extensions.MessageID()
+	for _, p := range bulletin.Pins {
+		if p.MessageID == mid {
+			return m.sendBulletin(c, "unpin the message", func() error {
+				return c.UnpinMessage(mid)
+			})
+		}
+	}
+
+	if _, err = client.NewPinnedMessage(r); err != nil {
+		return m.printNotice("Cannot pin the message: %v", err)
+	}
+	return m.sendBulletin(c, "pin the message", func() error {
+		return c.PinMessage(r)
+	})
+}
+
+// setTopic sends the topic to the channel. An empty topic clears it.
+func (m *Manager) setTopic(c *channelState, topic string) error {
+	if !c.isAdmin() {
+		return m.printNotice("Only the channel admin can set the topic.")
+	} else if err := client.ValidateTopic(topic); err != nil {
+		return m.printNotice("Invalid topic: %v", err)
+	}
+
+	return m.sendBulletin(c, "set the topic", func() error {
+		return c.SetTopic(topic)
+	})
+}
+
+// unpin unpins the pinned message with the number shown in the title box.
+func (m *Manager) unpin(c *channelState, number string) error {
+	if !c.isAdmin() {
+		return m.printNotice("Only the channel admin can unpin messages.")
+	}
+
+	bulletin, err := c.Bulletin()
+	if err != nil {
+		return m.printNotice("Cannot load pinned messages: %v", err)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 || n > len(bulletin.Pins) {
+		return m.printNotice("No pinned message #%s.", number)
+	}
+
+	mid := bulletin.Pins[n-1].MessageID
+	return m.sendBulletin(c, "unpin the message", func() error {
+		return c.UnpinMessage(mid)
+	})
+}
+
+// sendBulletin calls send in the background so that the UI does not block
+// while the admin message is sent. The topic and pinned messages are updated
+// when the message is received.
+func (m *Manager) sendBulletin(
+	c *channelState, description string, send func() error) error {
+	go func() {
+		if err := send(); err != nil {
+			jww.ERROR.Printf("Failed to %s on channel %q: %+v",
+				description, c.Channel.Name, err)
+			m.g.UpdateAsync(func(g *gocui.Gui) error {
+				return m.printNotice("Failed to %s: %v", description, err)
+			})
+		}
+	}()
+
+	return nil
+}
+
+// rebroadcastBulletin re-broadcasts the topic, pinned messages, and role
+// revocations of the channel shortly after the UI starts and then every
+// client.BulletinInterval so that new members receive them. Does nothing if the
+// user is not the channel admin.
+func (m *Manager) rebroadcastBulletin(c *channelState) {
+	if !c.isAdmin() {
+		return
+	}
+
+	time.Sleep(bulletinDelay)
+	ticker := time.NewTicker(client.BulletinInterval)
+	defer ticker.Stop()
+
+	for {
+		rebroadcast(c)
+		<-ticker.C
+	}
+}
+
+// welcome re-broadcasts the topic, pinned messages, and role revocations of the
+// channel when another member joins, at most once every
+// client.BulletinJoinInterval. Does nothing if the user is not the channel
+// admin.
+func (m *Manager) welcome(c *channelState, r client.ReceivedBroadcast) {
+	if !c.isAdmin() || r.Tag != client.Join || r.Username == m.username ||
+		!c.bulletinJoin.Allow(netTime.Now()) {
+		return
+	}
+
+	go rebroadcast(c)
+}
+
+// rebroadcast re-broadcasts the bulletin and role revocations of the channel.
+func rebroadcast(c *channelState) {
+	if err := c.RebroadcastBulletin(); err != nil {
+		jww.ERROR.Printf("Failed to re-broadcast bulletin of channel %q: %+v",
+			c.Channel.Name, err)
+	}
+	if err := c.RebroadcastRevocations(); err != nil {
+		jww.ERROR.Printf("Failed to re-broadcast revocations of channel "+
+			"%q: %+v", c.Channel.Name, err)
+	}
+}
+
+// formatBulletin returns the topic and pinned messages of the channel for the
+// title box. Returns an empty string if there are none.
+func formatBulletin(c *channelState) string {
+	bulletin, err := c.Bulletin()
+	if err != nil {
+		jww.ERROR.Printf("Failed to load bulletin of channel %q: %+v",
+			c.Channel.Name, err)
+		return ""
+	} else if bulletin.IsEmpty() {
+		return ""
+	}
+
+	var b strings.Builder
+	if bulletin.Topic != "" {
+		b.WriteString("\x1b[38;5;252mTopic:\n\x1b[33m" +
+			stripControl(bulletin.Topic) + "\x1b[0m\n\n")
+	}
+	if len(bulletin.Pins) > 0 {
+		b.WriteString("\x1b[38;5;252mPinned:\x1b[0m\n")
+		for i, p := range bulletin.Pins {
+			b.WriteString("\x1b[38;5;248m" + strconv.Itoa(i+1) + ". " +
+				stripControl(p.Username) + ": " +
+				shorten(p.Text, pinSnippetLen) +
+				"\x1b[0m\n")
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// formatBulletinChange returns the description of the Topic, Pin, or Unpin
+// message for the channel feed.
+func formatBulletinChange(r client.ReceivedBroadcast) string {
+	switch r.Tag {
+	case client.Topic:
+		if len(r.Message) == 0 {
+			return "\x1b[31mcleared the topic\x1b[0m"
+		}
+		return "\x1b[31mset the topic: " + stripControl(string(r.Message)) +
+			"\x1b[0m"
+	case client.Pin:
+		p, err := client.UnmarshalPinnedMessage(r)
+		if err != nil {
+			return "\x1b[31mpinned an invalid message\x1b[0m"
+		}
+		return "\x1b[31mpinned a message\x1b[0m\n\x1b[38;5;242m┃ " +
+			stripControl(p.Username) + ": " + shorten(p.Text, snippetLen) +
+			"\x1b[0m"
+	default:
+		return "\x1b[31munpinned a message\x1b[0m"
+	}
+}
+
+// shorten returns the text on a single line of at most n characters.
+func shorten(text string, n int) string {
+	text = strings.Join(strings.Fields(stripControl(text)), " ")
+	return runewidth.Truncate(text, n, "…")
+}
@@ -0,0 +1,500 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	jww "github.com/spf13/jwalterweatherman"
+	"sync"
+	"time"
+)
+
+// channelState contains the feed buffer and UI state of a single joined
+// channel.
+type channelState struct {
+	*client.JoinedChannel
+
+	// messages is the feed buffer of every message received on the channel,
+	// starting with those loaded from the history. Edit, Delete, and Reaction
+	// messages are applied to the message they modify instead of being added.
+	messages []client.ReceivedBroadcast
+
+	// states is the messageState of every modified message in the feed
+	// buffer.
+	states map[int]messageState
+
+	// reactions are the reactions to each message in the feed buffer in the
+	// order they were first received.
+	reactions map[int][]reaction
+
+	// unread is the number of messages received while the channel was not
+	// being displayed.
+	unread int
+
+	// adminMode is true when messages are sent as admin.
+	adminMode bool
+
+	// ids maps the MessageID of every message in the feed buffer to its index.
+	// Message IDs are chosen by the sender, so only the first message received
+	// with an ID is indexed.
+	ids map[client.MessageID]int
+
+	// selected is the index of the message selected in the feed or -1 if no
+	// message is selected.
+	selected int
+
+	// replyTo is the index of the message being replied to or -1 if the next
+	// message is not a reply.
+	replyTo int
+
+	// editOf is the index of the message being edited or -1 if the next
+	// message is not an edit.
+	editOf int
+
+	// reactTo is the index of the message being reacted to or -1 if the next
+	// message is not a reaction.
+	reactTo int
+
+	// presence tracks the users typing in the channel.
+	presence *client.Presence
+
+	// roster tracks the members of the channel.
+	roster *client.Roster
+
+	// filter is the username whose messages the feed is filtered to or empty
+	// if all messages are shown.
+	filter string
+
+	// searching is true when the next input is a search query.
+	searching bool
+
+	// search is the last search run on the feed or nil if no search is
+	// highlighted. hits are the indexes of the messages that match it.
+	search *client.SearchQuery
+	hits   []int
+
+	// typing limits how often typing indicators are sent to the channel.
+	typing *client.Throttle
+
+	// bulletinJoin limits how often the admin re-broadcasts the topic and
+	// pinned messages when members join the channel.
+	bulletinJoin *client.Throttle
+
+	mux sync.RWMutex
+}
+
+// newChannelState returns the state for the channel with its feed buffer
+// initialised with the backlog. Members of its roster expire after the idle
+// period.
+func newChannelState(c Channel, rosterIdle time.Duration) *channelState {
+	cs := &channelState{
+		JoinedChannel: c.JoinedChannel,
+		messages:      make([]client.ReceivedBroadcast, 0, len(c.Backlog)),
+		states:        make(map[int]messageState),
+		reactions:     make(map[int][]reaction),
+		ids:           make(map[client.MessageID]int),
+		selected:      -1,
+		replyTo:       -1,
+		editOf:        -1,
+		reactTo:       -1,
+		presence:      client.NewPresence(),
+		roster:        client.NewRoster(rosterIdle),
+		typing:        client.NewThrottle(client.TypingInterval),
+		bulletinJoin:  client.NewThrottle(client.BulletinJoinInterval),
+	}
+
+	for _, r := range c.Backlog {
+		if isChange(r) {
+			cs.change(r)
+		} else {
+			cs.messages = append(cs.messages, r)
+			cs.indexMessage(len(cs.messages) - 1)
+		}
+	}
+
+	return cs
+}
+
+// addMessage appends the message to the feed buffer. If the channel is not
+// being displayed, then the unread count is incremented. Returns the index of
+// the message in the feed buffer and, if the message is an attachment, its
+// number in the channel.
+func (c *channelState) addMessage(
+	r client.ReceivedBroadcast, displayed bool) (index, attachment int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.messages = append(c.messages, r)
+	index = len(c.messages) - 1
+	c.indexMessage(index)
+	if !displayed {
+		c.unread++
+	}
+
+	if r.Tag != client.File {
+		return index, 0
+	}
+	return index, c.countAttachments()
+}
+
+// indexMessage adds the message at the index to the ID map if it has an ID.
+// A later message with the ID of an earlier one is not indexed so that it
+// cannot take over the replies, reactions, edits, and deletions of the
+// original. Must be called while the lock is held.
+func (c *channelState) indexMessage(i int) {
+	mid, exists := c.messages[i].Extensions.MessageID()
+	if !exists {
+		return
+	} else if first, duplicate := c.ids[mid]; duplicate {
+		jww.WARN.Printf("Not indexing message from %q with the ID %s of an "+
+			"earlier message from %q.", c.messages[i].Username, mid,
+			c.messages[first].Username)
+		return
+	}
+	c.ids[mid] = i
+}
+
+// getMessage returns the message at the index in the feed buffer.
+func (c *channelState) getMessage(i int) (client.ReceivedBroadcast, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if i < 0 || i >= len(c.messages) {
+		return client.ReceivedBroadcast{}, false
+	}
+	return c.messages[i], true
+}
+
+// getParent returns the message that the message replies to. Returns false if
+// the message is not a reply or the parent is not in the feed buffer.
+func (c *channelState) getParent(
+	r client.ReceivedBroadcast) (client.ReceivedBroadcast, bool) {
+	replyTo, exists := r.Extensions.ReplyTo()
+	if !exists {
+		return client.ReceivedBroadcast{}, false
+	}
+
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	i, exists := c.ids[replyTo]
+	if !exists {
+		return client.ReceivedBroadcast{}, false
+	}
+	return c.messages[i], true
+}
+
+// applyChange applies the Edit, Delete, or Reaction message to the message it
+// modifies. Returns false if the change was not applied because the message is
+// not in the feed buffer or the sender is not allowed to modify it.
+func (c *channelState) applyChange(r client.ReceivedBroadcast) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.change(r)
+}
+
+// change applies the Edit, Delete, or Reaction message to the message it
+// modifies. Must be called while the lock is held.
+func (c *channelState) change(r client.ReceivedBroadcast) bool {
+	if r.Tag == client.Reaction {
+		return c.react(r)
+	}
+
+	mid, exists := r.Extensions.EditOf()
+	if !exists {
+		jww.WARN.Printf("Ignoring %s from %q without a message ID.",
+			r.Tag, r.Username)
+		return false
+	}
+
+	i, exists := c.ids[mid]
+	if !exists {
+		jww.WARN.Printf("Ignoring %s of unknown message %s from %q.",
+			r.Tag, mid, r.Username)
+		return false
+	} else if c.states[i] == deleted || c.states[i] == retracted {
+		return false
+	} else if !client.CanModify(c.messages[i], r) {
+		jww.WARN.Printf("Rejected %s of message %s by %q from %q.",
+			r.Tag, mid, c.messages[i].Username, r.Username)
+		return false
+	}
+
+	switch r.Tag {
+	case client.Edit:
+		c.messages[i].Message = r.Message
+		c.states[i] = edited
+	case client.Delete:
+		c.messages[i].Message = nil
+		c.states[i] = deleted
+		if r.Asymmetric && !c.messages[i].Asymmetric {
+			c.states[i] = retracted
+		}
+	}
+
+	return true
+}
+
+// react adds the Reaction message to the reactions of the message it reacts
+// to. Each user is counted once per reaction. Must be called while the lock is
+// held.
+func (c *channelState) react(r client.ReceivedBroadcast) bool {
+	mid, exists := r.Extensions.ReplyTo()
+	if !exists {
+		jww.WARN.Printf("Ignoring %s from %q without a message ID.",
+			r.Tag, r.Username)
+		return false
+	}
+
+	i, exists := c.ids[mid]
+	if !exists {
+		jww.WARN.Printf("Ignoring %s to unknown message %s from %q.",
+			r.Tag, mid, r.Username)
+		return false
+	} else if c.states[i] == deleted || c.states[i] == retracted {
+		return false
+	} else if r.Verification == client.Impersonation {
+		jww.WARN.Printf("Rejected %s to message %s from impersonated %q.",
+			r.Tag, mid, r.Username)
+		return false
+	} else if err := client.ValidateReaction(string(r.Message)); err != nil {
+		jww.WARN.Printf("Ignoring invalid %s to message %s from %q: %+v",
+			r.Tag, mid, r.Username, err)
+		return false
+	}
+
+	text := string(r.Message)
+	for j, existing := range c.reactions[i] {
+		if existing.text != text {
+			continue
+		}
+		for _, username := range existing.usernames {
+			if username == r.Username {
+				return false
+			}
+		}
+		c.reactions[i][j].usernames = append(existing.usernames, r.Username)
+		return true
+	}
+
+	c.reactions[i] = append(c.reactions[i],
+		reaction{text: text, usernames: []string{r.Username}})
+	return true
+}
+
+// getReactions returns a copy of the reactions to the message at the index.
+func (c *channelState) getReactions(i int) []reaction {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	reactions := make([]reaction, len(c.reactions[i]))
+	copy(reactions, c.reactions[i])
+	return reactions
+}
+
+// getState returns the messageState of the message at the index.
+func (c *channelState) getState(i int) messageState {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.states[i]
+}
+
+// getSelected returns the index of the selected message or -1 if no message
+// is selected.
+func (c *channelState) getSelected() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.selected
+}
+
+// setSelected selects the message at the index. Pass -1 to clear the
+// selection.
+func (c *channelState) setSelected(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.selected = i
+}
+
+// getReplyTo returns the index of the message being replied to or -1 if the
+// next message is not a reply.
+func (c *channelState) getReplyTo() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.replyTo
+}
+
+// setReplyTo sets the message at the index as the one being replied to. Pass
+// -1 to cancel the reply.
+func (c *channelState) setReplyTo(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.replyTo = i
+}
+
+// getAttachment returns the attachment with the given number in the channel.
+// The first attachment is number 1. If n is 0, then the most recent attachment
+// is returned.
+func (c *channelState) getAttachment(n int) (client.ReceivedBroadcast, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if n == 0 {
+		n = c.countAttachments()
+	}
+
+	for _, r := range c.messages {
+		if r.Tag == client.File {
+			if n--; n == 0 {
+				return r, true
+			}
+		}
+	}
+
+	return client.ReceivedBroadcast{}, false
+}
+
+// countAttachments returns the number of attachments in the feed buffer. Must
+// be called while the lock is held.
+func (c *channelState) countAttachments() int {
+	var n int
+	for _, r := range c.messages {
+		if r.Tag == client.File {
+			n++
+		}
+	}
+	return n
+}
+
+// getMessages returns a copy of the feed buffer.
+func (c *channelState) getMessages() []client.ReceivedBroadcast {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	messages := make([]client.ReceivedBroadcast, len(c.messages))
+	copy(messages, c.messages)
+	return messages
+}
+
+// markRead resets the unread count.
+func (c *channelState) markRead() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.unread = 0
+}
+
+// getUnread returns the number of unread messages.
+func (c *channelState) getUnread() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.unread
+}
+
+// maxMessageLen returns the maximum length of a message that can be sent in
+// the current mode.
+func (c *channelState) maxMessageLen() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.adminMode {
+		return c.AsymMaxPayloadSize
+	}
+	return c.SymMaxPayloadSize
+}
+
+// getEditOf returns the index of the message being edited or -1 if the next
+// message is not an edit.
+func (c *channelState) getEditOf() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.editOf
+}
+
+// setEditOf sets the message at the index as the one being edited. Pass -1 to
+// cancel the edit.
+func (c *channelState) setEditOf(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.editOf = i
+}
+
+// getReactTo returns the index of the message being reacted to or -1 if the
+// next message is not a reaction.
+func (c *channelState) getReactTo() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.reactTo
+}
+
+// setReactTo sets the message at the index as the one being reacted to. Pass
+// -1 to cancel the reaction.
+func (c *channelState) setReactTo(i int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.reactTo = i
+}
+
+// getFilter returns the username whose messages the feed is filtered to or an
+// empty string if all messages are shown.
+func (c *channelState) getFilter() string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.filter
+}
+
+// setFilter filters the feed to the messages sent by the username. Pass an
+// empty string to show all messages.
+func (c *channelState) setFilter(username string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.filter = username
+}
+
+// isShown determines if the message is shown in the feed with its current
+// filter. Messages from muted users are never shown.
+func (c *channelState) isShown(r client.ReceivedBroadcast) bool {
+	if c.IsMuted(r) {
+		return false
+	}
+	filter := c.getFilter()
+	return filter == "" || r.Username == filter && !r.Asymmetric
+}
+
+// isSearching determines if the next input is a search query.
+func (c *channelState) isSearching() bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.searching
+}
+
+// setSearching sets whether the next input is a search query.
+func (c *channelState) setSearching(searching bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.searching = searching
+}
+
+// getSearch returns the search highlighted in the feed and the indexes of the
+// messages that match it.
+func (c *channelState) getSearch() (*client.SearchQuery, []int) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.search, c.hits
+}
+
+// setSearch sets the search highlighted in the feed and the indexes of the
+// messages that match it. Pass nil to clear the search.
+func (c *channelState) setSearch(search *client.SearchQuery, hits []int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.search, c.hits = search, hits
+}
+
+// isAdmin determines if the channel's private key is available so that admin
+// messages can be sent.
+func (c *channelState) isAdmin() bool {
+	return c.AsymBroadcastFn != nil
+}
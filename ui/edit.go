@@ -0,0 +1,156 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strings"
+)
+
+// messageState describes how a message in the feed buffer has been modified.
+type messageState uint8
+
+const (
+	// unmodified indicates the message has not been modified.
+	unmodified messageState = iota
+
+	// edited indicates the text of the message was replaced by its sender.
+	edited
+
+	// deleted indicates the message was retracted by its sender.
+	deleted
+
+	// retracted indicates the message was retracted by the channel admin.
+	retracted
+)
+
+// isChange determines if the message modifies an earlier message instead of
+// being displayed itself.
+func isChange(r client.ReceivedBroadcast) bool {
+	return r.Tag == client.Edit || r.Tag == client.Delete ||
+		r.Tag == client.Reaction
+}
+
+// formatState returns the message body of a message in the channel feed
+// updated to reflect how the message was modified.
+func formatState(body string, state messageState) string {
+	switch state {
+	case edited:
+		return body + " \x1b[38;5;242m(edited)\x1b[0m"
+	case deleted:
+		return "\x1b[38;5;242m[message deleted]\x1b[0m"
+	case retracted:
+		return "\x1b[38;5;242m[message removed by admin]\x1b[0m"
+	default:
+		return body
+	}
+}
+
+// editSelected starts editing the message selected in the channel feed. The
+// text of the message is copied to the message input to be changed.
+func (m *Manager) editSelected(g *gocui.Gui, v *gocui.View) error {
+	c := m.currentChannel()
+	i := c.getSelected()
+	r, exists := c.getMessage(i)
+	if !exists {
+		return nil
+	}
+
+	switch {
+	case r.Tag != client.Default && r.Tag != client.Admin:
+		return m.printNotice("Only text messages can be edited.")
+	case r.Username != m.username:
+		return m.printNotice("You can only edit your own messages.")
+	case r.Asymmetric && !c.isAdmin():
+		return m.printNotice("Admin messages can only be edited as admin.")
+	case c.getState(i) == deleted || c.getState(i) == retracted:
+		return m.printNotice("Deleted messages cannot be edited.")
+	}
+
+	if _, exists = r.Extensions.MessageID(); !exists {
+		return m.printNotice("Cannot edit a message without an ID.")
+	}
+
+	c.setReplyTo(-1)
+	c.setReactTo(-1)
+	c.setSearching(false)
+	c.setEditOf(i)
+	if err := m.clearInput(c); err != nil {
+		return err
+	}
+	for _, ch := range strings.TrimSpace(string(r.Message)) {
+		m.v.messageInput.EditWrite(ch)
+	}
+
+	if err := m.drawAdminState(); err != nil {
+		return err
+	}
+
+	return switchActiveTo(messageInput)(g, v)
+}
+
+// deleteSelected retracts the message selected in the channel feed. Messages
+// sent by other users can only be retracted by the channel admin.
+func (m *Manager) deleteSelected(*gocui.Gui, *gocui.View) error {
+	c := m.currentChannel()
+	i := c.getSelected()
+	r, exists := c.getMessage(i)
+	if !exists {
+		return nil
+	}
+
+	mid, exists := r.Extensions.MessageID()
+	if !exists {
+		return m.printNotice("Cannot delete a message without an ID.")
+	} else if state := c.getState(i); state == deleted || state == retracted {
+		return nil
+	}
+
+	broadcastFn := c.SymBroadcastFn
+	if r.Asymmetric || r.Username != m.username {
+		if !c.isAdmin() {
+			return m.printNotice("You can only delete your own messages.")
+		}
+		broadcastFn = c.AsymBroadcastFn
+	}
+
+	err := broadcastFn(client.Delete, netTime.Now(), nil,
+		client.NewEditOfExtension(mid))
+	if err != nil {
+		jww.ERROR.Printf("Failed to delete message %s: %+v", mid, err)
+		return m.printNotice("Failed to delete message: %v", err)
+	}
+
+	return nil
+}
+
+// editExtensions returns the BroadcastFn and extensions used to send the next
+// message in the channel as an edit of the message being edited. Returns false
+// if no message is being edited.
+func editExtensions(
+	c *channelState) (client.BroadcastFn, []client.Extension, bool) {
+	original, exists := c.getMessage(c.getEditOf())
+	if !exists {
+		return nil, nil, false
+	}
+
+	mid, exists := original.Extensions.MessageID()
+	if !exists {
+		return nil, nil, false
+	}
+
+	broadcastFn := c.SymBroadcastFn
+	if original.Asymmetric {
+		broadcastFn = c.AsymBroadcastFn
+	}
+
+	return broadcastFn, []client.Extension{client.NewEditOfExtension(mid)}, true
+}
@@ -10,77 +10,137 @@ package ui
 import (
 	"git.xx.network/elixxir/cli-client/client"
 	"github.com/awesome-gocui/gocui"
-	crypto "gitlab.com/elixxir/crypto/broadcast"
 	"sync"
+	"time"
 )
 
+// Channel is a joined channel to display in the UI along with the messages
+// stored in its history.
+type Channel struct {
+	*client.JoinedChannel
+	Backlog []client.ReceivedBroadcast
+}
+
 type Manager struct {
-	v                   *views
-	ch                  *crypto.Channel
-	receivedBroadcastCh chan client.ReceivedBroadcast
-	symBroadcastFunc    client.BroadcastFn
-	asymBroadcastFunc   client.BroadcastFn
-	username            string
-	symMaxMessageLen    int
-	asymMaxMessageLen   int
-	adminMode           bool
-	adminModeMux        sync.RWMutex
+	v        *views
+	g        *gocui.Gui
+	channels []*channelState
+	current  int
+	username string
+
+	// showMalformed is true when a notice is printed to the feed for every
+	// malformed message received.
+	showMalformed bool
+
+	// sendPresence is true when heartbeats and typing indicators are sent.
+	sendPresence bool
+
+	// lastInput is the contents of the message input when it was last checked
+	// for typing.
+	lastInput string
+
+	// presence is the summary of online and typing users last drawn to the
+	// title box.
+	presence string
+
+	// rosterIdle is how long members stay in the roster without sending a
+	// message.
+	rosterIdle time.Duration
+
+	// rosterText is the text last drawn to the roster and members are the
+	// usernames listed in it, in order.
+	rosterText string
+	members    []string
+
+	// feed is the position of every message printed to the channel feed of the
+	// channel being displayed.
+	feed []feedEntry
+
+	mux sync.RWMutex
 }
 
-func NewManager(ch *crypto.Channel,
-	receivedBroadcastCh chan client.ReceivedBroadcast,
-	symBroadcastFunc, asymBroadcastFunc client.BroadcastFn, username string,
-	symMaxMessageLen, asymMaxMessageLen int) *Manager {
+func NewManager(username string, channels []Channel, showMalformed,
+	sendPresence bool, rosterIdle time.Duration) *Manager {
 	m := &Manager{
-		v:                   newViews(),
-		ch:                  ch,
-		receivedBroadcastCh: receivedBroadcastCh,
-		symBroadcastFunc:    symBroadcastFunc,
-		asymBroadcastFunc:   asymBroadcastFunc,
-		username:            username,
-		symMaxMessageLen:    symMaxMessageLen,
-		asymMaxMessageLen:   asymMaxMessageLen,
-		adminMode:           false,
+		v:             newViews(),
+		channels:      make([]*channelState, len(channels)),
+		current:       0,
+		username:      username,
+		showMalformed: showMalformed,
+		sendPresence:  sendPresence,
+		rosterIdle:    rosterIdle,
+	}
+
+	for i, c := range channels {
+		m.channels[i] = newChannelState(c, rosterIdle)
 	}
 
 	return m
 }
 
+// currentChannel returns the state of the channel currently displayed.
+func (m *Manager) currentChannel() *channelState {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.channels[m.current]
+}
+
+// isCurrent determines if the channel is the one currently displayed.
+func (m *Manager) isCurrent(c *channelState) bool {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.channels[m.current] == c
+}
+
+// setCurrent sets the channel at the index as the one currently displayed and
+// returns its state.
+func (m *Manager) setCurrent(i int) *channelState {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.current = (i + len(m.channels)) % len(m.channels)
+	return m.channels[m.current]
+}
+
 func (m *Manager) toggleAdminMode() {
-	m.adminModeMux.Lock()
-	defer m.adminModeMux.Unlock()
-	m.adminMode = !m.adminMode
+	c := m.currentChannel()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.adminMode = !c.adminMode
 }
 
 func (m *Manager) isAdminMode() bool {
-	m.adminModeMux.RLock()
-	defer m.adminModeMux.RUnlock()
-	return m.adminMode
+	c := m.currentChannel()
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.adminMode
 }
 
 type views struct {
 	list   []*gocui.View
 	active int
 
+	channelList  *gocui.View
 	channelFeed  *gocui.View
 	messageInput *gocui.View
 	sendButton   *gocui.View
 	messageCount *gocui.View
 	adminBtn     *gocui.View
 	titleBox     *gocui.View
+	roster       *gocui.View
 }
 
 func newViews() *views {
 	vs := &views{
-		list:   make([]*gocui.View, 0, 5),
+		list:   make([]*gocui.View, 0, 6),
 		active: 0,
 	}
 	return vs
 }
 
 func (vs *views) makeList() {
+	vs.list = vs.list[:0]
 	list := []*gocui.View{vs.channelFeed, vs.messageInput,
-		vs.sendButton, vs.adminBtn, vs.titleBox}
+		vs.sendButton, vs.adminBtn, vs.titleBox, vs.roster, vs.channelList}
 	for i, v := range list {
 		if v != nil {
 			vs.list = append(vs.list, list[i])
@@ -0,0 +1,114 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	jww "github.com/spf13/jwalterweatherman"
+	"strings"
+)
+
+// Commands that can be entered into the message input by the channel admin to
+// change the mute and ban lists of the channel.
+const (
+	muteCmd   = "/mute"
+	unmuteCmd = "/unmute"
+	banCmd    = "/ban"
+	unbanCmd  = "/unban"
+	modCmd    = "/moderation"
+)
+
+// moderationCmds correlates each moderation command to its action.
+var moderationCmds = map[string]client.ModerationAction{
+	muteCmd:   client.Mute,
+	unmuteCmd: client.Unmute,
+	banCmd:    client.Ban,
+	unbanCmd:  client.Unban,
+}
+
+// moderationPastTense correlates each action to how it is described in the
+// channel feed.
+var moderationPastTense = map[client.ModerationAction]string{
+	client.Mute:   "muted",
+	client.Unmute: "unmuted",
+	client.Ban:    "banned",
+	client.Unban:  "unbanned",
+}
+
+// moderate sends a moderation command for the user with the username to the
+// channel. Only the channel admin and moderators can moderate. The command is
+// sent in the background and the feed is redrawn once it is applied so that
+// the messages of muted users are hidden.
+func (m *Manager) moderate(
+	c *channelState, action client.ModerationAction, username string) error {
+	if !c.IsModerator() {
+		return m.printNotice(
+			"Only the channel admin and moderators can %s users.", action)
+	} else if username == "" {
+		return m.printNotice("Usage: /%s <username>", action)
+	}
+
+	go func() {
+		err := c.Moderate(action, username, nil)
+		m.g.UpdateAsync(func(g *gocui.Gui) error {
+			if err != nil {
+				jww.ERROR.Printf("Failed to %s %q: %+v", action, username, err)
+				return m.printNotice(
+					"Failed to %s %q: %v", action, username, err)
+			}
+			if m.isCurrent(c) {
+				return m.renderFeed()
+			}
+			return nil
+		})
+	}()
+
+	return nil
+}
+
+// printModeration prints the mute and ban lists of the channel to the channel
+// feed.
+func (m *Manager) printModeration(c *channelState) error {
+	lists, err := c.ModerationLists()
+	if err != nil {
+		return m.printNotice("Cannot load moderation lists: %v", err)
+	}
+
+	err = m.printNotice("Muted: %s", formatModerationList(lists.Muted))
+	if err != nil {
+		return err
+	}
+	return m.printNotice("Banned: %s", formatModerationList(lists.Banned))
+}
+
+// formatModerationList returns the users on the list separated by commas.
+// Identity keys are shown by their fingerprint.
+func formatModerationList(l client.ModerationList) string {
+	if l.IsEmpty() {
+		return "none"
+	}
+
+	users := append([]string{}, l.Usernames...)
+	for _, key := range l.Keys {
+		users = append(users, "key "+client.Fingerprint(key))
+	}
+	return strings.Join(users, ", ")
+}
+
+// formatModeration returns the moderation command in the payload of a message
+// with the Moderate tag formatted for the channel feed.
+func formatModeration(payload []byte) string {
+	mc, err := client.UnmarshalModerationCommand(payload)
+	if err != nil {
+		return "\x1b[31msent an invalid moderation command\x1b[0m"
+	}
+
+	return "\x1b[31m" + moderationPastTense[mc.Action] + " " + mc.Target() +
+		"\x1b[0m"
+}
@@ -0,0 +1,77 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendHeartbeats sends a Heartbeat message to the channel every
+// client.HeartbeatInterval so that other users see this user as online.
+func (m *Manager) sendHeartbeats(c *channelState) {
+	ticker := time.NewTicker(client.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := c.SymBroadcastFn(client.Heartbeat, netTime.Now(), []byte{})
+		if err != nil {
+			jww.WARN.Printf("Failed to send heartbeat to channel %q: %+v",
+				c.Channel.Name, err)
+		}
+	}
+}
+
+// sendTyping sends a Typing message to the channel if the message input has
+// changed and one has not been sent within client.TypingInterval. Commands and
+// search queries are not reported.
+func (m *Manager) sendTyping(c *channelState, input string) {
+	if !m.sendPresence || input == "" || input == m.lastInput ||
+		c.isSearching() {
+		return
+	}
+	m.lastInput = input
+
+	if strings.HasPrefix(input, "/") || !c.typing.Allow(netTime.Now()) {
+		return
+	}
+
+	go func() {
+		err := c.SymBroadcastFn(client.Typing, netTime.Now(), []byte{})
+		if err != nil {
+			jww.WARN.Printf("Failed to send typing indicator to channel "+
+				"%q: %+v", c.Channel.Name, err)
+		}
+	}()
+}
+
+// drawPresence redraws the title box if the number of online or typing users
+// of the channel being displayed has changed since it was last drawn.
+func (m *Manager) drawPresence() error {
+	if m.v.titleBox == nil ||
+		formatPresence(m.currentChannel()) == m.presence {
+		return nil
+	}
+	return m.drawTitleBox()
+}
+
+// formatPresence returns the number of users online and typing in the channel
+// for the title box. The users themselves are listed in the roster.
+func formatPresence(c *channelState) string {
+	now := netTime.Now()
+	online := len(c.presence.Online(now))
+	typing := len(c.presence.Typing(now))
+
+	return "\x1b[38;5;252mPresence:\n\x1b[38;5;248m" +
+		strconv.Itoa(online) + " online, " + strconv.Itoa(typing) +
+		" typing\x1b[0m"
+}
@@ -0,0 +1,85 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	"strconv"
+	"strings"
+)
+
+// reaction is a reaction to a message and the users that sent it.
+type reaction struct {
+	text      string
+	usernames []string
+}
+
+// formatReactions returns the line listing the reactions to a message with
+// the number of users that sent each one.
+func formatReactions(reactions []reaction) string {
+	fields := make([]string, len(reactions))
+	for i, r := range reactions {
+		fields[i] = "[" + r.text + " " + strconv.Itoa(len(r.usernames)) + "]"
+	}
+
+	return "\x1b[38;5;245m" + strings.Join(fields, " ") + "\x1b[0m"
+}
+
+// reactSelected starts writing a reaction to the message selected in the
+// channel feed. If no message is selected, then the most recent message is
+// selected first.
+func (m *Manager) reactSelected(g *gocui.Gui, v *gocui.View) error {
+	c := m.currentChannel()
+	if c.getSelected() < 0 {
+		if err := m.moveSelection(0)(g, v); err != nil {
+			return err
+		}
+	}
+
+	i := c.getSelected()
+	r, exists := c.getMessage(i)
+	if !exists {
+		return nil
+	} else if _, exists = r.Extensions.MessageID(); !exists {
+		return m.printNotice("Cannot react to a message without an ID.")
+	} else if state := c.getState(i); state == deleted || state == retracted {
+		return m.printNotice("Cannot react to a deleted message.")
+	}
+
+	if c.getEditOf() >= 0 {
+		c.setEditOf(-1)
+		if err := m.clearInput(c); err != nil {
+			return err
+		}
+	}
+	c.setReplyTo(-1)
+	c.setSearching(false)
+	c.setReactTo(i)
+	if err := m.drawAdminState(); err != nil {
+		return err
+	}
+
+	return switchActiveTo(messageInput)(g, v)
+}
+
+// reactionExtensions returns the extensions used to send the next message in
+// the channel as a reaction to the message being reacted to. Returns false if
+// no reaction is being written.
+func reactionExtensions(c *channelState) ([]client.Extension, bool) {
+	target, exists := c.getMessage(c.getReactTo())
+	if !exists {
+		return nil, false
+	}
+
+	mid, exists := target.Extensions.MessageID()
+	if !exists {
+		return nil, false
+	}
+	return []client.Extension{client.NewReplyToExtension(mid)}, true
+}
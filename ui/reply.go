@@ -0,0 +1,404 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	"github.com/mattn/go-runewidth"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// selectedMark is prefixed to the first line of the selected message in the
+// channel feed.
+const selectedMark = "\x1b[1;32m▶\x1b[0m "
+
+// snippetLen is the maximum number of characters of a parent message quoted
+// above a reply.
+const snippetLen = 50
+
+// feedEntry is the position of a message printed to the channel feed.
+type feedEntry struct {
+	// index is the index of the message in the feed buffer of the channel.
+	index int
+
+	// start and end are the first buffer line of the message in the channel
+	// feed and the first buffer line after it.
+	start, end int
+}
+
+// initFeedKeybindings initializes the key bindings used to select, reply to,
+// react to, edit, and delete messages in the channel feed.
+func (m *Manager) initFeedKeybindings(g *gocui.Gui) error {
+	err := g.SetKeybinding(
+		channelFeed, gocui.KeyArrowUp, gocui.ModNone, m.moveSelection(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow up: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		channelFeed, gocui.KeyArrowDown, gocui.ModNone, m.moveSelection(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow down: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		channelFeed, gocui.MouseWheelUp, gocui.ModNone, scrollView(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for wheel up: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		channelFeed, gocui.MouseWheelDown, gocui.ModNone, scrollView(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for wheel down: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		channelFeed, gocui.MouseLeft, gocui.ModNone, m.clickMessage)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for left mouse button: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		channelFeed, gocui.KeyEsc, gocui.ModNone, m.clearSelection)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Esc: %+v", err)
+	}
+
+	for _, key := range []interface{}{'r', gocui.KeyEnter} {
+		err = g.SetKeybinding(
+			channelFeed, key, gocui.ModNone, m.replySelected)
+		if err != nil {
+			return errors.Errorf(
+				"failed to set key binding for %v: %+v", key, err)
+		}
+	}
+
+	err = g.SetKeybinding(channelFeed, 'a', gocui.ModNone, m.reactSelected)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for a: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelFeed, 'e', gocui.ModNone, m.editSelected)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for e: %+v", err)
+	}
+
+	for _, key := range []interface{}{'d', gocui.KeyDelete} {
+		err = g.SetKeybinding(
+			channelFeed, key, gocui.ModNone, m.deleteSelected)
+		if err != nil {
+			return errors.Errorf(
+				"failed to set key binding for %v: %+v", key, err)
+		}
+	}
+
+	err = g.SetKeybinding("", gocui.KeyCtrlR, gocui.ModNone, m.replySelected)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Ctrl + R: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		messageInput, gocui.KeyEsc, gocui.ModNone, m.cancelCompose)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Esc: %+v", err)
+	}
+
+	return nil
+}
+
+// entryAt returns the message printed on the line of the channel feed. The
+// line is a line as displayed, after wrapping.
+func (m *Manager) entryAt(viewLine int) (feedEntry, bool) {
+	line := bufferLineAt(m.v.channelFeed, viewLine)
+	for _, e := range m.feed {
+		if line >= e.start && line < e.end {
+			return e, true
+		}
+	}
+	return feedEntry{}, false
+}
+
+// entryOf returns the position in the channel feed of the message at the
+// index in the feed buffer.
+func (m *Manager) entryOf(index int) (feedEntry, bool) {
+	for _, e := range m.feed {
+		if e.index == index {
+			return e, true
+		}
+	}
+	return feedEntry{}, false
+}
+
+// moveSelection returns a key binding handler that selects the message delta
+// positions away from the selected message in the channel feed. If no message
+// is selected, then the most recent message is selected.
+func (m *Manager) moveSelection(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if len(m.feed) == 0 {
+			return nil
+		}
+
+		pos := len(m.feed) - 1
+		if e, exists := m.entryOf(m.currentChannel().getSelected()); exists {
+			for i := range m.feed {
+				if m.feed[i] == e {
+					pos = i + delta
+				}
+			}
+		}
+
+		if pos < 0 || pos >= len(m.feed) {
+			return nil
+		}
+		return m.selectMessage(m.feed[pos].index)
+	}
+}
+
+// clickMessage selects the message under the mouse in the channel feed.
+func (m *Manager) clickMessage(g *gocui.Gui, v *gocui.View) error {
+	if err := switchActive(g, v); err != nil {
+		return err
+	}
+
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if e, exists := m.entryAt(cy + oy); exists {
+		return m.selectMessage(e.index)
+	}
+	return nil
+}
+
+// clearSelection clears the message selection in the channel feed and
+// scrolls back to the most recent message. The member filter and search
+// highlights are also cleared.
+func (m *Manager) clearSelection(*gocui.Gui, *gocui.View) error {
+	if err := m.selectMessage(-1); err != nil {
+		return err
+	}
+	if err := m.filterFeed(""); err != nil {
+		return err
+	}
+	if err := m.clearSearch(); err != nil {
+		return err
+	}
+	m.v.channelFeed.Autoscroll = true
+	return nil
+}
+
+// selectMessage marks the message at the index in the feed buffer of the
+// channel being displayed as selected and scrolls the channel feed to it. Pass
+// -1 to clear the selection.
+func (m *Manager) selectMessage(index int) error {
+	c := m.currentChannel()
+	if err := m.markMessage(c, c.getSelected(), false); err != nil {
+		return err
+	}
+
+	c.setSelected(index)
+	if err := m.markMessage(c, index, true); err != nil {
+		return err
+	}
+
+	return m.scrollTo(index)
+}
+
+// markMessage adds or removes the selection mark on the first line of the
+// message at the index in the channel feed.
+func (m *Manager) markMessage(c *channelState, index int, selected bool) error {
+	e, exists := m.entryOf(index)
+	if !exists {
+		return nil
+	}
+
+	r, _ := c.getMessage(index)
+	header := strings.SplitN(
+		formatBroadcast(r, 0, nil, unmodified, nil, nil), "\n", 2)[0]
+	if selected {
+		header = selectedMark + header
+	}
+
+	if err := m.v.channelFeed.SetLine(e.start, header); err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
+	}
+	return nil
+}
+
+// scrollTo scrolls the channel feed so that the message at the index is
+// displayed.
+func (m *Manager) scrollTo(index int) error {
+	e, exists := m.entryOf(index)
+	if !exists {
+		return nil
+	}
+
+	v := m.v.channelFeed
+	_, height := v.Size()
+	_, oy := v.Origin()
+	start, end := viewLineOf(v, e.start), viewLineOf(v, e.end)
+
+	switch {
+	case start < oy:
+		oy = start
+	case end > oy+height:
+		oy = end - height
+	default:
+		return nil
+	}
+
+	v.Autoscroll = false
+	return v.SetOrigin(0, oy)
+}
+
+// replySelected returns a key binding handler that starts a reply to the
+// message selected in the channel feed. If no message is selected, then the
+// most recent message is selected first.
+func (m *Manager) replySelected(g *gocui.Gui, v *gocui.View) error {
+	c := m.currentChannel()
+	if c.getSelected() < 0 {
+		if err := m.moveSelection(0)(g, v); err != nil {
+			return err
+		}
+	}
+
+	r, exists := c.getMessage(c.getSelected())
+	if !exists {
+		return nil
+	} else if _, exists = r.Extensions.MessageID(); !exists {
+		return m.printNotice("Cannot reply to a message without an ID.")
+	}
+
+	c.setEditOf(-1)
+	c.setReactTo(-1)
+	c.setSearching(false)
+	c.setReplyTo(c.getSelected())
+	if err := m.drawAdminState(); err != nil {
+		return err
+	}
+
+	return switchActiveTo(messageInput)(g, v)
+}
+
+// cancelCompose cancels the reply, reaction, edit, or search being written in
+// the channel being displayed. The text of a cancelled edit is cleared from
+// the message input.
+func (m *Manager) cancelCompose(*gocui.Gui, *gocui.View) error {
+	c := m.currentChannel()
+	c.setReplyTo(-1)
+	c.setReactTo(-1)
+	c.setSearching(false)
+	if c.getEditOf() >= 0 {
+		c.setEditOf(-1)
+		if err := m.clearInput(c); err != nil {
+			return err
+		}
+	}
+	return m.drawAdminState()
+}
+
+// replyExtensions returns the extensions to send with the next message in the
+// channel. If a reply is being written, then it contains the ID of the
+// message being replied to.
+func replyExtensions(c *channelState) []client.Extension {
+	parent, exists := c.getMessage(c.getReplyTo())
+	if !exists {
+		return nil
+	}
+
+	mid, exists := parent.Extensions.MessageID()
+	if !exists {
+		return nil
+	}
+	return []client.Extension{client.NewReplyToExtension(mid)}
+}
+
+// formatQuote returns the line quoting the parent of a reply. If the parent is
+// nil, then the parent was not received.
+func formatQuote(parent *client.ReceivedBroadcast) string {
+	if parent == nil {
+		return "\x1b[38;5;242m┃ reply to an earlier message\x1b[0m"
+	}
+
+	return "\x1b[38;5;242m┃ " + stripControl(parent.Username) + ": " +
+		snippet(*parent) + "\x1b[0m"
+}
+
+// snippet returns the message shortened to a single line of at most
+// snippetLen characters. Deleted messages have no text.
+func snippet(r client.ReceivedBroadcast) string {
+	text := strings.Join(strings.Fields(string(r.Message)), " ")
+	if len(r.Message) == 0 {
+		text = "[deleted]"
+	} else if r.Tag == client.File {
+		text = "[file]"
+		if a, err := client.UnmarshalAttachment(r.Message); err == nil {
+			text += " " + a.Name
+		}
+	}
+
+	return runewidth.Truncate(stripControl(text), snippetLen, "…")
+}
+
+// bufferLineAt returns the buffer line of the view that is displayed on the
+// line after wrapping. Returns -1 if the line is past the end of the buffer.
+func bufferLineAt(v *gocui.View, viewLine int) int {
+	width, _ := v.Size()
+	for i, line := range v.BufferLines() {
+		h := wrappedHeight(line, width)
+		if viewLine < h {
+			return i
+		}
+		viewLine -= h
+	}
+	return -1
+}
+
+// viewLineOf returns the line that the buffer line of the view is displayed
+// on after wrapping.
+func viewLineOf(v *gocui.View, bufferLine int) int {
+	width, _ := v.Size()
+	var viewLine int
+	for i, line := range v.BufferLines() {
+		if i >= bufferLine {
+			break
+		}
+		viewLine += wrappedHeight(line, width)
+	}
+	return viewLine
+}
+
+// wrappedHeight returns the number of lines the line is wrapped onto in a view
+// of the given width. It matches the wrapping done by gocui.
+func wrappedHeight(line string, width int) int {
+	if width <= 0 {
+		return 1
+	}
+
+	height, w := 1, 0
+	for _, r := range line {
+		rw := runewidth.RuneWidth(r)
+		if w+rw > width {
+			height++
+			w = 0
+		}
+		w += rw
+	}
+	return height
+}
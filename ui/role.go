@@ -0,0 +1,192 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strings"
+	"time"
+)
+
+// Commands that can be entered into the message input by the channel admin to
+// grant and revoke the moderator role and by anyone to list the moderators.
+const (
+	grantCmd      = "/grant"
+	revokeCmd     = "/revoke"
+	moderatorsCmd = "/moderators"
+)
+
+// grant makes the user with the username a moderator of the channel for the
+// duration or, if it is empty, indefinitely. Only the channel admin can grant
+// roles and only to users whose identity key is known from their messages.
+func (m *Manager) grant(c *channelState, username, duration string) error {
+	if !c.isAdmin() {
+		return m.printNotice("Only the channel admin can grant moderators.")
+	} else if username == "" {
+		return m.printNotice("Usage: %s <username> [duration]", grantCmd)
+	}
+
+	key, exists := c.identityKey(username)
+	if !exists {
+		return m.printNotice(
+			"No verified message from %q has been received.", username)
+	}
+
+	var expires time.Time
+	if duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return m.printNotice("Invalid duration %q.", duration)
+		}
+		expires = netTime.Now().Add(d)
+	}
+
+	return m.sendRole(c, "grant "+username, func() error {
+		return c.Grant(client.Moderator, key, expires)
+	})
+}
+
+// revoke revokes the roles of the user with the username. Only the channel
+// admin can revoke roles.
+func (m *Manager) revoke(c *channelState, username string) error {
+	if !c.isAdmin() {
+		return m.printNotice("Only the channel admin can revoke moderators.")
+	} else if username == "" {
+		return m.printNotice("Usage: %s <username>", revokeCmd)
+	}
+
+	key, exists := c.identityKey(username)
+	if !exists {
+		return m.printNotice(
+			"No verified message from %q has been received.", username)
+	}
+
+	return m.sendRole(c, "revoke "+username, func() error {
+		return c.Revoke(key)
+	})
+}
+
+// sendRole calls send in the background so that the UI does not block while
+// the grant or revocation is sent.
+func (m *Manager) sendRole(
+	c *channelState, description string, send func() error) error {
+	go func() {
+		if err := send(); err != nil {
+			jww.ERROR.Printf("Failed to %s on channel %q: %+v",
+				description, c.Channel.Name, err)
+			m.g.UpdateAsync(func(g *gocui.Gui) error {
+				return m.printNotice("Failed to %s: %v", description, err)
+			})
+		}
+	}()
+
+	return nil
+}
+
+// printModerators prints the moderators of the channel to the channel feed.
+func (m *Manager) printModerators(c *channelState) error {
+	grants, err := c.Grants()
+	if err != nil {
+		return m.printNotice("Cannot load moderators: %v", err)
+	} else if len(grants) == 0 {
+		return m.printNotice("Moderators: none")
+	}
+
+	moderators := make([]string, len(grants))
+	for i, g := range grants {
+		moderators[i] = formatGrantee(c, g.Key)
+		if !g.Expires.IsZero() {
+			moderators[i] += " until " + g.Expires.Format("Jan 2 3:04 pm")
+		}
+	}
+
+	return m.printNotice("Moderators: %s", strings.Join(moderators, ", "))
+}
+
+// identityKey returns the identity key of the user with the username taken
+// from the most recent verified message they sent in the channel.
+func (c *channelState) identityKey(username string) (ed25519.PublicKey, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		r := c.messages[i]
+		if r.Username == username && r.Verification == client.Verified {
+			return r.Extensions.Get(client.SigningKeyExt)
+		}
+	}
+
+	return nil, false
+}
+
+// username returns the username of the most recent verified message in the
+// channel signed with the identity key. Returns false if there is none.
+func (c *channelState) username(key ed25519.PublicKey) (string, bool) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		r := c.messages[i]
+		signingKey, _ := r.Extensions.Get(client.SigningKeyExt)
+		if r.Verification == client.Verified && bytes.Equal(signingKey, key) {
+			return r.Username, true
+		}
+	}
+
+	return "", false
+}
+
+// formatGrantee returns the username of the owner of the identity key, if it
+// is known, or the fingerprint of the key.
+func formatGrantee(c *channelState, key ed25519.PublicKey) string {
+	if username, exists := c.username(key); exists {
+		return username
+	}
+	return "key " + client.Fingerprint(key)
+}
+
+// formatRole returns the description of the Grant or Revoke message for the
+// channel feed. Identity keys are shown by their fingerprint.
+func formatRole(r client.ReceivedBroadcast) string {
+	if r.Tag == client.Revoke {
+		key, err := client.UnmarshalRevocation(r.Message)
+		if err != nil {
+			return "\x1b[31msent an invalid revocation\x1b[0m"
+		}
+		return "\x1b[31mrevoked the roles of key " + client.Fingerprint(key) +
+			"\x1b[0m"
+	}
+
+	g, err := client.UnmarshalRoleGrant(r.Message)
+	if err != nil {
+		return "\x1b[31msent an invalid grant\x1b[0m"
+	}
+
+	message := "made key " + client.Fingerprint(g.Key) + " a " +
+		g.Role.String()
+	if !g.Expires.IsZero() {
+		message += " until " + g.Expires.Format("Jan 2 3:04 pm")
+	}
+	return "\x1b[31m" + message + "\x1b[0m"
+}
+
+// formatHandover returns the description of the Handover message for the
+// channel feed. The successor key is shown by its fingerprint.
+func formatHandover(r client.ReceivedBroadcast) string {
+	h, err := client.UnmarshalKeyHandover(r.Message)
+	if err != nil {
+		return "\x1b[31msent an invalid handover\x1b[0m"
+	}
+	return "\x1b[31mhanded the channel over to key " +
+		client.RsaFingerprint(h.Successor) + "\x1b[0m"
+}
@@ -0,0 +1,207 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"fmt"
+	"github.com/awesome-gocui/gocui"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rosterRefresh is how often the roster is checked for expired members.
+const rosterRefresh = time.Second
+
+// initRosterKeybindings initializes the key bindings used to filter the
+// channel feed by the members listed in the roster.
+func (m *Manager) initRosterKeybindings(g *gocui.Gui) error {
+	err := g.SetKeybinding(
+		rosterView, gocui.MouseLeft, gocui.ModNone, m.clickMember)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for left mouse button: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		rosterView, gocui.KeyArrowUp, gocui.ModNone, m.moveFilter(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow up: %+v", err)
+	}
+
+	err = g.SetKeybinding(
+		rosterView, gocui.KeyArrowDown, gocui.ModNone, m.moveFilter(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow down: %+v", err)
+	}
+
+	err = g.SetKeybinding(rosterView, gocui.KeyEsc, gocui.ModNone,
+		func(*gocui.Gui, *gocui.View) error { return m.filterFeed("") })
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Esc: %+v", err)
+	}
+
+	return nil
+}
+
+// refreshRoster redraws the roster and the presence summary in the title box
+// every rosterRefresh if they have changed for the channel being displayed, so
+// that idle members and expired users are removed.
+func (m *Manager) refreshRoster() {
+	ticker := time.NewTicker(rosterRefresh)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.g.Update(func(*gocui.Gui) error {
+			if err := m.drawRoster(false); err != nil {
+				return err
+			}
+			return m.drawPresence()
+		})
+	}
+}
+
+// drawRoster writes the members of the channel being displayed to the roster.
+// Unless force is set, the roster is only redrawn if it has changed since it
+// was last drawn.
+func (m *Manager) drawRoster(force bool) error {
+	if m.v.roster == nil {
+		return nil
+	}
+
+	c := m.currentChannel()
+	members, text := formatRoster(c)
+	if !force && text == m.rosterText {
+		return nil
+	}
+	m.rosterText = text
+	m.members = members
+
+	m.v.roster.Title = " Members (" + strconv.Itoa(len(members)) + ") "
+	m.v.roster.Clear()
+	if _, err := fmt.Fprint(m.v.roster, text); err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
+	}
+
+	return nil
+}
+
+// formatRoster returns the usernames of the members of the channel in the
+// order they are listed and the text of the roster. Each member is listed
+// with their message count and marked if they are typing or the feed is
+// filtered to them.
+func formatRoster(c *channelState) ([]string, string) {
+	now := netTime.Now()
+	members := c.roster.Members(now)
+	typing := make(map[string]bool)
+	for _, username := range c.presence.Typing(now) {
+		typing[username] = true
+	}
+	filter := c.getFilter()
+
+	usernames := make([]string, len(members))
+	lines := make([]string, len(members))
+	for i, member := range members {
+		usernames[i] = member.Username
+
+		line := "\x1b[38;5;250m" + member.Username + " \x1b[38;5;242m" +
+			strconv.Itoa(member.Messages) + "\x1b[0m"
+		if member.Username == filter {
+			line = selectedMark + line
+		}
+		if typing[member.Username] {
+			line += " \x1b[32mtyping…\x1b[0m"
+		}
+		lines[i] = line
+	}
+
+	return usernames, strings.Join(lines, "\n")
+}
+
+// clickMember filters the channel feed to the member under the mouse in the
+// roster. Clicking the member the feed is already filtered to clears the
+// filter.
+func (m *Manager) clickMember(g *gocui.Gui, v *gocui.View) error {
+	if err := switchActive(g, v); err != nil {
+		return err
+	}
+
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	i := cy + oy
+	if i < 0 || i >= len(m.members) {
+		return nil
+	}
+
+	username := m.members[i]
+	if username == m.currentChannel().getFilter() {
+		username = ""
+	}
+	return m.filterFeed(username)
+}
+
+// moveFilter returns a key binding handler that filters the channel feed to
+// the member delta positions away in the roster from the member the feed is
+// filtered to. If the feed is not filtered, then the first or last member is
+// used.
+func (m *Manager) moveFilter(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(*gocui.Gui, *gocui.View) error {
+		if len(m.members) == 0 {
+			return nil
+		}
+
+		pos := len(m.members)
+		if delta > 0 {
+			pos = -1
+		}
+		filter := m.currentChannel().getFilter()
+		for i, username := range m.members {
+			if username == filter {
+				pos = i
+			}
+		}
+
+		if pos += delta; pos < 0 || pos >= len(m.members) {
+			return nil
+		}
+		return m.filterFeed(m.members[pos])
+	}
+}
+
+// filterFeed redraws the channel feed with only the messages sent by the user
+// and prints when the user was first and last seen. Pass an empty username to
+// show all messages.
+func (m *Manager) filterFeed(username string) error {
+	c := m.currentChannel()
+	if username == c.getFilter() {
+		return nil
+	}
+
+	c.setFilter(username)
+	c.setSelected(-1)
+	if err := m.renderFeed(); err != nil {
+		return err
+	}
+	if err := m.drawRoster(true); err != nil {
+		return err
+	}
+
+	member, exists := c.roster.Get(username)
+	if !exists {
+		return nil
+	}
+	return m.printNotice("Showing messages from %s: first seen %s, last seen "+
+		"%s, %d messages received. Press Esc to show all messages.",
+		member.Username, member.FirstSeen.Format("3:04:05 pm"),
+		member.LastSeen.Format("3:04:05 pm"), member.Messages)
+}
@@ -0,0 +1,175 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package ui
+
+import (
+	"git.xx.network/elixxir/cli-client/client"
+	"github.com/awesome-gocui/gocui"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/netTime"
+	"strings"
+)
+
+// searchHit is the color of text in the channel feed that matches the search.
+const searchHit = "\x1b[30;43m"
+
+// initSearchKeybindings initializes the key bindings used to search the
+// channel feed and jump between the results.
+func (m *Manager) initSearchKeybindings(g *gocui.Gui) error {
+	err := g.SetKeybinding("", gocui.KeyCtrlF, gocui.ModNone, m.startSearch)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Ctrl + F: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelFeed, 'n', gocui.ModNone, m.jumpHit(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for n: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelFeed, 'N', gocui.ModNone, m.jumpHit(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for N: %+v", err)
+	}
+
+	return nil
+}
+
+// startSearch switches the message input to writing a search query for the
+// channel being displayed.
+func (m *Manager) startSearch(g *gocui.Gui, v *gocui.View) error {
+	c := m.currentChannel()
+	if c.getEditOf() >= 0 {
+		c.setEditOf(-1)
+		if err := m.clearInput(c); err != nil {
+			return err
+		}
+	}
+	c.setReplyTo(-1)
+	c.setReactTo(-1)
+	c.setSearching(true)
+	if err := m.drawAdminState(); err != nil {
+		return err
+	}
+
+	return switchActiveTo(messageInput)(g, v)
+}
+
+// runSearch searches the feed buffer of the channel for the messages matching
+// the query, highlights them in the channel feed, and selects the most recent
+// one. The feed buffer contains the messages received in this session and
+// those loaded from the history.
+func (m *Manager) runSearch(
+	g *gocui.Gui, c *channelState, query string) error {
+	q, err := client.ParseSearchQuery(query, netTime.Now())
+	if err != nil {
+		return m.printNotice("Invalid search: %v", err)
+	}
+
+	var hits []int
+	for i, r := range c.getMessages() {
+		if c.isShown(r) && q.Match(r) {
+			hits = append(hits, i)
+		}
+	}
+
+	c.setSearching(false)
+	c.setSearch(q, hits)
+	if err = m.clearInput(c); err != nil {
+		return err
+	}
+	if err = m.drawAdminState(); err != nil {
+		return err
+	}
+	if err = m.renderFeed(); err != nil {
+		return err
+	}
+
+	if len(hits) == 0 {
+		return m.printNotice("No messages match %q.", query)
+	}
+
+	err = m.printNotice("%d messages match %q. Press n and N in the channel "+
+		"feed to jump to older and newer results and Esc to clear the search.",
+		len(hits), query)
+	if err != nil {
+		return err
+	}
+	if err = m.selectMessage(hits[len(hits)-1]); err != nil {
+		return err
+	}
+
+	return switchActiveTo(channelFeed)(g, nil)
+}
+
+// jumpHit returns a key binding handler that selects the search result delta
+// positions away from the selected message. Negative values move to older
+// results.
+func (m *Manager) jumpHit(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(*gocui.Gui, *gocui.View) error {
+		c := m.currentChannel()
+		_, hits := c.getSearch()
+		if len(hits) == 0 {
+			return nil
+		}
+
+		selected := c.getSelected()
+		if selected < 0 {
+			selected = hits[len(hits)-1] + 1
+		}
+		pos := len(hits)
+		for i, hit := range hits {
+			if delta < 0 && hit < selected {
+				pos = i
+			} else if delta > 0 && hit > selected {
+				pos = i
+				break
+			}
+		}
+
+		if pos == len(hits) || hits[pos] == selected {
+			return nil
+		}
+		return m.selectMessage(hits[pos])
+	}
+}
+
+// clearSearch removes the search highlights from the channel feed.
+func (m *Manager) clearSearch() error {
+	c := m.currentChannel()
+	if q, _ := c.getSearch(); q == nil {
+		return nil
+	}
+
+	c.setSearch(nil, nil)
+	return m.renderFeed()
+}
+
+// highlight marks every match of the search in the text of a message with the
+// given color. The color is restored after each match.
+func highlight(text, color string, search *client.SearchQuery) string {
+	if search == nil {
+		return text
+	}
+
+	var b strings.Builder
+	var last int
+	for _, span := range search.FindAll(text) {
+		if span[0] == span[1] {
+			continue
+		}
+		b.WriteString(text[last:span[0]])
+		b.WriteString(searchHit + text[span[0]:span[1]] + "\x1b[0m" + color)
+		last = span[1]
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
@@ -16,6 +16,7 @@ import (
 	"gitlab.com/xx_network/primitives/netTime"
 	"strings"
 	"time"
+	"unicode"
 )
 
 const (
@@ -25,12 +26,17 @@ const (
 	sendButton   = "sendButtonBox"
 	messageCount = "messageCountBox"
 	adminBtn     = "adminButtonView"
+	channelList  = "channelListView"
+	rosterView   = "rosterView"
 )
 
+// channelListWidth is the width of the channel list sidebar.
+const channelListWidth = 22
+
 const charCountFmt = "%4d/\n%4d"
 
 var (
-	viewArr = []string{channelFeed, messageInput, sendButton, titleBox}
+	viewArr = []string{messageInput, sendButton, titleBox}
 )
 
 func (m *Manager) MakeUI() {
@@ -52,123 +58,512 @@ func (m *Manager) MakeUI() {
 	if err != nil {
 		jww.FATAL.Panicf("Failed to generate key bindings: %+v", err)
 	}
-	go func() {
-		for {
-			select {
-			case r := <-m.receivedBroadcastCh:
+	m.g = g
 
-				for m.v.channelFeed == nil {
-					time.Sleep(250 * time.Millisecond)
-				}
+	for _, c := range m.channels {
+		go m.receive(c)
+		if m.showMalformed {
+			go m.receiveMalformed(c)
+		}
 
-				jww.INFO.Printf("Got broadcast: %+v", r)
+		err = c.SymBroadcastFn(client.Join, netTime.Now(), []byte{})
+		if err != nil {
+			jww.FATAL.Panicf("Failed to send initial join message to "+
+				"channel %q: %+v", c.Channel.Name, err)
+		}
 
-				var message string
-				tsFmt := "\u001B[38;5;242m["
-				unFmt := "\u001B[38;5;255m"
+		if m.sendPresence {
+			go m.sendHeartbeats(c)
+		}
+		go m.rebroadcastBulletin(c)
+	}
+	go m.refreshRoster()
 
-				switch r.Tag {
-				case client.Default:
-					usernameField := unFmt + r.Username + "\x1b[0m"
-					timestampField := tsFmt + "sent " + r.Timestamp.Format("3:04:05 pm") + " / received " + netTime.Now().Format("3:04:05 pm") + "]\x1b[0m"
-					messageField := "\x1b[38;5;250m" + strings.TrimSpace(string(r.Message)) + "\x1b[0m"
+	if err = g.MainLoop(); err != nil && err != gocui.ErrQuit {
+		jww.FATAL.Panicf("Error in main loop: %+v", err)
+	}
+}
 
-					message = usernameField + " " + timestampField + "\n" + messageField
-				case client.Join:
-					usernameField := unFmt + r.Username + "\x1b[0m \x1B[38;5;250mhas joined the channel.\x1B[0m"
-					timestampField := tsFmt + "sent " + r.Timestamp.Format("3:04:05 pm") + " / received " + netTime.Now().Format("3:04:05 pm") + "]\x1b[0m"
+// receive adds every message received on the channel to its feed buffer and
+// prints it to the channel feed if the channel is being displayed.
+func (m *Manager) receive(c *channelState) {
+	for m.v.channelFeed == nil {
+		time.Sleep(250 * time.Millisecond)
+	}
 
-					message = usernameField + " " + timestampField
-				case client.Exit:
-					usernameField := unFmt + r.Username + "\x1b[0m \x1B[38;5;250mhas left the channel.\x1B[0m"
-					timestampField := tsFmt + "sent " + r.Timestamp.Format("3:04:05 pm") + " / received " + netTime.Now().Format("3:04:05 pm") + "]\x1b[0m"
+	for r := range c.Received {
+		jww.INFO.Printf("Got broadcast on channel %q: %+v", c.Channel.Name, r)
+		r := r
+		m.g.UpdateAsync(func(g *gocui.Gui) error {
+			c.presence.Update(r)
+			c.roster.Update(r)
+			m.welcome(c, r)
+			if m.isCurrent(c) {
+				if err := m.drawRoster(false); err != nil {
+					return err
+				}
+				if err := m.drawPresence(); err != nil {
+					return err
+				}
+			}
 
-					message = usernameField + " " + timestampField
-				case client.Admin:
-					usernameField := "\x1b[41m[ADMIN]\x1b[0m"
-					timestampField := tsFmt + "sent " + r.Timestamp.Format("3:04:05 pm") + " / received " + netTime.Now().Format("3:04:05 pm") + "]\x1b[0m"
-					messageField := "\x1b[31m" + strings.TrimSpace(string(r.Message)) + "\x1b[0m"
+			// Heartbeats and typing indicators are not displayed
+			if r.Tag.IsEphemeral() {
+				return nil
+			}
 
-					message = usernameField + " " + timestampField + "\n" + messageField
+			// Edits, deletes, and reactions redraw the feed instead of being
+			// printed
+			if isChange(r) {
+				if c.applyChange(r) && m.isCurrent(c) {
+					return m.renderFeed()
 				}
+				return nil
+			}
 
-				message = message + "\n\n"
-
-				_, err = fmt.Fprintf(m.v.channelFeed, message)
-				if err != nil {
-					jww.ERROR.Print(err)
-					continue
+			// Moderation commands can hide or show earlier messages, so the
+			// feed is redrawn
+			displayed := m.isCurrent(c)
+			index, attachment := c.addMessage(r, displayed)
+			if displayed && r.Tag.IsBulletin() {
+				if err := m.drawTitleBox(); err != nil {
+					return err
 				}
+			}
+			if displayed && r.Tag == client.Moderate {
+				if err := m.renderFeed(); err != nil {
+					return err
+				}
+			} else if displayed && c.isShown(r) {
+				if err := m.printBroadcast(c, r, index, attachment); err != nil {
+					return err
+				}
+			}
+			return m.drawChannelList()
+		})
+	}
+}
+
+// receiveMalformed prints a notice to the channel feed for every malformed
+// message received on the channel while it is being displayed.
+func (m *Manager) receiveMalformed(c *channelState) {
+	for m.v.channelFeed == nil {
+		time.Sleep(250 * time.Millisecond)
+	}
 
-				m.v.channelFeed.Autoscroll = true
+	for mm := range c.Malformed {
+		mm := mm
+		m.g.UpdateAsync(func(g *gocui.Gui) error {
+			if !m.isCurrent(c) {
+				return nil
 			}
+			return m.printNotice("\x1b[31mDropped malformed message received "+
+				"on round %d (%d total): %v", mm.RoundID, c.MalformedCount(),
+				mm.Err)
+		})
+	}
+}
+
+// printBroadcast formats the received broadcast at the index in the feed
+// buffer of the channel and prints it to the channel feed. If the broadcast is
+// an attachment, then attachment is its number in the channel.
+func (m *Manager) printBroadcast(c *channelState, r client.ReceivedBroadcast,
+	index, attachment int) error {
+	var parent *client.ReceivedBroadcast
+	if p, exists := c.getParent(r); exists {
+		parent = &p
+	}
+
+	search, _ := c.getSearch()
+	text := formatBroadcast(r, attachment, parent, c.getState(index),
+		c.getReactions(index), search)
+	if index == c.getSelected() {
+		text = selectedMark + text
+	}
+
+	_, start := m.v.channelFeed.WritePos()
+	_, err := fmt.Fprint(m.v.channelFeed, text)
+	if err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
+	}
+	_, end := m.v.channelFeed.WritePos()
+	m.feed = append(m.feed, feedEntry{index: index, start: start, end: end})
+
+	m.v.channelFeed.Autoscroll = true
+	return nil
+}
+
+// renderFeed clears the channel feed and prints the feed buffer of the
+// channel being displayed.
+func (m *Manager) renderFeed() error {
+	c := m.currentChannel()
+
+	m.v.channelFeed.Clear()
+	m.v.channelFeed.Title =
+		" Channel Feed for \"" + c.Channel.Name + "\" [F4] "
+	if filter := c.getFilter(); filter != "" {
+		m.v.channelFeed.Title = " Channel Feed for \"" + c.Channel.Name +
+			"\" from \"" + filter + "\" [Esc] "
+	}
+	m.feed = m.feed[:0]
+	var attachment int
+	for i, r := range c.getMessages() {
+		if r.Tag == client.File {
+			attachment++
 		}
-	}()
+		if !c.isShown(r) {
+			continue
+		}
+		if err := m.printBroadcast(c, r, i, attachment); err != nil {
+			return err
+		}
+	}
+	m.v.channelFeed.Autoscroll = true
 
-	err = m.symBroadcastFunc(client.Join, netTime.Now(), []byte{})
+	return nil
+}
+
+// printNotice prints a notice to the channel feed that is not sent to the
+// channel.
+func (m *Manager) printNotice(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(m.v.channelFeed,
+		"\x1b[38;5;242m* "+format+"\x1b[0m\n\n", a...)
 	if err != nil {
-		jww.FATAL.Panicf("Failed to send initial join message: %+v", err)
+		return errors.Errorf("Failed to write to view: %+v", err)
 	}
 
-	if err = g.MainLoop(); err != nil && err != gocui.ErrQuit {
-		jww.FATAL.Panicf("Error in main loop: %+v", err)
+	m.v.channelFeed.Autoscroll = true
+	return nil
+}
+
+// formatBroadcast returns the received broadcast formatted for the channel
+// feed. If the broadcast is an attachment, then attachment is its number in the
+// channel. If the broadcast is a reply, then a snippet of the parent is quoted
+// above it; parent is nil if it was not received. Edited and deleted messages
+// are marked according to their state, and reactions are listed below the
+// message. Text matching the search, if it is not nil, is highlighted.
+func formatBroadcast(r client.ReceivedBroadcast, attachment int,
+	parent *client.ReceivedBroadcast, state messageState,
+	reactions []reaction, search *client.SearchQuery) string {
+	tsFmt := "\u001B[38;5;242m["
+	timestampField := tsFmt + "sent " + r.Timestamp.Format("3:04:05 pm") +
+		" / received " + r.ReceivedTime.Format("3:04:05 pm") + "]\x1b[0m"
+
+	var quote string
+	if _, isReply := r.Extensions.ReplyTo(); isReply && !r.Tag.IsBulletin() {
+		quote = formatQuote(parent) + "\n"
+	}
+
+	var usernameField, messageField string
+	switch r.Tag {
+	case client.Default:
+		usernameField = formatUsername(r)
+		messageField = "\x1b[38;5;250m" + highlight(strings.TrimSpace(
+			stripControl(string(r.Message))), "\x1b[38;5;250m", search) +
+			"\x1b[0m"
+	case client.Join:
+		usernameField = formatUsername(r) + " \x1B[38;5;250mhas joined the channel.\x1B[0m"
+	case client.Exit:
+		usernameField = formatUsername(r) + " \x1B[38;5;250mhas left the channel.\x1B[0m"
+	case client.Admin:
+		usernameField = "\x1b[41m[ADMIN]\x1b[0m"
+		messageField = "\x1b[31m" + highlight(strings.TrimSpace(
+			stripControl(string(r.Message))), "\x1b[31m", search) + "\x1b[0m"
+	case client.File:
+		usernameField = formatUsername(r)
+		messageField = formatAttachment(r.Message, attachment)
+	case client.Moderate:
+		usernameField = "\x1b[41m[ADMIN]\x1b[0m " + formatModeration(r.Message)
+		if !r.Asymmetric {
+			usernameField = formatUsername(r) + " " + formatModeration(r.Message)
+		}
+	case client.Grant, client.Revoke:
+		usernameField = "\x1b[41m[ADMIN]\x1b[0m " + formatRole(r)
+	case client.Handover:
+		usernameField = "\x1b[41m[ADMIN]\x1b[0m " + formatHandover(r)
+	case client.Topic, client.Pin, client.Unpin:
+		usernameField = "\x1b[41m[ADMIN]\x1b[0m " + formatBulletinChange(r)
+	}
+
+	message := usernameField + " " + timestampField
+	if messageField != "" {
+		message += "\n" + quote + formatState(messageField, state)
+	}
+	if len(reactions) > 0 {
+		message += "\n" + formatReactions(reactions)
+	}
+
+	return message + "\n\n"
+}
+
+// formatUsername returns the username of the received broadcast marked with
+// whether the sender was verified and whether they are a moderator.
+func formatUsername(r client.ReceivedBroadcast) string {
+	username := "\u001B[38;5;255m" + stripControl(r.Username) + "\x1b[0m"
+	if r.Role == client.Moderator {
+		username = "\x1b[44m[MOD]\x1b[0m " + username
+	}
+	switch r.Verification {
+	case client.Verified:
+		return username + " \x1b[32m✓\x1b[0m"
+	case client.Impersonation:
+		return "\x1b[41m[IMPERSONATION]\x1b[0m " + username
+	default:
+		return username + " \x1b[38;5;242m(unverified)\x1b[0m"
+	}
+}
+
+// stripControl returns the text with every control character, other than
+// newlines and tabs, removed so that received text cannot move the cursor or
+// change how the terminal is displayed with escape sequences.
+func stripControl(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// drawTitleBox writes the controls and the information of the channel being
+// displayed to the title box.
+func (m *Manager) drawTitleBox() error {
+	c := m.currentChannel()
+
+	adminControl := "\n"
+	if c.isAdmin() {
+		adminControl = " p       Pin (in feed)\n" +
+			" F6      Admin toggle\n\n"
+	}
+
+	m.presence = formatPresence(c)
+	m.v.titleBox.Clear()
+	_, err := fmt.Fprintf(m.v.titleBox, m.presence+"\n\n"+
+		"Controls:\n"+
+		"\u001B[38;5;250m"+
+		" Ctrl+C  exit\n"+
+		" Tab     Switch view\n"+
+		" ↑ ↓     Seek input\n"+
+		" Enter   Send message\n"+
+		" Ctrl+J  New line\n"+
+		" Ctrl+N  Next channel\n"+
+		" Ctrl+P  Prev channel\n"+
+		" Ctrl+S  Save last file\n"+
+		" Ctrl+R  Reply\n"+
+		" Ctrl+F  Search\n"+
+		" a       React (in feed)\n"+
+		" Esc     Cancel/clear\n"+
+		" F4      Channel feed\n"+
+		" F5      Message field\n"+
+		adminControl+
+		"\x1b[0m"+
+		formatBulletin(c)+
+		"Channel Info:\n"+
+		"\x1b[38;5;252mName:\n\x1b[38;5;248m"+c.Channel.Name+"\x1b[0m\n\n"+
+		"\x1b[38;5;252mDescription:\n\x1b[38;5;248m"+c.Channel.Description+"\x1b[0m\n\n"+
+		"\x1b[38;5;252mID:\n\x1b[38;5;248m"+c.Channel.ReceptionID.String()+"\x1b[0m")
+	if err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
+	}
+
+	return nil
+}
+
+// drawChannelList writes the list of channels with their unread counts to the
+// channel list sidebar and highlights the channel being displayed.
+func (m *Manager) drawChannelList() error {
+	current := m.currentChannel()
+
+	m.v.channelList.Clear()
+	for _, c := range m.channels {
+		line := " " + c.Channel.Name
+		if unread := c.getUnread(); unread > 0 {
+			line += fmt.Sprintf(" \x1b[1;32m(%d)\x1b[0m", unread)
+		}
+		if c == current {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		if _, err := fmt.Fprintln(m.v.channelList, line); err != nil {
+			return errors.Errorf("Failed to write to view: %+v", err)
+		}
+	}
+
+	return nil
+}
+
+// drawAdminState updates the message input title and the admin button to
+// reflect the admin mode of the channel being displayed.
+func (m *Manager) drawAdminState() error {
+	if m.isAdminMode() {
+		m.v.messageInput.Title = " Sending Message as \"ADMIN\" [F5] "
+		m.v.messageInput.FgColor = gocui.ColorRed
+		m.v.messageInput.TitleColor = gocui.ColorRed
+	} else {
+		m.v.messageInput.Title = " Sending Message as \"" + m.username + "\" [F5] "
+		m.v.messageInput.FgColor = gocui.ColorDefault
+		m.v.messageInput.TitleColor = gocui.ColorDefault
+	}
+
+	c := m.currentChannel()
+	if parent, exists := c.getMessage(c.getReplyTo()); exists {
+		m.v.messageInput.Title = " Replying to \"" + parent.Username +
+			"\": " + snippet(parent) + " [Esc] "
+	} else if c.getEditOf() >= 0 {
+		m.v.messageInput.Title = " Editing Message [Esc] "
+	} else if target, exists := c.getMessage(c.getReactTo()); exists {
+		m.v.messageInput.Title = " Reacting to \"" + target.Username +
+			"\": " + snippet(target) + " [Esc] "
+	} else if c.isSearching() {
+		m.v.messageInput.Title = " Search: text or /regexp/ from:user " +
+			"tag:file after:1h before:15:04 [Esc] "
+	}
+
+	if m.v.adminBtn == nil {
+		return nil
+	}
+
+	m.v.adminBtn.Highlight = m.isAdminMode()
+	m.v.adminBtn.Clear()
+	text := "    ☐ Send as Admin    "
+	if m.isAdminMode() {
+		text = "    ☑ Send as Admin    "
+	}
+	if _, err := fmt.Fprint(m.v.adminBtn, text); err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
+	}
+
+	return nil
+}
+
+// switchChannel displays the channel at the index in the channel list.
+func (m *Manager) switchChannel(g *gocui.Gui, i int) error {
+	c := m.setCurrent(i)
+	c.markRead()
+
+	// Remove the admin button if the new channel has no private key
+	if !c.isAdmin() && m.v.adminBtn != nil {
+		if g.CurrentView() == m.v.adminBtn {
+			if err := switchActiveTo(messageInput)(g, nil); err != nil {
+				return err
+			}
+		}
+		if err := g.DeleteView(adminBtn); err != nil {
+			return err
+		}
+		m.v.adminBtn = nil
+	}
+
+	// Lay out the views so that the admin button exists before drawing them
+	if err := m.makeLayout()(g); err != nil {
+		return err
+	}
+
+	if err := m.renderFeed(); err != nil {
+		return err
 	}
+	if err := m.drawTitleBox(); err != nil {
+		return err
+	}
+	if err := m.drawRoster(true); err != nil {
+		return err
+	}
+	if err := m.drawAdminState(); err != nil {
+		return err
+	}
+
+	return m.drawChannelList()
+}
+
+// cycleChannel returns a key binding handler that displays the channel delta
+// positions away in the channel list.
+func (m *Manager) cycleChannel(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		m.mux.RLock()
+		i := m.current + delta
+		m.mux.RUnlock()
+		return m.switchChannel(g, i)
+	}
+}
+
+// selectChannel displays the channel under the cursor in the channel list.
+func (m *Manager) selectChannel(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if i := cy + oy; i >= 0 && i < len(m.channels) {
+		return m.switchChannel(g, i)
+	}
+	return nil
 }
 
 func (m *Manager) makeLayout() func(g *gocui.Gui) error {
 	return func(g *gocui.Gui) error {
 		maxX, maxY := g.Size()
+		c := m.currentChannel()
 
 		deltaY := 7
-		if m.asymBroadcastFunc != nil {
+		if c.isAdmin() {
 			deltaY = 10
 		}
 
-		adminControl := "\n"
-		if m.asymBroadcastFunc != nil {
-			adminControl = " F6      Admin toggle\n\n"
+		if v, err := g.SetView(channelList, 0, 0, channelListWidth-1, maxY-1, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Title = " Channels "
+			v.Wrap = false
+			m.v.channelList = v
+
+			if err = m.drawChannelList(); err != nil {
+				return err
+			}
 		}
 
-		if v, err := g.SetView(titleBox, maxX-25, 0, maxX-1, maxY-deltaY, 0); err != nil {
+		// The roster takes the bottom of the column below the title box
+		rosterY := (maxY - deltaY) * 3 / 5
+
+		if v, err := g.SetView(titleBox, maxX-25, 0, maxX-1, rosterY-1, 0); err != nil {
 			if err != gocui.ErrUnknownView {
 				return err
 			}
 			v.Title = " xx Channel Chat "
 			v.Wrap = true
 			v.Autoscroll = true
+			m.v.titleBox = v
 
-			_, err = fmt.Fprintf(v, "Controls:\n"+
-				"\u001B[38;5;250m"+
-				" Ctrl+C  exit\n"+
-				" Tab     Switch view\n"+
-				" ↑ ↓     Seek input\n"+
-				" Enter   Send message\n"+
-				" Ctrl+J  New line\n"+
-				" F4      Channel feed\n"+
-				" F5      Message field\n"+
-				adminControl+
-				"\x1b[0m"+
-				"Channel Info:\n"+
-				"\x1b[38;5;252mName:\n\x1b[38;5;248m"+m.ch.Name+"\x1b[0m\n\n"+
-				"\x1b[38;5;252mDescription:\n\x1b[38;5;248m"+m.ch.Description+"\x1b[0m\n\n"+
-				"\x1b[38;5;252mID:\n\x1b[38;5;248m"+m.ch.ReceptionID.String()+"\x1b[0m")
-			if err != nil {
+			if err = m.drawTitleBox(); err != nil {
+				return err
+			}
+		}
+
+		if v, err := g.SetView(rosterView, maxX-25, rosterY, maxX-1, maxY-deltaY, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Title = " Members "
+			v.Wrap = false
+			m.v.roster = v
+
+			if err = m.drawRoster(true); err != nil {
 				return err
 			}
-			m.v.titleBox = v
 		}
 
-		if v, err := g.SetView(channelFeed, 0, 0, maxX-26, maxY-7, 0); err != nil {
+		if v, err := g.SetView(channelFeed, channelListWidth, 0, maxX-26, maxY-7, 0); err != nil {
 			if err != gocui.ErrUnknownView {
 				return err
 			}
-			v.Title = " Channel Feed for \"" + m.ch.Name + "\" [F4] "
+			v.Title = " Channel Feed for \"" + c.Channel.Name + "\" [F4] "
 			v.Wrap = true
 			v.Autoscroll = true
 			m.v.channelFeed = v
+
+			// Print the stored history of the channel displayed first
+			if err = m.renderFeed(); err != nil {
+				return err
+			}
 		}
 
-		if v, err := g.SetView(messageInput, 0, maxY-6, maxX-9, maxY-1, 0); err != nil {
+		if v, err := g.SetView(messageInput, channelListWidth, maxY-6, maxX-9, maxY-1, 0); err != nil {
 			if err != gocui.ErrUnknownView {
 				return err
 			}
@@ -189,7 +584,7 @@ func (m *Manager) makeLayout() func(g *gocui.Gui) error {
 			v.Frame = false
 			v.Wrap = true
 
-			_, err = fmt.Fprintf(v, charCountFmt, 0, m.symMaxMessageLen)
+			_, err = fmt.Fprintf(v, charCountFmt, 0, c.maxMessageLen())
 			if err != nil {
 				return err
 			}
@@ -202,21 +597,17 @@ func (m *Manager) makeLayout() func(g *gocui.Gui) error {
 						g.Update(func(gui *gocui.Gui) error {
 							buff := strings.TrimSpace(m.v.messageInput.Buffer())
 							n := len(buff)
+							max := m.currentChannel().maxMessageLen()
+							m.sendTyping(m.currentChannel(), buff)
 
 							var color string
-							if (!m.isAdminMode() && n >= m.symMaxMessageLen) ||
-								(m.isAdminMode() && n >= m.asymMaxMessageLen) {
+							if n >= max {
 								m.v.messageInput.Editable = false
 								color = "\x1b[0;31m"
 							} else {
 								m.v.messageInput.Editable = true
 							}
 
-							max := m.symMaxMessageLen
-							if m.isAdminMode() {
-								max = m.asymMaxMessageLen
-							}
-
 							m.v.messageCount.Clear()
 							_, err = fmt.Fprintf(m.v.messageCount, color+charCountFmt+"\x1b[0m", n, max)
 							if err != nil {
@@ -246,7 +637,7 @@ func (m *Manager) makeLayout() func(g *gocui.Gui) error {
 			m.v.sendButton = v
 		}
 
-		if m.asymBroadcastFunc != nil {
+		if c.isAdmin() {
 			if v, err := g.SetView(adminBtn, maxX-25, maxY-9, maxX-1, maxY-7, 0); err != nil {
 				if err != gocui.ErrUnknownView {
 					return err
@@ -255,12 +646,11 @@ func (m *Manager) makeLayout() func(g *gocui.Gui) error {
 				v.Highlight = false
 				v.SelBgColor = gocui.ColorRed
 				v.SelFgColor = gocui.ColorBlack
+				m.v.adminBtn = v
 
-				_, err = fmt.Fprintf(v, "    ☐ Send as Admin    ")
-				if err != nil {
+				if err = m.drawAdminState(); err != nil {
 					return err
 				}
-				m.v.adminBtn = v
 			}
 		}
 
@@ -333,6 +723,42 @@ func (m *Manager) initKeybindings(g *gocui.Gui) error {
 			"failed to set key binding for Ctrl + C: %+v", err)
 	}
 
+	err = g.SetKeybinding("", gocui.KeyCtrlN, gocui.ModNone, m.cycleChannel(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Ctrl + N: %+v", err)
+	}
+
+	err = g.SetKeybinding("", gocui.KeyCtrlP, gocui.ModNone, m.cycleChannel(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Ctrl + P: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelList, gocui.MouseLeft, gocui.ModNone, m.selectChannel)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for left mouse button: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelList, gocui.KeyArrowUp, gocui.ModNone, m.cycleChannel(-1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow up: %+v", err)
+	}
+
+	err = g.SetKeybinding(channelList, gocui.KeyArrowDown, gocui.ModNone, m.cycleChannel(1))
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for arrow down: %+v", err)
+	}
+
+	err = g.SetKeybinding("", gocui.KeyCtrlS, gocui.ModNone, m.saveLatest)
+	if err != nil {
+		return errors.Errorf(
+			"failed to set key binding for Ctrl + S: %+v", err)
+	}
+
 	err = g.SetKeybinding("", gocui.KeyF4, gocui.ModNone, switchActiveTo(channelFeed))
 	if err != nil {
 		return errors.Errorf(
@@ -345,12 +771,28 @@ func (m *Manager) initKeybindings(g *gocui.Gui) error {
 			"failed to set key binding for F5: %+v", err)
 	}
 
-	err = g.SetKeybinding("", gocui.KeyF6, gocui.ModNone, switchActiveTo(adminBtn))
+	err = g.SetKeybinding("", gocui.KeyF6, gocui.ModNone, m.switchToAdminBtn)
 	if err != nil {
 		return errors.Errorf(
 			"failed to set key binding for F6: %+v", err)
 	}
 
+	if err = m.initFeedKeybindings(g); err != nil {
+		return err
+	}
+
+	if err = m.initRosterKeybindings(g); err != nil {
+		return err
+	}
+
+	if err = m.initSearchKeybindings(g); err != nil {
+		return err
+	}
+
+	if err = m.initBulletinKeybindings(g); err != nil {
+		return err
+	}
+
 	for _, v := range viewArr {
 		err = g.SetKeybinding(v, gocui.KeyArrowUp, gocui.ModNone, scrollView(-1))
 		if err != nil {
@@ -407,29 +849,7 @@ func (m *Manager) initKeybindings(g *gocui.Gui) error {
 func (m *Manager) toggleAdmin() func(*gocui.Gui, *gocui.View) error {
 	return func(g *gocui.Gui, v *gocui.View) error {
 		m.toggleAdminMode()
-		v.Highlight = !v.Highlight
-		if m.isAdminMode() {
-			m.v.messageInput.Title = " Sending Message as \"ADMIN\" [F5] "
-			m.v.messageInput.FgColor = gocui.ColorRed
-			m.v.messageInput.TitleColor = gocui.ColorRed
-
-			v.Clear()
-			_, err := fmt.Fprintf(v, "    ☑ Send as Admin    ")
-			if err != nil {
-				return err
-			}
-		} else {
-			m.v.messageInput.Title = " Sending Message as \"" + m.username + "\" [F5] "
-			m.v.messageInput.FgColor = gocui.ColorDefault
-			m.v.messageInput.TitleColor = gocui.ColorDefault
-
-			v.Clear()
-			_, err := fmt.Fprintf(v, "    ☐ Send as Admin    ")
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return m.drawAdminState()
 	}
 }
 
@@ -463,6 +883,15 @@ func switchActiveTo(name string) func(g *gocui.Gui, v *gocui.View) error {
 	}
 }
 
+// switchToAdminBtn sets the admin button as the current view if the channel
+// being displayed has one.
+func (m *Manager) switchToAdminBtn(g *gocui.Gui, v *gocui.View) error {
+	if m.v.adminBtn == nil {
+		return nil
+	}
+	return switchActiveTo(adminBtn)(g, v)
+}
+
 func backSpace(_ *gocui.Gui, v *gocui.View) error {
 	v.EditDelete(true)
 	v.Editable = true
@@ -474,13 +903,22 @@ func (m *Manager) readBuffs() func(*gocui.Gui, *gocui.View) error {
 	return func(g *gocui.Gui, v *gocui.View) error {
 
 		buff := strings.TrimSpace(m.v.messageInput.Buffer())
+		c := m.currentChannel()
 
-		if len(buff) == 0 ||
-			(!m.isAdminMode() && len(buff) > m.symMaxMessageLen) ||
-			(m.isAdminMode() && len(buff) > m.asymMaxMessageLen) {
+		if len(buff) == 0 || len(buff) > c.maxMessageLen() {
 			return nil
 		}
 
+		if c.isSearching() {
+			return m.runSearch(g, c, buff)
+		}
+
+		if handled, err := m.runCommand(c, buff); err != nil {
+			return err
+		} else if handled {
+			return m.clearInput(c)
+		}
+
 		m.v.sendButton.Highlight = true
 		defer func() {
 			go func() {
@@ -490,34 +928,57 @@ func (m *Manager) readBuffs() func(*gocui.Gui, *gocui.View) error {
 		}()
 
 		var err error
-		if m.isAdminMode() {
-			err = m.asymBroadcastFunc(client.Admin, netTime.Now(), []byte(buff))
+		extensions := replyExtensions(c)
+		if reactionExt, reacting := reactionExtensions(c); reacting {
+			if err = client.ValidateReaction(buff); err != nil {
+				return m.printNotice("Invalid reaction: %v", err)
+			}
+			err = c.SymBroadcastFn(
+				client.Reaction, netTime.Now(), []byte(buff), reactionExt...)
+		} else if broadcastFn, editExt, editing := editExtensions(c); editing {
+			err = broadcastFn(client.Edit, netTime.Now(), []byte(buff), editExt...)
+		} else if m.isAdminMode() {
+			err = c.AsymBroadcastFn(
+				client.Admin, netTime.Now(), []byte(buff), extensions...)
 		} else {
-			err = m.symBroadcastFunc(client.Default, netTime.Now(), []byte(buff))
+			err = c.SymBroadcastFn(
+				client.Default, netTime.Now(), []byte(buff), extensions...)
 		}
 
 		if err != nil {
 			return err
 		}
+		c.typing.Reset()
 
-		m.v.messageInput.Clear()
-		err = m.v.messageInput.SetOrigin(0, 0)
-		if err != nil {
-			return errors.Errorf("Failed to set origin back to (0, 0): %+v", err)
-		}
-		err = m.v.messageInput.SetCursor(0, 0)
-		if err != nil {
-			return errors.Errorf("Failed to set cursor back to (0, 0): %+v", err)
+		if c.getReplyTo() >= 0 || c.getEditOf() >= 0 || c.getReactTo() >= 0 {
+			if err = m.cancelCompose(g, v); err != nil {
+				return err
+			}
 		}
 
-		m.v.messageCount.Clear()
-		_, err = fmt.Fprintf(m.v.messageCount, charCountFmt, 0, m.symMaxMessageLen)
-		if err != nil {
-			return errors.Errorf("Failed to write to view: %+v", err)
-		}
+		return m.clearInput(c)
+	}
+}
 
-		return nil
+// clearInput clears the message input and resets the character count.
+func (m *Manager) clearInput(c *channelState) error {
+	m.v.messageInput.Clear()
+	err := m.v.messageInput.SetOrigin(0, 0)
+	if err != nil {
+		return errors.Errorf("Failed to set origin back to (0, 0): %+v", err)
+	}
+	err = m.v.messageInput.SetCursor(0, 0)
+	if err != nil {
+		return errors.Errorf("Failed to set cursor back to (0, 0): %+v", err)
+	}
+
+	m.v.messageCount.Clear()
+	_, err = fmt.Fprintf(m.v.messageCount, charCountFmt, 0, c.maxMessageLen())
+	if err != nil {
+		return errors.Errorf("Failed to write to view: %+v", err)
 	}
+
+	return nil
 }
 
 func addLine(_ *gocui.Gui, v *gocui.View) error {
@@ -562,9 +1023,12 @@ func (m *Manager) nextView(g *gocui.Gui, _ *gocui.View) error {
 
 func (m *Manager) quitWithMessage() func(*gocui.Gui, *gocui.View) error {
 	return func(gui *gocui.Gui, view *gocui.View) error {
-		err := m.symBroadcastFunc(client.Exit, netTime.Now(), []byte{})
-		if err != nil {
-			jww.ERROR.Printf("Failed to send exit message: %+v", err)
+		for _, c := range m.channels {
+			err := c.SymBroadcastFn(client.Exit, netTime.Now(), []byte{})
+			if err != nil {
+				jww.ERROR.Printf("Failed to send exit message to channel "+
+					"%q: %+v", c.Channel.Name, err)
+			}
 		}
 		return gocui.ErrQuit
 	}